@@ -2,15 +2,22 @@ package main
 
 import (
 	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jesus/FCCUR/internal/api"
 	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/blob"
+	"github.com/jesus/FCCUR/internal/mail"
 	"github.com/jesus/FCCUR/internal/storage"
 )
 
@@ -25,12 +32,50 @@ func main() {
 	keyFile := flag.String("key", getEnv("FCCUR_KEY_FILE", ""), "TLS private key file (enables HTTPS)")
 	authUser := flag.String("auth-user", getEnv("FCCUR_AUTH_USER", ""), "Upload authentication username (optional)")
 	authPass := flag.String("auth-pass", getEnv("FCCUR_AUTH_PASS", ""), "Upload authentication password (optional)")
-	rateLimit := flag.Int("rate-limit", getEnvAsInt("FCCUR_RATE_LIMIT", 10), "Upload rate limit per IP (uploads per hour, 0 to disable)")
+	rateLimit := flag.Int("rate-limit", getEnvAsInt("FCCUR_RATE_LIMIT", 10), "Upload rate limit per IP and submission rate limit per user (per hour, 0 to disable)")
 	jwtSecret := flag.String("jwt-secret", getEnv("FCCUR_JWT_SECRET", ""), "JWT secret key (auto-generated if not provided)")
 	oauth2ClientID := flag.String("oauth2-client-id", getEnv("FCCUR_OAUTH2_CLIENT_ID", ""), "OAuth2 client ID (Microsoft/Azure AD)")
 	oauth2ClientSecret := flag.String("oauth2-client-secret", getEnv("FCCUR_OAUTH2_CLIENT_SECRET", ""), "OAuth2 client secret")
 	oauth2RedirectURL := flag.String("oauth2-redirect", getEnv("FCCUR_OAUTH2_REDIRECT_URL", "http://localhost:8080/api/oauth2/callback"), "OAuth2 redirect URL")
 	oauth2Tenant := flag.String("oauth2-tenant", getEnv("FCCUR_OAUTH2_TENANT", "common"), "Microsoft tenant ID (common for multi-tenant)")
+	oidcProviders := flag.String("oidc-providers", getEnv("FCCUR_OIDC_PROVIDERS", ""), "Comma-separated OpenID Connect provider names, each configured with FCCUR_OIDC_<NAME>_* variables")
+	ldapURL := flag.String("ldap-url", getEnv("FCCUR_LDAP_URL", ""), "LDAP or Active Directory server for password logins, e.g. ldaps://ldap.uni.edu (optional)")
+	ldapStartTLS := flag.Bool("ldap-start-tls", getEnvAsBool("FCCUR_LDAP_START_TLS", false), "Upgrade ldap:// connections with StartTLS")
+	ldapCAFile := flag.String("ldap-ca-file", getEnv("FCCUR_LDAP_CA_FILE", ""), "PEM file with the CA certificates of the LDAP server (defaults to the system roots)")
+	ldapBindDN := flag.String("ldap-bind-dn", getEnv("FCCUR_LDAP_BIND_DN", ""), "DN of the service account that searches for users (empty binds anonymously)")
+	ldapBindPassword := flag.String("ldap-bind-password", getEnv("FCCUR_LDAP_BIND_PASSWORD", ""), "Password of the LDAP service account")
+	ldapBaseDN := flag.String("ldap-base-dn", getEnv("FCCUR_LDAP_BASE_DN", ""), "Base DN of the user search, e.g. ou=people,dc=uni,dc=edu")
+	ldapUserFilter := flag.String("ldap-user-filter", getEnv("FCCUR_LDAP_USER_FILTER", "(|(uid=%s)(mail=%s))"), "User search filter; %s is replaced by the login name")
+	ldapEmailAttr := flag.String("ldap-email-attr", getEnv("FCCUR_LDAP_EMAIL_ATTR", "mail"), "LDAP attribute holding the user's email address")
+	ldapNameAttr := flag.String("ldap-name-attr", getEnv("FCCUR_LDAP_NAME_ATTR", "displayName"), "LDAP attribute holding the user's full name")
+	ldapGroupAttr := flag.String("ldap-group-attr", getEnv("FCCUR_LDAP_GROUP_ATTR", "memberOf"), "LDAP attribute of the user listing their group DNs")
+	ldapGroupBaseDN := flag.String("ldap-group-base-dn", getEnv("FCCUR_LDAP_GROUP_BASE_DN", ""), "Base DN of the group search (defaults to -ldap-base-dn)")
+	ldapGroupFilter := flag.String("ldap-group-filter", getEnv("FCCUR_LDAP_GROUP_FILTER", ""), "Group search filter, e.g. (member=%s); %s is replaced by the user DN (optional)")
+	ldapGroupRoles := flag.String("ldap-group-roles", getEnv("FCCUR_LDAP_GROUP_ROLES", ""), "Semicolon-separated group:role mappings, e.g. cn=admins,ou=groups,dc=uni,dc=edu:admin;profesores:professor")
+	ldapOrder := flag.String("ldap-order", getEnv("FCCUR_LDAP_ORDER", api.LDAPFirst), "Check passwords against LDAP before (first) or after (last) local passwords")
+	storageBackend := flag.String("storage", getEnv("FCCUR_STORAGE", "local"), "Storage backend for package files: local or s3")
+	s3Endpoint := flag.String("s3-endpoint", getEnv("FCCUR_S3_ENDPOINT", ""), "S3-compatible endpoint URL (e.g. http://localhost:9000 for MinIO)")
+	s3Region := flag.String("s3-region", getEnv("FCCUR_S3_REGION", "us-east-1"), "S3 region")
+	s3Bucket := flag.String("s3-bucket", getEnv("FCCUR_S3_BUCKET", ""), "S3 bucket name")
+	s3AccessKey := flag.String("s3-access-key", getEnv("FCCUR_S3_ACCESS_KEY", ""), "S3 access key")
+	s3SecretKey := flag.String("s3-secret-key", getEnv("FCCUR_S3_SECRET_KEY", ""), "S3 secret key")
+	s3Prefix := flag.String("s3-prefix", getEnv("FCCUR_S3_PREFIX", ""), "Optional key prefix inside the S3 bucket")
+	moderateRoles := flag.String("moderate-roles", getEnv("FCCUR_MODERATE_ROLES", ""), "Comma-separated roles whose uploads need admin approval (e.g. professor)")
+	trustedRoles := flag.String("trusted-roles", getEnv("FCCUR_TRUSTED_ROLES", "admin"), "Comma-separated roles whose uploads are never moderated, even in moderated categories")
+	trashRetention := flag.Int("trash-retention", getEnvAsInt("FCCUR_TRASH_RETENTION_DAYS", 30), "Days deleted packages stay in the trash before being purged (0 keeps them until purged by hand)")
+	publicURL := flag.String("public-url", getEnv("FCCUR_PUBLIC_URL", "http://localhost:8080"), "Public base URL of the server, used in links sent by email")
+	mailBackend := flag.String("mail", getEnv("FCCUR_MAIL", "log"), "Mail backend: smtp, file (writes .eml files) or log (recipients and subjects only)")
+	mailFrom := flag.String("mail-from", getEnv("FCCUR_MAIL_FROM", "FCCUR <no-reply@localhost>"), "Sender address of emails")
+	mailDir := flag.String("mail-dir", getEnv("FCCUR_MAIL_DIR", "./data/mail"), "Output directory of the file mail backend")
+	mailLang := flag.String("mail-lang", getEnv("FCCUR_MAIL_LANG", "es"), "Default language of emails (es or en)")
+	smtpHost := flag.String("smtp-host", getEnv("FCCUR_SMTP_HOST", ""), "SMTP server host")
+	smtpPort := flag.Int("smtp-port", getEnvAsInt("FCCUR_SMTP_PORT", 587), "SMTP server port")
+	smtpUser := flag.String("smtp-user", getEnv("FCCUR_SMTP_USER", ""), "SMTP username (optional)")
+	smtpPass := flag.String("smtp-pass", getEnv("FCCUR_SMTP_PASS", ""), "SMTP password")
+	smtpRequireTLS := flag.Bool("smtp-require-tls", getEnvAsBool("FCCUR_SMTP_REQUIRE_TLS", true), "Refuse to send mail when the SMTP server does not offer STARTTLS")
+	requireVerified := flag.String("require-verified-email", getEnv("FCCUR_REQUIRE_VERIFIED_EMAIL", ""), "Block unverified users (except admins) from: upload, or login (and uploads)")
+	registrationDomains := flag.String("registration-domains", getEnv("FCCUR_REGISTRATION_DOMAINS", ""), "Comma-separated email domains allowed to self-register (e.g. uni.edu); empty allows any")
+	mfaRequiredRoles := flag.String("mfa-required-roles", getEnv("FCCUR_MFA_REQUIRED_ROLES", ""), "Comma-separated roles that must use two-factor authentication (e.g. admin,professor)")
 	flag.Parse()
 
 	// Ensure directories exist
@@ -81,6 +126,32 @@ func main() {
 	// Create API server
 	server := api.NewServer(db, *packagesDir, *webDir, secret)
 
+	// Configure storage backend
+	blobStore, err := blob.New(blob.Config{
+		Backend:  *storageBackend,
+		LocalDir: *packagesDir,
+		S3: blob.S3Config{
+			Endpoint:  *s3Endpoint,
+			Region:    *s3Region,
+			Bucket:    *s3Bucket,
+			AccessKey: *s3AccessKey,
+			SecretKey: *s3SecretKey,
+			Prefix:    *s3Prefix,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Error initializing storage backend: %v", err)
+	}
+	server.SetBlobStore(blobStore)
+	if *storageBackend == blob.BackendS3 {
+		log.Printf("Storage: S3 bucket %s at %s", *s3Bucket, *s3Endpoint)
+	} else {
+		log.Printf("Storage: local filesystem")
+	}
+
+	// Extract README text of packages not yet in the search index
+	go server.IndexReadmes()
+
 	// Configure authentication if provided
 	if *authUser != "" && *authPass != "" {
 		server.SetAuth(*authUser, *authPass)
@@ -92,11 +163,90 @@ func main() {
 	// Configure rate limiting
 	if *rateLimit > 0 {
 		server.SetRateLimit(*rateLimit)
-		log.Printf("Upload rate limiting enabled: %d uploads per hour per IP", *rateLimit)
+		log.Printf("Upload rate limiting enabled: %d uploads per hour per IP, %d submissions per hour per user", *rateLimit, *rateLimit)
 	} else {
 		log.Printf("Upload rate limiting disabled")
 	}
 
+	// Configure upload moderation
+	moderation := api.ModerationConfig{}
+	if moderation.Roles, err = api.ParseRoles(*moderateRoles); err != nil {
+		log.Fatalf("Invalid -moderate-roles: %v", err)
+	}
+	if moderation.TrustedRoles, err = api.ParseRoles(*trustedRoles); err != nil {
+		log.Fatalf("Invalid -trusted-roles: %v", err)
+	}
+	server.SetModeration(moderation)
+	if len(moderation.Roles) > 0 {
+		log.Printf("Upload moderation enabled for roles: %s", *moderateRoles)
+	}
+
+	// Configure the trash and purge expired packages in the background
+	server.SetTrashRetention(time.Duration(*trashRetention) * 24 * time.Hour)
+	if *trashRetention > 0 {
+		log.Printf("Trash retention: %d days", *trashRetention)
+		go server.RunTrashPurger(time.Hour)
+	} else {
+		log.Printf("Trash retention disabled; deleted packages are kept until purged")
+	}
+
+	// Drop sessions that can no longer be refreshed
+	go server.RunSessionCleaner(time.Hour)
+
+	// Configure email delivery
+	mailer, err := mail.New(mail.Config{
+		Backend: *mailBackend,
+		From:    *mailFrom,
+		Dir:     *mailDir,
+		SMTP: mail.SMTPConfig{
+			Host:       *smtpHost,
+			Port:       *smtpPort,
+			Username:   *smtpUser,
+			Password:   *smtpPass,
+			RequireTLS: *smtpRequireTLS,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Error initializing mail backend: %v", err)
+	}
+	if !mail.Supported(*mailLang) {
+		log.Fatalf("Unsupported -mail-lang: %q", *mailLang)
+	}
+	server.SetMailer(mailer, *mailLang)
+	server.SetPublicURL(*publicURL)
+	switch *mailBackend {
+	case mail.BackendSMTP:
+		log.Printf("Mail: SMTP via %s:%d", *smtpHost, *smtpPort)
+	case mail.BackendFile:
+		log.Printf("Mail: writing messages to %s", *mailDir)
+	default:
+		log.Printf("WARNING: Mail is not delivered: only recipients and subjects are logged, so users " +
+			"cannot verify their email or reset their password. Use -mail smtp, or -mail file in development.")
+	}
+
+	// Configure email verification and the registration allowlist
+	verification := api.VerificationConfig{AllowedDomains: api.ParseDomains(*registrationDomains)}
+	if verification.Require, err = api.ParseVerificationRequirement(*requireVerified); err != nil {
+		log.Fatalf("Invalid -require-verified-email: %v", err)
+	}
+	server.SetVerification(verification)
+	if verification.Require != api.RequireVerifiedNone {
+		log.Printf("Email verification required for: %s", verification.Require)
+	}
+	if len(verification.AllowedDomains) > 0 {
+		log.Printf("Self-registration restricted to: %s", *registrationDomains)
+	}
+
+	// Configure mandatory two-factor authentication
+	mfa := api.MFAConfig{}
+	if mfa.RequiredRoles, err = api.ParseRoles(*mfaRequiredRoles); err != nil {
+		log.Fatalf("Invalid -mfa-required-roles: %v", err)
+	}
+	server.SetMFA(mfa)
+	if len(mfa.RequiredRoles) > 0 {
+		log.Printf("Two-factor authentication required for roles: %s", *mfaRequiredRoles)
+	}
+
 	// Configure OAuth2
 	if *oauth2ClientID != "" && *oauth2ClientSecret != "" {
 		oauth2Config := auth.NewMicrosoftOAuth2Config(
@@ -113,6 +263,61 @@ func main() {
 		log.Printf("OAuth2 disabled (provide -oauth2-client-id and -oauth2-client-secret to enable)")
 	}
 
+	// Configure OpenID Connect providers
+	providers, err := loadOIDCProviders(*oidcProviders, *publicURL)
+	if err != nil {
+		log.Fatalf("Invalid OpenID Connect configuration: %v", err)
+	}
+	server.SetOIDCProviders(providers...)
+	for _, p := range providers {
+		log.Printf("OpenID Connect provider %s enabled (issuer %s)", p.Name, p.Issuer)
+	}
+
+	// Configure LDAP password logins
+	if *ldapURL != "" {
+		config := auth.LDAPConfig{
+			URL:            *ldapURL,
+			StartTLS:       *ldapStartTLS,
+			BindDN:         *ldapBindDN,
+			BindPassword:   *ldapBindPassword,
+			BaseDN:         *ldapBaseDN,
+			UserFilter:     *ldapUserFilter,
+			EmailAttribute: *ldapEmailAttr,
+			NameAttribute:  *ldapNameAttr,
+			GroupAttribute: *ldapGroupAttr,
+			GroupBaseDN:    *ldapGroupBaseDN,
+			GroupFilter:    *ldapGroupFilter,
+		}
+		if *ldapCAFile != "" {
+			pem, err := os.ReadFile(*ldapCAFile)
+			if err != nil {
+				log.Fatalf("Failed to read LDAP CA file: %v", err)
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(pem) {
+				log.Fatalf("No certificates found in LDAP CA file %s", *ldapCAFile)
+			}
+			config.TLSConfig = &tls.Config{RootCAs: roots}
+		}
+
+		authenticator, err := auth.NewLDAPAuthenticator(config)
+		if err != nil {
+			log.Fatalf("Invalid LDAP configuration: %v", err)
+		}
+		directory := &api.LDAPDirectory{LDAPAuthenticator: authenticator}
+		if directory.GroupRoles, err = api.ParseGroupRoles(*ldapGroupRoles); err != nil {
+			log.Fatalf("Invalid -ldap-group-roles: %v", err)
+		}
+		if directory.Order, err = api.ParseLDAPOrder(*ldapOrder); err != nil {
+			log.Fatalf("Invalid -ldap-order: %v", err)
+		}
+		server.SetLDAP(directory)
+		log.Printf("LDAP logins enabled against %s (order: %s)", *ldapURL, directory.Order)
+		if !authenticator.Secure() {
+			log.Printf("Warning: LDAP passwords are sent unencrypted; use ldaps:// or -ldap-start-tls")
+		}
+	}
+
 	// Start server
 	log.Printf("FCCUR server starting on %s", *addr)
 	log.Printf("Packages directory: %s", *packagesDir)
@@ -138,6 +343,44 @@ func main() {
 	}
 }
 
+// loadOIDCProviders configures the comma-separated OpenID Connect providers
+// in names from their FCCUR_OIDC_<NAME>_* environment variables, where
+// <NAME> is the provider name in upper case with dashes as underscores
+func loadOIDCProviders(names, publicURL string) ([]*api.OIDCProvider, error) {
+	var providers []*api.OIDCProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "FCCUR_OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		config := auth.OIDCConfig{
+			Name:         name,
+			DisplayName:  getEnv(prefix+"DISPLAY_NAME", name),
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", strings.TrimSuffix(publicURL, "/")+"/auth.html"),
+			Scopes:       strings.Fields(strings.ReplaceAll(getEnv(prefix+"SCOPES", ""), ",", " ")),
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("%s: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+		}
+
+		rules, err := api.ParseRoleRules(getEnv(prefix+"ROLE_RULES", ""))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		providers = append(providers, &api.OIDCProvider{
+			OIDCProvider: auth.NewOIDCProvider(config),
+			RoleRules:    rules,
+			TrustEmail:   getEnvAsBool(prefix+"TRUST_EMAIL", false),
+		})
+	}
+	return providers, nil
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -155,3 +398,13 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvAsBool gets an environment variable as bool or returns a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
@@ -111,7 +111,7 @@ fi
 # Build the binary
 if [ -f "cmd/server/main.go" ]; then
     echo "Building FCCUR..."
-    go build -v -o /usr/local/bin/fccur ./cmd/server
+    go build -v -tags sqlite_fts5 -o /usr/local/bin/fccur ./cmd/server
     chmod +x /usr/local/bin/fccur
     echo "Binary installed to /usr/local/bin/fccur"
 else
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+const (
+	defaultAccessTokenDays = 90
+	maxAccessTokenDays     = 365
+	maxAccessTokenName     = 100
+	// accessTokenTouchInterval bounds how often a token's last use is written
+	accessTokenTouchInterval = time.Minute
+)
+
+// errTokenScope is returned by getCurrentUser for a request that its
+// personal access token's scope does not cover
+var errTokenScope = errors.New("access token scope does not permit this request")
+
+// AccessTokenRequest creates a personal access token
+type AccessTokenRequest struct {
+	Name          string            `json:"name"`
+	Scope         models.TokenScope `json:"scope"`
+	Courses       []string          `json:"courses,omitempty"` // Upload scope only; empty allows any course
+	ExpiresInDays int               `json:"expires_in_days"`   // Defaults to 90, at most 365
+}
+
+// AccessTokenResponse returns a new personal access token. The token itself
+// is shown only this once.
+type AccessTokenResponse struct {
+	Token string `json:"token"`
+	*models.AccessToken
+}
+
+// AccessTokens lists (GET), creates (POST) and revokes (DELETE ?id=) the
+// current user's personal access tokens
+func (s *Server) AccessTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listAccessTokens(w, r)
+	case http.MethodPost:
+		s.createAccessToken(w, r)
+	case http.MethodDelete:
+		s.revokeAccessToken(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) listAccessTokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := s.db.ListAccessTokens(user.ID)
+	if err != nil {
+		log.Printf("Error listing access tokens: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, tokens)
+}
+
+func (s *Server) createAccessToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req AccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if !s.checkAccessTokenRequest(w, user, &req) {
+		return
+	}
+
+	token, prefix, err := auth.GenerateAccessToken()
+	if err != nil {
+		log.Printf("Error generating access token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	t := &models.AccessToken{
+		UserID:    user.ID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		TokenHash: auth.HashAccessToken(token),
+		Scope:     req.Scope,
+		Courses:   req.Courses,
+		ExpiresAt: now.AddDate(0, 0, req.ExpiresInDays),
+		CreatedAt: now,
+	}
+	if err := s.db.CreateAccessToken(t); err != nil {
+		log.Printf("Error creating access token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.auditUser(r, user, models.AuditTokenCreate, accessTokenDetails(t))
+
+	respondJSON(w, http.StatusCreated, AccessTokenResponse{Token: token, AccessToken: t})
+}
+
+// checkAccessTokenRequest validates and normalizes req. A token never gets
+// more than its owner may do: the admin scope needs an admin, the upload
+// scope someone who can upload, and its courses ones they upload to. It
+// writes the error response and returns false when req is refused.
+func (s *Server) checkAccessTokenRequest(w http.ResponseWriter, user *models.User, req *AccessTokenRequest) bool {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAccessTokenName {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Name is required and must be at most 100 characters"})
+		return false
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAccessTokenDays
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAccessTokenDays {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "expires_in_days must be between 1 and 365"})
+		return false
+	}
+
+	if !models.ValidScope(req.Scope) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Scope must be read, upload or admin"})
+		return false
+	}
+	if (req.Scope == models.ScopeAdmin && !user.IsAdminRole()) || (req.Scope == models.ScopeUpload && !user.CanUpload()) {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "You cannot create a token with this scope"})
+		return false
+	}
+
+	if len(req.Courses) > 0 && req.Scope != models.ScopeUpload {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Only upload tokens can be limited to courses"})
+		return false
+	}
+	for _, course := range req.Courses {
+		if !s.checkCourse(w, course) {
+			return false
+		}
+		if !user.CanUploadToCourse(course) {
+			respondJSON(w, http.StatusForbidden, map[string]string{"error": "You don't have permission to upload to this course"})
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) revokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.DeleteAccessToken(user.ID, id); err != nil {
+		if err == storage.ErrAccessTokenNotFound {
+			http.Error(w, "Access token not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error revoking access token %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.auditUser(r, user, models.AuditTokenRevoke, map[string]int64{"token_id": id})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// accessTokenDetails describes a token in the audit log, never the token itself
+func accessTokenDetails(t *models.AccessToken) map[string]interface{} {
+	details := map[string]interface{}{
+		"token_id": t.ID,
+		"name":     t.Name,
+		"prefix":   t.Prefix,
+		"scope":    t.Scope,
+	}
+	if len(t.Courses) > 0 {
+		details["courses"] = t.Courses
+	}
+	return details
+}
+
+// accessTokenClaims authenticates a request made with a personal access
+// token, recording its use. Tokens are refused on the account endpoints
+// under /api/auth/ other than /api/auth/me, so that one cannot change the
+// password or mint wider tokens, and read tokens on anything but GET and
+// HEAD; both return errTokenScope.
+func (s *Server) accessTokenClaims(r *http.Request, token string) (*auth.JWTClaims, error) {
+	t, err := s.db.GetAccessTokenByHash(auth.HashAccessToken(token))
+	if err != nil {
+		if err != storage.ErrInvalidToken {
+			log.Printf("Error getting access token: %v", err)
+		}
+		return nil, auth.ErrInvalidToken
+	}
+	if t.Expired() {
+		return nil, auth.ErrTokenExpired
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/api/auth/") && r.URL.Path != "/api/auth/me" {
+		return nil, errTokenScope
+	}
+	if t.Scope == models.ScopeRead && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return nil, errTokenScope
+	}
+
+	user, err := s.db.GetUserByID(t.UserID)
+	if err != nil {
+		log.Printf("Error getting user %d: %v", t.UserID, err)
+		return nil, auth.ErrInvalidToken
+	}
+	// Not every handler goes through withRoleRequired, which checks this too
+	if !user.IsActive {
+		return nil, auth.ErrInvalidToken
+	}
+
+	if t.LastUsedAt == nil || time.Since(*t.LastUsedAt) >= accessTokenTouchInterval {
+		if err := s.db.TouchAccessToken(t.ID, truncate(clientIP(r), maxAuditIPAddress)); err != nil {
+			log.Printf("Error recording use of access token %d: %v", t.ID, err)
+		}
+	}
+
+	return &auth.JWTClaims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      string(user.Role),
+		IsAdmin:   user.IsAdminRole(),
+		ExpiresAt: t.ExpiresAt.Unix(),
+		IssuedAt:  t.CreatedAt.Unix(),
+		Scope:     string(t.Scope),
+		Courses:   t.Courses,
+	}, nil
+}
+
+// scopeAllowsRoute reports whether the scope of a request's access token,
+// if any, reaches a route open to roles. Only admin tokens reach routes
+// open to admins alone.
+func scopeAllowsRoute(claims *auth.JWTClaims, roles []models.UserRole) bool {
+	if claims.Scope == "" || models.TokenScope(claims.Scope) == models.ScopeAdmin {
+		return true
+	}
+	for _, role := range roles {
+		if role != models.RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTokenCourse rejects requests made with an access token limited to
+// other courses. It writes the error response and returns false when denied.
+func (s *Server) checkTokenCourse(w http.ResponseWriter, r *http.Request, courseName string) bool {
+	claims, err := s.getCurrentUser(r)
+	if err != nil || claims.AllowsCourse(courseName) {
+		return true
+	}
+	respondJSON(w, http.StatusForbidden, map[string]string{
+		"error": "This access token is limited to other courses",
+	})
+	return false
+}
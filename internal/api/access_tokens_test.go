@@ -0,0 +1,167 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// newAccessToken creates a personal access token through the API with the
+// login token of its owner
+func newAccessToken(t *testing.T, e *testEnv, login, body string) *AccessTokenResponse {
+	t.Helper()
+	resp, respBody := e.do(http.MethodPost, "/api/auth/tokens", login, body)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating token %s: %d %s", body, resp.StatusCode, respBody)
+	}
+	var token AccessTokenResponse
+	e.decode(respBody, &token)
+	return &token
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	e := newTestEnv(t)
+	own := newCoursePackage(t, e, "Apuntes", "Redes", models.VisibilityPublic)
+	other := newCoursePackage(t, e, "Examen", "Compiladores", models.VisibilityPublic)
+	assignCourses(t, e, "prof@uni.edu", "Redes", "Compiladores")
+	prof, _ := e.login("prof@uni.edu")
+	admin, _ := e.login("admin@uni.edu")
+
+	read := newAccessToken(t, e, prof, `{"name": "ci", "scope": "read"}`).Token
+	upload := newAccessToken(t, e, prof, `{"name": "ci", "scope": "upload", "courses": ["Redes"]}`).Token
+	adminUpload := newAccessToken(t, e, admin, `{"name": "ci", "scope": "upload"}`).Token
+	adminAll := newAccessToken(t, e, admin, `{"name": "ci", "scope": "admin"}`).Token
+
+	edit := func(pkg *models.Package) string {
+		return fmt.Sprintf("/api/packages/update?id=%d", pkg.ID)
+	}
+	for _, tc := range []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"read token reads", read, http.MethodGet, "/api/auth/me", "", http.StatusOK},
+		{"read token edits", read, http.MethodPatch, edit(own), `{"description": "x"}`, http.StatusForbidden},
+		{"upload token edits its course", upload, http.MethodPatch, edit(own), `{"description": "x"}`, http.StatusOK},
+		{"upload token edits another course", upload, http.MethodPatch, edit(other), `{"description": "x"}`, http.StatusForbidden},
+		{"upload token mints a token", upload, http.MethodPost, "/api/auth/tokens", `{"name": "more", "scope": "upload"}`, http.StatusForbidden},
+		{"upload token changes the password", upload, http.MethodPost, "/api/auth/change-password", `{}`, http.StatusUnauthorized},
+		{"admin upload token on an admin route", adminUpload, http.MethodGet, "/api/admin/audit", "", http.StatusForbidden},
+		{"admin token on an admin route", adminAll, http.MethodGet, "/api/admin/audit", "", http.StatusOK},
+	} {
+		if resp, body := e.do(tc.method, tc.path, tc.token, tc.body); resp.StatusCode != tc.want {
+			t.Errorf("%s: got %d %s, want %d", tc.name, resp.StatusCode, body, tc.want)
+		}
+	}
+}
+
+func TestAccessTokenRequestLimits(t *testing.T) {
+	e := newTestEnv(t)
+	newCoursePackage(t, e, "Apuntes", "Redes", models.VisibilityPublic)
+	newCoursePackage(t, e, "Examen", "Compiladores", models.VisibilityPublic)
+	assignCourses(t, e, "prof@uni.edu", "Redes")
+	prof, _ := e.login("prof@uni.edu")
+	ana, _ := e.login("ana@uni.edu")
+
+	// A token never gets more than its owner may do
+	for _, tc := range []struct {
+		name  string
+		token string
+		body  string
+		want  int
+	}{
+		{"student upload token", ana, `{"name": "ci", "scope": "upload"}`, http.StatusForbidden},
+		{"professor admin token", prof, `{"name": "ci", "scope": "admin"}`, http.StatusForbidden},
+		{"course not taught", prof, `{"name": "ci", "scope": "upload", "courses": ["Compiladores"]}`, http.StatusForbidden},
+		{"read token limited to courses", prof, `{"name": "ci", "scope": "read", "courses": ["Redes"]}`, http.StatusBadRequest},
+		{"expiry over a year", prof, `{"name": "ci", "scope": "read", "expires_in_days": 400}`, http.StatusBadRequest},
+	} {
+		if resp, body := e.do(http.MethodPost, "/api/auth/tokens", tc.token, tc.body); resp.StatusCode != tc.want {
+			t.Errorf("%s: got %d %s, want %d", tc.name, resp.StatusCode, body, tc.want)
+		}
+	}
+}
+
+func TestAccessTokenRevokedAndExpired(t *testing.T) {
+	e := newTestEnv(t)
+	prof, _ := e.login("prof@uni.edu")
+
+	token := newAccessToken(t, e, prof, `{"name": "ci", "scope": "read"}`)
+	if resp, _ := e.do(http.MethodGet, "/api/auth/me", token.Token, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("new token: got %d, want 200", resp.StatusCode)
+	}
+	if resp, body := e.do(http.MethodDelete, fmt.Sprintf("/api/auth/tokens?id=%d", token.ID), prof, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("revoking: %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := e.do(http.MethodGet, "/api/auth/me", token.Token, ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("revoked token: got %d, want 401", resp.StatusCode)
+	}
+
+	expired, prefix, err := auth.GenerateAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.db.CreateAccessToken(&models.AccessToken{
+		UserID:    e.user("prof@uni.edu").ID,
+		Name:      "old",
+		Prefix:    prefix,
+		TokenHash: auth.HashAccessToken(expired),
+		Scope:     models.ScopeRead,
+		ExpiresAt: time.Now().Add(-time.Minute),
+		CreatedAt: time.Now().AddDate(0, 0, -90),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := e.do(http.MethodGet, "/api/auth/me", expired, ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expired token: got %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestAccessTokenOfDeactivatedUser(t *testing.T) {
+	e := newTestEnv(t)
+	prof, _ := e.login("prof@uni.edu")
+	token := newAccessToken(t, e, prof, `{"name": "ci", "scope": "read"}`).Token
+
+	if err := e.db.SetUserActive(e.user("prof@uni.edu").ID, false); err != nil {
+		t.Fatal(err)
+	}
+	// /api/auth/me authenticates the token without withRoleRequired
+	if got := e.status("/api/auth/me", token); got != http.StatusUnauthorized {
+		t.Errorf("token of a deactivated user: got %d, want 401", got)
+	}
+}
+
+func TestAccessTokensFollowAccountChanges(t *testing.T) {
+	e := newTestEnv(t)
+	admin, _ := e.login("admin@uni.edu")
+	prof, _ := e.login("prof@uni.edu")
+	upload := newAccessToken(t, e, prof, `{"name": "ci", "scope": "upload"}`).Token
+	path := fmt.Sprintf("/api/admin/users?id=%d", e.user("prof@uni.edu").ID)
+
+	// A demoted professor's upload token can no longer upload
+	if resp, body := e.do(http.MethodPatch, path, admin, `{"role": "student"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("demoting: %d %s", resp.StatusCode, body)
+	}
+	if got := e.status("/api/moderation", upload); got != http.StatusForbidden {
+		t.Errorf("upload route with the token of a demoted professor: got %d, want 403", got)
+	}
+
+	if resp, body := e.do(http.MethodPatch, path, admin, `{"is_active": false}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("deactivating: %d %s", resp.StatusCode, body)
+	}
+	tokens, err := e.db.ListAccessTokens(e.user("prof@uni.edu").ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("deactivated user still has %d access tokens", len(tokens))
+	}
+}
@@ -4,10 +4,20 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
+	"errors"
+	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/jesus/FCCUR/internal/blob"
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+var (
+	errNotArchive         = errors.New("not an archive file")
+	errUnsupportedArchive = errors.New("unsupported archive format")
+	errArchiveMissing     = errors.New("archive file not found")
 )
 
 // ArchiveFile represents a file within an archive
@@ -25,13 +35,40 @@ type ArchiveContents struct {
 	Readme     string         `json:"readme,omitempty"`
 }
 
+// readArchiveContents lists the archive stored for pkg, detecting the format
+// from the original filename's extension
+func (s *Server) readArchiveContents(pkg *models.Package) (*ArchiveContents, error) {
+	fileName := strings.ToLower(pkg.GetFileName())
+	ext := filepath.Ext(fileName)
+
+	switch ext {
+	case ".zip", ".tar", ".tgz":
+	case ".gz":
+		if !strings.HasSuffix(fileName, ".tar.gz") {
+			return nil, errUnsupportedArchive
+		}
+	default:
+		return nil, errNotArchive
+	}
+
+	file, err := blob.Open(s.blobs, pkg.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errArchiveMissing, err)
+	}
+	defer file.Close()
+
+	if ext == ".zip" {
+		return listZipContents(file, file.Info().Size)
+	}
+	return listTarContents(file, ext != ".tar")
+}
+
 // listZipContents lists the contents of a ZIP file
-func listZipContents(filePath string) (*ArchiveContents, error) {
-	r, err := zip.OpenReader(filePath)
+func listZipContents(file io.ReaderAt, size int64) (*ArchiveContents, error) {
+	r, err := zip.NewReader(file, size)
 	if err != nil {
 		return nil, err
 	}
-	defer r.Close()
 
 	contents := &ArchiveContents{
 		Files: make([]ArchiveFile, 0),
@@ -60,13 +97,7 @@ func listZipContents(filePath string) (*ArchiveContents, error) {
 }
 
 // listTarContents lists the contents of a TAR file (optionally gzipped)
-func listTarContents(filePath string, isGzipped bool) (*ArchiveContents, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
+func listTarContents(file io.Reader, isGzipped bool) (*ArchiveContents, error) {
 	var tarReader *tar.Reader
 
 	if isGzipped {
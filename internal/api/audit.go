@@ -0,0 +1,343 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+const (
+	maxAuditIPAddress = 45 // Fits the ip_address column
+	maxAuditUserAgent = 500
+)
+
+// AuditListResponse is the envelope returned by GET /api/admin/audit
+type AuditListResponse struct {
+	Events     []*models.AuditEvent `json:"events"`
+	Total      int64                `json:"total"`                 // Matches across all pages
+	NextCursor string               `json:"next_cursor,omitempty"` // Absent on the last page
+}
+
+// audit records an action by the user of the request's token in the audit
+// log. details becomes the event's diff; see recordAudit. r is nil for
+// actions the server takes on its own, which have no actor.
+func (s *Server) audit(r *http.Request, action, targetType, targetID string, details interface{}) {
+	e := &models.AuditEvent{Action: action, TargetType: targetType, TargetID: targetID}
+	if r == nil {
+		s.recordAudit(r, e, details)
+		return
+	}
+	if claims, err := s.getCurrentUser(r); err == nil {
+		e.ActorID = claims.UserID
+		e.ActorEmail = claims.Email
+	}
+	s.recordAudit(r, e, details)
+}
+
+// auditUser records an action by user on their own account, such as a
+// login, in the audit log
+func (s *Server) auditUser(r *http.Request, user *models.User, action string, details interface{}) {
+	s.recordAudit(r, &models.AuditEvent{
+		ActorID:    user.ID,
+		ActorEmail: user.Email,
+		Action:     action,
+		TargetType: models.AuditTargetUser,
+		TargetID:   auditID(user.ID),
+	}, details)
+}
+
+// auditLoginFailed records a rejected login attempt for email; user is nil
+// when no account has that email
+func (s *Server) auditLoginFailed(r *http.Request, email string, user *models.User, reason string) {
+	e := &models.AuditEvent{Action: models.AuditLoginFailed, TargetType: models.AuditTargetUser}
+	if user != nil {
+		e.TargetID = auditID(user.ID)
+	}
+	s.recordAudit(r, e, map[string]string{"email": truncate(email, 255), "reason": reason})
+}
+
+// recordAudit stores e with the client address and user agent of r, which
+// may be nil. details, when not nil, is stored as JSON in the event's diff.
+// Failures are logged; they never fail the action being recorded.
+func (s *Server) recordAudit(r *http.Request, e *models.AuditEvent, details interface{}) {
+	if r != nil {
+		e.IPAddress = truncate(clientIP(r), maxAuditIPAddress)
+		e.UserAgent = truncate(r.UserAgent(), maxAuditUserAgent)
+	}
+
+	if details != nil {
+		diff, err := json.Marshal(details)
+		if err != nil {
+			log.Printf("Error encoding audit details of %s: %v", e.Action, err)
+		} else if string(diff) != "null" {
+			e.Diff = diff
+		}
+	}
+
+	if err := s.db.CreateAuditEvent(e); err != nil {
+		log.Printf("Error recording audit event %s: %v", e.Action, err)
+	}
+}
+
+// auditChanges returns the fields whose JSON values differ between before
+// and after, two values of the same type. IDs, timestamps and derived
+// counts are ignored.
+func auditChanges(before, after interface{}) map[string]models.AuditChange {
+	prev, next := auditFields(before), auditFields(after)
+	changes := map[string]models.AuditChange{}
+	for field, value := range next {
+		if !reflect.DeepEqual(prev[field], value) {
+			changes[field] = models.AuditChange{Old: prev[field], New: value}
+		}
+	}
+	for field, value := range prev {
+		if _, ok := next[field]; !ok {
+			changes[field] = models.AuditChange{Old: value, New: nil}
+		}
+	}
+	return changes
+}
+
+// auditFields decodes v's JSON form into a map, without the fields that
+// are not edited directly
+func auditFields(v interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(data, &fields)
+	for _, skip := range []string{"id", "created_at", "updated_at", "count", "package_count"} {
+		delete(fields, skip)
+	}
+	return fields
+}
+
+// packageChanges converts package edits to an audit diff
+func packageChanges(changes []*models.PackageChange) map[string]models.AuditChange {
+	diff := make(map[string]models.AuditChange, len(changes))
+	for _, c := range changes {
+		diff[c.Field] = models.AuditChange{Old: c.OldValue, New: c.NewValue}
+	}
+	return diff
+}
+
+// auditPackage summarizes a package for the audit log
+func auditPackage(pkg *models.Package) map[string]interface{} {
+	return map[string]interface{}{
+		"name":      pkg.Name,
+		"version":   pkg.Version,
+		"category":  pkg.Category,
+		"file_name": pkg.GetFileName(),
+		"file_size": pkg.FileSize,
+		"sha256":    pkg.SHA256Hash,
+		"status":    pkg.Status,
+	}
+}
+
+// auditID formats a numeric ID as an audit target ID
+func auditID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// parseAuditQuery reads the audit log filters, limit and cursor from the
+// request's query parameters. since and until accept RFC 3339 times or
+// dates; until is exclusive.
+func parseAuditQuery(r *http.Request) (*storage.AuditQuery, error) {
+	params := r.URL.Query()
+	q := &storage.AuditQuery{
+		ActorEmail: strings.TrimSpace(params.Get("actor")),
+		Action:     params.Get("action"),
+		TargetType: params.Get("target_type"),
+		TargetID:   params.Get("target_id"),
+		Limit:      defaultPageSize,
+	}
+
+	if v := params.Get("actor_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid actor_id")
+		}
+		q.ActorID = id
+	}
+
+	for _, t := range []struct {
+		name string
+		dst  **time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		v := params.Get(t.name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if parsed, err = time.Parse("2006-01-02", v); err != nil {
+				return nil, fmt.Errorf("invalid %s (RFC 3339 time or YYYY-MM-DD)", t.name)
+			}
+		}
+		*t.dst = &parsed
+	}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid limit")
+		}
+		q.Limit = min(n, maxPageSize)
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		q.BeforeID = id
+	}
+
+	return q, nil
+}
+
+// GetAuditLog lists audit events, newest first, filtered by actor
+// (?actor_id= or ?actor=email), action (exact, or "auth." for a whole
+// group), target_type, target_id and a since/until time range. With
+// ?format=csv or ?format=jsonl every matching event is exported as a file.
+// Admin only.
+func (s *Server) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+	case "csv", "jsonl":
+		s.exportAuditLog(w, q, format)
+		return
+	default:
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid format (json, csv, jsonl)"})
+		return
+	}
+
+	page, err := s.db.ListAuditEvents(q)
+	if err != nil {
+		log.Printf("Error listing audit events: %v", err)
+		http.Error(w, "Error fetching audit log", http.StatusInternalServerError)
+		return
+	}
+
+	resp := AuditListResponse{Events: page.Events, Total: page.Total}
+	if page.Next != 0 {
+		resp.NextCursor = strconv.FormatInt(page.Next, 10)
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// exportAuditLog streams every event matching q, from q's cursor on, as
+// CSV or JSON lines
+func (s *Server) exportAuditLog(w http.ResponseWriter, q *storage.AuditQuery, format string) {
+	q.Limit = maxPageSize
+
+	page, err := s.db.ListAuditEvents(q)
+	if err != nil {
+		log.Printf("Error exporting audit events: %v", err)
+		http.Error(w, "Error fetching audit log", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	var write func(e *models.AuditEvent) error
+	var flush func() error
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "created_at", "actor_id", "actor_email", "action",
+			"target_type", "target_id", "ip_address", "user_agent", "diff"})
+		write = func(e *models.AuditEvent) error {
+			return cw.Write(auditCSVRecord(e))
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		write = func(e *models.AuditEvent) error { return enc.Encode(e) }
+		flush = func() error { return nil }
+	}
+
+	for {
+		for _, e := range page.Events {
+			if err := write(e); err != nil {
+				log.Printf("Error writing audit export: %v", err)
+				return
+			}
+		}
+		if page.Next == 0 {
+			break
+		}
+
+		q.BeforeID = page.Next
+		if page, err = s.db.ListAuditEvents(q); err != nil {
+			// Headers are sent; the truncated file is all we can give
+			log.Printf("Error exporting audit events: %v", err)
+			break
+		}
+	}
+
+	if err := flush(); err != nil {
+		log.Printf("Error writing audit export: %v", err)
+	}
+}
+
+// auditCSVRecord formats an event as a CSV row. Free-text cells that a
+// spreadsheet would run as a formula are prefixed with a quote.
+func auditCSVRecord(e *models.AuditEvent) []string {
+	actorID := ""
+	if e.ActorID != 0 {
+		actorID = strconv.FormatInt(e.ActorID, 10)
+	}
+	return []string{
+		strconv.FormatInt(e.ID, 10),
+		e.CreatedAt.UTC().Format(time.RFC3339),
+		actorID,
+		csvSafe(e.ActorEmail),
+		e.Action,
+		e.TargetType,
+		csvSafe(e.TargetID),
+		csvSafe(e.IPAddress),
+		csvSafe(e.UserAgent),
+		string(e.Diff),
+	}
+}
+
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -34,6 +35,11 @@ func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.verification.domainAllowed(req.Email) {
+		s.rejectRegistration(w)
+		return
+	}
+
 	// Check if email already exists
 	existingUser, err := s.db.GetUserByEmail(req.Email)
 	if err == nil && existingUser != nil {
@@ -56,30 +62,21 @@ func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	s.auditUser(r, user, models.AuditRegister, nil)
 
-	// Generate tokens
-	token, expiresAt, err := s.jwtManager.GenerateToken(user.ID, user.Email, string(user.Role), user.IsAdmin)
-	if err != nil {
-		log.Printf("Error generating token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	// Ask the user to confirm their email address
+	if err := s.issueVerification(r, user); err != nil {
+		log.Printf("Error issuing verification token for user %d: %v", user.ID, err)
 	}
 
-	refreshToken, err := s.jwtManager.GenerateRefreshToken()
+	// Generate tokens and create session
+	token, refreshToken, err := s.newSession(r, user)
 	if err != nil {
-		log.Printf("Error generating refresh token: %v", err)
+		log.Printf("Error creating session: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Create session
-	ipAddress := getIPAddress(r)
-	userAgent := r.UserAgent()
-	_, err = s.db.CreateSession(user.ID, token, refreshToken, ipAddress, userAgent, expiresAt)
-	if err != nil {
-		log.Printf("Error creating session: %v", err)
-	}
-
 	// Return auth response
 	respondJSON(w, http.StatusCreated, models.AuthResponse{
 		Token:        token,
@@ -97,10 +94,19 @@ func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Directory accounts may take precedence over local passwords
+	if s.tryLDAP(w, r, &req, LDAPFirst) {
+		return
+	}
+
 	// Get user by email
 	user, err := s.db.GetUserByEmail(req.Email)
 	if err != nil {
 		if err == storage.ErrUserNotFound {
+			if s.tryLDAP(w, r, &req, LDAPLast) {
+				return
+			}
+			s.auditLoginFailed(r, req.Email, nil, "unknown email")
 			respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
 			return
 		}
@@ -111,51 +117,69 @@ func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
 
 	// Check if user is active
 	if !user.IsActive {
+		s.auditLoginFailed(r, req.Email, user, "account deactivated")
 		respondJSON(w, http.StatusForbidden, map[string]string{"error": "Account is deactivated"})
 		return
 	}
 
 	// Verify password
 	if !auth.CheckPassword(req.Password, user.PasswordHash) {
+		if s.tryLDAP(w, r, &req, LDAPLast) {
+			return
+		}
+		s.auditLoginFailed(r, req.Email, user, "wrong password")
 		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
 		return
 	}
 
-	// Generate tokens
-	token, expiresAt, err := s.jwtManager.GenerateToken(user.ID, user.Email, string(user.Role), user.IsAdmin)
-	if err != nil {
-		log.Printf("Error generating token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	// Check if the email address must be verified first
+	if s.verification.blocks(user, RequireVerifiedLogin) {
+		s.auditLoginFailed(r, req.Email, user, "email not verified")
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "Email address not verified"})
 		return
 	}
 
-	refreshToken, err := s.jwtManager.GenerateRefreshToken()
+	// Staff may need a second factor before getting tokens
+	s.finishLogin(w, r, user, models.AuditLogin)
+}
+
+// completeLogin issues tokens and a session to user, whose credentials
+// have been checked, and records the login as action
+func (s *Server) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, action string) {
+	resp, err := s.issueTokens(r, user, action)
 	if err != nil {
-		log.Printf("Error generating refresh token: %v", err)
+		log.Printf("Error generating token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// issueTokens creates the tokens and session of a login by user, recorded
+// as action
+func (s *Server) issueTokens(r *http.Request, user *models.User, action string) (*models.AuthResponse, error) {
+	// Warn the user by email when the login comes from a new device,
+	// before the new session counts as a known one
+	s.notifyNewLogin(r, user)
 
-	// Create session
-	ipAddress := getIPAddress(r)
-	userAgent := r.UserAgent()
-	_, err = s.db.CreateSession(user.ID, token, refreshToken, ipAddress, userAgent, expiresAt)
+	// Generate tokens and create session
+	token, refreshToken, err := s.newSession(r, user)
 	if err != nil {
-		log.Printf("Error creating session: %v", err)
+		return nil, err
 	}
 
 	// Update last login
 	if err := s.db.UpdateUserLastLogin(user.ID); err != nil {
 		log.Printf("Error updating last login: %v", err)
 	}
+	s.auditUser(r, user, action, nil)
 
-	// Return auth response
-	respondJSON(w, http.StatusOK, models.AuthResponse{
+	return &models.AuthResponse{
 		Token:        token,
 		RefreshToken: refreshToken,
 		User:         user,
 		ExpiresIn:    int64(s.jwtManager.GetAccessExpiration().Seconds()),
-	})
+	}, nil
 }
 
 // Logout handles user logout
@@ -166,10 +190,17 @@ func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete session
-	if err := s.db.DeleteSession(token); err != nil {
+	// Delete session, revoking the token at once
+	claims, err := s.jwtManager.ValidateToken(token)
+	if err != nil {
+		claims = &auth.JWTClaims{}
+	}
+	if err := s.endSession(token, claims.JTI, time.Unix(claims.ExpiresAt, 0)); err != nil {
 		log.Printf("Error deleting session: %v", err)
 	}
+	if claims.UserID != 0 {
+		s.audit(r, models.AuditLogout, models.AuditTargetUser, auditID(claims.UserID), nil)
+	}
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
 }
@@ -184,11 +215,12 @@ func (s *Server) LogoutAll(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete all user sessions
-	if err := s.db.DeleteUserSessions(claims.UserID); err != nil {
+	if err := s.endUserSessions(claims.UserID); err != nil {
 		log.Printf("Error deleting user sessions: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	s.audit(r, models.AuditLogoutAll, models.AuditTargetUser, auditID(claims.UserID), nil)
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Logged out from all devices"})
 }
@@ -206,12 +238,25 @@ func (s *Server) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	// Get session by refresh token
 	session, err := s.db.GetSessionByRefreshToken(req.RefreshToken)
 	if err != nil {
-		if err == storage.ErrSessionNotFound {
+		switch err {
+		case storage.ErrSessionExpired:
+			respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Refresh token expired"})
+		case storage.ErrSessionNotFound:
+			// A refresh token that was already rotated has been copied
+			rotated, err := s.db.GetRotatedRefreshToken(auth.HashRefreshToken(req.RefreshToken))
+			if err == nil && time.Now().Before(rotated.ExpiresAt) {
+				s.refreshTokenReused(r, rotated.FamilyID, rotated.UserID)
+				respondJSON(w, http.StatusUnauthorized, map[string]string{"error": errRefreshTokenReused})
+				return
+			}
+			if err != nil && err != storage.ErrSessionNotFound {
+				log.Printf("Error getting rotated refresh token: %v", err)
+			}
 			respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
-			return
+		default:
+			log.Printf("Error getting session: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
-		log.Printf("Error getting session: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -222,29 +267,28 @@ func (s *Server) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-
-	// Generate new tokens
-	token, expiresAt, err := s.jwtManager.GenerateToken(user.ID, user.Email, string(user.Role), user.IsAdmin)
-	if err != nil {
-		log.Printf("Error generating token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if s.verification.blocks(user, RequireVerifiedLogin) {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "Email address not verified"})
 		return
 	}
-
-	newRefreshToken, err := s.jwtManager.GenerateRefreshToken()
-	if err != nil {
-		log.Printf("Error generating refresh token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	// Sessions from before MFA became mandatory must log in again to enroll
+	if s.mfa.required(user) && !user.MFAEnabled {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "Two-factor authentication required"})
 		return
 	}
 
-	// Delete old session and create new one
-	s.db.DeleteSession(session.Token)
-	ipAddress := getIPAddress(r)
-	userAgent := r.UserAgent()
-	_, err = s.db.CreateSession(user.ID, token, newRefreshToken, ipAddress, userAgent, expiresAt)
+	// Replace the old session, and its access token, with a new one
+	token, newRefreshToken, err := s.rotateSession(r, user, session)
+	if err == storage.ErrSessionNotFound {
+		// A concurrent request presented the same refresh token first
+		s.refreshTokenReused(r, session.FamilyID, session.UserID)
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": errRefreshTokenReused})
+		return
+	}
 	if err != nil {
 		log.Printf("Error creating session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
 	// Return new tokens
@@ -290,9 +334,12 @@ func (s *Server) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// In production, send email with reset link
-	// For now, log the token (REMOVE IN PRODUCTION)
-	log.Printf("Password reset token for %s: %s", user.Email, resetToken)
+	s.sendPasswordResetEmail(r, user, resetToken, expiry)
+	s.recordAudit(r, &models.AuditEvent{
+		Action:     models.AuditPasswordResetRequest,
+		TargetType: models.AuditTargetUser,
+		TargetID:   auditID(user.ID),
+	}, nil)
 
 	respondJSON(w, http.StatusOK, map[string]string{
 		"message": "If the email exists, a reset link will be sent",
@@ -338,7 +385,10 @@ func (s *Server) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Invalidate all sessions
-	s.db.DeleteUserSessions(user.ID)
+	if err := s.endUserSessions(user.ID); err != nil {
+		log.Printf("Error deleting sessions of user %d: %v", user.ID, err)
+	}
+	s.auditUser(r, user, models.AuditPasswordReset, nil)
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Password reset successfully"})
 }
@@ -394,6 +444,7 @@ func (s *Server) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	s.auditUser(r, user, models.AuditPasswordChange, nil)
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Password changed successfully"})
 }
@@ -431,8 +482,18 @@ func (s *Server) getCurrentUser(r *http.Request) (*auth.JWTClaims, error) {
 	if token == "" {
 		return nil, auth.ErrInvalidToken
 	}
+	if auth.IsAccessToken(token) {
+		return s.accessTokenClaims(r, token)
+	}
 
-	return s.jwtManager.ValidateToken(token)
+	claims, err := s.jwtManager.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSession(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
 
 func getIPAddress(r *http.Request) string {
@@ -444,6 +505,19 @@ func getIPAddress(r *http.Request) string {
 	return r.RemoteAddr
 }
 
+// clientIP returns the client address of r without a port
+func clientIP(r *http.Request) string {
+	return hostOnly(strings.TrimSpace(getIPAddress(r)))
+}
+
+// hostOnly strips the port, if any, from a host:port address
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"log"
+	"os"
+
+	"github.com/jesus/FCCUR/internal/blob"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+// thumbnailsPrefix is the key prefix for uploaded package thumbnails
+const thumbnailsPrefix = "thumbnails/"
+
+// createStagingFile creates a temporary local file for an upload whose hash,
+// and therefore blob key, is not known yet
+func (s *Server) createStagingFile() (*os.File, error) {
+	return os.CreateTemp(s.packagesDir, ".incoming-*")
+}
+
+// createPackageWithBlob moves srcPath into the blob store and creates the
+// package record pointing at it. Identical content is stored only once.
+func (s *Server) createPackageWithBlob(pkg *models.Package, srcPath string) (int64, error) {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+
+	key, err := s.storeBlobLocked(pkg.BLAKE3Hash, srcPath)
+	if err != nil {
+		return 0, err
+	}
+	pkg.FilePath = key
+
+	id, err := s.db.CreatePackage(pkg)
+	if err != nil {
+		s.releaseBlobLocked(key)
+		return 0, err
+	}
+	pkg.ID = id
+
+	if len(pkg.Tags) > 0 {
+		if err := s.db.AddPackageTags(id, pkg.Tags); err != nil {
+			log.Printf("Warning: Error tagging package %d: %v", id, err)
+		}
+	}
+
+	s.indexReadme(pkg)
+
+	return id, nil
+}
+
+// replacePackageBlob moves srcPath into the blob store and swaps it in as
+// the package's file, keeping the previous file as a revision
+func (s *Server) replacePackageBlob(pkg *models.Package, previous *models.PackageRevision, srcPath string) error {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+
+	key, err := s.storeBlobLocked(pkg.BLAKE3Hash, srcPath)
+	if err != nil {
+		return err
+	}
+	pkg.FilePath = key
+
+	if err := s.db.ReplacePackageFile(pkg, previous); err != nil {
+		s.releaseBlobLocked(key)
+		return err
+	}
+
+	s.indexReadme(pkg)
+
+	return nil
+}
+
+// saveSubmissionBlob moves srcPath into the blob store and records the
+// submission, releasing the file of any submission it replaces
+func (s *Server) saveSubmissionBlob(sub *models.Submission, srcPath string) error {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+
+	key, err := s.storeBlobLocked(sub.BLAKE3Hash, srcPath)
+	if err != nil {
+		return err
+	}
+	sub.FilePath = key
+
+	previous, err := s.db.GetUserSubmission(sub.BoxID, sub.UserID)
+	if err != nil && err != storage.ErrSubmissionNotFound {
+		s.releaseBlobLocked(key)
+		return err
+	}
+
+	if err := s.db.SaveSubmission(sub); err != nil {
+		s.releaseBlobLocked(key)
+		return err
+	}
+
+	if previous != nil && previous.FilePath != key {
+		s.releaseBlobLocked(previous.FilePath)
+	}
+	return nil
+}
+
+// storeBlobLocked moves srcPath into the blob store under its content key,
+// discarding it if identical content is already stored. blobMu must be held.
+func (s *Server) storeBlobLocked(blake3Hash, srcPath string) (string, error) {
+	key, err := blob.Key(blake3Hash)
+	if err != nil {
+		os.Remove(srcPath)
+		return "", err
+	}
+
+	if _, err := s.blobs.Stat(key); err == nil {
+		// Deduplicate: identical content is already stored
+		os.Remove(srcPath)
+	} else if err == blob.ErrNotFound {
+		if err := blob.PutFile(s.blobs, key, srcPath); err != nil {
+			return "", err
+		}
+	} else {
+		os.Remove(srcPath)
+		return "", err
+	}
+
+	return key, nil
+}
+
+// releaseBlob deletes a stored file once no package references it
+func (s *Server) releaseBlob(filePath string) {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+	s.releaseBlobLocked(filePath)
+}
+
+func (s *Server) releaseBlobLocked(filePath string) {
+	refs, err := s.db.CountPackagesByFilePath(filePath)
+	if err != nil {
+		log.Printf("Warning: Error counting references to %s: %v", filePath, err)
+		return
+	}
+	if refs > 0 {
+		return
+	}
+
+	if blob.IsKey(filePath) {
+		err = s.blobs.Delete(filePath)
+	} else {
+		// Legacy file stored by name, not yet migrated
+		err = os.Remove(filePath)
+	}
+	if err != nil {
+		log.Printf("Warning: Error deleting file %s: %v", filePath, err)
+	}
+}
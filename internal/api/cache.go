@@ -4,13 +4,20 @@ import (
 	"sync"
 	"time"
 
-	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
 )
 
-// PackageCache caches package metadata in memory
+// maxCacheEntries bounds the number of distinct listings kept in memory;
+// every filter, sort and cursor combination is a separate entry
+const maxCacheEntries = 256
+
+// allPackagesKey caches the unfiltered list of every package
+const allPackagesKey = "all"
+
+// PackageCache caches package listings in memory, keyed by query
 type PackageCache struct {
 	mu           sync.RWMutex
-	packages     []*models.Package
+	pages        map[string]*storage.PackagePage
 	lastUpdated  time.Time
 	enabled      bool
 }
@@ -18,14 +25,14 @@ type PackageCache struct {
 // NewPackageCache creates a new package cache
 func NewPackageCache() *PackageCache {
 	return &PackageCache{
-		packages:    make([]*models.Package, 0),
+		pages:       make(map[string]*storage.PackagePage),
 		lastUpdated: time.Time{},
 		enabled:     true,
 	}
 }
 
-// Get returns cached packages if available
-func (c *PackageCache) Get() ([]*models.Package, bool) {
+// Get returns the cached listing for key if available
+func (c *PackageCache) Get(key string) (*storage.PackagePage, bool) {
 	if !c.enabled {
 		return nil, false
 	}
@@ -33,18 +40,19 @@ func (c *PackageCache) Get() ([]*models.Package, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if c.packages == nil || len(c.packages) == 0 {
+	page, ok := c.pages[key]
+	if !ok {
 		return nil, false
 	}
 
 	// Return copy to prevent external modifications
-	result := make([]*models.Package, len(c.packages))
-	copy(result, c.packages)
-	return result, true
+	result := *page
+	result.Packages = append(result.Packages[:0:0], page.Packages...)
+	return &result, true
 }
 
-// Set updates the cache with new packages
-func (c *PackageCache) Set(packages []*models.Package) {
+// Set stores the listing for key
+func (c *PackageCache) Set(key string, page *storage.PackagePage) {
 	if !c.enabled {
 		return
 	}
@@ -52,7 +60,12 @@ func (c *PackageCache) Set(packages []*models.Package) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.packages = packages
+	// Start over rather than track usage; listings are cheap to rebuild
+	if len(c.pages) >= maxCacheEntries {
+		c.pages = make(map[string]*storage.PackagePage)
+	}
+
+	c.pages[key] = page
 	c.lastUpdated = time.Now()
 }
 
@@ -61,7 +74,7 @@ func (c *PackageCache) Invalidate() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.packages = nil
+	c.pages = make(map[string]*storage.PackagePage)
 	c.lastUpdated = time.Time{}
 }
 
@@ -77,7 +90,7 @@ func (c *PackageCache) Disable() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.enabled = false
-	c.packages = nil
+	c.pages = make(map[string]*storage.PackagePage)
 }
 
 // LastUpdated returns when the cache was last updated
@@ -87,9 +100,9 @@ func (c *PackageCache) LastUpdated() time.Time {
 	return c.lastUpdated
 }
 
-// Size returns the number of cached packages
+// Size returns the number of cached listings
 func (c *PackageCache) Size() int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return len(c.packages)
+	return len(c.pages)
 }
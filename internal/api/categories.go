@@ -0,0 +1,253 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+const (
+	defaultCategoryColor = "#6b7280"
+	defaultCategoryIcon  = "🛠️"
+	maxCategoryName      = 100
+	maxCategoryIcon      = 8 // Runes; enough for a short label or an emoji sequence
+)
+
+var categoryColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// CategoryRequest holds the fields of a category create or update
+type CategoryRequest struct {
+	Slug      string `json:"slug"` // Create only; packages refer to it
+	Name      string `json:"name"`
+	Color     string `json:"color,omitempty"`
+	Icon      string `json:"icon,omitempty"`
+	Moderated bool   `json:"moderated"` // Uploads need admin approval
+}
+
+// toCategory validates the request and builds the category, applying defaults
+func (req *CategoryRequest) toCategory() (*models.Category, error) {
+	c := &models.Category{
+		Slug:      models.NormalizeCategorySlug(req.Slug),
+		Name:      strings.TrimSpace(req.Name),
+		Color:     strings.TrimSpace(req.Color),
+		Icon:      strings.TrimSpace(req.Icon),
+		Moderated: req.Moderated,
+	}
+
+	if c.Slug == "" || c.Name == "" {
+		return nil, fmt.Errorf("Missing required fields")
+	}
+	if len(c.Slug) > maxCategoryName || utf8.RuneCountInString(c.Name) > maxCategoryName {
+		return nil, fmt.Errorf("Category slug and name must be at most %d characters", maxCategoryName)
+	}
+	if c.Color == "" {
+		c.Color = defaultCategoryColor
+	}
+	if !categoryColorPattern.MatchString(c.Color) {
+		return nil, fmt.Errorf("Invalid color (expected #rrggbb)")
+	}
+	if utf8.RuneCountInString(c.Icon) > maxCategoryIcon {
+		return nil, fmt.Errorf("Icon must be at most %d characters", maxCategoryIcon)
+	}
+
+	return c, nil
+}
+
+// GetCategories lists the category taxonomy with package counts
+func (s *Server) GetCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	categories, err := s.db.ListCategories()
+	if err != nil {
+		log.Printf("Error listing categories: %v", err)
+		http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, categories)
+}
+
+// ManageCategories creates (POST), updates (PATCH/PUT ?slug=) and deletes
+// (DELETE ?slug=) categories. Admin only.
+func (s *Server) ManageCategories(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.createCategory(w, r)
+	case http.MethodPatch, http.MethodPut:
+		s.updateCategory(w, r)
+	case http.MethodDelete:
+		s.deleteCategory(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) createCategory(w http.ResponseWriter, r *http.Request) {
+	var req CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	c, err := req.toCategory()
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.CreateCategory(c); err != nil {
+		if err == storage.ErrCategoryExists {
+			respondJSON(w, http.StatusConflict, map[string]string{"error": "Category already exists"})
+			return
+		}
+		log.Printf("Error creating category %s: %v", c.Slug, err)
+		http.Error(w, "Error creating category", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Category created: %s (%s)", c.Slug, c.Name)
+	s.audit(r, models.AuditCategoryCreate, models.AuditTargetCategory, c.Slug, auditFields(c))
+	s.respondCategory(w, http.StatusCreated, c.Slug)
+}
+
+func (s *Server) updateCategory(w http.ResponseWriter, r *http.Request) {
+	slug := r.URL.Query().Get("slug")
+	existing, err := s.db.GetCategory(slug)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Category not found"})
+		return
+	}
+
+	// PATCH keeps fields absent from the body; PUT replaces all of them
+	var req CategoryRequest
+	if r.Method == http.MethodPatch {
+		req = CategoryRequest{Name: existing.Name, Color: existing.Color, Icon: existing.Icon,
+			Moderated: existing.Moderated}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	req.Slug = existing.Slug
+
+	c, err := req.toCategory()
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.UpdateCategory(c); err != nil {
+		if err == storage.ErrCategoryNotFound {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "Category not found"})
+			return
+		}
+		log.Printf("Error updating category %s: %v", slug, err)
+		http.Error(w, "Error updating category", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Category updated: %s (%s)", c.Slug, c.Name)
+	s.audit(r, models.AuditCategoryUpdate, models.AuditTargetCategory, c.Slug, auditChanges(existing, c))
+	s.respondCategory(w, http.StatusOK, c.Slug)
+}
+
+func (s *Server) deleteCategory(w http.ResponseWriter, r *http.Request) {
+	slug := r.URL.Query().Get("slug")
+
+	switch err := s.db.DeleteCategory(slug); err {
+	case nil:
+	case storage.ErrCategoryNotFound:
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Category not found"})
+		return
+	case storage.ErrCategoryInUse:
+		respondJSON(w, http.StatusConflict, map[string]string{
+			"error": "Category is used by packages; move them to another category first",
+		})
+		return
+	default:
+		log.Printf("Error deleting category %s: %v", slug, err)
+		http.Error(w, "Error deleting category", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Category deleted: %s", slug)
+	s.audit(r, models.AuditCategoryDelete, models.AuditTargetCategory, slug, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondCategory writes the stored category, including its package count
+func (s *Server) respondCategory(w http.ResponseWriter, status int, slug string) {
+	c, err := s.db.GetCategory(slug)
+	if err != nil {
+		log.Printf("Error reloading category %s: %v", slug, err)
+		http.Error(w, "Error fetching category", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, status, c)
+}
+
+// checkCategory rejects categories missing from the taxonomy. It writes the
+// error response and returns false when the category is unknown.
+func (s *Server) checkCategory(w http.ResponseWriter, category string) bool {
+	_, err := s.db.GetCategory(category)
+	switch err {
+	case nil:
+		return true
+	case storage.ErrCategoryNotFound:
+		respondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("Unknown category %q; see /api/categories", category),
+		})
+	default:
+		log.Printf("Error checking category %s: %v", category, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// categoryIconSVG draws the default thumbnail of a category: its icon text
+// on its color. Symbols and emoji are drawn larger than letter labels.
+func categoryIconSVG(c *models.Category) string {
+	color, icon := defaultCategoryColor, defaultCategoryIcon
+	if c != nil {
+		color = c.Color
+		icon = c.Icon
+		if icon == "" {
+			r, _ := utf8.DecodeRuneInString(c.Name)
+			icon = string(unicode.ToUpper(r))
+		}
+	}
+
+	size, y, font := 50, 60, ""
+	if strings.IndexFunc(icon, isLabelRune) >= 0 {
+		y, font = 55, ` font-family="Arial"`
+		switch n := utf8.RuneCountInString(icon); {
+		case n <= 2:
+			size = 40
+		case n == 3:
+			size = 30
+		default:
+			size = 20
+		}
+	}
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100"><rect fill="%s" width="100" height="100"/><text x="50" y="%d" font-size="%d" text-anchor="middle" fill="white"%s>%s</text></svg>`,
+		html.EscapeString(color), y, size, font, html.EscapeString(icon))
+}
+
+// isLabelRune reports whether r is an ASCII letter or digit, which marks an
+// icon as a text label rather than a symbol
+func isLabelRune(r rune) bool {
+	return r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
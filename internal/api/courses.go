@@ -0,0 +1,437 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+const (
+	maxCourseName = 255
+	maxCourseCode = 50
+)
+
+// CourseRequest holds the fields of a course create or update
+type CourseRequest struct {
+	Name        string `json:"name"`
+	Code        string `json:"code,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// toCourse validates the request and builds the course
+func (req *CourseRequest) toCourse() (*models.Course, error) {
+	c := &models.Course{
+		Name:        strings.TrimSpace(req.Name),
+		Code:        strings.TrimSpace(req.Code),
+		Description: strings.TrimSpace(req.Description),
+	}
+
+	if c.Name == "" {
+		return nil, fmt.Errorf("Missing required fields")
+	}
+	if utf8.RuneCountInString(c.Name) > maxCourseName {
+		return nil, fmt.Errorf("Course name must be at most %d characters", maxCourseName)
+	}
+	if utf8.RuneCountInString(c.Code) > maxCourseCode {
+		return nil, fmt.Errorf("Course code must be at most %d characters", maxCourseCode)
+	}
+
+	return c, nil
+}
+
+// CourseMemberRequest names the professor to assign to, or the student to
+// enroll in, a course, by ID or email
+type CourseMemberRequest struct {
+	UserID int64  `json:"user_id,omitempty"`
+	Email  string `json:"email,omitempty"`
+}
+
+// user looks up the user named by the request
+func (req *CourseMemberRequest) user(db storage.Database) (*models.User, error) {
+	if req.UserID == 0 && req.Email != "" {
+		return db.GetUserByEmail(strings.ToLower(strings.TrimSpace(req.Email)))
+	}
+	return db.GetUserByID(req.UserID)
+}
+
+// GetCourses lists courses with package counts
+func (s *Server) GetCourses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	courses, err := s.db.ListCourses()
+	if err != nil {
+		log.Printf("Error listing courses: %v", err)
+		http.Error(w, "Error fetching courses", http.StatusInternalServerError)
+		return
+	}
+
+	// Professor assignments are only shown to admins
+	for _, c := range courses {
+		c.Professors = nil
+	}
+
+	respondJSON(w, http.StatusOK, courses)
+}
+
+// ManageCourses lists courses with their professors (GET), creates (POST),
+// updates (PATCH/PUT ?id=) and deletes (DELETE ?id=) courses. Admin only.
+func (s *Server) ManageCourses(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listCourses(w, r)
+	case http.MethodPost:
+		s.createCourse(w, r)
+	case http.MethodPatch, http.MethodPut:
+		s.updateCourse(w, r)
+	case http.MethodDelete:
+		s.deleteCourse(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) listCourses(w http.ResponseWriter, r *http.Request) {
+	if id := r.URL.Query().Get("id"); id != "" {
+		courseID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		s.respondCourse(w, http.StatusOK, courseID)
+		return
+	}
+
+	courses, err := s.db.ListCourses()
+	if err != nil {
+		log.Printf("Error listing courses: %v", err)
+		http.Error(w, "Error fetching courses", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, courses)
+}
+
+func (s *Server) createCourse(w http.ResponseWriter, r *http.Request) {
+	var req CourseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	c, err := req.toCourse()
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.CreateCourse(c); err != nil {
+		if err == storage.ErrCourseExists {
+			respondJSON(w, http.StatusConflict, map[string]string{"error": "Course already exists"})
+			return
+		}
+		log.Printf("Error creating course %s: %v", c.Name, err)
+		http.Error(w, "Error creating course", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Course created: %d (%s)", c.ID, c.Name)
+	s.audit(r, models.AuditCourseCreate, models.AuditTargetCourse, auditID(c.ID), auditFields(c))
+	s.respondCourse(w, http.StatusCreated, c.ID)
+}
+
+func (s *Server) updateCourse(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := s.db.GetCourse(id)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Course not found"})
+		return
+	}
+
+	// PATCH keeps fields absent from the body; PUT replaces all of them
+	var req CourseRequest
+	if r.Method == http.MethodPatch {
+		req = CourseRequest{Name: existing.Name, Code: existing.Code, Description: existing.Description}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	c, err := req.toCourse()
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	c.ID = id
+
+	switch err := s.db.UpdateCourse(c); err {
+	case nil:
+	case storage.ErrCourseNotFound:
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Course not found"})
+		return
+	case storage.ErrCourseExists:
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Course already exists"})
+		return
+	default:
+		log.Printf("Error updating course %d: %v", id, err)
+		http.Error(w, "Error updating course", http.StatusInternalServerError)
+		return
+	}
+
+	// Renaming moves packages to the new name
+	if c.Name != existing.Name {
+		s.cache.Invalidate()
+		log.Printf("Course %d renamed: %q -> %q", id, existing.Name, c.Name)
+	}
+	c.Professors = existing.Professors
+	s.audit(r, models.AuditCourseUpdate, models.AuditTargetCourse, auditID(id), auditChanges(existing, c))
+
+	s.respondCourse(w, http.StatusOK, id)
+}
+
+func (s *Server) deleteCourse(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	switch err := s.db.DeleteCourse(id); err {
+	case nil:
+	case storage.ErrCourseNotFound:
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Course not found"})
+		return
+	case storage.ErrCourseInUse:
+		respondJSON(w, http.StatusConflict, map[string]string{
+			"error": "Course has packages or submission boxes; move or delete them first",
+		})
+		return
+	default:
+		log.Printf("Error deleting course %d: %v", id, err)
+		http.Error(w, "Error deleting course", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Course deleted: %d", id)
+	s.audit(r, models.AuditCourseDelete, models.AuditTargetCourse, auditID(id), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CourseProfessors assigns (POST) and unassigns (DELETE &user_id=) the
+// professors of the course ?id=. Admin only.
+func (s *Server) CourseProfessors(w http.ResponseWriter, r *http.Request) {
+	courseID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var userID int64
+	switch r.Method {
+	case http.MethodPost:
+		var req CourseMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+			return
+		}
+		user, err := req.user(s.db)
+		if err != nil {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+			return
+		}
+		if user.Role != models.RoleProfessor {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Only professors can be assigned to courses"})
+			return
+		}
+		userID = user.ID
+	case http.MethodDelete:
+		userID, err = strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		err = s.db.AddCourseProfessor(courseID, userID)
+	} else {
+		err = s.db.RemoveCourseProfessor(courseID, userID)
+	}
+
+	if err != nil {
+		if err == storage.ErrCourseNotFound {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "Course not found"})
+			return
+		}
+		log.Printf("Error updating professors of course %d: %v", courseID, err)
+		http.Error(w, "Error updating course professors", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Course %d professors updated (%s user %d)", courseID, r.Method, userID)
+	action := models.AuditCourseProfessorAdd
+	if r.Method == http.MethodDelete {
+		action = models.AuditCourseProfessorRemove
+	}
+	s.audit(r, action, models.AuditTargetCourse, auditID(courseID), map[string]int64{"user_id": userID})
+	s.respondCourse(w, http.StatusOK, courseID)
+}
+
+// CourseStudents lists (GET), enrolls (POST) and unenrolls (DELETE
+// &user_id=) the students of the course ?id=. Admins and the course's
+// professors only; enrollment grants access to the course's enrolled-only
+// packages.
+func (s *Server) CourseStudents(w http.ResponseWriter, r *http.Request) {
+	courseID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.getCurrentUser(r)
+	if err != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized - login required"})
+		return
+	}
+	manager, err := s.db.GetUserByID(claims.UserID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	course, err := s.db.GetCourse(courseID)
+	if err != nil {
+		if err == storage.ErrCourseNotFound {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "Course not found"})
+			return
+		}
+		log.Printf("Error fetching course %d: %v", courseID, err)
+		http.Error(w, "Error fetching course", http.StatusInternalServerError)
+		return
+	}
+	if !manager.CanUploadToCourse(course.Name) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "You don't have permission to manage the students of this course",
+		})
+		return
+	}
+
+	var userID int64
+	switch r.Method {
+	case http.MethodGet:
+		s.respondCourseStudents(w, courseID)
+		return
+	case http.MethodPost:
+		var req CourseMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+			return
+		}
+		user, err := req.user(s.db)
+		if err != nil {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+			return
+		}
+		if user.Role != models.RoleStudent {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Only students can be enrolled in courses"})
+			return
+		}
+		userID = user.ID
+	case http.MethodDelete:
+		userID, err = strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		err = s.db.EnrollStudent(courseID, userID)
+	} else {
+		err = s.db.UnenrollStudent(courseID, userID)
+	}
+
+	if err != nil {
+		if err == storage.ErrCourseNotFound {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "Course not found"})
+			return
+		}
+		log.Printf("Error updating students of course %d: %v", courseID, err)
+		http.Error(w, "Error updating course students", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Course %d students updated by %s (%s user %d)", courseID, manager.Email, r.Method, userID)
+	action := models.AuditCourseStudentAdd
+	if r.Method == http.MethodDelete {
+		action = models.AuditCourseStudentRemove
+	}
+	s.audit(r, action, models.AuditTargetCourse, auditID(courseID), map[string]int64{"user_id": userID})
+	s.respondCourseStudents(w, courseID)
+}
+
+// respondCourseStudents writes the students enrolled in a course
+func (s *Server) respondCourseStudents(w http.ResponseWriter, courseID int64) {
+	students, err := s.db.ListCourseStudents(courseID)
+	if err != nil {
+		log.Printf("Error listing students of course %d: %v", courseID, err)
+		http.Error(w, "Error fetching course students", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, students)
+}
+
+// respondCourse writes the stored course with its professors
+func (s *Server) respondCourse(w http.ResponseWriter, status int, id int64) {
+	c, err := s.db.GetCourse(id)
+	if err != nil {
+		if err == storage.ErrCourseNotFound {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "Course not found"})
+			return
+		}
+		log.Printf("Error reloading course %d: %v", id, err)
+		http.Error(w, "Error fetching course", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, status, c)
+}
+
+// checkCourse rejects course names that are not registered courses. It
+// writes the error response and returns false when the course is unknown.
+func (s *Server) checkCourse(w http.ResponseWriter, name string) bool {
+	_, err := s.db.GetCourseByName(name)
+	switch err {
+	case nil:
+		return true
+	case storage.ErrCourseNotFound:
+		respondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("Unknown course %q; see /api/courses", name),
+		})
+	default:
+		log.Printf("Error checking course %s: %v", name, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+	return false
+}
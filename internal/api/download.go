@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// downloadResponseWriter records the status code sent for a download
+type downloadResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader captures the status before passing it on
+func (w *downloadResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records an implicit 200 status
+func (w *downloadResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// packageETag derives a strong ETag from the package content hash
+func packageETag(pkg *models.Package) string {
+	return `"` + pkg.BLAKE3Hash + `"`
+}
+
+// countsAsDownload reports whether a response is the start of a logical download.
+// Full responses count, and so do range responses that begin at byte 0, so a
+// download manager fetching many ranges or a client resuming with
+// `curl -C -` is only counted once.
+func countsAsDownload(r *http.Request, status int) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+
+	switch status {
+	case http.StatusOK:
+		return true
+	case http.StatusPartialContent:
+		return rangeStartsAtZero(r.Header.Get("Range"))
+	default:
+		return false
+	}
+}
+
+// rangeStartsAtZero checks whether any range in a Range header starts at byte 0
+func rangeStartsAtZero(header string) bool {
+	specs, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return false
+	}
+
+	for _, spec := range strings.Split(specs, ",") {
+		start, _, _ := strings.Cut(strings.TrimSpace(spec), "-")
+		if strings.TrimLeft(start, "0") == "" && start != "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/version"
+)
+
+// platformAll marks multiplatform packages, which match any requested platform
+const platformAll = "all"
+
+// FamilyVersions is the response for a package family's version listing
+type FamilyVersions struct {
+	Family   string                     `json:"family"`
+	Platform string                     `json:"platform,omitempty"`
+	Latest   map[string]*models.Package `json:"latest"` // Newest build per platform
+	Versions []*models.Package          `json:"versions"`
+}
+
+// GetFamilyVersions lists all versions of a package family, newest first
+func (s *Server) GetFamilyVersions(w http.ResponseWriter, r *http.Request) {
+	family := models.FamilySlug(r.URL.Query().Get("family"))
+	platform := strings.ToLower(r.URL.Query().Get("platform"))
+	if family == "" {
+		http.Error(w, "Missing family", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := s.familyPackages(family, platform, s.viewer(r))
+	if err != nil {
+		http.Error(w, "Error fetching packages", http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "Package family not found", http.StatusNotFound)
+		return
+	}
+
+	resp := FamilyVersions{
+		Family:   family,
+		Platform: platform,
+		Latest:   make(map[string]*models.Package),
+		Versions: versions,
+	}
+	for _, pkg := range versions {
+		key := strings.ToLower(pkg.Platform)
+		if _, ok := resp.Latest[key]; !ok {
+			resp.Latest[key] = pkg
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// DownloadLatest redirects /download/latest/<family>?platform=<p> to the
+// newest build of the family
+func (s *Server) DownloadLatest(w http.ResponseWriter, r *http.Request) {
+	family := models.FamilySlug(strings.TrimPrefix(r.URL.Path, "/download/latest/"))
+	platform := strings.ToLower(r.URL.Query().Get("platform"))
+	if family == "" {
+		http.Error(w, "Missing family", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := s.familyPackages(family, platform, s.viewer(r))
+	if err != nil {
+		http.Error(w, "Error fetching packages", http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "Package family not found", http.StatusNotFound)
+		return
+	}
+
+	// Without a platform the choice must be unambiguous
+	if platform == "" {
+		platforms := familyPlatforms(versions)
+		if len(platforms) > 1 {
+			http.Error(w, fmt.Sprintf("Multiple platforms available, specify ?platform= (%s)",
+				strings.Join(platforms, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+
+	latest := versions[0]
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Package-Version", latest.Version)
+	http.Redirect(w, r, fmt.Sprintf("/download/?id=%d", latest.ID), http.StatusFound)
+}
+
+// familyPackages returns the packages of a family visible to v, newest
+// version first. A platform matches its own builds and multiplatform ones;
+// an empty platform matches everything.
+func (s *Server) familyPackages(family, platform string, v *models.Viewer) ([]*models.Package, error) {
+	packages, err := s.visiblePackages(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*models.Package
+	for _, pkg := range packages {
+		if pkg.Family() != family {
+			continue
+		}
+		if platform != "" && !strings.EqualFold(pkg.Platform, platform) && !strings.EqualFold(pkg.Platform, platformAll) {
+			continue
+		}
+		matches = append(matches, pkg)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if c := version.Compare(a.Version, b.Version); c != 0 {
+			return c > 0
+		}
+		// Same version: prefer the platform-specific build, then the newest upload
+		if platform != "" {
+			exactA := strings.EqualFold(a.Platform, platform)
+			exactB := strings.EqualFold(b.Platform, platform)
+			if exactA != exactB {
+				return exactA
+			}
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+
+	return matches, nil
+}
+
+// familyPlatforms lists the distinct platforms in packages
+func familyPlatforms(packages []*models.Package) []string {
+	seen := make(map[string]bool)
+	var platforms []string
+	for _, pkg := range packages {
+		p := strings.ToLower(pkg.Platform)
+		if !seen[p] {
+			seen[p] = true
+			platforms = append(platforms, p)
+		}
+	}
+	sort.Strings(platforms)
+	return platforms
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,8 +13,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jesus/FCCUR/internal/blob"
 	"github.com/jesus/FCCUR/internal/hash"
 	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
 )
 
 // Health returns server health status
@@ -48,31 +51,6 @@ func (s *Server) Health(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// GetPackages lists all packages
-func (s *Server) GetPackages(w http.ResponseWriter, r *http.Request) {
-	// Try to get from cache first
-	if packages, ok := s.cache.Get(); ok {
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("X-Cache", "HIT")
-		json.NewEncoder(w).Encode(packages)
-		return
-	}
-
-	// Cache miss - fetch from database
-	packages, err := s.db.GetPackages()
-	if err != nil {
-		http.Error(w, "Error fetching packages", http.StatusInternalServerError)
-		return
-	}
-
-	// Update cache
-	s.cache.Set(packages)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("X-Cache", "MISS")
-	json.NewEncoder(w).Encode(packages)
-}
-
 // GetPackage retrieves a specific package
 func (s *Server) GetPackage(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
@@ -82,9 +60,8 @@ func (s *Server) GetPackage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pkg, err := s.db.GetPackage(id)
-	if err != nil {
-		http.Error(w, "Package not found", http.StatusNotFound)
+	pkg, ok := s.visiblePackage(w, r, id)
+	if !ok {
 		return
 	}
 
@@ -122,58 +99,51 @@ func (s *Server) UploadPackage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get metadata
-	name := r.FormValue("name")
-	version := r.FormValue("version")
-	category := r.FormValue("category")
-	platform := r.FormValue("platform")
-	description := r.FormValue("description")
-	contentType := r.FormValue("content_type") // "tool" or "material"
-	courseName := r.FormValue("course_name")    // Optional, for materials
-
-	// Default to "tool" if not specified
-	if contentType == "" {
-		contentType = "tool"
+	meta := UploadMetadata{
+		Name:        r.FormValue("name"),
+		Version:     r.FormValue("version"),
+		Category:    r.FormValue("category"),
+		Platform:    r.FormValue("platform"),
+		Description: r.FormValue("description"),
+		ContentType: r.FormValue("content_type"), // "tool" or "material"
+		CourseName:  r.FormValue("course_name"),  // Optional, for materials
+		Tags:        models.SplitTags(r.FormValue("tags")),
+		Visibility:  models.Visibility(r.FormValue("visibility")),
 	}
 
-	// Validate required fields
-	if name == "" || version == "" || category == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	// Validate required fields and apply defaults
+	if err := meta.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// For materials, course_name is recommended
-	if contentType == "material" && courseName == "" {
-		courseName = "General"
+	if !s.checkCategory(w, meta.Category) {
+		return
 	}
 
 	// Check course permissions for professors
-	if contentType == "material" && courseName != "" {
-		if !s.checkCoursePermission(w, r, courseName) {
-			claims, _ := s.getCurrentUser(r)
-			user, _ := s.db.GetUserByID(claims.UserID)
-			// Only restrict professors, admins can upload to any course
-			if user != nil && user.Role == models.RoleProfessor {
-				respondJSON(w, http.StatusForbidden, map[string]string{
-					"error": "You don't have permission to upload to this course",
-				})
-				return
-			}
-		}
+	if !s.checkUploadCourse(w, r, meta.ContentType, meta.CourseName) {
+		return
 	}
 
-	// Save file with sanitized filename
-	destPath := filepath.Join(s.packagesDir, sanitizedFilename)
-	dest, err := os.Create(destPath)
+	uploader, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Stage file locally until its hash is known
+	dest, err := s.createStagingFile()
 	if err != nil {
 		http.Error(w, "Error saving file", http.StatusInternalServerError)
 		return
 	}
-	defer dest.Close()
+	tempPath := dest.Name()
 
 	// Copy and calculate hashes
 	blake3Hash, sha256Hash, fileSize, err := s.saveAndHash(file, dest)
+	dest.Close()
 	if err != nil {
-		os.Remove(destPath)
+		os.Remove(tempPath)
 		http.Error(w, "Error processing file", http.StatusInternalServerError)
 		return
 	}
@@ -194,48 +164,29 @@ func (s *Server) UploadPackage(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Thumbnail too large: %d bytes", thumbHeader.Size)
 		} else {
 			// Save thumbnail
-			thumbFilename := fmt.Sprintf("thumb_%d%s", time.Now().UnixNano(), thumbExt)
-			thumbPath := filepath.Join(s.packagesDir, "thumbnails", thumbFilename)
-
-			// Ensure thumbnails directory exists
-			os.MkdirAll(filepath.Join(s.packagesDir, "thumbnails"), 0755)
-
-			thumbDest, err := os.Create(thumbPath)
-			if err == nil {
-				defer thumbDest.Close()
-				if _, err := io.Copy(thumbDest, thumbFile); err == nil {
-					thumbnailPath = thumbPath
-				} else {
-					log.Printf("Error saving thumbnail: %v", err)
-				}
+			thumbKey := fmt.Sprintf("%sthumb_%d%s", thumbnailsPrefix, time.Now().UnixNano(), thumbExt)
+			if err := s.blobs.Put(thumbKey, thumbFile, thumbHeader.Size); err == nil {
+				thumbnailPath = thumbKey
+			} else {
+				log.Printf("Error saving thumbnail: %v", err)
 			}
 		}
 	}
 
 	// Create database record
-	pkg := &models.Package{
-		Name:          name,
-		Version:       version,
-		Description:   description,
-		Category:      category,
-		ContentType:   contentType,
-		CourseName:    courseName,
-		FilePath:      destPath,
-		FileSize:      fileSize,
-		BLAKE3Hash:    blake3Hash,
-		SHA256Hash:    sha256Hash,
-		Platform:      platform,
-		ThumbnailPath: thumbnailPath,
-	}
-
-	id, err := s.db.CreatePackage(pkg)
+	pkg := meta.toPackage(sanitizedFilename, fileSize, blake3Hash, sha256Hash)
+	pkg.ThumbnailPath = thumbnailPath
+	s.holdForReview(pkg, uploader)
+
+	id, err := s.createPackageWithBlob(pkg, tempPath)
 	if err != nil {
-		os.Remove(destPath)
 		http.Error(w, "Error creating package", http.StatusInternalServerError)
 		return
 	}
 
 	pkg.ID = id
+	s.notifyPending(pkg)
+	s.audit(r, models.AuditPackageUpload, models.AuditTargetPackage, auditID(id), auditPackage(pkg))
 
 	// Invalidate cache after successful upload
 	s.cache.Invalidate()
@@ -255,35 +206,42 @@ func (s *Server) DownloadPackage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get package metadata
-	pkg, err := s.db.GetPackage(id)
-	if err != nil {
-		http.Error(w, "Package not found", http.StatusNotFound)
+	pkg, ok := s.visiblePackage(w, r, id)
+	if !ok {
 		return
 	}
 
 	// Open file
-	file, err := os.Open(pkg.FilePath)
+	file, err := blob.Open(s.blobs, pkg.FilePath)
 	if err != nil {
 		http.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
 	defer file.Close()
 
-	// Record download asynchronously
-	go s.db.RecordDownload(id, r.RemoteAddr, r.UserAgent())
-
 	// Set headers
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(pkg.FilePath)))
-	w.Header().Set("Content-Length", strconv.FormatInt(pkg.FileSize, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", pkg.GetFileName()))
+	w.Header().Set("ETag", packageETag(pkg))
 	w.Header().Set("X-BLAKE3-Hash", pkg.BLAKE3Hash)
 	w.Header().Set("X-SHA256-Hash", pkg.SHA256Hash)
+	if !pkg.VisibleTo(nil) {
+		// Keep restricted files out of shared caches
+		w.Header().Set("Cache-Control", "private")
+	}
+
+	// Stream file; ServeContent handles Range, If-Range, If-None-Match
+	// and If-Modified-Since using the ETag and modification time
+	dw := &downloadResponseWriter{ResponseWriter: w}
+	http.ServeContent(dw, r, pkg.GetFileName(), pkg.UpdatedAt, file)
 
-	// Stream file
-	io.Copy(w, file)
+	// Record download asynchronously
+	if countsAsDownload(r, dw.status) {
+		go s.db.RecordDownload(id, r.RemoteAddr, r.UserAgent())
+	}
 }
 
-// GetStats returns download statistics
+// GetStats returns download statistics for the packages the caller may see
 func (s *Server) GetStats(w http.ResponseWriter, r *http.Request) {
 	stats, err := s.db.GetStats()
 	if err != nil {
@@ -292,6 +250,27 @@ func (s *Server) GetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if viewer := s.viewer(r); !viewer.SeesAll() {
+		packages, err := s.visiblePackages(viewer)
+		if err != nil {
+			log.Printf("Error fetching packages: %v", err)
+			http.Error(w, "Error fetching stats", http.StatusInternalServerError)
+			return
+		}
+		visible := make(map[int64]bool, len(packages))
+		for _, pkg := range packages {
+			visible[pkg.ID] = true
+		}
+
+		filtered := stats[:0]
+		for _, stat := range stats {
+			if visible[stat.PackageID] {
+				filtered = append(filtered, stat)
+			}
+		}
+		stats = filtered
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
@@ -321,12 +300,13 @@ func (s *Server) CheckDuplicate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Duplicate found
+	// Duplicate found; its details are only shown to those who may see it
+	response := map[string]interface{}{"duplicate": true}
+	if pkg.VisibleTo(s.viewer(r)) {
+		response["package"] = pkg
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"duplicate": true,
-		"package":   pkg,
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
 // DownloadChecksum generates and downloads checksum file for a package
@@ -344,14 +324,12 @@ func (s *Server) DownloadChecksum(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pkg, err := s.db.GetPackage(id)
-	if err != nil {
-		http.Error(w, "Package not found", http.StatusNotFound)
+	pkg, ok := s.visiblePackage(w, r, id)
+	if !ok {
 		return
 	}
 
-	// Get filename from path
-	filename := filepath.Base(pkg.FilePath)
+	filename := pkg.GetFileName()
 
 	var checksumContent string
 	var checksumFilename string
@@ -374,7 +352,8 @@ func (s *Server) DownloadChecksum(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(checksumContent))
 }
 
-// DownloadAllChecksums generates a batch checksum file for all packages
+// DownloadAllChecksums generates a batch checksum file for all packages the
+// caller may see
 func (s *Server) DownloadAllChecksums(w http.ResponseWriter, r *http.Request) {
 	checksumType := r.URL.Query().Get("type") // "sha256" or "blake3"
 
@@ -382,7 +361,7 @@ func (s *Server) DownloadAllChecksums(w http.ResponseWriter, r *http.Request) {
 		checksumType = "sha256"
 	}
 
-	packages, err := s.db.GetPackages()
+	packages, err := s.visiblePackages(s.viewer(r))
 	if err != nil {
 		http.Error(w, "Error fetching packages", http.StatusInternalServerError)
 		return
@@ -394,7 +373,7 @@ func (s *Server) DownloadAllChecksums(w http.ResponseWriter, r *http.Request) {
 	checksumContent.WriteString(fmt.Sprintf("# Total packages: %d\n\n", len(packages)))
 
 	for _, pkg := range packages {
-		filename := filepath.Base(pkg.FilePath)
+		filename := pkg.GetFileName()
 		switch checksumType {
 		case "blake3":
 			checksumContent.WriteString(fmt.Sprintf("%s  %s\n", pkg.BLAKE3Hash, filename))
@@ -425,43 +404,24 @@ func (s *Server) GetArchiveContents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pkg, err := s.db.GetPackage(id)
-	if err != nil {
-		http.Error(w, "Package not found", http.StatusNotFound)
+	pkg, ok := s.visiblePackage(w, r, id)
+	if !ok {
 		return
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(pkg.FilePath); os.IsNotExist(err) {
+	contents, err := s.readArchiveContents(pkg)
+	switch {
+	case errors.Is(err, errArchiveMissing):
 		http.Error(w, "File not found", http.StatusNotFound)
 		return
-	}
-
-	// Determine archive type from extension
-	ext := strings.ToLower(filepath.Ext(pkg.FilePath))
-	var contents interface{}
-	var archiveErr error
-
-	switch ext {
-	case ".zip":
-		contents, archiveErr = listZipContents(pkg.FilePath)
-	case ".tar":
-		contents, archiveErr = listTarContents(pkg.FilePath, false)
-	case ".gz", ".tgz":
-		// Check if it's a tar.gz
-		if strings.HasSuffix(strings.ToLower(pkg.FilePath), ".tar.gz") || ext == ".tgz" {
-			contents, archiveErr = listTarContents(pkg.FilePath, true)
-		} else {
-			http.Error(w, "Unsupported archive format", http.StatusBadRequest)
-			return
-		}
-	default:
+	case err == errUnsupportedArchive:
+		http.Error(w, "Unsupported archive format", http.StatusBadRequest)
+		return
+	case err == errNotArchive:
 		http.Error(w, "Not an archive file", http.StatusBadRequest)
 		return
-	}
-
-	if archiveErr != nil {
-		log.Printf("Error reading archive: %v", archiveErr)
+	case err != nil:
+		log.Printf("Error reading archive: %v", err)
 		http.Error(w, "Error reading archive", http.StatusInternalServerError)
 		return
 	}
@@ -479,9 +439,8 @@ func (s *Server) ServeThumbnail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pkg, err := s.db.GetPackage(id)
-	if err != nil {
-		http.Error(w, "Package not found", http.StatusNotFound)
+	pkg, ok := s.visiblePackage(w, r, id)
+	if !ok {
 		return
 	}
 
@@ -493,37 +452,33 @@ func (s *Server) ServeThumbnail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if thumbnail file exists
-	if _, err := os.Stat(pkg.ThumbnailPath); os.IsNotExist(err) {
+	thumb, err := blob.Open(s.blobs, pkg.ThumbnailPath)
+	if err != nil {
 		s.serveDefaultIcon(w, pkg.Category)
 		return
 	}
+	defer thumb.Close()
 
 	// Serve the thumbnail file
-	http.ServeFile(w, r, pkg.ThumbnailPath)
+	http.ServeContent(w, r, pkg.ThumbnailPath, thumb.Info().ModTime, thumb)
 }
 
-// serveDefaultIcon serves a default SVG icon based on category
+// serveDefaultIcon serves a default SVG icon drawn from the category's
+// color and icon; unknown categories get a generic tool icon
 func (s *Server) serveDefaultIcon(w http.ResponseWriter, category string) {
-	var svg string
-	switch category {
-	case "os":
-		svg = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100"><rect fill="#2563eb" width="100" height="100"/><text x="50" y="55" font-size="40" text-anchor="middle" fill="white" font-family="Arial">OS</text></svg>`
-	case "compiler":
-		svg = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100"><rect fill="#10b981" width="100" height="100"/><text x="50" y="55" font-size="35" text-anchor="middle" fill="white" font-family="Arial">⚙️</text></svg>`
-	case "ide":
-		svg = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100"><rect fill="#f59e0b" width="100" height="100"/><text x="50" y="55" font-size="30" text-anchor="middle" fill="white" font-family="Arial">IDE</text></svg>`
-	case "library":
-		svg = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100"><rect fill="#8b5cf6" width="100" height="100"/><text x="50" y="60" font-size="50" text-anchor="middle" fill="white">📚</text></svg>`
-	default: // "tool" and others
-		svg = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100"><rect fill="#6b7280" width="100" height="100"/><text x="50" y="60" font-size="50" text-anchor="middle" fill="white">🛠️</text></svg>`
+	c, err := s.db.GetCategory(category)
+	if err != nil {
+		c = nil
 	}
+	svg := categoryIconSVG(c)
 
 	w.Header().Set("Content-Type", "image/svg+xml")
 	w.Header().Set("Cache-Control", "public, max-age=86400")
 	w.Write([]byte(svg))
 }
 
-// DeletePackage removes a package (requires authentication)
+// DeletePackage moves a package to the trash (requires authentication). It
+// can be restored until the trash retention period ends; see Trash.
 func (s *Server) DeletePackage(w http.ResponseWriter, r *http.Request) {
 	// ALWAYS require authentication for deletion, regardless of global auth settings
 	if !s.authConfig.Enabled {
@@ -545,32 +500,40 @@ func (s *Server) DeletePackage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete from database (will delete download records too)
-	if err := s.db.DeletePackage(id); err != nil {
-		log.Printf("Error deleting package from database: %v", err)
-		http.Error(w, "Error deleting package", http.StatusInternalServerError)
-		return
+	var userID int64
+	if claims, err := s.getCurrentUser(r); err == nil {
+		userID = claims.UserID
 	}
 
-	// Delete the file
-	if err := os.Remove(pkg.FilePath); err != nil {
-		log.Printf("Warning: Error deleting file %s: %v", pkg.FilePath, err)
-		// Continue - database is already updated
+	// Files and download records stay until the package is purged
+	if err := s.db.TrashPackage(id, userID); err != nil {
+		if err == storage.ErrPackageNotFound {
+			http.Error(w, "Package not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error moving package to trash: %v", err)
+		http.Error(w, "Error deleting package", http.StatusInternalServerError)
+		return
 	}
 
 	// Invalidate cache after successful deletion
 	s.cache.Invalidate()
 
 	// Log deletion event
-	log.Printf("Package deleted: ID=%d, Name=%s, Version=%s, File=%s",
+	log.Printf("Package moved to trash: ID=%d, Name=%s, Version=%s, File=%s",
 		pkg.ID, pkg.Name, pkg.Version, pkg.FilePath)
+	s.audit(r, models.AuditPackageDelete, models.AuditTargetPackage, auditID(id), auditPackage(pkg))
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	response := map[string]interface{}{
 		"success": true,
-		"message": "Package deleted successfully",
+		"message": "Package moved to trash",
 		"id":      id,
-	})
+	}
+	if s.trashRetention > 0 {
+		response["purge_at"] = time.Now().Add(s.trashRetention).UTC()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 // saveAndHash saves file and calculates both hashes simultaneously
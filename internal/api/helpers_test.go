@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+// testPassword is the password of every user testEnv creates
+const testPassword = "Passw0rd!"
+
+// testEnv is a server on a fresh SQLite database with an admin, a
+// professor and two students
+type testEnv struct {
+	t   *testing.T
+	srv *Server
+	ts  *httptest.Server
+	db  storage.Database
+	dir string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	dir := t.TempDir()
+	storage.SetMigrationsPath(filepath.Join("..", "..", "migrations"))
+	path := filepath.Join(dir, "fccur.db")
+	db, err := storage.NewDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Migrate closes the connection it runs on
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = storage.NewDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	hash, err := auth.HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for email, role := range map[string]models.UserRole{
+		"admin@uni.edu":  models.RoleAdmin,
+		"prof@uni.edu":   models.RoleProfessor,
+		"ana@uni.edu":    models.RoleStudent,
+		"carlos@uni.edu": models.RoleStudent,
+	} {
+		if _, err := db.CreateUser(email, hash, email, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	packagesDir := filepath.Join(dir, "packages")
+	if err := os.MkdirAll(packagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(db, packagesDir, dir, "test-secret")
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	return &testEnv{t: t, srv: srv, ts: ts, db: db, dir: dir}
+}
+
+// user returns the user with email
+func (e *testEnv) user(email string) *models.User {
+	e.t.Helper()
+	user, err := e.db.GetUserByEmail(email)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return user
+}
+
+// login logs in as email and returns the access and refresh tokens
+func (e *testEnv) login(email string) (token, refreshToken string) {
+	e.t.Helper()
+	resp, body := e.do(http.MethodPost, "/api/auth/login", "",
+		fmt.Sprintf(`{"email": %q, "password": %q}`, email, testPassword))
+	if resp.StatusCode != http.StatusOK {
+		e.t.Fatalf("login as %s: %d %s", email, resp.StatusCode, body)
+	}
+	var auth models.AuthResponse
+	if err := json.Unmarshal([]byte(body), &auth); err != nil {
+		e.t.Fatal(err)
+	}
+	return auth.Token, auth.RefreshToken
+}
+
+// do sends a request with a JSON body, or none when body is empty, and
+// returns the response and its body
+func (e *testEnv) do(method, path, token, body string) (*http.Response, string) {
+	e.t.Helper()
+	if body == "" {
+		return e.send(method, path, token, nil, nil)
+	}
+	return e.send(method, path, token, bytes.NewBufferString(body), map[string]string{"Content-Type": "application/json"})
+}
+
+// send sends a request with body, which may be nil, and header
+func (e *testEnv) send(method, path, token string, body io.Reader, header map[string]string) (*http.Response, string) {
+	e.t.Helper()
+	req, err := http.NewRequest(method, e.ts.URL+path, body)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+// sendFile posts a multipart form with the file data as field "file" and
+// the other fields
+func (e *testEnv) sendFile(method, path, token, name string, data []byte, fields map[string]string) (*http.Response, string) {
+	e.t.Helper()
+	return e.sendForm(method, path, token, "file", name, data, fields)
+}
+
+// sendForm posts a multipart form with the file data as fileField and the
+// other fields
+func (e *testEnv) sendForm(method, path, token, fileField, name string, data []byte, fields map[string]string) (*http.Response, string) {
+	e.t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	fw, err := mw.CreateFormFile(fileField, name)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+	return e.send(method, path, token, &buf, map[string]string{"Content-Type": mw.FormDataContentType()})
+}
+
+// decode unmarshals a JSON response body into v
+func (e *testEnv) decode(body string, v interface{}) {
+	e.t.Helper()
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		e.t.Fatalf("decoding %q: %v", body, err)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// When Login checks passwords against the directory
+const (
+	LDAPFirst = "first" // Before local passwords, which remain a fallback
+	LDAPLast  = "last"  // Only when the local password does not match
+)
+
+// ParseLDAPOrder validates the -ldap-order setting
+func ParseLDAPOrder(value string) (string, error) {
+	switch value {
+	case LDAPFirst, LDAPLast:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown order %q (first, last)", value)
+}
+
+// GroupRole gives Role to members of Group, which is either a group DN or
+// the value of its first component, e.g. "admins" for
+// "cn=admins,ou=groups,dc=uni,dc=edu"
+type GroupRole struct {
+	Group string
+	Role  models.UserRole
+}
+
+// ParseGroupRoles parses semicolon-separated group:role mappings, e.g.
+// "cn=fccur-admins,ou=groups,dc=uni,dc=edu:admin;profesores:professor"
+func ParseGroupRoles(list string) ([]GroupRole, error) {
+	var mappings []GroupRole
+	for _, item := range strings.Split(list, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		colon := strings.LastIndex(item, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("group mapping %q is not group:role", item)
+		}
+		mapping := GroupRole{
+			Group: strings.TrimSpace(item[:colon]),
+			Role:  models.UserRole(strings.TrimSpace(item[colon+1:])),
+		}
+		if !models.ValidRole(mapping.Role) {
+			return nil, fmt.Errorf("unknown role %q in group mapping %q", mapping.Role, item)
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// matches reports whether the group with DN dn is the mapping's group.
+// Directories differ in the case of DNs, so the comparison ignores it.
+func (g GroupRole) matches(dn string) bool {
+	if strings.EqualFold(g.Group, dn) {
+		return true
+	}
+	if strings.Contains(g.Group, "=") {
+		return false
+	}
+	first, _, _ := strings.Cut(dn, ",")
+	_, name, ok := strings.Cut(first, "=")
+	return ok && strings.EqualFold(strings.TrimSpace(name), g.Group)
+}
+
+// LDAPDirectory is an LDAP or Active Directory server Login checks
+// passwords against, and how its users are admitted
+type LDAPDirectory struct {
+	*auth.LDAPAuthenticator
+	GroupRoles []GroupRole // Roles from group membership; users in none get the student role
+	Order      string      // LDAPFirst or LDAPLast
+}
+
+// role returns the highest role the mappings give members of groups, and
+// whether any mapping matched
+func (d *LDAPDirectory) role(groups []string) (models.UserRole, bool) {
+	role, matched := models.RoleStudent, false
+	for _, mapping := range d.GroupRoles {
+		for _, dn := range groups {
+			if mapping.matches(dn) && (!matched || roleRank[mapping.Role] > roleRank[role]) {
+				role, matched = mapping.Role, true
+			}
+		}
+	}
+	return role, matched
+}
+
+// tryLDAP checks req against the directory, when one is configured for
+// order, and logs the user in when it accepts them. It returns false,
+// having written nothing, when the directory does not know the user, the
+// password is wrong or the directory cannot be reached, so that Login can
+// go on with local passwords.
+func (s *Server) tryLDAP(w http.ResponseWriter, r *http.Request, req *models.UserLogin, order string) bool {
+	if s.ldap == nil || s.ldap.Order != order {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.ldap.Timeout)
+	defer cancel()
+
+	entry, err := s.ldap.Authenticate(ctx, req.Email, req.Password)
+	if err != nil {
+		if !errors.Is(err, auth.ErrLDAPInvalidCredentials) {
+			log.Printf("Error checking %s against the directory: %v", req.Email, err)
+		}
+		return false
+	}
+	if entry.Email == "" {
+		log.Printf("Directory entry %s has no %s attribute, cannot log in", entry.DN, s.ldap.EmailAttribute)
+		return false
+	}
+
+	role, matched := s.ldap.role(entry.Groups)
+	s.externalLogin(w, r, &externalIdentity{
+		email:    entry.Email,
+		fullName: entry.FullName,
+		role:     role,
+		syncRole: matched,
+		via:      "ldap",
+	}, models.AuditLDAPLogin)
+	return true
+}
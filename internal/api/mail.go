@@ -0,0 +1,75 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/mail"
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+const (
+	defaultMailFrom  = "FCCUR <no-reply@localhost>"
+	defaultPublicURL = "http://localhost:8080"
+	mailTimeFormat   = "2006-01-02 15:04 MST"
+)
+
+// sendMail renders template name for user, in the language the request
+// asks for, and sends it in the background so that slow mail servers do not
+// delay the response. Failures are logged.
+func (s *Server) sendMail(r *http.Request, user *models.User, name string, data map[string]interface{}) {
+	data["Name"] = user.FullName
+	lang := mail.Language(r.Header.Get("Accept-Language"), s.mailLanguage)
+	msg, err := mail.Render(lang, name, user.Email, data)
+	if err != nil {
+		log.Printf("Error rendering %s email: %v", name, err)
+		return
+	}
+
+	go func() {
+		if err := s.mailer.Send(msg); err != nil {
+			log.Printf("Error sending %s email to user %d: %v", name, user.ID, err)
+		}
+	}()
+}
+
+// sendVerificationEmail mails user the link that confirms their address
+func (s *Server) sendVerificationEmail(r *http.Request, user *models.User, token string) {
+	s.sendMail(r, user, mail.TemplateVerifyEmail, map[string]interface{}{
+		"Link": s.publicURL + "/auth.html?verify=" + token,
+	})
+}
+
+// sendPasswordResetEmail mails user the link to choose a new password
+func (s *Server) sendPasswordResetEmail(r *http.Request, user *models.User, token string, expiry time.Time) {
+	s.sendMail(r, user, mail.TemplatePasswordReset, map[string]interface{}{
+		"Link":    s.publicURL + "/auth.html?token=" + token,
+		"Expires": expiry.UTC().Format(mailTimeFormat),
+	})
+}
+
+// notifyNewLogin mails user about a login from a device that holds none of
+// their open sessions, compared by IP address and user agent. Call it
+// before creating the login's own session.
+func (s *Server) notifyNewLogin(r *http.Request, user *models.User) {
+	ip, userAgent := clientIP(r), r.UserAgent()
+
+	sessions, err := s.db.ListUserSessions(user.ID)
+	if err != nil {
+		log.Printf("Error listing sessions of user %d: %v", user.ID, err)
+		return
+	}
+	for _, session := range sessions {
+		if hostOnly(session.IPAddress) == ip && session.UserAgent == userAgent {
+			return
+		}
+	}
+
+	s.sendMail(r, user, mail.TemplateNewLogin, map[string]interface{}{
+		"Time":      time.Now().UTC().Format(mailTimeFormat),
+		"IPAddress": ip,
+		"UserAgent": userAgent,
+		"Link":      s.publicURL + "/auth.html",
+	})
+}
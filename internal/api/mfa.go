@@ -0,0 +1,535 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+const (
+	mfaIssuer            = "FCCUR" // Account label shown by authenticator apps
+	mfaChallengeExpiry   = 5 * time.Minute
+	mfaChallengeAttempts = 5 // Wrong codes before the password must be entered again
+	recoveryCodeCount    = 10
+)
+
+// MFAConfig decides which users must use two-factor authentication
+type MFAConfig struct {
+	RequiredRoles []models.UserRole // Users with these roles cannot log in without MFA
+}
+
+// required reports whether user must have MFA enabled
+func (c MFAConfig) required(user *models.User) bool {
+	return hasAnyRole(c.RequiredRoles, user.Role)
+}
+
+// MFAChallengeResponse is returned by a login whose password was correct
+// but which needs a second step. With mfa_required, POST the mfa_token and
+// a code to /api/auth/mfa/verify; with mfa_setup_required, use it to enroll
+// through /api/auth/mfa/setup and /api/auth/mfa/enable.
+type MFAChallengeResponse struct {
+	MFARequired      bool   `json:"mfa_required,omitempty"`
+	MFASetupRequired bool   `json:"mfa_setup_required,omitempty"`
+	MFAToken         string `json:"mfa_token"`
+	ExpiresIn        int64  `json:"expires_in"` // seconds
+}
+
+// MFASetupResponse holds a new TOTP secret, to be confirmed with a code
+type MFASetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI to show as a QR code
+}
+
+// MFAEnableResponse returns the recovery codes of a new enrollment, shown
+// only once. When enrolling during login it also carries the login's tokens.
+type MFAEnableResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	*models.AuthResponse
+}
+
+// MFAStatus describes the current user's two-factor authentication
+type MFAStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// MFARequest carries a challenge token and/or a code to the MFA endpoints
+type MFARequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`          // TOTP code
+	RecoveryCode string `json:"recovery_code"` // Instead of code, on /api/auth/mfa/verify
+	Password     string `json:"password"`      // On /api/auth/mfa/disable
+}
+
+// mfaChallenge is a login waiting for its second factor
+type mfaChallenge struct {
+	userID   int64
+	action   string // Audit action of the login, e.g. models.AuditLogin
+	setup    bool   // The user must enroll before logging in
+	expires  time.Time
+	attempts int
+}
+
+// MFAChallenges holds pending second-factor logins in memory
+type MFAChallenges struct {
+	mu         sync.Mutex
+	challenges map[string]*mfaChallenge
+}
+
+// NewMFAChallenges creates an empty challenge store
+func NewMFAChallenges() *MFAChallenges {
+	return &MFAChallenges{challenges: make(map[string]*mfaChallenge)}
+}
+
+// create stores c under a new random token
+func (m *MFAChallenges) create(c *mfaChallenge) (string, error) {
+	token, err := auth.GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+	c.expires = time.Now().Add(mfaChallengeExpiry)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for t, other := range m.challenges {
+		if now.After(other.expires) {
+			delete(m.challenges, t)
+		}
+	}
+	m.challenges[token] = c
+	return token, nil
+}
+
+// get returns the unexpired challenge of token, or nil
+func (m *MFAChallenges) get(token string) *mfaChallenge {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.challenges[token]
+	if !ok || time.Now().After(c.expires) {
+		return nil
+	}
+	return c
+}
+
+// fail counts a wrong code against token, dropping the challenge after
+// mfaChallengeAttempts failures
+func (m *MFAChallenges) fail(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.challenges[token]; ok {
+		c.attempts++
+		if c.attempts >= mfaChallengeAttempts {
+			delete(m.challenges, token)
+		}
+	}
+}
+
+// remove ends the challenge of token
+func (m *MFAChallenges) remove(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.challenges, token)
+}
+
+// finishLogin completes a login whose first factor (password or OAuth2)
+// succeeded. Users with MFA get a challenge for their code, users that
+// must enroll get a setup challenge, and everyone else is logged in.
+func (s *Server) finishLogin(w http.ResponseWriter, r *http.Request, user *models.User, action string) {
+	if !user.MFAEnabled && !s.mfa.required(user) {
+		s.completeLogin(w, r, user, action)
+		return
+	}
+
+	c := &mfaChallenge{userID: user.ID, action: action, setup: !user.MFAEnabled}
+	token, err := s.mfaChallenges.create(c)
+	if err != nil {
+		log.Printf("Error creating MFA challenge: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, MFAChallengeResponse{
+		MFARequired:      !c.setup,
+		MFASetupRequired: c.setup,
+		MFAToken:         token,
+		ExpiresIn:        int64(mfaChallengeExpiry.Seconds()),
+	})
+}
+
+// mfaUser returns the user an MFA enrollment request acts for: the holder
+// of a setup challenge's mfa_token, or else the logged-in user. challenge
+// is empty for the latter. It writes the error response and returns false
+// when there is neither.
+func (s *Server) mfaUser(w http.ResponseWriter, r *http.Request, req *MFARequest) (*models.User, string, bool) {
+	if req.MFAToken != "" {
+		c := s.mfaChallenges.get(req.MFAToken)
+		if c == nil || !c.setup {
+			respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or expired MFA token"})
+			return nil, "", false
+		}
+		user, err := s.db.GetUserByID(c.userID)
+		if err != nil {
+			log.Printf("Error getting user %d: %v", c.userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return nil, "", false
+		}
+		return user, req.MFAToken, true
+	}
+
+	user, ok := s.currentUser(w, r)
+	return user, "", ok
+}
+
+// decodeMFARequest reads an MFARequest body, writing the error response and
+// returning false when it is malformed
+func decodeMFARequest(w http.ResponseWriter, r *http.Request) (*MFARequest, bool) {
+	var req MFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return nil, false
+	}
+	return &req, true
+}
+
+// checkTOTP validates code for user and consumes its time step, so that a
+// code works only once
+func (s *Server) checkTOTP(user *models.User, code string) bool {
+	step, ok := auth.ValidateTOTP(user.MFASecret, code, time.Now())
+	if !ok {
+		return false
+	}
+	fresh, err := s.db.UseTOTPStep(user.ID, step)
+	if err != nil {
+		log.Printf("Error recording TOTP step of user %d: %v", user.ID, err)
+		return false
+	}
+	return fresh
+}
+
+// newRecoveryCodes generates recovery codes and their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// GetMFAStatus reports whether the current user has MFA enabled, whether
+// they must, and how many recovery codes they have left (GET)
+func (s *Server) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	status := MFAStatus{Enabled: user.MFAEnabled, Required: s.mfa.required(user)}
+	if user.MFAEnabled {
+		n, err := s.db.CountRecoveryCodes(user.ID)
+		if err != nil {
+			log.Printf("Error counting recovery codes of user %d: %v", user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		status.RecoveryCodesLeft = n
+	}
+	respondJSON(w, http.StatusOK, status)
+}
+
+// SetupMFA starts TOTP enrollment (POST) for the logged-in user, or for the
+// holder of a setup challenge's mfa_token. It returns a new secret and its
+// provisioning URI; MFA is enabled once a code is confirmed with EnableMFA.
+func (s *Server) SetupMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, ok := decodeMFARequest(w, r)
+	if !ok {
+		return
+	}
+	user, _, ok := s.mfaUser(w, r, req)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.SetUserMFASecret(user.ID, secret); err != nil {
+		log.Printf("Error storing TOTP secret of user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, MFASetupResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(mfaIssuer, user.Email, secret),
+	})
+}
+
+// EnableMFA confirms enrollment with a code from the authenticator app
+// (POST) and returns the recovery codes. With a setup challenge's
+// mfa_token it also completes the login.
+func (s *Server) EnableMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, ok := decodeMFARequest(w, r)
+	if !ok {
+		return
+	}
+	user, challenge, ok := s.mfaUser(w, r, req)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.MFASecret == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Start enrollment with /api/auth/mfa/setup first"})
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(user.MFASecret, req.Code, time.Now())
+	if !valid {
+		if challenge != "" {
+			s.mfaChallenges.fail(challenge)
+		}
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.EnableUserMFA(user.ID, step, hashes); err != nil {
+		log.Printf("Error enabling MFA for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	user.MFAEnabled = true
+	s.auditUser(r, user, models.AuditMFAEnable, nil)
+
+	if challenge == "" {
+		respondJSON(w, http.StatusOK, MFAEnableResponse{RecoveryCodes: codes})
+		return
+	}
+
+	// Enrolled during login: finish it
+	c := s.mfaChallenges.get(challenge)
+	s.mfaChallenges.remove(challenge)
+	action := models.AuditLogin
+	if c != nil {
+		action = c.action
+	}
+	token, err := s.issueTokens(r, user, action)
+	if err != nil {
+		log.Printf("Error completing login of user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, MFAEnableResponse{RecoveryCodes: codes, AuthResponse: token})
+}
+
+// VerifyMFA completes a login challenged for its second factor (POST
+// {"mfa_token", "code"}, or "recovery_code" instead of "code")
+func (s *Server) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, ok := decodeMFARequest(w, r)
+	if !ok {
+		return
+	}
+	c := s.mfaChallenges.get(req.MFAToken)
+	if c == nil || c.setup {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	user, err := s.db.GetUserByID(c.userID)
+	if err != nil {
+		log.Printf("Error getting user %d: %v", c.userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !user.IsActive {
+		s.mfaChallenges.remove(req.MFAToken)
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "Account is deactivated"})
+		return
+	}
+
+	var valid bool
+	if req.RecoveryCode != "" {
+		valid, err = s.db.UseRecoveryCode(user.ID, auth.HashRecoveryCode(req.RecoveryCode))
+		if err != nil {
+			log.Printf("Error using recovery code of user %d: %v", user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if valid {
+			s.auditUser(r, user, models.AuditMFARecoveryCodeUsed, nil)
+		}
+	} else {
+		valid = user.MFAEnabled && s.checkTOTP(user, req.Code)
+	}
+
+	if !valid {
+		s.mfaChallenges.fail(req.MFAToken)
+		s.auditLoginFailed(r, user.Email, user, "wrong MFA code")
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid code"})
+		return
+	}
+
+	s.mfaChallenges.remove(req.MFAToken)
+	s.completeLogin(w, r, user, c.action)
+}
+
+// DisableMFA turns off two-factor authentication for the current user
+// (POST {"password", "code"}). Users whose role requires MFA cannot.
+func (s *Server) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeMFARequest(w, r)
+	if !ok {
+		return
+	}
+
+	if !user.MFAEnabled {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if s.mfa.required(user) {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+	// Accounts created through OAuth2 have no password
+	if user.PasswordHash != "" && !auth.CheckPassword(req.Password, user.PasswordHash) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Current password is incorrect"})
+		return
+	}
+	if !s.checkTOTP(user, req.Code) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid code"})
+		return
+	}
+
+	if err := s.db.DisableUserMFA(user.ID); err != nil {
+		log.Printf("Error disabling MFA for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.auditUser(r, user, models.AuditMFADisable, nil)
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes (POST
+// {"code"}) and returns the new ones
+func (s *Server) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeMFARequest(w, r)
+	if !ok {
+		return
+	}
+
+	if !user.MFAEnabled {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !s.checkTOTP(user, req.Code) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		log.Printf("Error replacing recovery codes of user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.auditUser(r, user, models.AuditMFARecoveryCodes, nil)
+
+	respondJSON(w, http.StatusOK, MFAEnableResponse{RecoveryCodes: codes})
+}
+
+// ResetUserMFA turns off two-factor authentication for the user ?id=
+// (POST), e.g. after they lose their device and recovery codes, and ends
+// their sessions. If their role requires MFA they enroll again at their
+// next login. Admin only.
+func (s *Server) ResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.db.DisableUserMFA(user.ID); err != nil {
+		s.userUpdateError(w, user.ID, err)
+		return
+	}
+	if err := s.endUserSessions(user.ID); err != nil {
+		log.Printf("Error deleting sessions of user %d: %v", user.ID, err)
+	}
+
+	log.Printf("MFA reset for user %d (%s)", user.ID, user.Email)
+	s.audit(r, models.AuditUserResetMFA, models.AuditTargetUser, auditID(user.ID), nil)
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication reset"})
+}
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+// maxReviewReason bounds the reason given when reviewing a package
+const maxReviewReason = 1000
+
+// ModerationConfig decides which uploads are held for admin approval
+// before they are published. An upload is held when its uploader's role is
+// in Roles or its category is moderated, unless the role is trusted.
+type ModerationConfig struct {
+	Roles        []models.UserRole // Uploads by these roles are always reviewed
+	TrustedRoles []models.UserRole // Uploads by these roles are never reviewed
+}
+
+// needsReview reports whether an upload by role to category must be
+// approved first. category may be nil.
+func (c ModerationConfig) needsReview(role models.UserRole, category *models.Category) bool {
+	if hasAnyRole(c.TrustedRoles, role) {
+		return false
+	}
+	return hasAnyRole(c.Roles, role) || category != nil && category.Moderated
+}
+
+func hasAnyRole(roles []models.UserRole, role models.UserRole) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRoles parses a comma-separated list of roles, e.g. "professor,admin"
+func ParseRoles(list string) ([]models.UserRole, error) {
+	var roles []models.UserRole
+	for _, name := range strings.Split(list, ",") {
+		role := models.UserRole(strings.TrimSpace(name))
+		if role == "" {
+			continue
+		}
+		if !models.ValidRole(role) {
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// ReviewRequest approves or rejects a package held for review
+type ReviewRequest struct {
+	Action string `json:"action"` // "approve" or "reject"
+	Reason string `json:"reason"` // Required when rejecting
+}
+
+// holdForReview records the uploader of a new package and marks it pending
+// when moderation applies to the uploader or the package's category
+func (s *Server) holdForReview(pkg *models.Package, uploader *models.User) {
+	pkg.UploadedBy = uploader.ID
+	pkg.Status = models.StatusPublished
+
+	category, err := s.db.GetCategory(pkg.Category)
+	if err != nil {
+		log.Printf("Error loading category %s for moderation: %v", pkg.Category, err)
+		category = nil
+	}
+	if s.moderation.needsReview(uploader.Role, category) {
+		pkg.Status = models.StatusPending
+	}
+}
+
+// notifyPending tells the uploader of a new package held for review
+func (s *Server) notifyPending(pkg *models.Package) {
+	if pkg.Status != models.StatusPending {
+		return
+	}
+	log.Printf("Package %d (%s %s) held for review", pkg.ID, pkg.Name, pkg.Version)
+	s.notify(pkg.UploadedBy, models.NotifyPackagePending, pkg.ID,
+		fmt.Sprintf("%s %s is awaiting review by an administrator", pkg.Name, pkg.Version))
+}
+
+// notify stores a notification for a user. Failures are logged; they never
+// fail the action being reported.
+func (s *Server) notify(userID int64, kind string, packageID int64, message string) {
+	if userID == 0 {
+		return
+	}
+	n := &models.Notification{UserID: userID, Kind: kind, Message: message, PackageID: packageID}
+	if err := s.db.CreateNotification(n); err != nil {
+		log.Printf("Error notifying user %d: %v", userID, err)
+	}
+}
+
+// GetModerationQueue lists packages awaiting review (?status=pending, the
+// default) or rejected ones (?status=rejected). Admins see every upload;
+// professors see their own. Accepts the filters, sort and pagination of
+// GET /api/packages.
+func (s *Server) GetModerationQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	q, err := parsePackageQuery(r)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	q.Status = models.PackageStatus(r.URL.Query().Get("status"))
+	if q.Status == "" {
+		q.Status = models.StatusPending
+	}
+	if q.Status == models.StatusPublished || !models.ValidPackageStatus(q.Status) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid status (pending, rejected)"})
+		return
+	}
+
+	q.Viewer = user.Viewer()
+	if !user.IsAdminRole() {
+		q.UploadedBy = user.ID
+	}
+
+	page, err := s.db.ListPackages(q)
+	if err != nil {
+		log.Printf("Error listing moderation queue: %v", err)
+		http.Error(w, "Error fetching packages", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, packageListResponse(q, page))
+}
+
+// ReviewPackage approves or rejects a package held for review
+// (POST ?id=) and notifies its uploader. Rejected packages may be approved
+// later. Admin only.
+func (s *Server) ReviewPackage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	var status models.PackageStatus
+	switch req.Action {
+	case "approve":
+		status = models.StatusPublished
+	case "reject":
+		status = models.StatusRejected
+		if req.Reason == "" {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "A reason is required to reject a package"})
+			return
+		}
+	default:
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid action (approve, reject)"})
+		return
+	}
+	if len(req.Reason) > maxReviewReason {
+		respondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("Reason must be at most %d characters", maxReviewReason),
+		})
+		return
+	}
+
+	reviewer, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	pkg, err := s.db.GetPackage(id)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Package not found"})
+		return
+	}
+	if pkg.Published() {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Package is already published"})
+		return
+	}
+
+	if err := s.db.ReviewPackage(id, status, req.Reason, reviewer.ID); err != nil {
+		if err == storage.ErrPackageNotFound {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "Package not found"})
+			return
+		}
+		log.Printf("Error reviewing package %d: %v", id, err)
+		http.Error(w, "Error reviewing package", http.StatusInternalServerError)
+		return
+	}
+
+	s.cache.Invalidate()
+	log.Printf("Package %d %sd by %s", id, req.Action, reviewer.Email)
+	s.audit(r, models.AuditPackageReview, models.AuditTargetPackage, auditID(id), map[string]interface{}{
+		"status": models.AuditChange{Old: pkg.Status, New: status},
+		"reason": req.Reason,
+	})
+
+	if status == models.StatusPublished {
+		s.notify(pkg.UploadedBy, models.NotifyPackageApproved, id,
+			fmt.Sprintf("%s %s was approved and is now published", pkg.Name, pkg.Version))
+	} else {
+		s.notify(pkg.UploadedBy, models.NotifyPackageRejected, id,
+			fmt.Sprintf("%s %s was rejected: %s", pkg.Name, pkg.Version, req.Reason))
+	}
+
+	pkg, err = s.db.GetPackage(id)
+	if err != nil {
+		log.Printf("Error reloading package %d: %v", id, err)
+		http.Error(w, "Error fetching package", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, pkg)
+}
+
+// Notifications lists the current user's notifications (GET, ?unread=true
+// for unread only) and marks them read (POST ?id=, or every notification
+// without id)
+func (s *Server) Notifications(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		limit := defaultPageSize
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+				return
+			}
+			limit = min(n, maxPageSize)
+		}
+
+		unread := r.URL.Query().Get("unread") == "true"
+		notifications, err := s.db.ListNotifications(user.ID, unread, limit)
+		if err != nil {
+			log.Printf("Error listing notifications: %v", err)
+			http.Error(w, "Error fetching notifications", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, notifications)
+
+	case http.MethodPost:
+		var id int64
+		if v := r.URL.Query().Get("id"); v != "" {
+			var err error
+			if id, err = strconv.ParseInt(v, 10, 64); err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := s.db.MarkNotificationsRead(user.ID, id); err != nil {
+			log.Printf("Error marking notifications read: %v", err)
+			http.Error(w, "Error updating notifications", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+func TestUploadHeldForReview(t *testing.T) {
+	e := newTestEnv(t)
+	e.srv.SetModeration(ModerationConfig{Roles: []models.UserRole{models.RoleProfessor}})
+	prof, _ := e.login("prof@uni.edu")
+	admin, _ := e.login("admin@uni.edu")
+
+	resp, body := e.sendForm(http.MethodPost, "/api/upload", prof, "package", "tool.zip", []byte("PK tool"),
+		map[string]string{"name": "Herramienta", "version": "1.0", "category": "tool", "content_type": "tool"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: %d %s", resp.StatusCode, body)
+	}
+	var pkg models.Package
+	e.decode(body, &pkg)
+	if pkg.Status != models.StatusPending {
+		t.Fatalf("upload by a moderated role has status %q, want pending", pkg.Status)
+	}
+	assertPendingNotice(t, e, prof, pkg.ID)
+
+	get := fmt.Sprintf("/api/packages/?id=%d", pkg.ID)
+	if resp, _ := e.do(http.MethodGet, get, "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("anonymous GET of a pending package: got %d, want 404", resp.StatusCode)
+	}
+
+	review := fmt.Sprintf("/api/admin/moderation/review?id=%d", pkg.ID)
+	if resp, body := e.do(http.MethodPost, review, admin, `{"action": "approve"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("approve: %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := e.do(http.MethodGet, get, "", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("anonymous GET of an approved package: got %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestReplaceHeldForReview(t *testing.T) {
+	e := newTestEnv(t)
+	e.srv.SetModeration(ModerationConfig{Roles: []models.UserRole{models.RoleProfessor}})
+	pkg := newCoursePackage(t, e, "Apuntes", "Redes", models.VisibilityPublic)
+	assignCourses(t, e, "prof@uni.edu", "Redes")
+	prof, _ := e.login("prof@uni.edu")
+
+	path := fmt.Sprintf("/api/packages/replace?id=%d", pkg.ID)
+	resp, body := e.sendForm(http.MethodPost, path, prof, "package", "apuntes.zip", []byte("PK new notes"), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("replace: %d %s", resp.StatusCode, body)
+	}
+	var result struct {
+		Package models.Package `json:"package"`
+	}
+	e.decode(body, &result)
+	if result.Package.Status != models.StatusPending {
+		t.Fatalf("package with a replaced file has status %q, want pending", result.Package.Status)
+	}
+	assertPendingNotice(t, e, prof, pkg.ID)
+
+	// The unreviewed file is not served in place of the published one
+	if resp, _ := e.do(http.MethodGet, fmt.Sprintf("/api/packages/?id=%d", pkg.ID), "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("anonymous GET after replace: got %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestReplaceKeepsStatusWithoutModeration(t *testing.T) {
+	e := newTestEnv(t)
+	pkg := newCoursePackage(t, e, "Apuntes", "Redes", models.VisibilityPublic)
+	if err := e.db.ReviewPackage(pkg.ID, models.StatusRejected, "Incompleto", e.user("admin@uni.edu").ID); err != nil {
+		t.Fatal(err)
+	}
+	admin, _ := e.login("admin@uni.edu")
+
+	path := fmt.Sprintf("/api/packages/replace?id=%d", pkg.ID)
+	if resp, body := e.sendForm(http.MethodPost, path, admin, "package", "apuntes.zip", []byte("PK"), nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("replace: %d %s", resp.StatusCode, body)
+	}
+	if got, _ := e.db.GetPackage(pkg.ID); got.Status != models.StatusRejected {
+		t.Errorf("rejected package has status %q after its file was replaced, want rejected", got.Status)
+	}
+}
+
+// assertPendingNotice checks the user of token was told package id awaits
+// review
+func assertPendingNotice(t *testing.T, e *testEnv, token string, id int64) {
+	t.Helper()
+	resp, body := e.do(http.MethodGet, "/api/notifications", token, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("notifications: %d %s", resp.StatusCode, body)
+	}
+	var notifications []models.Notification
+	e.decode(body, &notifications)
+	for _, n := range notifications {
+		if n.Kind == models.NotifyPackagePending && n.PackageID == id {
+			return
+		}
+	}
+	t.Errorf("no pending notice for package %d in %+v", id, notifications)
+}
@@ -105,21 +105,45 @@ func (s *Server) OAuth2Callback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := userInfo.GetEmail()
-	fullName := userInfo.GetFullName()
+	s.externalLogin(w, r, &externalIdentity{
+		email:    userInfo.GetEmail(),
+		fullName: userInfo.GetFullName(),
+		role:     models.RoleStudent,
+		via:      "oauth2",
+	}, models.AuditOAuth2Login)
+}
+
+// externalIdentity is a user an identity provider vouched for
+type externalIdentity struct {
+	email    string
+	fullName string
+	role     models.UserRole // Given to new accounts, or to existing ones with syncRole
+	syncRole bool            // The provider decides the role on every login
+	via      string          // Names the provider in the audit log
+}
+
+// externalLogin logs in the user an identity provider vouched for, creating
+// the account on first login, and writes the response
+func (s *Server) externalLogin(w http.ResponseWriter, r *http.Request, id *externalIdentity, action string) {
+	email := id.email
 
 	// Check if user exists
 	user, err := s.db.GetUserByEmail(email)
 	if err != nil {
 		if err == storage.ErrUserNotFound {
-			// Create new user with student role by default
-			user, err = s.db.CreateUser(email, "", fullName, models.RoleStudent)
+			if !s.verification.domainAllowed(email) {
+				s.rejectRegistration(w)
+				return
+			}
+
+			user, err = s.db.CreateUser(email, "", id.fullName, id.role)
 			if err != nil {
-				log.Printf("Error creating OAuth2 user: %v", err)
+				log.Printf("Error creating %s user: %v", id.via, err)
 				http.Error(w, "Failed to create user", http.StatusInternalServerError)
 				return
 			}
-			log.Printf("Created new OAuth2 user: %s", email)
+			log.Printf("Created new %s user: %s", id.via, email)
+			s.auditUser(r, user, models.AuditRegister, map[string]string{"via": id.via})
 		} else {
 			log.Printf("Error getting user: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -129,47 +153,42 @@ func (s *Server) OAuth2Callback(w http.ResponseWriter, r *http.Request) {
 
 	// Check if user is active
 	if !user.IsActive {
+		s.auditLoginFailed(r, email, user, "account deactivated")
 		respondJSON(w, http.StatusForbidden, map[string]string{
 			"error": "Account is deactivated",
 		})
 		return
 	}
 
-	// Generate JWT tokens
-	jwtToken, expiresAt, err := s.jwtManager.GenerateToken(user.ID, user.Email, string(user.Role), user.IsAdmin)
-	if err != nil {
-		log.Printf("Error generating token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	refreshToken, err := s.jwtManager.GenerateRefreshToken()
-	if err != nil {
-		log.Printf("Error generating refresh token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+	if id.syncRole && user.Role != id.role {
+		if err := s.db.UpdateUserRole(user.ID, id.role); err != nil {
+			log.Printf("Error updating role of user %d: %v", user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		s.auditUser(r, user, models.AuditUserUpdate, map[string]interface{}{
+			"role": models.AuditChange{Old: user.Role, New: id.role},
+			"via":  id.via,
+		})
+		user.Role = id.role
 
-	// Create session
-	ipAddress := getIPAddress(r)
-	userAgent := r.UserAgent()
-	_, err = s.db.CreateSession(user.ID, jwtToken, refreshToken, ipAddress, userAgent, expiresAt)
-	if err != nil {
-		log.Printf("Error creating session: %v", err)
+		// Live tokens carry the old role, as when an admin changes it
+		if err := s.endUserSessions(user.ID); err != nil {
+			log.Printf("Error deleting sessions of user %d: %v", user.ID, err)
+		}
 	}
 
-	// Update last login
-	if err := s.db.UpdateUserLastLogin(user.ID); err != nil {
-		log.Printf("Error updating last login: %v", err)
+	// The identity provider vouches for the address
+	if !user.EmailVerified {
+		if err := s.db.SetUserEmailVerified(user.ID); err != nil {
+			log.Printf("Error verifying email of user %d: %v", user.ID, err)
+		} else {
+			user.EmailVerified = true
+		}
 	}
 
-	// Return auth response
-	respondJSON(w, http.StatusOK, models.AuthResponse{
-		Token:        jwtToken,
-		RefreshToken: refreshToken,
-		User:         user,
-		ExpiresIn:    int64(s.jwtManager.GetAccessExpiration().Seconds()),
-	})
+	// Staff may need a second factor before getting tokens
+	s.finishLogin(w, r, user, action)
 }
 
 // OAuth2Config returns OAuth2 configuration status
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+const (
+	oidcLoginExpiry = 10 * time.Minute
+	oidcStateCookie = "oidc_state"
+)
+
+// roleRank orders roles for claim mapping, where the highest match wins
+var roleRank = map[models.UserRole]int{
+	models.RoleGuest:     0,
+	models.RoleStudent:   1,
+	models.RoleProfessor: 2,
+	models.RoleAdmin:     3,
+}
+
+// RoleRule gives Role to users whose Claim holds Value. Claim is a dotted
+// path into the ID token, e.g. "realm_access.roles"; a list claim matches
+// when any element equals Value.
+type RoleRule struct {
+	Claim string
+	Value string
+	Role  models.UserRole
+}
+
+// ParseRoleRules parses comma-separated claim=value:role rules, e.g.
+// "groups=fccur-admins:admin,realm_access.roles=teacher:professor"
+func ParseRoleRules(list string) ([]RoleRule, error) {
+	var rules []RoleRule
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eq := strings.Index(item, "=")
+		colon := strings.LastIndex(item, ":")
+		if eq <= 0 || colon < eq {
+			return nil, fmt.Errorf("role rule %q is not claim=value:role", item)
+		}
+		rule := RoleRule{
+			Claim: strings.TrimSpace(item[:eq]),
+			Value: strings.TrimSpace(item[eq+1 : colon]),
+			Role:  models.UserRole(strings.TrimSpace(item[colon+1:])),
+		}
+		if !models.ValidRole(rule.Role) {
+			return nil, fmt.Errorf("unknown role %q in role rule %q", rule.Role, item)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// matches reports whether claims satisfy the rule
+func (r RoleRule) matches(claims auth.OIDCClaims) bool {
+	value, ok := claims.Lookup(r.Claim)
+	if !ok {
+		return false
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if fmt.Sprint(item) == r.Value {
+				return true
+			}
+		}
+		return false
+	default:
+		return fmt.Sprint(v) == r.Value
+	}
+}
+
+// OIDCProvider is an OpenID Connect provider users can log in with, and
+// how its users are admitted
+type OIDCProvider struct {
+	*auth.OIDCProvider
+	RoleRules  []RoleRule // Roles from claims; users matching none get the student role
+	TrustEmail bool       // Accept email addresses without an email_verified claim
+}
+
+// role returns the highest role the rules give claims, and whether any rule
+// matched
+func (p *OIDCProvider) role(claims auth.OIDCClaims) (models.UserRole, bool) {
+	role, matched := models.RoleStudent, false
+	for _, rule := range p.RoleRules {
+		if rule.matches(claims) && (!matched || roleRank[rule.Role] > roleRank[role]) {
+			role, matched = rule.Role, true
+		}
+	}
+	return role, matched
+}
+
+// oidcLogin is a login waiting for the provider to redirect back
+type oidcLogin struct {
+	provider string
+	nonce    string
+	verifier string // PKCE code verifier
+	expires  time.Time
+}
+
+// OIDCLogins holds logins in progress by state. The nonce and PKCE
+// verifier never leave the server.
+type OIDCLogins struct {
+	mu     sync.Mutex
+	logins map[string]*oidcLogin
+}
+
+// NewOIDCLogins creates an empty login store
+func NewOIDCLogins() *OIDCLogins {
+	return &OIDCLogins{logins: make(map[string]*oidcLogin)}
+}
+
+// create stores l under state
+func (o *OIDCLogins) create(state string, l *oidcLogin) {
+	l.expires = time.Now().Add(oidcLoginExpiry)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	for s, other := range o.logins {
+		if now.After(other.expires) {
+			delete(o.logins, s)
+		}
+	}
+	o.logins[state] = l
+}
+
+// take removes and returns the unexpired login of state, or nil, so that
+// a state is only ever used once
+func (o *OIDCLogins) take(state string) *oidcLogin {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	l, ok := o.logins[state]
+	delete(o.logins, state)
+	if !ok || time.Now().After(l.expires) {
+		return nil
+	}
+	return l
+}
+
+// oidcProvider returns the configured provider called name, or nil
+func (s *Server) oidcProvider(name string) *OIDCProvider {
+	for _, p := range s.oidcProviders {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// OIDCProviders lists the OpenID Connect providers for login buttons
+func (s *Server) OIDCProviders(w http.ResponseWriter, r *http.Request) {
+	providers := []map[string]string{}
+	for _, p := range s.oidcProviders {
+		providers = append(providers, map[string]string{"name": p.Name, "display_name": p.DisplayName})
+	}
+	respondJSON(w, http.StatusOK, providers)
+}
+
+// OIDCLogin starts a login with the provider named by ?provider= and
+// returns the URL to send the browser to
+func (s *Server) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	p := s.oidcProvider(r.URL.Query().Get("provider"))
+	if p == nil {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Unknown identity provider"})
+		return
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := auth.GenerateOIDCSecret()
+		if err != nil {
+			log.Printf("Error generating OIDC state: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		secrets[i] = secret
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("Error starting %s login: %v", p.Name, err)
+		respondJSON(w, http.StatusBadGateway, map[string]string{"error": "Identity provider is unavailable"})
+		return
+	}
+	s.oidcLogins.create(state, &oidcLogin{provider: p.Name, nonce: nonce, verifier: verifier})
+
+	// Binds the login to this browser, against login CSRF
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(oidcLoginExpiry / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	respondJSON(w, http.StatusOK, map[string]string{"auth_url": authURL})
+}
+
+// OIDCCallback completes a login with the code and state the provider
+// redirected back with
+func (s *Server) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		desc := q.Get("error_description")
+		if desc == "" {
+			desc = e
+		}
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": desc})
+		return
+	}
+
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid state parameter"})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+
+	login := s.oidcLogins.take(state)
+	if login == nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Login expired, please try again"})
+		return
+	}
+	p := s.oidcProvider(login.provider)
+	code := q.Get("code")
+	if p == nil || code == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "No authorization code received"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	token, err := p.Exchange(ctx, code, login.verifier)
+	if err != nil {
+		log.Printf("Error exchanging %s code: %v", p.Name, err)
+		respondJSON(w, http.StatusBadGateway, map[string]string{"error": "Failed to exchange authorization code"})
+		return
+	}
+	claims, err := p.VerifyIDToken(ctx, token.IDToken, login.nonce)
+	if err != nil {
+		log.Printf("Rejected %s ID token: %v", p.Name, err)
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid ID token"})
+		return
+	}
+
+	// Some providers only put the address in the userinfo response
+	if claims.Email() == "" && token.AccessToken != "" {
+		info, err := p.UserInfo(ctx, token.AccessToken)
+		if err != nil {
+			log.Printf("Error getting %s user info: %v", p.Name, err)
+		} else if info.Subject() == claims.Subject() {
+			for name, value := range info {
+				if _, ok := claims[name]; !ok {
+					claims[name] = value
+				}
+			}
+		}
+	}
+
+	email := claims.Email()
+	verified, present := claims.EmailVerified()
+	if email == "" || (!verified && (present || !p.TrustEmail)) {
+		s.auditLoginFailed(r, email, nil, "unverified "+p.Name+" email")
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "The identity provider did not confirm your email address",
+		})
+		return
+	}
+
+	role, matched := p.role(claims)
+	s.externalLogin(w, r, &externalIdentity{
+		email:    email,
+		fullName: claims.FullName(),
+		role:     role,
+		syncRole: matched,
+		via:      "oidc:" + p.Name,
+	}, models.AuditOIDCLogin)
+}
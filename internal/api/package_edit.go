@@ -0,0 +1,240 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+// PackageUpdateRequest holds editable package metadata. With PATCH only the
+// fields present in the body are changed; PUT replaces all of them.
+type PackageUpdateRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Category    *string `json:"category"`
+	Platform    *string `json:"platform"`
+	CourseName  *string `json:"course_name"`
+	Visibility  *string `json:"visibility"`
+}
+
+// apply copies the requested values onto pkg and returns the changed fields
+func (req *PackageUpdateRequest) apply(pkg *models.Package, userID int64) []*models.PackageChange {
+	var changes []*models.PackageChange
+
+	set := func(field string, dst *string, value *string) {
+		if value == nil {
+			return
+		}
+		newValue := strings.TrimSpace(*value)
+		if newValue == *dst {
+			return
+		}
+		changes = append(changes, &models.PackageChange{
+			PackageID: pkg.ID,
+			UserID:    userID,
+			Field:     field,
+			OldValue:  *dst,
+			NewValue:  newValue,
+		})
+		*dst = newValue
+	}
+
+	set("name", &pkg.Name, req.Name)
+	set("description", &pkg.Description, req.Description)
+	set("category", &pkg.Category, req.Category)
+	set("platform", &pkg.Platform, req.Platform)
+	set("course_name", &pkg.CourseName, req.CourseName)
+
+	visibility := string(pkg.Visibility)
+	set("visibility", &visibility, req.Visibility)
+	pkg.Visibility = models.Visibility(visibility)
+
+	return changes
+}
+
+// fillMissing sets absent fields to empty values so PUT replaces
+// everything. An absent visibility keeps the current one: a client that
+// does not know the field must not publish a restricted package.
+func (req *PackageUpdateRequest) fillMissing() {
+	for _, field := range []**string{&req.Name, &req.Description, &req.Category, &req.Platform, &req.CourseName} {
+		if *field == nil {
+			empty := ""
+			*field = &empty
+		}
+	}
+}
+
+// UpdatePackage edits package metadata (PATCH or PUT, admins and course professors)
+func (s *Server) UpdatePackage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.getCurrentUser(r)
+	if err != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized - login required"})
+		return
+	}
+
+	user, err := s.db.GetUserByID(claims.UserID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	pkg, err := s.db.GetPackage(id)
+	if err != nil {
+		http.Error(w, "Package not found", http.StatusNotFound)
+		return
+	}
+
+	if !canEditPackage(claims, user, pkg) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "You don't have permission to edit this package",
+		})
+		return
+	}
+
+	var req PackageUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if r.Method == http.MethodPut {
+		req.fillMissing()
+	}
+
+	changes := req.apply(pkg, user.ID)
+
+	if pkg.Name == "" || pkg.Category == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+		return
+	}
+
+	for _, c := range changes {
+		if c.Field == "category" && !s.checkCategory(w, pkg.Category) {
+			return
+		}
+		if c.Field == "course_name" && pkg.CourseName != "" && !s.checkCourse(w, pkg.CourseName) {
+			return
+		}
+		if c.Field == "course_name" || c.Field == "visibility" {
+			if err := validateVisibility(pkg.Visibility, pkg.CourseName); err != nil {
+				respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	// Professors may only move materials into courses they teach
+	if !canEditPackage(claims, user, pkg) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "You don't have permission to move this package to that course",
+		})
+		return
+	}
+
+	if len(changes) > 0 {
+		if err := s.db.UpdatePackage(pkg, changes); err != nil {
+			if err == storage.ErrPackageNotFound {
+				http.Error(w, "Package not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("Error updating package %d: %v", id, err)
+			http.Error(w, "Error updating package", http.StatusInternalServerError)
+			return
+		}
+
+		s.cache.Invalidate()
+
+		for _, c := range changes {
+			log.Printf("Package %d edited by %s: %s %q -> %q", id, user.Email, c.Field, c.OldValue, c.NewValue)
+		}
+		s.audit(r, models.AuditPackageUpdate, models.AuditTargetPackage, auditID(id), packageChanges(changes))
+
+		// Reload to pick up the new updated_at
+		if updated, err := s.db.GetPackage(id); err == nil {
+			pkg = updated
+		}
+	}
+
+	respondJSON(w, http.StatusOK, pkg)
+}
+
+// GetPackageHistory lists metadata edits for a package to those who may
+// edit it: old values can reveal a course or visibility since changed
+func (s *Server) GetPackageHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.getCurrentUser(r)
+	if err != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized - login required"})
+		return
+	}
+
+	user, err := s.db.GetUserByID(claims.UserID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	pkg, err := s.db.GetPackage(id)
+	if err != nil {
+		http.Error(w, "Package not found", http.StatusNotFound)
+		return
+	}
+
+	if !canEditPackage(claims, user, pkg) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "You don't have permission to view the history of this package",
+		})
+		return
+	}
+
+	history, err := s.db.GetPackageHistory(id)
+	if err != nil {
+		log.Printf("Error fetching history for package %d: %v", id, err)
+		http.Error(w, "Error fetching history", http.StatusInternalServerError)
+		return
+	}
+	if history == nil {
+		history = []*models.PackageChange{}
+	}
+
+	respondJSON(w, http.StatusOK, history)
+}
+
+// canEditPackage reports whether user may edit pkg: admins always, professors
+// only for course materials of a course assigned to them. Access tokens
+// limited to some courses only edit packages of those courses.
+func canEditPackage(claims *auth.JWTClaims, user *models.User, pkg *models.Package) bool {
+	if !claims.AllowsCourse(pkg.CourseName) {
+		return false
+	}
+	if user.IsAdminRole() {
+		return true
+	}
+	if user.Role != models.RoleProfessor || pkg.CourseName == "" {
+		return false
+	}
+	return user.CanUploadToCourse(pkg.CourseName)
+}
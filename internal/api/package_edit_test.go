@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// newCoursePackage stores a package of courseName, creating the course if
+// needed, with the given visibility
+func newCoursePackage(t *testing.T, e *testEnv, name, courseName string, visibility models.Visibility) *models.Package {
+	t.Helper()
+	if _, err := e.db.GetCourseByName(courseName); err != nil {
+		if err := e.db.CreateCourse(&models.Course{Name: courseName}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkg := &models.Package{
+		Name: name, Version: "1", Category: "tool", ContentType: "course_material",
+		CourseName: courseName, Visibility: visibility,
+		FilePath: "blobs/none", FileSize: 1,
+	}
+	id, err := e.db.CreatePackage(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.ID = id
+	return pkg
+}
+
+// assignCourses makes email the professor of courseNames
+func assignCourses(t *testing.T, e *testEnv, email string, courseNames ...string) {
+	t.Helper()
+	var ids []int64
+	for _, name := range courseNames {
+		course, err := e.db.GetCourseByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, course.ID)
+	}
+	if err := e.db.SetUserCourses(e.user(email).ID, ids); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackageHistoryRequiresEditPermission(t *testing.T) {
+	e := newTestEnv(t)
+	own := newCoursePackage(t, e, "Apuntes", "Redes", models.VisibilityStaff)
+	other := newCoursePackage(t, e, "Examen", "Compiladores", models.VisibilityStaff)
+	assignCourses(t, e, "prof@uni.edu", "Redes")
+
+	admin, _ := e.login("admin@uni.edu")
+	prof, _ := e.login("prof@uni.edu")
+
+	// An edit by the admin, which the professor of another course may not see
+	path := fmt.Sprintf("/api/packages/update?id=%d", other.ID)
+	if resp, body := e.do(http.MethodPatch, path, admin, `{"description": "Final de junio"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("editing as admin: %d %s", resp.StatusCode, body)
+	}
+
+	for _, tc := range []struct {
+		token string
+		pkg   *models.Package
+		want  int
+	}{
+		{admin, other, http.StatusOK},
+		{prof, own, http.StatusOK},
+		{prof, other, http.StatusForbidden},
+		{"", other, http.StatusUnauthorized},
+	} {
+		resp, body := e.do(http.MethodGet, fmt.Sprintf("/api/packages/history?id=%d", tc.pkg.ID), tc.token, "")
+		if resp.StatusCode != tc.want {
+			t.Errorf("history of %s: got %d %s, want %d", tc.pkg.Name, resp.StatusCode, body, tc.want)
+		}
+	}
+
+	_, body := e.do(http.MethodGet, fmt.Sprintf("/api/packages/history?id=%d", other.ID), admin, "")
+	var history []models.PackageChange
+	e.decode(body, &history)
+	if len(history) != 1 || history[0].Field != "description" {
+		t.Errorf("history = %+v, want the description edit", history)
+	}
+}
+
+func TestPackagePutKeepsVisibility(t *testing.T) {
+	e := newTestEnv(t)
+	pkg := newCoursePackage(t, e, "Examen", "Redes", models.VisibilityStaff)
+	admin, _ := e.login("admin@uni.edu")
+
+	// A PUT from a client that predates visibility replaces everything else
+	path := fmt.Sprintf("/api/packages/update?id=%d", pkg.ID)
+	resp, body := e.do(http.MethodPut, path, admin,
+		`{"name": "Examen final", "category": "tool", "course_name": "Redes"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT without visibility: %d %s", resp.StatusCode, body)
+	}
+	var updated models.Package
+	e.decode(body, &updated)
+	if updated.Visibility != models.VisibilityStaff || updated.Name != "Examen final" {
+		t.Errorf("after PUT: name %q, visibility %q; want %q, %q",
+			updated.Name, updated.Visibility, "Examen final", models.VisibilityStaff)
+	}
+
+	if resp, _ := e.do(http.MethodGet, fmt.Sprintf("/api/packages/?id=%d", pkg.ID), "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("anonymous GET of the staff package: got %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// PackageListResponse is the envelope returned by GET /api/packages
+type PackageListResponse struct {
+	Packages   []*models.Package `json:"packages"`
+	Total      int64             `json:"total"`                 // Matches across all pages
+	NextCursor string            `json:"next_cursor,omitempty"` // Absent on the last page
+}
+
+// listCursor is the decoded form of the opaque next_cursor token. It
+// records the sort it was issued for so it cannot be replayed against a
+// different order.
+type listCursor struct {
+	Sort      storage.PackageSort `json:"s"`
+	Ascending *bool               `json:"a,omitempty"`
+	storage.PackageCursor
+}
+
+func encodeListCursor(c *listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(token string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	c := &listCursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// packageFilterParams reads the listing filters shared by listing, search
+// and tag counts. tag may be repeated; packages must carry every tag.
+func packageFilterParams(params url.Values) *storage.PackageQuery {
+	return &storage.PackageQuery{
+		Category:    params.Get("category"),
+		Platform:    params.Get("platform"),
+		ContentType: params.Get("content_type"),
+		CourseName:  params.Get("course_name"),
+		Tags:        models.NormalizeTags(params["tag"]),
+	}
+}
+
+// parsePackageQuery reads filters, sort, order, limit and cursor from the
+// request's query parameters
+func parsePackageQuery(r *http.Request) (*storage.PackageQuery, error) {
+	params := r.URL.Query()
+	q := packageFilterParams(params)
+	q.Sort = storage.SortNewest
+	q.Limit = defaultPageSize
+
+	if v := params.Get("sort"); v != "" {
+		q.Sort = storage.PackageSort(v)
+		if !storage.ValidSort(q.Sort) {
+			return nil, fmt.Errorf("invalid sort %q (newest, name, size, downloads)", v)
+		}
+	}
+
+	switch v := params.Get("order"); v {
+	case "":
+	case "asc", "desc":
+		ascending := v == "asc"
+		q.Ascending = &ascending
+	default:
+		return nil, fmt.Errorf("invalid order %q (asc, desc)", v)
+	}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid limit")
+		}
+		q.Limit = min(n, maxPageSize)
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		c, err := decodeListCursor(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		if c.Sort != q.Sort || !sameDirection(c.Ascending, q.Ascending) {
+			return nil, fmt.Errorf("cursor does not match sort order")
+		}
+		q.After = &c.PackageCursor
+	}
+
+	return q, nil
+}
+
+func sameDirection(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// listCacheKey identifies a listing in PackageCache
+func listCacheKey(r *http.Request, q *storage.PackageQuery) string {
+	order := ""
+	if q.Ascending != nil {
+		order = strconv.FormatBool(*q.Ascending)
+	}
+	return fmt.Sprintf("list|%s|%s|%s|%s|%s|%s|%s|%d|%s|%s", q.Category, q.Platform, q.ContentType,
+		q.CourseName, strings.Join(q.Tags, ","), q.Sort, order, q.Limit, r.URL.Query().Get("cursor"),
+		viewerCacheKey(q.Viewer))
+}
+
+// allPackages returns every package regardless of visibility, from the
+// cache when possible
+func (s *Server) allPackages() ([]*models.Package, error) {
+	if page, ok := s.cache.Get(allPackagesKey); ok {
+		return page.Packages, nil
+	}
+
+	packages, err := s.db.GetPackages()
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Set(allPackagesKey, &storage.PackagePage{Packages: packages, Total: int64(len(packages))})
+
+	return packages, nil
+}
+
+// visiblePackages returns every published package v may see
+func (s *Server) visiblePackages(v *models.Viewer) ([]*models.Package, error) {
+	packages, err := s.allPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]*models.Package, 0, len(packages))
+	for _, pkg := range packages {
+		if pkg.Published() && pkg.VisibleTo(v) {
+			visible = append(visible, pkg)
+		}
+	}
+	return visible, nil
+}
+
+// GetPackages lists packages matching the filter query parameters, one page
+// at a time
+func (s *Server) GetPackages(w http.ResponseWriter, r *http.Request) {
+	q, err := parsePackageQuery(r)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	q.Viewer = s.viewer(r)
+
+	// Download counts change without invalidating the cache, so that order
+	// bypasses it and is always read fresh
+	key := listCacheKey(r, q)
+	cached := q.Sort != storage.SortDownloads
+	var page *storage.PackagePage
+	hit := false
+	if cached {
+		page, hit = s.cache.Get(key)
+	}
+	if !hit {
+		page, err = s.db.ListPackages(q)
+		if err != nil {
+			log.Printf("Error listing packages: %v", err)
+			http.Error(w, "Error fetching packages", http.StatusInternalServerError)
+			return
+		}
+		if cached {
+			s.cache.Set(key, page)
+		}
+	}
+
+	switch {
+	case !cached:
+		w.Header().Set("X-Cache", "BYPASS")
+	case hit:
+		w.Header().Set("X-Cache", "HIT")
+	default:
+		w.Header().Set("X-Cache", "MISS")
+	}
+	respondJSON(w, http.StatusOK, packageListResponse(q, page))
+}
+
+// packageListResponse wraps a page of q in the listing envelope
+func packageListResponse(q *storage.PackageQuery, page *storage.PackagePage) PackageListResponse {
+	resp := PackageListResponse{Packages: page.Packages, Total: page.Total}
+	if page.Next != nil {
+		resp.NextCursor = encodeListCursor(&listCursor{Sort: q.Sort, Ascending: q.Ascending, PackageCursor: *page.Next})
+	}
+	return resp
+}
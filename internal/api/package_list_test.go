@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+func TestPackageListCacheHeader(t *testing.T) {
+	e := newTestEnv(t)
+	newCoursePackage(t, e, "Apuntes", "Redes", models.VisibilityPublic)
+
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{"/api/packages?sort=name", "MISS"},
+		{"/api/packages?sort=name", "HIT"},
+		// Download counts are always read fresh
+		{"/api/packages?sort=downloads", "BYPASS"},
+		{"/api/packages?sort=downloads", "BYPASS"},
+	} {
+		resp, body := e.do(http.MethodGet, tc.path, "", "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: %d %s", tc.path, resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("X-Cache"); got != tc.want {
+			t.Errorf("%s: X-Cache %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/jesus/FCCUR/internal/blob"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+// ReplacePackageFile uploads a new file for an existing package, keeping its
+// ID, metadata and download stats. The previous file is kept as a revision,
+// and the package is held for review again when moderation applies.
+func (s *Server) ReplacePackageFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.getCurrentUser(r)
+	if err != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized - login required"})
+		return
+	}
+
+	user, err := s.db.GetUserByID(claims.UserID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	pkg, err := s.db.GetPackage(id)
+	if err != nil {
+		http.Error(w, "Package not found", http.StatusNotFound)
+		return
+	}
+
+	if !canEditPackage(claims, user, pkg) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "You don't have permission to edit this package",
+		})
+		return
+	}
+
+	// Limit size to 10GB
+	if err := r.ParseMultipartForm(10 << 30); err != nil {
+		http.Error(w, "File too large", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("package")
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if err := validateFileType(header); err != nil {
+		http.Error(w, fmt.Sprintf("File validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	sanitizedFilename, err := sanitizeFilename(header.Filename)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid filename: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Stage file locally until its hash is known
+	dest, err := s.createStagingFile()
+	if err != nil {
+		http.Error(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+	tempPath := dest.Name()
+
+	blake3Hash, sha256Hash, fileSize, err := s.saveAndHash(file, dest)
+	dest.Close()
+	if err != nil {
+		os.Remove(tempPath)
+		http.Error(w, "Error processing file", http.StatusInternalServerError)
+		return
+	}
+
+	if blake3Hash == pkg.BLAKE3Hash {
+		os.Remove(tempPath)
+		respondJSON(w, http.StatusConflict, map[string]string{
+			"error": "File is identical to the current version",
+		})
+		return
+	}
+
+	previous := &models.PackageRevision{
+		PackageID:  pkg.ID,
+		FilePath:   pkg.FilePath,
+		FileName:   pkg.GetFileName(),
+		FileSize:   pkg.FileSize,
+		BLAKE3Hash: pkg.BLAKE3Hash,
+		SHA256Hash: pkg.SHA256Hash,
+		ReplacedBy: user.ID,
+	}
+
+	pkg.FileName = sanitizedFilename
+	pkg.FileSize = fileSize
+	pkg.BLAKE3Hash = blake3Hash
+	pkg.SHA256Hash = sha256Hash
+
+	// A new file is reviewed like a new upload. Otherwise the package keeps
+	// its status, so replacing the file of a rejected package does not
+	// publish it.
+	uploadedBy, status := pkg.UploadedBy, pkg.Status
+	s.holdForReview(pkg, user)
+	if pkg.Status != models.StatusPending {
+		pkg.UploadedBy, pkg.Status = uploadedBy, status
+	}
+
+	if err := s.replacePackageBlob(pkg, previous, tempPath); err != nil {
+		if err == storage.ErrPackageNotFound {
+			http.Error(w, "Package not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error replacing file of package %d: %v", id, err)
+		http.Error(w, "Error replacing package file", http.StatusInternalServerError)
+		return
+	}
+
+	s.notifyPending(pkg)
+
+	// Invalidate cache after successful replacement
+	s.cache.Invalidate()
+
+	log.Printf("Package file replaced: ID=%d, Name=%s, %s -> %s by %s",
+		pkg.ID, pkg.Name, previous.BLAKE3Hash, pkg.BLAKE3Hash, user.Email)
+	s.audit(r, models.AuditPackageReplace, models.AuditTargetPackage, auditID(id), map[string]models.AuditChange{
+		"file_name": {Old: previous.FileName, New: pkg.FileName},
+		"file_size": {Old: previous.FileSize, New: pkg.FileSize},
+		"sha256":    {Old: previous.SHA256Hash, New: pkg.SHA256Hash},
+	})
+
+	// Reload to pick up the database timestamps
+	if updated, err := s.db.GetPackage(id); err == nil {
+		pkg = updated
+	}
+	if rev, err := s.db.GetPackageRevision(previous.ID); err == nil {
+		previous = rev
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"package":           pkg,
+		"previous_revision": previous,
+	})
+}
+
+// GetPackageRevisions lists the previous files of a package
+func (s *Server) GetPackageRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.visiblePackage(w, r, id); !ok {
+		return
+	}
+
+	revisions, err := s.db.GetPackageRevisions(id)
+	if err != nil {
+		log.Printf("Error fetching revisions for package %d: %v", id, err)
+		http.Error(w, "Error fetching revisions", http.StatusInternalServerError)
+		return
+	}
+	if revisions == nil {
+		revisions = []*models.PackageRevision{}
+	}
+
+	respondJSON(w, http.StatusOK, revisions)
+}
+
+// DownloadRevision streams a previous file of a package
+func (s *Server) DownloadRevision(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	rev, err := s.db.GetPackageRevision(id)
+	if err != nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := s.visiblePackage(w, r, rev.PackageID); !ok {
+		return
+	}
+
+	file, err := blob.Open(s.blobs, rev.FilePath)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", rev.FileName))
+	w.Header().Set("ETag", `"`+rev.BLAKE3Hash+`"`)
+	w.Header().Set("X-BLAKE3-Hash", rev.BLAKE3Hash)
+	w.Header().Set("X-SHA256-Hash", rev.SHA256Hash)
+
+	http.ServeContent(w, r, rev.FileName, rev.CreatedAt, file)
+}
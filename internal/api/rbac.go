@@ -11,8 +11,14 @@ import (
 func (s *Server) withRoleRequired(roles ...models.UserRole) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			// Get current user from JWT
+			// Get current user from JWT or access token
 			claims, err := s.getCurrentUser(r)
+			if err == errTokenScope {
+				respondJSON(w, http.StatusForbidden, map[string]string{
+					"error": "Access token scope does not permit this action",
+				})
+				return
+			}
 			if err != nil {
 				respondJSON(w, http.StatusUnauthorized, map[string]string{
 					"error": "Unauthorized - login required",
@@ -52,6 +58,13 @@ func (s *Server) withRoleRequired(roles ...models.UserRole) func(http.HandlerFun
 				return
 			}
 
+			if !scopeAllowsRoute(claims, roles) {
+				respondJSON(w, http.StatusForbidden, map[string]string{
+					"error": "Access token scope does not permit this action",
+				})
+				return
+			}
+
 			next(w, r)
 		}
 	}
@@ -67,12 +80,17 @@ func (s *Server) withCanUpload(next http.HandlerFunc) http.HandlerFunc {
 	return s.withRoleRequired(models.RoleAdmin, models.RoleProfessor)(next)
 }
 
+// withLoginRequired middleware ensures an active user of any role is logged in
+func (s *Server) withLoginRequired(next http.HandlerFunc) http.HandlerFunc {
+	return s.withRoleRequired(models.RoleAdmin, models.RoleProfessor, models.RoleStudent)(next)
+}
+
 // withCanDelete middleware ensures user can delete
 func (s *Server) withCanDelete(next http.HandlerFunc) http.HandlerFunc {
 	return s.withRoleRequired(models.RoleAdmin)(next)
 }
 
-// checkCoursePermission checks if user can upload to a specific course
+// checkCoursePermission checks if user is assigned to a specific course
 func (s *Server) checkCoursePermission(w http.ResponseWriter, r *http.Request, courseName string) bool {
 	claims, err := s.getCurrentUser(r)
 	if err != nil {
@@ -86,3 +104,26 @@ func (s *Server) checkCoursePermission(w http.ResponseWriter, r *http.Request, c
 
 	return user.CanUploadToCourse(courseName)
 }
+
+// checkUploadCourse rejects unknown courses, professors uploading materials
+// to a course they are not assigned to and access tokens limited to other
+// courses. It writes the error response and returns false when denied.
+func (s *Server) checkUploadCourse(w http.ResponseWriter, r *http.Request, contentType, courseName string) bool {
+	if !s.checkTokenCourse(w, r, courseName) {
+		return false
+	}
+	if courseName == "" {
+		return true
+	}
+	if !s.checkCourse(w, courseName) {
+		return false
+	}
+	if contentType != "material" || s.checkCoursePermission(w, r, courseName) {
+		return true
+	}
+
+	respondJSON(w, http.StatusForbidden, map[string]string{
+		"error": "You don't have permission to upload to this course",
+	})
+	return false
+}
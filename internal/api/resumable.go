@@ -0,0 +1,584 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/hash"
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+const (
+	// uploadStagingDir is the directory under packagesDir holding partial uploads
+	uploadStagingDir = ".uploads"
+	// defaultUploadExpiry is how long an idle staged upload is kept
+	defaultUploadExpiry = 24 * time.Hour
+	// maxUploadSize matches the multipart limit of UploadPackage (10GB)
+	maxUploadSize = 10 << 30
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadIncomplete     = errors.New("upload incomplete")
+)
+
+// UploadSession tracks a resumable upload staged on disk
+type UploadSession struct {
+	ID        string         `json:"id"`
+	UserID    int64          `json:"user_id"`
+	Filename  string         `json:"filename"` // Sanitized filename
+	Length    int64          `json:"length"`
+	Offset    int64          `json:"offset"`
+	Metadata  UploadMetadata `json:"metadata"`
+	CreatedAt time.Time      `json:"created_at"`
+	ExpiresAt time.Time      `json:"expires_at"`
+
+	mu     sync.Mutex
+	hasher *hash.DualHasher // nil until rebuilt after a restart
+}
+
+// UploadStore manages staged resumable uploads. A session's mu is always
+// taken before the store's mu, never the other way round.
+type UploadStore struct {
+	mu       sync.Mutex
+	dir      string
+	sessions map[string]*UploadSession
+	expiry   time.Duration
+	cleanupT *time.Ticker
+}
+
+// NewUploadStore creates an upload store in dir and restores any sessions
+// left over from a previous run
+func NewUploadStore(dir string, expiry time.Duration) (*UploadStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	u := &UploadStore{
+		dir:      dir,
+		sessions: make(map[string]*UploadSession),
+		expiry:   expiry,
+	}
+
+	if err := u.load(); err != nil {
+		return nil, err
+	}
+
+	// Start cleanup goroutine to remove expired uploads
+	interval := expiry / 4
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	u.cleanupT = time.NewTicker(interval)
+	go u.cleanup()
+
+	return u, nil
+}
+
+// Create registers a new upload and creates its empty staging file
+func (u *UploadStore) Create(userID int64, filename string, length int64, meta UploadMetadata) (*UploadSession, error) {
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sess := &UploadSession{
+		ID:        id,
+		UserID:    userID,
+		Filename:  filename,
+		Length:    length,
+		Metadata:  meta,
+		CreatedAt: now,
+		ExpiresAt: now.Add(u.expiry),
+		hasher:    hash.NewDualHasher(),
+	}
+
+	f, err := os.Create(u.partPath(id))
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	if err := u.save(sess); err != nil {
+		os.Remove(u.partPath(id))
+		return nil, err
+	}
+
+	u.mu.Lock()
+	u.sessions[id] = sess
+	u.mu.Unlock()
+
+	return sess, nil
+}
+
+// Get returns an upload session by ID
+func (u *UploadStore) Get(id string) (*UploadSession, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	sess, ok := u.sessions[id]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+	return sess, nil
+}
+
+// Append writes a chunk starting at offset and returns the new offset.
+// Bytes received before a dropped connection are kept so the client can resume.
+func (u *UploadStore) Append(sess *UploadSession, offset int64, r io.Reader) (int64, error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if offset != sess.Offset {
+		return sess.Offset, ErrUploadOffsetMismatch
+	}
+
+	if err := u.ensureHasher(sess); err != nil {
+		return sess.Offset, err
+	}
+
+	f, err := os.OpenFile(u.partPath(sess.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		return sess.Offset, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(sess.Offset, io.SeekStart); err != nil {
+		return sess.Offset, err
+	}
+
+	// Never accept more than the declared length
+	remaining := sess.Length - sess.Offset
+	_, copyErr := io.Copy(io.MultiWriter(f, sess.hasher), io.LimitReader(r, remaining))
+
+	// The hasher only sees bytes the file accepted, so it is the source of truth
+	sess.Offset = sess.hasher.Written()
+	if err := f.Truncate(sess.Offset); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	sess.ExpiresAt = time.Now().Add(u.expiry)
+
+	if err := u.save(sess); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	return sess.Offset, copyErr
+}
+
+// Complete claims a fully received upload so no further chunks or finalize
+// calls can touch it, and returns its staged file path and hashes.
+// The caller must Remove the session once the staged file has been handled.
+func (u *UploadStore) Complete(sess *UploadSession) (partPath, blake3Hash, sha256Hash string, err error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.Offset != sess.Length {
+		return "", "", "", ErrUploadIncomplete
+	}
+
+	if err := u.ensureHasher(sess); err != nil {
+		return "", "", "", err
+	}
+
+	u.mu.Lock()
+	if _, ok := u.sessions[sess.ID]; !ok {
+		u.mu.Unlock()
+		return "", "", "", ErrUploadNotFound
+	}
+	delete(u.sessions, sess.ID)
+	u.mu.Unlock()
+
+	blake3Hash, sha256Hash = sess.hasher.Sums()
+	return u.partPath(sess.ID), blake3Hash, sha256Hash, nil
+}
+
+// Remove deletes an upload session and any staged data
+func (u *UploadStore) Remove(id string) {
+	u.mu.Lock()
+	delete(u.sessions, id)
+	u.mu.Unlock()
+
+	os.Remove(u.partPath(id))
+	os.Remove(u.metaPath(id))
+}
+
+// Stop stops the cleanup goroutine
+func (u *UploadStore) Stop() {
+	u.cleanupT.Stop()
+}
+
+// ensureHasher rebuilds the hash state from the staged file after a restart.
+// Must be called with sess.mu held.
+func (u *UploadStore) ensureHasher(sess *UploadSession) error {
+	if sess.hasher != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(u.partPath(sess.ID), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Drop any bytes written after the last recorded offset
+	if err := f.Truncate(sess.Offset); err != nil {
+		return err
+	}
+
+	hasher := hash.NewDualHasher()
+	if _, err := io.CopyN(hasher, f, sess.Offset); err != nil {
+		return err
+	}
+
+	sess.hasher = hasher
+	return nil
+}
+
+// load restores session metadata from the staging directory
+func (u *UploadStore) load() error {
+	entries, err := os.ReadDir(u.dir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(u.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		sess := &UploadSession{}
+		if err := json.Unmarshal(data, sess); err != nil {
+			log.Printf("Warning: Ignoring corrupt upload metadata %s: %v", entry.Name(), err)
+			continue
+		}
+
+		if now.After(sess.ExpiresAt) {
+			os.Remove(u.partPath(sess.ID))
+			os.Remove(u.metaPath(sess.ID))
+			continue
+		}
+
+		u.sessions[sess.ID] = sess
+	}
+
+	return nil
+}
+
+// save persists session metadata next to the staged file
+func (u *UploadStore) save(sess *UploadSession) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	tmp := u.metaPath(sess.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.metaPath(sess.ID))
+}
+
+// cleanup removes uploads that have not been touched within the expiry window
+func (u *UploadStore) cleanup() {
+	for range u.cleanupT.C {
+		u.removeExpired(time.Now())
+	}
+}
+
+// removeExpired removes the uploads that expired before now. Sessions are
+// copied out of the map first so that each one is locked before the store,
+// as Complete does; one being finalized is left alone.
+func (u *UploadStore) removeExpired(now time.Time) {
+	u.mu.Lock()
+	sessions := make([]*UploadSession, 0, len(u.sessions))
+	for _, sess := range u.sessions {
+		sessions = append(sessions, sess)
+	}
+	u.mu.Unlock()
+
+	for _, sess := range sessions {
+		sess.mu.Lock()
+		expired := now.After(sess.ExpiresAt)
+		if expired {
+			u.mu.Lock()
+			_, expired = u.sessions[sess.ID]
+			delete(u.sessions, sess.ID)
+			u.mu.Unlock()
+		}
+		sess.mu.Unlock()
+
+		if expired {
+			u.Remove(sess.ID)
+			log.Printf("Expired staged upload removed: ID=%s", sess.ID)
+		}
+	}
+}
+
+func (u *UploadStore) partPath(id string) string {
+	return filepath.Join(u.dir, id+".part")
+}
+
+func (u *UploadStore) metaPath(id string) string {
+	return filepath.Join(u.dir, id+".json")
+}
+
+// newUploadID generates a random upload identifier
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Uploads dispatches resumable upload requests by method:
+// POST creates, HEAD/GET reports progress, PATCH appends a chunk, DELETE aborts
+func (s *Server) Uploads(w http.ResponseWriter, r *http.Request) {
+	if s.uploads == nil {
+		http.Error(w, "Resumable uploads are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		s.withRateLimit(s.CreateUpload)(w, r)
+	case http.MethodHead, http.MethodGet:
+		s.GetUploadStatus(w, r)
+	case http.MethodPatch:
+		s.UploadChunk(w, r)
+	case http.MethodDelete:
+		s.CancelUpload(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CreateUpload starts a resumable upload from JSON metadata
+func (s *Server) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UploadMetadata
+		Filename string `json:"filename"`
+		Size     int64  `json:"size"`
+		MIMEType string `json:"mime_type,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Size <= 0 || req.Size > maxUploadSize {
+		http.Error(w, "Invalid upload size", http.StatusBadRequest)
+		return
+	}
+
+	// Validate file type
+	if err := validateFileNameAndMIME(req.Filename, req.MIMEType); err != nil {
+		http.Error(w, fmt.Sprintf("File validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Sanitize filename
+	sanitizedFilename, err := sanitizeFilename(req.Filename)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid filename: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	meta := req.UploadMetadata
+	if err := meta.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkCategory(w, meta.Category) {
+		return
+	}
+
+	// Check course permissions for professors
+	if !s.checkUploadCourse(w, r, meta.ContentType, meta.CourseName) {
+		return
+	}
+
+	claims, err := s.getCurrentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sess, err := s.uploads.Create(claims.UserID, sanitizedFilename, req.Size, meta)
+	if err != nil {
+		log.Printf("Error creating upload: %v", err)
+		http.Error(w, "Error creating upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads?id="+sess.ID)
+	setUploadHeaders(w, sess)
+	respondJSON(w, http.StatusCreated, sess)
+}
+
+// GetUploadStatus reports how many bytes of an upload have been received
+func (s *Server) GetUploadStatus(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.ownedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store")
+	setUploadHeaders(w, sess)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	respondJSON(w, http.StatusOK, sess)
+}
+
+// UploadChunk appends the request body to an upload at the given Upload-Offset
+func (s *Server) UploadChunk(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.ownedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Missing or invalid Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+
+	newOffset, err := s.uploads.Append(sess, offset, r.Body)
+	if err != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+		if err == ErrUploadOffsetMismatch {
+			http.Error(w, "Upload offset does not match", http.StatusConflict)
+			return
+		}
+		log.Printf("Error writing upload chunk %s: %v", sess.ID, err)
+		http.Error(w, "Error writing upload chunk", http.StatusInternalServerError)
+		return
+	}
+
+	sess.mu.Lock()
+	setUploadHeaders(w, sess)
+	sess.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CancelUpload aborts an upload and deletes its staged data
+func (s *Server) CancelUpload(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.ownedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	s.uploads.Remove(sess.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FinalizeUpload moves a completed upload into place and creates its package
+func (s *Server) FinalizeUpload(w http.ResponseWriter, r *http.Request) {
+	if s.uploads == nil {
+		http.Error(w, "Resumable uploads are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sess, ok := s.ownedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	partPath, blake3Hash, sha256Hash, err := s.uploads.Complete(sess)
+	if err != nil {
+		switch err {
+		case ErrUploadIncomplete:
+			http.Error(w, "Upload is not complete", http.StatusConflict)
+		case ErrUploadNotFound:
+			http.Error(w, "Upload not found", http.StatusNotFound)
+		default:
+			log.Printf("Error completing upload %s: %v", sess.ID, err)
+			http.Error(w, "Error processing file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	uploader, err := s.db.GetUserByID(sess.UserID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Move staged file into the blob store and create database record
+	pkg := sess.Metadata.toPackage(sess.Filename, sess.Length, blake3Hash, sha256Hash)
+	s.holdForReview(pkg, uploader)
+	id, err := s.createPackageWithBlob(pkg, partPath)
+	if err != nil {
+		log.Printf("Error storing upload %s: %v", sess.ID, err)
+		s.uploads.Remove(sess.ID)
+		http.Error(w, "Error creating package", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.ID = id
+	s.uploads.Remove(sess.ID)
+	s.notifyPending(pkg)
+	s.audit(r, models.AuditPackageUpload, models.AuditTargetPackage, auditID(id), auditPackage(pkg))
+
+	// Invalidate cache after successful upload
+	s.cache.Invalidate()
+
+	respondJSON(w, http.StatusCreated, pkg)
+}
+
+// ownedUpload looks up the upload named by the id query parameter and checks
+// that it belongs to the current user
+func (s *Server) ownedUpload(w http.ResponseWriter, r *http.Request) (*UploadSession, bool) {
+	claims, err := s.getCurrentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	sess, err := s.uploads.Get(r.URL.Query().Get("id"))
+	if err != nil || sess.UserID != claims.UserID {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return sess, true
+}
+
+// setUploadHeaders reports upload progress in tus-style headers
+func setUploadHeaders(w http.ResponseWriter, sess *UploadSession) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(sess.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(sess.Length, 10))
+	w.Header().Set("Upload-Expires", sess.ExpiresAt.UTC().Format(http.TimeFormat))
+}
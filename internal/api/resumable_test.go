@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/hash"
+)
+
+// failingReader returns data and then err, like a dropped connection
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestUploadStoreResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+
+	store, err := NewUploadStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := store.Create(1, "tool.zip", int64(len(data)), UploadMetadata{Name: "tool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The connection drops after 30000 bytes; they are kept
+	dropped := errors.New("connection reset")
+	offset, err := store.Append(sess, 0, &failingReader{data: data[:30000], err: dropped})
+	if !errors.Is(err, dropped) || offset != 30000 {
+		t.Fatalf("Append = %d, %v; want 30000, connection reset", offset, err)
+	}
+	store.Stop()
+
+	// Bytes written after the last recorded offset are dropped on restart
+	f, err := os.OpenFile(store.partPath(sess.ID), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("garbage"))
+	f.Close()
+
+	store, err = NewUploadStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Stop()
+	sess, err = store.Get(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Append(sess, 0, bytes.NewReader(data)); !errors.Is(err, ErrUploadOffsetMismatch) {
+		t.Fatalf("Append at a stale offset: %v, want ErrUploadOffsetMismatch", err)
+	}
+	if _, _, _, err := store.Complete(sess); !errors.Is(err, ErrUploadIncomplete) {
+		t.Fatalf("Complete before the last byte: %v, want ErrUploadIncomplete", err)
+	}
+	if offset, err := store.Append(sess, 30000, bytes.NewReader(data[30000:])); err != nil || offset != int64(len(data)) {
+		t.Fatalf("Append = %d, %v; want %d", offset, err, len(data))
+	}
+
+	partPath, blake3Hash, sha256Hash, err := store.Complete(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Remove(sess.ID)
+
+	wantBlake3, wantSHA256, err := hash.DualHash(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blake3Hash != wantBlake3 || sha256Hash != wantSHA256 {
+		t.Errorf("hashes rebuilt after restart = %s, %s; want %s, %s", blake3Hash, sha256Hash, wantBlake3, wantSHA256)
+	}
+	staged, err := os.ReadFile(partPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(staged, data) {
+		t.Errorf("staged file has %d bytes, want the %d uploaded", len(staged), len(data))
+	}
+}
+
+func TestUploadStoreCompleteDuringCleanup(t *testing.T) {
+	store, err := NewUploadStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Stop()
+
+	// Empty uploads are complete at once; all of them look expired to the
+	// cleanup running at the same time
+	var sessions []*UploadSession
+	for i := 0; i < 200; i++ {
+		sess, err := store.Create(1, "tool.zip", 0, UploadMetadata{Name: "tool"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, sess)
+	}
+	later := time.Now().Add(2 * time.Hour)
+
+	done := make(chan struct{})
+	var completed []string
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				store.removeExpired(later)
+			}
+		}()
+		for _, sess := range sessions {
+			wg.Add(1)
+			go func(sess *UploadSession) {
+				defer wg.Done()
+				partPath, _, _, err := store.Complete(sess)
+				if err == nil {
+					mu.Lock()
+					completed = append(completed, partPath)
+					mu.Unlock()
+				} else if !errors.Is(err, ErrUploadNotFound) {
+					t.Error(err)
+				}
+			}(sess)
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Complete and cleanup deadlocked")
+	}
+
+	// Cleanup never removes the file of an upload being finalized
+	for _, partPath := range completed {
+		if _, err := os.Stat(partPath); err != nil {
+			t.Errorf("staged file of a completed upload: %v", err)
+		}
+	}
+	if _, err := store.Create(1, "tool.zip", 0, UploadMetadata{Name: "tool"}); err != nil {
+		t.Errorf("creating an upload afterwards: %v", err)
+	}
+}
+
+func TestUploadsRateLimitCreationOnly(t *testing.T) {
+	e := newTestEnv(t)
+	e.srv.SetRateLimit(1)
+	admin, _ := e.login("admin@uni.edu")
+
+	data := bytes.Repeat([]byte("x"), 3000)
+	create := fmt.Sprintf(`{"filename": "tool.zip", "size": %d, "name": "tool", "version": "1", "category": "tool"}`, len(data))
+	resp, body := e.do(http.MethodPost, "/api/uploads", admin, create)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: %d %s", resp.StatusCode, body)
+	}
+	var sess UploadSession
+	e.decode(body, &sess)
+
+	// Chunks of the upload are not limited
+	path := "/api/uploads?id=" + sess.ID
+	for offset := 0; offset < len(data); offset += 1000 {
+		resp, body := e.send(http.MethodPatch, path, admin, bytes.NewReader(data[offset:offset+1000]),
+			map[string]string{"Upload-Offset": strconv.Itoa(offset)})
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("chunk at %d: %d %s", offset, resp.StatusCode, body)
+		}
+	}
+	if resp, body := e.do(http.MethodPost, "/api/uploads/finalize?id="+sess.ID, admin, ""); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("finalize: %d %s", resp.StatusCode, body)
+	}
+
+	// Starting another upload is
+	if resp, _ := e.do(http.MethodPost, "/api/uploads", admin, create); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("second upload: got %d, want 429", resp.StatusCode)
+	}
+	if resp, _ := e.sendFile(http.MethodPost, "/api/upload", admin, "tool.zip", data, nil); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("multipart upload after the limit: got %d, want 429", resp.StatusCode)
+	}
+}
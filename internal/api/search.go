@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchPackages handles full-text search over package name, description,
+// course and README text, narrowed by the listing filters
+func (s *Server) SearchPackages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	filters := packageFilterParams(r.URL.Query())
+	filters.Viewer = s.viewer(r)
+
+	results, err := s.db.SearchPackages(query, filters, limit, offset)
+	if err != nil {
+		log.Printf("Error searching packages for %q: %v", query, err)
+		http.Error(w, "Error searching packages", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"query":   query,
+		"limit":   limit,
+		"offset":  offset,
+		"results": results,
+	})
+}
+
+// indexReadme extracts the README of an archive package into the search
+// index. It reports false when the archive could not be read, leaving the
+// package to be retried by IndexReadmes.
+func (s *Server) indexReadme(pkg *models.Package) bool {
+	readme := ""
+	contents, err := s.readArchiveContents(pkg)
+	switch {
+	case err == nil:
+		readme = contents.Readme
+	case errors.Is(err, errArchiveMissing):
+		log.Printf("Error indexing README of package %d: %v", pkg.ID, err)
+		return false
+	case err != errNotArchive && err != errUnsupportedArchive:
+		// Corrupt archives are indexed without a README rather than retried
+		log.Printf("Error reading archive of package %d: %v", pkg.ID, err)
+	}
+
+	// PostgreSQL text cannot hold NUL bytes or invalid UTF-8
+	readme = strings.ReplaceAll(strings.ToValidUTF8(readme, ""), "\x00", "")
+
+	if err := s.db.SetPackageReadme(pkg.ID, readme); err != nil {
+		log.Printf("Error indexing README of package %d: %v", pkg.ID, err)
+		return false
+	}
+	return true
+}
+
+// IndexReadmes extracts README text for packages stored before search
+// indexing existed. It is meant to run in the background at startup.
+func (s *Server) IndexReadmes() {
+	var afterID int64
+	indexed := 0
+	for {
+		packages, err := s.db.GetPackagesWithoutReadme(afterID, 100)
+		if err != nil {
+			log.Printf("Error listing packages to index: %v", err)
+			return
+		}
+		if len(packages) == 0 {
+			break
+		}
+
+		for _, pkg := range packages {
+			if s.indexReadme(pkg) {
+				indexed++
+			}
+			afterID = pkg.ID
+		}
+	}
+
+	if indexed > 0 {
+		log.Printf("Search: indexed README text of %d packages", indexed)
+	}
+}
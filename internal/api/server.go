@@ -1,24 +1,48 @@
 package api
 
 import (
+	"log"
 	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/blob"
+	"github.com/jesus/FCCUR/internal/mail"
+	"github.com/jesus/FCCUR/internal/models"
 	"github.com/jesus/FCCUR/internal/storage"
 )
 
 type Server struct {
-	db           storage.Database
-	packagesDir  string
-	webDir       string
-	mux          *http.ServeMux
-	startTime    time.Time
-	authConfig   AuthConfig
-	rateLimiter  *RateLimiter
-	cache        *PackageCache
-	jwtManager   *auth.JWTManager
-	oauth2Config *auth.OAuth2Config
+	db             storage.Database
+	packagesDir    string
+	webDir         string
+	mux            *http.ServeMux
+	startTime      time.Time
+	authConfig     AuthConfig
+	rateLimiter    *RateLimiter
+	submitLimiter  *RateLimiter // Submissions per user
+	cache          *PackageCache
+	jwtManager     *auth.JWTManager
+	oauth2Config   *auth.OAuth2Config
+	oidcProviders  []*OIDCProvider
+	oidcLogins     *OIDCLogins
+	ldap           *LDAPDirectory
+	uploads        *UploadStore
+	blobs          blob.BlobStore
+	blobMu         sync.Mutex // Serializes blob writes with reference counting
+	moderation     ModerationConfig
+	trashRetention time.Duration // How long deleted packages stay restorable; 0 keeps them
+	mailer         mail.Mailer
+	mailLanguage   string // Language of emails when the request does not ask for a supported one
+	publicURL      string // Base URL of links in emails; never taken from the request's Host
+	verification   VerificationConfig
+	verifyLimiter  *RateLimiter // Verification emails per address
+	mfa            MFAConfig
+	mfaChallenges  *MFAChallenges
+	sessions       *SessionCache
 }
 
 // NewServer creates a new API server
@@ -27,20 +51,49 @@ func NewServer(db storage.Database, packagesDir, webDir, jwtSecret string) *Serv
 	jwtManager := auth.NewJWTManager(jwtSecret, 24*time.Hour, 30*24*time.Hour)
 
 	s := &Server{
-		db:          db,
-		packagesDir: packagesDir,
-		webDir:      webDir,
-		mux:         http.NewServeMux(),
-		startTime:   time.Now(),
-		authConfig:  AuthConfig{Enabled: false}, // Disabled by default
-		cache:       NewPackageCache(),
-		jwtManager:  jwtManager,
+		db:             db,
+		packagesDir:    packagesDir,
+		webDir:         webDir,
+		mux:            http.NewServeMux(),
+		startTime:      time.Now(),
+		authConfig:     AuthConfig{Enabled: false}, // Disabled by default
+		cache:          NewPackageCache(),
+		jwtManager:     jwtManager,
+		moderation:     ModerationConfig{TrustedRoles: []models.UserRole{models.RoleAdmin}},
+		trashRetention: defaultTrashRetention,
+		mailer:         mail.NewLog(defaultMailFrom),
+		mailLanguage:   mail.DefaultLanguage,
+		publicURL:      defaultPublicURL,
+		verifyLimiter:  NewRateLimiter(verificationResends, time.Hour),
+		mfaChallenges:  NewMFAChallenges(),
+		oidcLogins:     NewOIDCLogins(),
+		sessions:       NewSessionCache(),
+	}
+
+	// Package files default to the local filesystem; see SetBlobStore
+	blobs, err := blob.NewLocal(packagesDir)
+	if err != nil {
+		log.Fatalf("Failed to create blob store: %v", err)
+	}
+	s.blobs = blobs
+
+	// Staging area for resumable uploads
+	uploads, err := NewUploadStore(filepath.Join(packagesDir, uploadStagingDir), defaultUploadExpiry)
+	if err != nil {
+		log.Printf("Warning: Resumable uploads disabled: %v", err)
+	} else {
+		s.uploads = uploads
 	}
 
 	s.setupRoutes()
 	return s
 }
 
+// SetBlobStore replaces the storage backend for package files and thumbnails
+func (s *Server) SetBlobStore(store blob.BlobStore) {
+	s.blobs = store
+}
+
 // SetAuth configures authentication for upload endpoint
 func (s *Server) SetAuth(username, password string) {
 	if username != "" && password != "" {
@@ -53,10 +106,11 @@ func (s *Server) SetAuth(username, password string) {
 }
 
 // SetRateLimit configures rate limiting for uploads
-// limit: max uploads per hour per IP
+// limit: max uploads per hour per IP, and max submissions per hour per user
 func (s *Server) SetRateLimit(limit int) {
 	if limit > 0 {
 		s.rateLimiter = NewRateLimiter(limit, time.Hour)
+		s.submitLimiter = NewRateLimiter(limit, time.Hour)
 	}
 }
 
@@ -65,6 +119,48 @@ func (s *Server) SetOAuth2(config *auth.OAuth2Config) {
 	s.oauth2Config = config
 }
 
+// SetOIDCProviders configures the OpenID Connect providers users can log
+// in with
+func (s *Server) SetOIDCProviders(providers ...*OIDCProvider) {
+	s.oidcProviders = providers
+}
+
+// SetLDAP configures the directory Login checks passwords against
+func (s *Server) SetLDAP(directory *LDAPDirectory) {
+	s.ldap = directory
+}
+
+// SetModeration configures which uploads need admin approval
+func (s *Server) SetModeration(config ModerationConfig) {
+	s.moderation = config
+}
+
+// SetMailer configures how verification, password reset and login
+// notification emails are sent
+func (s *Server) SetMailer(mailer mail.Mailer, language string) {
+	s.mailer = mailer
+	if mail.Supported(language) {
+		s.mailLanguage = language
+	}
+}
+
+// SetVerification configures what unverified users may do and who may
+// register themselves
+func (s *Server) SetVerification(config VerificationConfig) {
+	s.verification = config
+}
+
+// SetMFA configures which roles must use two-factor authentication
+func (s *Server) SetMFA(config MFAConfig) {
+	s.mfa = config
+}
+
+// SetPublicURL sets the base URL of links in emails, e.g.
+// https://fccur.example.edu
+func (s *Server) SetPublicURL(url string) {
+	s.publicURL = strings.TrimSuffix(url, "/")
+}
+
 // setupRoutes configures all HTTP routes
 func (s *Server) setupRoutes() {
 	// Authentication routes
@@ -77,17 +173,75 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/api/auth/change-password", s.withCORS(s.withLogging(s.ChangePassword)))
 	s.mux.HandleFunc("/api/auth/request-reset", s.withCORS(s.withLogging(s.RequestPasswordReset)))
 	s.mux.HandleFunc("/api/auth/reset-password", s.withCORS(s.withLogging(s.ResetPassword)))
+	s.mux.HandleFunc("/api/auth/verify-email", s.withCORS(s.withLogging(s.VerifyEmail)))
+	s.mux.HandleFunc("/api/auth/resend-verification", s.withCORS(s.withLogging(s.ResendVerification)))
+	// Two-factor authentication: status, enrollment, login challenge and recovery codes
+	s.mux.HandleFunc("/api/auth/mfa", s.withCORS(s.withLogging(s.withLoginRequired(s.GetMFAStatus))))
+	s.mux.HandleFunc("/api/auth/mfa/setup", s.withCORS(s.withLogging(s.SetupMFA)))
+	s.mux.HandleFunc("/api/auth/mfa/enable", s.withCORS(s.withLogging(s.EnableMFA)))
+	s.mux.HandleFunc("/api/auth/mfa/verify", s.withCORS(s.withLogging(s.VerifyMFA)))
+	s.mux.HandleFunc("/api/auth/mfa/disable", s.withCORS(s.withLogging(s.withLoginRequired(s.DisableMFA))))
+	s.mux.HandleFunc("/api/auth/mfa/recovery-codes", s.withCORS(s.withLogging(s.withLoginRequired(s.RegenerateRecoveryCodes))))
+	s.mux.HandleFunc("/api/auth/tokens", s.withCORS(s.withLogging(s.withLoginRequired(s.AccessTokens))))
 
 	// OAuth2 routes
 	s.mux.HandleFunc("/api/oauth2/config", s.withCORS(s.withLogging(s.OAuth2Config)))
 	s.mux.HandleFunc("/api/oauth2/login", s.withCORS(s.withLogging(s.OAuth2Login)))
 	s.mux.HandleFunc("/api/oauth2/callback", s.withCORS(s.withLogging(s.OAuth2Callback)))
+	s.mux.HandleFunc("/api/oidc/providers", s.withCORS(s.withLogging(s.OIDCProviders)))
+	s.mux.HandleFunc("/api/oidc/login", s.withCORS(s.withLogging(s.OIDCLogin)))
+	s.mux.HandleFunc("/api/oidc/callback", s.withCORS(s.withLogging(s.OIDCCallback)))
 
 	// API routes with gzip compression
 	s.mux.HandleFunc("/api/packages", s.withCORS(s.withLogging(s.withGzip(s.GetPackages))))
 	s.mux.HandleFunc("/api/packages/", s.withCORS(s.withLogging(s.withGzip(s.GetPackage))))
 	// Upload endpoint with rate limiting and RBAC (admin or professor only)
-	s.mux.HandleFunc("/api/upload", s.withCORS(s.withLogging(s.withRateLimit(s.withCanUpload(s.UploadPackage)))))
+	s.mux.HandleFunc("/api/upload", s.withCORS(s.withLogging(s.withRateLimit(s.withCanUpload(s.withVerifiedEmail(s.UploadPackage))))))
+	// Resumable upload endpoints (create/status/chunk/cancel and finalize);
+	// Uploads applies the upload rate limit to creating an upload, not to its chunks
+	s.mux.HandleFunc("/api/uploads", s.withCORS(s.withLogging(s.withCanUpload(s.withVerifiedEmail(s.Uploads)))))
+	s.mux.HandleFunc("/api/uploads/finalize", s.withCORS(s.withLogging(s.withCanUpload(s.withVerifiedEmail(s.FinalizeUpload)))))
+	// Metadata editing (admin, or professor for their own course) and edit history
+	s.mux.HandleFunc("/api/packages/update", s.withCORS(s.withLogging(s.withCanUpload(s.UpdatePackage))))
+	s.mux.HandleFunc("/api/packages/history", s.withCORS(s.withLogging(s.withCanUpload(s.GetPackageHistory))))
+	// File replacement keeping the package ID; previous files stay downloadable
+	s.mux.HandleFunc("/api/packages/replace", s.withCORS(s.withLogging(s.withCanUpload(s.withVerifiedEmail(s.ReplacePackageFile)))))
+	// Tags (add/remove on a package, facet counts) and the category taxonomy
+	s.mux.HandleFunc("/api/packages/tags", s.withCORS(s.withLogging(s.withCanUpload(s.PackageTags))))
+	s.mux.HandleFunc("/api/tags", s.withCORS(s.withLogging(s.withGzip(s.GetTags))))
+	s.mux.HandleFunc("/api/categories", s.withCORS(s.withLogging(s.withGzip(s.GetCategories))))
+	s.mux.HandleFunc("/api/admin/categories", s.withCORS(s.withLogging(s.withAdminOnly(s.ManageCategories))))
+	s.mux.HandleFunc("/api/courses", s.withCORS(s.withLogging(s.withGzip(s.GetCourses))))
+	s.mux.HandleFunc("/api/admin/courses", s.withCORS(s.withLogging(s.withAdminOnly(s.ManageCourses))))
+	s.mux.HandleFunc("/api/admin/courses/professors", s.withCORS(s.withLogging(s.withAdminOnly(s.CourseProfessors))))
+	// Student enrollment (admin, or professor for their own course)
+	s.mux.HandleFunc("/api/courses/students", s.withCORS(s.withLogging(s.withCanUpload(s.CourseStudents))))
+	// Assignment submission boxes: professors open them, enrolled students hand files in
+	s.mux.HandleFunc("/api/submissions/boxes", s.withCORS(s.withLogging(s.withLoginRequired(s.SubmissionBoxes))))
+	s.mux.HandleFunc("/api/submissions", s.withCORS(s.withLogging(s.withLoginRequired(s.Submissions))))
+	s.mux.HandleFunc("/api/submissions/file", s.withCORS(s.withLogging(s.withLoginRequired(s.DownloadSubmission))))
+	s.mux.HandleFunc("/api/submissions/download", s.withCORS(s.withLogging(s.withCanUpload(s.DownloadSubmissions))))
+	// Moderation: held uploads (all for admins, own for professors) and admin review
+	s.mux.HandleFunc("/api/moderation", s.withCORS(s.withLogging(s.withCanUpload(s.GetModerationQueue))))
+	s.mux.HandleFunc("/api/admin/moderation/review", s.withCORS(s.withLogging(s.withAdminOnly(s.ReviewPackage))))
+	s.mux.HandleFunc("/api/notifications", s.withCORS(s.withLogging(s.withLoginRequired(s.Notifications))))
+	// Trash: deleted packages can be listed, restored or purged until the retention period ends
+	s.mux.HandleFunc("/api/admin/trash", s.withCORS(s.withLogging(s.withAdminOnly(s.Trash))))
+	s.mux.HandleFunc("/api/admin/trash/restore", s.withCORS(s.withLogging(s.withAdminOnly(s.RestorePackage))))
+	// User management: search, role, activation, assigned courses, forced logout and password reset
+	s.mux.HandleFunc("/api/admin/users", s.withCORS(s.withLogging(s.withAdminOnly(s.ManageUsers))))
+	s.mux.HandleFunc("/api/admin/users/logout", s.withCORS(s.withLogging(s.withAdminOnly(s.ForceLogout))))
+	s.mux.HandleFunc("/api/admin/users/reset-password", s.withCORS(s.withLogging(s.withAdminOnly(s.ForcePasswordReset))))
+	s.mux.HandleFunc("/api/admin/users/reset-mfa", s.withCORS(s.withLogging(s.withAdminOnly(s.ResetUserMFA))))
+	// Audit log of logins, uploads, deletions and admin changes; ?format=csv|jsonl exports it
+	s.mux.HandleFunc("/api/admin/audit", s.withCORS(s.withLogging(s.withAdminOnly(s.GetAuditLog))))
+	// Full-text search over name, description, course and README text
+	s.mux.HandleFunc("/api/search", s.withCORS(s.withLogging(s.withGzip(s.SearchPackages))))
+	// Package families: all versions of a name + platform, newest first
+	s.mux.HandleFunc("/api/packages/versions", s.withCORS(s.withLogging(s.withGzip(s.GetFamilyVersions))))
+	s.mux.HandleFunc("/api/packages/revisions", s.withCORS(s.withLogging(s.withGzip(s.GetPackageRevisions))))
+	// Short-lived signed download links for non-public packages
+	s.mux.HandleFunc("/api/packages/link", s.withCORS(s.withLogging(s.GetPackageLink)))
 	// Delete endpoint requires admin role
 	s.mux.HandleFunc("/api/delete", s.withCORS(s.withLogging(s.withCanDelete(s.DeletePackage))))
 	// Duplicate check endpoint
@@ -100,6 +254,8 @@ func (s *Server) setupRoutes() {
 	// Thumbnail endpoint
 	s.mux.HandleFunc("/api/thumbnail", s.withCORS(s.withLogging(s.ServeThumbnail)))
 	s.mux.HandleFunc("/download/", s.withCORS(s.withLogging(s.DownloadPackage)))
+	s.mux.HandleFunc("/download/revision", s.withCORS(s.withLogging(s.DownloadRevision)))
+	s.mux.HandleFunc("/download/latest/", s.withCORS(s.withLogging(s.DownloadLatest)))
 	s.mux.HandleFunc("/api/stats", s.withCORS(s.withLogging(s.withGzip(s.GetStats))))
 	s.mux.HandleFunc("/health", s.withGzip(s.Health))
 
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+// sessionCacheTTL bounds how long a session found in the database is
+// trusted without looking again. Sessions ended by this server are revoked
+// at once; ones ended by another server sharing the database within this time.
+const sessionCacheTTL = 30 * time.Second
+
+// errRefreshTokenReused answers a refresh token presented again after it
+// was rotated
+const errRefreshTokenReused = "Refresh token already used; log in again"
+
+// SessionCache keeps the session check of every authenticated request
+// cheap. It remembers sessions found in the database for a short while,
+// and the sessions that ended until their access tokens expire.
+type SessionCache struct {
+	mu      sync.Mutex
+	live    map[string]*cachedSession // By jti
+	revoked map[string]time.Time      // Access token expiry by jti
+	ended   map[int64]time.Time       // When every session of a user last ended
+	pruned  time.Time
+}
+
+// cachedSession is a session known to exist at checked
+type cachedSession struct {
+	userID  int64
+	expires time.Time // When its access token expires
+	checked time.Time
+}
+
+// NewSessionCache creates an empty session cache
+func NewSessionCache() *SessionCache {
+	return &SessionCache{
+		live:    make(map[string]*cachedSession),
+		revoked: make(map[string]time.Time),
+		ended:   make(map[int64]time.Time),
+		pruned:  time.Now(),
+	}
+}
+
+// lookup reports whether the session jti is known to be live or to have
+// ended; if neither, the database must be asked
+func (c *SessionCache) lookup(jti string) (live, revoked bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.revoked[jti]; ok {
+		return false, true
+	}
+	if s, ok := c.live[jti]; ok && time.Since(s.checked) < sessionCacheTTL {
+		return true, false
+	}
+	return false, false
+}
+
+// remember records that the session jti of userID existed when the
+// database was asked at asked. An answer from before every session of the
+// user ended is stale and not cached.
+func (c *SessionCache) remember(jti string, userID int64, expires, asked time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune()
+	if ended, ok := c.ended[userID]; ok && !asked.After(ended) {
+		return
+	}
+	c.live[jti] = &cachedSession{userID: userID, expires: expires, checked: time.Now()}
+}
+
+// revoke records that the session jti ended
+func (c *SessionCache) revoke(jti string, expires time.Time) {
+	if jti == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune()
+	delete(c.live, jti)
+	c.revoked[jti] = expires
+}
+
+// revokeUser records that every session of userID ended, once they are
+// gone from the database. Sessions not in the cache need nothing: the
+// database no longer has them, and a lookup already under way is not
+// remembered.
+func (c *SessionCache) revokeUser(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ended[userID] = time.Now()
+	for jti, s := range c.live {
+		if s.userID == userID {
+			delete(c.live, jti)
+			c.revoked[jti] = s.expires
+		}
+	}
+}
+
+// prune drops stale entries, at most once per sessionCacheTTL. The caller
+// holds c.mu.
+func (c *SessionCache) prune() {
+	now := time.Now()
+	if now.Sub(c.pruned) < sessionCacheTTL {
+		return
+	}
+	c.pruned = now
+	for jti, s := range c.live {
+		if now.Sub(s.checked) >= sessionCacheTTL {
+			delete(c.live, jti)
+		}
+	}
+	for jti, expires := range c.revoked {
+		if now.After(expires) {
+			delete(c.revoked, jti)
+		}
+	}
+	for userID, ended := range c.ended {
+		if now.Sub(ended) >= sessionCacheTTL {
+			delete(c.ended, userID)
+		}
+	}
+}
+
+// checkSession rejects access tokens whose session has ended, e.g. by
+// logging out, with auth.ErrTokenRevoked. Tokens from before sessions were
+// checked carry no jti and must log in again.
+func (s *Server) checkSession(claims *auth.JWTClaims) error {
+	if claims.JTI == "" {
+		return auth.ErrTokenRevoked
+	}
+	live, revoked := s.sessions.lookup(claims.JTI)
+	if live {
+		return nil
+	}
+	expires := time.Unix(claims.ExpiresAt, 0)
+	if revoked {
+		return auth.ErrTokenRevoked
+	}
+
+	asked := time.Now()
+	session, err := s.db.GetSessionByJTI(claims.JTI)
+	if err == storage.ErrSessionNotFound || err == storage.ErrSessionExpired ||
+		err == nil && session.UserID != claims.UserID {
+		s.sessions.revoke(claims.JTI, expires)
+		return auth.ErrTokenRevoked
+	}
+	if err != nil {
+		log.Printf("Error getting session: %v", err)
+		return err
+	}
+
+	s.sessions.remember(claims.JTI, session.UserID, expires, asked)
+	return nil
+}
+
+// nextSession generates the tokens of a new session of user in the
+// refresh token family familyID
+func (s *Server) nextSession(r *http.Request, user *models.User, familyID string, refreshExpiresAt time.Time) (*models.Session, error) {
+	jti, err := auth.GenerateSessionID()
+	if err != nil {
+		return nil, err
+	}
+	token, expiresAt, err := s.jwtManager.GenerateToken(user.ID, user.Email, string(user.Role), user.IsAdmin, jti)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := s.jwtManager.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Session{
+		UserID:           user.ID,
+		JTI:              jti,
+		FamilyID:         familyID,
+		Token:            token,
+		RefreshToken:     refreshToken,
+		IPAddress:        getIPAddress(r),
+		UserAgent:        r.UserAgent(),
+		ExpiresAt:        expiresAt,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// newSession creates the access token, refresh token and session of a
+// login by user. The login starts a refresh token family that can be
+// refreshed for the refresh expiration of the JWT manager.
+func (s *Server) newSession(r *http.Request, user *models.User) (token, refreshToken string, err error) {
+	familyID, err := auth.GenerateSessionID()
+	if err != nil {
+		return "", "", err
+	}
+	session, err := s.nextSession(r, user, familyID, time.Now().Add(s.jwtManager.GetRefreshExpiration()))
+	if err != nil {
+		return "", "", err
+	}
+
+	// A token without its session would be refused, so failing to store
+	// the session fails the login
+	if _, err := s.db.CreateSession(session); err != nil {
+		return "", "", err
+	}
+	return session.Token, session.RefreshToken, nil
+}
+
+// rotateSession replaces old, whose refresh token was just presented,
+// with a new session of user in the same family and revokes the old
+// access token. The family keeps its expiry, so refreshing never extends
+// a login. It returns storage.ErrSessionNotFound when old was already
+// rotated by a concurrent request.
+func (s *Server) rotateSession(r *http.Request, user *models.User, old *models.Session) (token, refreshToken string, err error) {
+	session, err := s.nextSession(r, user, old.FamilyID, old.RefreshExpiresAt)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := s.db.RotateSession(old.ID, auth.HashRefreshToken(old.RefreshToken), session); err != nil {
+		return "", "", err
+	}
+	s.sessions.revoke(old.JTI, old.ExpiresAt)
+	return session.Token, session.RefreshToken, nil
+}
+
+// refreshTokenReused ends the family of a refresh token presented after
+// it was rotated: either the client or whoever copied the token already
+// used it, and there is no telling which. Every session of the family is
+// deleted and the reuse recorded in the audit log, so that both have to
+// log in again.
+func (s *Server) refreshTokenReused(r *http.Request, familyID string, userID int64) {
+	ended, err := s.db.DeleteSessionFamily(familyID)
+	if err != nil {
+		log.Printf("Error deleting sessions of family %s: %v", familyID, err)
+	}
+	for _, session := range ended {
+		s.sessions.revoke(session.JTI, session.ExpiresAt)
+	}
+
+	log.Printf("WARNING: Refresh token of user %d reused from %s; ended %d sessions of its family",
+		userID, getIPAddress(r), len(ended))
+	s.audit(r, models.AuditRefreshTokenReuse, models.AuditTargetUser, auditID(userID), map[string]interface{}{
+		"family":         familyID,
+		"sessions_ended": len(ended),
+	})
+}
+
+// RunSessionCleaner removes sessions and rotated refresh tokens past their
+// refresh expiry every interval. It is meant to run in the background for
+// the life of the server.
+func (s *Server) RunSessionCleaner(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.db.CleanExpiredSessions(); err != nil {
+			log.Printf("Error cleaning expired sessions: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// endSession deletes the session of token, whose jti claim is jti and
+// which expires at expires, and revokes the token at once
+func (s *Server) endSession(token, jti string, expires time.Time) error {
+	s.sessions.revoke(jti, expires)
+	return s.db.DeleteSession(token)
+}
+
+// endUserSessions deletes every session of userID and revokes their access
+// tokens at once. The rows go first: revoking them before would let a
+// concurrent check find them in the database and cache them again.
+func (s *Server) endUserSessions(userID int64) error {
+	err := s.db.DeleteUserSessions(userID)
+	s.sessions.revokeUser(userID)
+	return err
+}
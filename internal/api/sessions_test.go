@@ -0,0 +1,242 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// status returns the status of GET path with token
+func (e *testEnv) status(path, token string) int {
+	e.t.Helper()
+	resp, _ := e.do(http.MethodGet, path, token, "")
+	return resp.StatusCode
+}
+
+// refresh presents refreshToken and returns the response status, the new
+// tokens and the error message, if any
+func (e *testEnv) refresh(refreshToken string) (int, *models.AuthResponse, string) {
+	e.t.Helper()
+	resp, body := e.do(http.MethodPost, "/api/auth/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, refreshToken))
+	if resp.StatusCode != http.StatusOK {
+		var failure map[string]string
+		e.decode(body, &failure)
+		return resp.StatusCode, nil, failure["error"]
+	}
+	var tokens models.AuthResponse
+	e.decode(body, &tokens)
+	return resp.StatusCode, &tokens, ""
+}
+
+func TestSessionRevocation(t *testing.T) {
+	e := newTestEnv(t)
+	me := "/api/auth/me"
+
+	token, _ := e.login("ana@uni.edu")
+	if got := e.status(me, token); got != http.StatusOK {
+		t.Fatalf("new session: got %d, want 200", got)
+	}
+	e.do(http.MethodPost, "/api/auth/logout", token, "")
+	if got := e.status(me, token); got != http.StatusUnauthorized {
+		t.Errorf("token after logout: got %d, want 401", got)
+	}
+
+	// Logging out everywhere ends sessions already in the cache
+	first, _ := e.login("ana@uni.edu")
+	second, _ := e.login("ana@uni.edu")
+	e.status(me, first)
+	e.status(me, second)
+	e.do(http.MethodPost, "/api/auth/logout-all", first, "")
+	if e.status(me, first) != http.StatusUnauthorized || e.status(me, second) != http.StatusUnauthorized {
+		t.Errorf("tokens after logout-all: want both refused")
+	}
+
+	admin, _ := e.login("admin@uni.edu")
+	prof, _ := e.login("prof@uni.edu")
+	if got := e.status(me, prof); got != http.StatusOK {
+		t.Fatalf("professor session: got %d, want 200", got)
+	}
+	path := fmt.Sprintf("/api/admin/users/logout?id=%d", e.user("prof@uni.edu").ID)
+	if resp, body := e.do(http.MethodPost, path, admin, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("force logout: %d %s", resp.StatusCode, body)
+	}
+	if got := e.status(me, prof); got != http.StatusUnauthorized {
+		t.Errorf("token after force logout: got %d, want 401", got)
+	}
+	if got := e.status(me, admin); got != http.StatusOK {
+		t.Errorf("admin token after forcing out another user: got %d, want 200", got)
+	}
+
+	// Tokens from before sessions were checked carry no jti
+	user := e.user("ana@uni.edu")
+	legacy, _, err := auth.NewJWTManager("test-secret", time.Hour, time.Hour).
+		GenerateToken(user.ID, user.Email, string(user.Role), false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.status(me, legacy); got != http.StatusUnauthorized {
+		t.Errorf("token without jti: got %d, want 401", got)
+	}
+}
+
+func TestSessionEndedElsewhere(t *testing.T) {
+	e := newTestEnv(t)
+	token, _ := e.login("ana@uni.edu")
+
+	// A session deleted by another server sharing the database, before this
+	// one cached it
+	if err := e.db.DeleteUserSessions(e.user("ana@uni.edu").ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.status("/api/auth/me", token); got != http.StatusUnauthorized {
+		t.Errorf("token of a deleted session: got %d, want 401", got)
+	}
+}
+
+func TestExternalLoginRoleSyncEndsSessions(t *testing.T) {
+	e := newTestEnv(t)
+	prof, _ := e.login("prof@uni.edu")
+	if got := e.status("/api/auth/me", prof); got != http.StatusOK {
+		t.Fatalf("professor session: got %d, want 200", got)
+	}
+
+	// The directory now says the professor is a student
+	rec := httptest.NewRecorder()
+	e.srv.externalLogin(rec, httptest.NewRequest(http.MethodPost, "/api/auth/ldap/login", nil), &externalIdentity{
+		email:    "prof@uni.edu",
+		role:     models.RoleStudent,
+		syncRole: true,
+		via:      "ldap",
+	}, models.AuditLDAPLogin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("external login: %d %s", rec.Code, rec.Body)
+	}
+	if got := e.status("/api/auth/me", prof); got != http.StatusUnauthorized {
+		t.Errorf("token issued before the role changed: got %d, want 401", got)
+	}
+}
+
+func TestSessionCacheRevokeUser(t *testing.T) {
+	c := NewSessionCache()
+	expires := time.Now().Add(time.Hour)
+	asked := time.Now()
+	c.remember("ana-1", 1, expires, asked)
+	c.remember("ana-2", 1, expires, asked)
+	c.remember("carlos", 2, expires, asked)
+
+	c.revokeUser(1)
+
+	// A check that asked the database before the sessions ended answers late
+	c.remember("ana-3", 1, expires, asked)
+	for _, tc := range []struct {
+		jti           string
+		live, revoked bool
+	}{
+		{"ana-1", false, true},
+		{"ana-2", false, true},
+		{"ana-3", false, false},
+		{"carlos", true, false},
+		{"unknown", false, false},
+	} {
+		if live, revoked := c.lookup(tc.jti); live != tc.live || revoked != tc.revoked {
+			t.Errorf("lookup(%s) = %v, %v; want %v, %v", tc.jti, live, revoked, tc.live, tc.revoked)
+		}
+	}
+
+	// Sessions found after the revocation are cached as usual
+	c.remember("ana-4", 1, expires, time.Now())
+	if live, _ := c.lookup("ana-4"); !live {
+		t.Errorf("session checked after revokeUser not cached")
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	e := newTestEnv(t)
+	me := "/api/auth/me"
+
+	first, refreshToken := e.login("ana@uni.edu")
+	other, otherRefresh := e.login("ana@uni.edu") // Another login, another family
+	e.status(me, first)
+
+	code, second, _ := e.refresh(refreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: got %d, want 200", code)
+	}
+	code, third, _ := e.refresh(second.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("second refresh: got %d, want 200", code)
+	}
+	if e.status(me, first) != http.StatusUnauthorized || e.status(me, second.Token) != http.StatusUnauthorized {
+		t.Errorf("access tokens of rotated sessions still accepted")
+	}
+	if got := e.status(me, third.Token); got != http.StatusOK {
+		t.Fatalf("latest access token: got %d, want 200", got)
+	}
+
+	// Presenting a rotated refresh token again ends the whole family
+	if code, _, msg := e.refresh(refreshToken); code != http.StatusUnauthorized || msg != errRefreshTokenReused {
+		t.Errorf("reused refresh token: got %d %q, want 401 %q", code, msg, errRefreshTokenReused)
+	}
+	if got := e.status(me, third.Token); got != http.StatusUnauthorized {
+		t.Errorf("access token of the ended family: got %d, want 401", got)
+	}
+	if code, _, _ := e.refresh(third.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh token of the ended family: got %d, want 401", code)
+	}
+
+	if got := e.status(me, other); got != http.StatusOK {
+		t.Errorf("access token of another family: got %d, want 200", got)
+	}
+	if code, _, _ := e.refresh(otherRefresh); code != http.StatusOK {
+		t.Errorf("refresh token of another family: got %d, want 200", code)
+	}
+
+	admin, _ := e.login("admin@uni.edu")
+	resp, body := e.do(http.MethodGet, "/api/admin/audit?action="+models.AuditRefreshTokenReuse, admin, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("audit log: %d %s", resp.StatusCode, body)
+	}
+	var audit AuditListResponse
+	e.decode(body, &audit)
+	if len(audit.Events) != 1 || audit.Events[0].TargetID != auditID(e.user("ana@uni.edu").ID) {
+		t.Errorf("audit events = %s, want one reuse alert for ana", body)
+	}
+}
+
+func TestRefreshTokenExpiry(t *testing.T) {
+	e := newTestEnv(t)
+	live, _ := e.login("ana@uni.edu")
+
+	// A family whose refresh expiry has passed, though its access token has not
+	user := e.user("carlos@uni.edu")
+	_, err := e.db.CreateSession(&models.Session{
+		UserID:           user.ID,
+		JTI:              "expired-jti",
+		FamilyID:         "expired-family",
+		Token:            "expired-token",
+		RefreshToken:     "expired-refresh-token",
+		ExpiresAt:        time.Now().Add(time.Hour),
+		RefreshExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _, msg := e.refresh("expired-refresh-token"); code != http.StatusUnauthorized || msg != "Refresh token expired" {
+		t.Errorf("expired refresh token: got %d %q, want 401 %q", code, msg, "Refresh token expired")
+	}
+
+	if err := e.db.CleanExpiredSessions(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.db.GetSessionByJTI("expired-jti"); err == nil {
+		t.Errorf("expired family survived cleaning")
+	}
+	if got := e.status("/api/auth/me", live); got != http.StatusOK {
+		t.Errorf("live session after cleaning: got %d, want 200", got)
+	}
+}
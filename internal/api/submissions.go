@@ -0,0 +1,636 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jesus/FCCUR/internal/blob"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+const maxSubmissionBoxTitle = 200
+
+// submissionFormMemory is how much of a submission upload is buffered in
+// memory before spilling to a temporary file
+const submissionFormMemory = 32 << 20
+
+// SubmissionBoxRequest holds the settings of a submission box create or update
+type SubmissionBoxRequest struct {
+	CourseID          int64     `json:"course_id"`
+	Title             string    `json:"title"`
+	Description       string    `json:"description,omitempty"`
+	Deadline          time.Time `json:"deadline"`                     // RFC 3339, e.g. "2024-11-30T23:59:00-06:00"
+	AllowedExtensions []string  `json:"allowed_extensions,omitempty"` // Empty allows any upload type
+	MaxSize           int64     `json:"max_size,omitempty"`           // Bytes; 0 uses the upload limit
+	AcceptLate        *bool     `json:"accept_late,omitempty"`        // Defaults to true
+}
+
+// toBox validates the request and builds the box
+func (req *SubmissionBoxRequest) toBox() (*models.SubmissionBox, error) {
+	b := &models.SubmissionBox{
+		CourseID:          req.CourseID,
+		Title:             strings.TrimSpace(req.Title),
+		Description:       strings.TrimSpace(req.Description),
+		Deadline:          req.Deadline,
+		AllowedExtensions: models.ParseExtensions(strings.Join(req.AllowedExtensions, ",")),
+		MaxSize:           req.MaxSize,
+		AcceptLate:        req.AcceptLate == nil || *req.AcceptLate,
+	}
+
+	if b.Title == "" || b.Deadline.IsZero() {
+		return nil, fmt.Errorf("Missing required fields")
+	}
+	if utf8.RuneCountInString(b.Title) > maxSubmissionBoxTitle {
+		return nil, fmt.Errorf("Title must be at most %d characters", maxSubmissionBoxTitle)
+	}
+	for _, ext := range b.AllowedExtensions {
+		if !allowedExtensions[ext] {
+			return nil, fmt.Errorf("File type not allowed for uploads: %s", ext)
+		}
+	}
+	if b.MaxSize < 0 || b.MaxSize > maxUploadSize {
+		return nil, fmt.Errorf("max_size must be between 0 and %d bytes", int64(maxUploadSize))
+	}
+
+	return b, nil
+}
+
+// SubmissionBoxResponse is a submission box as listed to a user; students
+// also get their own submission, if any
+type SubmissionBoxResponse struct {
+	*models.SubmissionBox
+	Submission *models.Submission `json:"submission,omitempty"`
+}
+
+// SubmissionReceipt confirms a handed-in file. The hashes let students prove
+// which file they submitted.
+type SubmissionReceipt struct {
+	*models.Submission
+	Box      string    `json:"box"`
+	Course   string    `json:"course"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// currentUser loads the logged-in user. It writes the error response and
+// returns false when there is none.
+func (s *Server) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	claims, err := s.getCurrentUser(r)
+	if err != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized - login required"})
+		return nil, false
+	}
+
+	user, err := s.db.GetUserByID(claims.UserID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// submissionBox loads the box named by the query parameter param. It writes
+// the error response and returns false when the box does not exist.
+func (s *Server) submissionBox(w http.ResponseWriter, r *http.Request, param string) (*models.SubmissionBox, bool) {
+	id, err := strconv.ParseInt(r.URL.Query().Get(param), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	b, err := s.db.GetSubmissionBox(id)
+	if err != nil {
+		if err == storage.ErrSubmissionBoxNotFound {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "Submission box not found"})
+			return nil, false
+		}
+		log.Printf("Error fetching submission box %d: %v", id, err)
+		http.Error(w, "Error fetching submission box", http.StatusInternalServerError)
+		return nil, false
+	}
+	return b, true
+}
+
+// SubmissionBoxes lists (GET), opens (POST), changes (PATCH/PUT ?id=) and
+// deletes (DELETE ?id=) submission boxes. Admins and the course's
+// professors manage boxes; enrolled students see their courses' boxes.
+func (s *Server) SubmissionBoxes(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.listSubmissionBoxes(w, r, user)
+	case http.MethodPost:
+		s.createSubmissionBox(w, r, user)
+	case http.MethodPatch, http.MethodPut:
+		s.updateSubmissionBox(w, r, user)
+	case http.MethodDelete:
+		s.deleteSubmissionBox(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) listSubmissionBoxes(w http.ResponseWriter, r *http.Request, user *models.User) {
+	var courseID int64
+	if v := r.URL.Query().Get("course_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid course ID", http.StatusBadRequest)
+			return
+		}
+		courseID = id
+	}
+
+	boxes, err := s.db.ListSubmissionBoxes(courseID)
+	if err != nil {
+		log.Printf("Error listing submission boxes: %v", err)
+		http.Error(w, "Error fetching submission boxes", http.StatusInternalServerError)
+		return
+	}
+
+	resp := []*SubmissionBoxResponse{}
+	for _, b := range boxes {
+		switch {
+		case user.CanUploadToCourse(b.CourseName):
+			resp = append(resp, &SubmissionBoxResponse{SubmissionBox: b})
+		case user.EnrolledIn(b.CourseName):
+			sub, err := s.db.GetUserSubmission(b.ID, user.ID)
+			if err != nil && err != storage.ErrSubmissionNotFound {
+				log.Printf("Error fetching submission to box %d: %v", b.ID, err)
+				http.Error(w, "Error fetching submission boxes", http.StatusInternalServerError)
+				return
+			}
+			resp = append(resp, &SubmissionBoxResponse{SubmissionBox: b, Submission: sub})
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) createSubmissionBox(w http.ResponseWriter, r *http.Request, user *models.User) {
+	var req SubmissionBoxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	b, err := req.toBox()
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	course, err := s.db.GetCourse(b.CourseID)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown course; see /api/courses"})
+		return
+	}
+	if !user.CanUploadToCourse(course.Name) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "You don't have permission to open submission boxes in this course",
+		})
+		return
+	}
+
+	b.CreatedBy = user.ID
+	if err := s.db.CreateSubmissionBox(b); err != nil {
+		log.Printf("Error creating submission box: %v", err)
+		http.Error(w, "Error creating submission box", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Submission box %d opened in %s by %s (due %s)", b.ID, course.Name, user.Email, b.Deadline.Format(time.RFC3339))
+	s.respondSubmissionBox(w, http.StatusCreated, b.ID)
+}
+
+func (s *Server) updateSubmissionBox(w http.ResponseWriter, r *http.Request, user *models.User) {
+	existing, ok := s.submissionBox(w, r, "id")
+	if !ok {
+		return
+	}
+	if !user.CanUploadToCourse(existing.CourseName) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "You don't have permission to manage this submission box",
+		})
+		return
+	}
+
+	// PATCH keeps fields absent from the body; PUT replaces all of them
+	var req SubmissionBoxRequest
+	if r.Method == http.MethodPatch {
+		req = SubmissionBoxRequest{
+			Title:             existing.Title,
+			Description:       existing.Description,
+			Deadline:          existing.Deadline,
+			AllowedExtensions: existing.AllowedExtensions,
+			MaxSize:           existing.MaxSize,
+			AcceptLate:        &existing.AcceptLate,
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	b, err := req.toBox()
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	b.ID = existing.ID
+
+	if err := s.db.UpdateSubmissionBox(b); err != nil {
+		if err == storage.ErrSubmissionBoxNotFound {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "Submission box not found"})
+			return
+		}
+		log.Printf("Error updating submission box %d: %v", b.ID, err)
+		http.Error(w, "Error updating submission box", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Submission box %d updated by %s", b.ID, user.Email)
+	s.respondSubmissionBox(w, http.StatusOK, b.ID)
+}
+
+func (s *Server) deleteSubmissionBox(w http.ResponseWriter, r *http.Request, user *models.User) {
+	b, ok := s.submissionBox(w, r, "id")
+	if !ok {
+		return
+	}
+	if !user.CanUploadToCourse(b.CourseName) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "You don't have permission to manage this submission box",
+		})
+		return
+	}
+
+	submissions, err := s.db.ListSubmissions(b.ID)
+	if err != nil {
+		log.Printf("Error listing submissions to box %d: %v", b.ID, err)
+		http.Error(w, "Error deleting submission box", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.DeleteSubmissionBox(b.ID); err != nil {
+		if err == storage.ErrSubmissionBoxNotFound {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "Submission box not found"})
+			return
+		}
+		log.Printf("Error deleting submission box %d: %v", b.ID, err)
+		http.Error(w, "Error deleting submission box", http.StatusInternalServerError)
+		return
+	}
+
+	for _, sub := range submissions {
+		s.releaseBlob(sub.FilePath)
+	}
+
+	log.Printf("Submission box %d deleted by %s with %d submissions", b.ID, user.Email, len(submissions))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondSubmissionBox writes the stored submission box
+func (s *Server) respondSubmissionBox(w http.ResponseWriter, status int, id int64) {
+	b, err := s.db.GetSubmissionBox(id)
+	if err != nil {
+		log.Printf("Error reloading submission box %d: %v", id, err)
+		http.Error(w, "Error fetching submission box", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, status, b)
+}
+
+// Submissions hands a file in to the box ?box_id= (POST, multipart field
+// "file", enrolled students) or lists its submissions (GET): all of them
+// for the course's professors and admins, only their own for students.
+func (s *Server) Submissions(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	b, ok := s.submissionBox(w, r, "box_id")
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.listSubmissions(w, b, user)
+	case http.MethodPost:
+		// Limited per user, not per IP: a class behind one campus NAT
+		// submits at the same deadline
+		if s.submitLimiter != nil && !s.submitLimiter.Allow(fmt.Sprint(user.ID)) {
+			http.Error(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
+			return
+		}
+		if s.checkVerifiedUpload(w, user) {
+			s.submitFile(w, r, b, user)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) listSubmissions(w http.ResponseWriter, b *models.SubmissionBox, user *models.User) {
+	if user.CanUploadToCourse(b.CourseName) {
+		submissions, err := s.db.ListSubmissions(b.ID)
+		if err != nil {
+			log.Printf("Error listing submissions to box %d: %v", b.ID, err)
+			http.Error(w, "Error fetching submissions", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, submissions)
+		return
+	}
+
+	if !user.EnrolledIn(b.CourseName) {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Submission box not found"})
+		return
+	}
+
+	submissions := []*models.Submission{}
+	sub, err := s.db.GetUserSubmission(b.ID, user.ID)
+	switch err {
+	case nil:
+		submissions = append(submissions, sub)
+	case storage.ErrSubmissionNotFound:
+	default:
+		log.Printf("Error fetching submission to box %d: %v", b.ID, err)
+		http.Error(w, "Error fetching submissions", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, submissions)
+}
+
+func (s *Server) submitFile(w http.ResponseWriter, r *http.Request, b *models.SubmissionBox, user *models.User) {
+	if user.Role != models.RoleStudent || !user.EnrolledIn(b.CourseName) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "Only students enrolled in the course can hand in files",
+		})
+		return
+	}
+
+	submittedAt := time.Now().UTC()
+	late := b.IsLate(submittedAt)
+	if late && !b.AcceptLate {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "The deadline for this submission box has passed"})
+		return
+	}
+
+	limit := b.MaxSize
+	if limit == 0 {
+		limit = maxUploadSize
+	}
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1<<20)
+	if err := r.ParseMultipartForm(submissionFormMemory); err != nil {
+		respondJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+			"error": fmt.Sprintf("File too large (max %d bytes)", limit),
+		})
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > limit {
+		respondJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+			"error": fmt.Sprintf("File too large (max %d bytes)", limit),
+		})
+		return
+	}
+
+	if err := validateFileType(header); err != nil {
+		http.Error(w, fmt.Sprintf("File validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	sanitizedFilename, err := sanitizeFilename(header.Filename)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid filename: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !b.AllowsFile(sanitizedFilename) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("This submission box only accepts %s files", strings.Join(b.AllowedExtensions, ", ")),
+		})
+		return
+	}
+
+	// Stage file locally until its hash is known
+	dest, err := s.createStagingFile()
+	if err != nil {
+		http.Error(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+	tempPath := dest.Name()
+
+	blake3Hash, sha256Hash, fileSize, err := s.saveAndHash(file, dest)
+	dest.Close()
+	if err != nil {
+		os.Remove(tempPath)
+		http.Error(w, "Error processing file", http.StatusInternalServerError)
+		return
+	}
+
+	sub := &models.Submission{
+		BoxID:       b.ID,
+		UserID:      user.ID,
+		UserEmail:   user.Email,
+		UserName:    user.FullName,
+		FileName:    sanitizedFilename,
+		FileSize:    fileSize,
+		BLAKE3Hash:  blake3Hash,
+		SHA256Hash:  sha256Hash,
+		Late:        late,
+		SubmittedAt: submittedAt,
+	}
+	if err := s.saveSubmissionBlob(sub, tempPath); err != nil {
+		log.Printf("Error saving submission to box %d: %v", b.ID, err)
+		http.Error(w, "Error saving submission", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Submission %d to box %d by %s (late: %t, sha256 %s)", sub.ID, b.ID, user.Email, late, sha256Hash)
+	respondJSON(w, http.StatusCreated, SubmissionReceipt{
+		Submission: sub,
+		Box:        b.Title,
+		Course:     b.CourseName,
+		Deadline:   b.Deadline,
+	})
+}
+
+// DownloadSubmission streams one submitted file (?id=) to its student or
+// to the course's professors and admins
+func (s *Server) DownloadSubmission(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := s.db.GetSubmission(id)
+	if err != nil {
+		http.Error(w, "Submission not found", http.StatusNotFound)
+		return
+	}
+	if sub.UserID != user.ID {
+		b, err := s.db.GetSubmissionBox(sub.BoxID)
+		if err != nil || !user.CanUploadToCourse(b.CourseName) {
+			http.Error(w, "Submission not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	file, err := blob.Open(s.blobs, sub.FilePath)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", sub.FileName))
+	w.Header().Set("Cache-Control", "private")
+	w.Header().Set("X-SHA256-Hash", sub.SHA256Hash)
+	http.ServeContent(w, r, sub.FileName, sub.SubmittedAt, file)
+}
+
+// DownloadSubmissions streams every submission to the box ?box_id= as one
+// ZIP: a folder per student, prefixed with LATE- for late submissions, and
+// a submissions.csv manifest
+func (s *Server) DownloadSubmissions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	b, ok := s.submissionBox(w, r, "box_id")
+	if !ok {
+		return
+	}
+	if !user.CanUploadToCourse(b.CourseName) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "You don't have permission to download these submissions",
+		})
+		return
+	}
+
+	submissions, err := s.db.ListSubmissions(b.ID)
+	if err != nil {
+		log.Printf("Error listing submissions to box %d: %v", b.ID, err)
+		http.Error(w, "Error fetching submissions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		models.FamilySlug(b.CourseName+" "+b.Title)+"-submissions.zip"))
+	w.Header().Set("Cache-Control", "private")
+
+	// Headers are sent with the first entry, so errors past this point can
+	// only be logged
+	zw := zip.NewWriter(w)
+	for _, sub := range submissions {
+		if err := s.writeSubmissionEntry(zw, sub); err != nil {
+			log.Printf("Error adding submission %d to archive: %v", sub.ID, err)
+			return
+		}
+	}
+
+	manifest, err := zw.CreateHeader(&zip.FileHeader{Name: "submissions.csv", Method: zip.Deflate, Modified: time.Now()})
+	if err == nil {
+		err = writeSubmissionManifest(manifest, submissions)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		log.Printf("Error writing submissions archive for box %d: %v", b.ID, err)
+		return
+	}
+
+	log.Printf("Submissions of box %d downloaded by %s (%d files)", b.ID, user.Email, len(submissions))
+}
+
+// submissionFolder names a submission's folder in the bulk archive
+func submissionFolder(sub *models.Submission) string {
+	folder := strings.NewReplacer("/", "_", "\\", "_").Replace(sub.UserEmail)
+	if sub.Late {
+		folder = "LATE-" + folder
+	}
+	return folder
+}
+
+// writeSubmissionEntry copies a submitted file into the archive
+func (s *Server) writeSubmissionEntry(zw *zip.Writer, sub *models.Submission) error {
+	file, err := blob.Open(s.blobs, sub.FilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     submissionFolder(sub) + "/" + sub.FileName,
+		Method:   zip.Deflate,
+		Modified: sub.SubmittedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+// writeSubmissionManifest writes one CSV row per submission
+func writeSubmissionManifest(w io.Writer, submissions []*models.Submission) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"email", "name", "file", "size", "sha256", "blake3", "submitted_at", "late"})
+	for _, sub := range submissions {
+		cw.Write([]string{
+			sub.UserEmail,
+			sub.UserName,
+			submissionFolder(sub) + "/" + sub.FileName,
+			strconv.FormatInt(sub.FileSize, 10),
+			sub.SHA256Hash,
+			sub.BLAKE3Hash,
+			sub.SubmittedAt.UTC().Format(time.RFC3339),
+			strconv.FormatBool(sub.Late),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
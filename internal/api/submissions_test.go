@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// newSubmissionBox opens a box in a new course with ana and carlos enrolled
+func newSubmissionBox(t *testing.T, e *testEnv) *models.SubmissionBox {
+	t.Helper()
+	course := &models.Course{Name: "Redes"}
+	if err := e.db.CreateCourse(course); err != nil {
+		t.Fatal(err)
+	}
+	for _, email := range []string{"ana@uni.edu", "carlos@uni.edu"} {
+		if err := e.db.EnrollStudent(course.ID, e.user(email).ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	box := &models.SubmissionBox{
+		CourseID:   course.ID,
+		CourseName: course.Name,
+		Title:      "Práctica 1",
+		Deadline:   time.Now().Add(time.Hour),
+		CreatedBy:  e.user("prof@uni.edu").ID,
+	}
+	if err := e.db.CreateSubmissionBox(box); err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func TestSubmissionRateLimitPerUser(t *testing.T) {
+	e := newTestEnv(t)
+	e.srv.SetRateLimit(2)
+	box := newSubmissionBox(t, e)
+	path := fmt.Sprintf("/api/submissions?box_id=%d", box.ID)
+
+	ana, _ := e.login("ana@uni.edu")
+	carlos, _ := e.login("carlos@uni.edu")
+
+	// Listing own submissions does not use up the quota
+	for i := 0; i < 5; i++ {
+		if resp, body := e.do(http.MethodGet, path, ana, ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("listing %d: %d %s", i, resp.StatusCode, body)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp, body := e.sendFile(http.MethodPost, path, ana, "p1.zip", []byte("PK"), nil); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("submission %d: %d %s", i, resp.StatusCode, body)
+		}
+	}
+	if resp, _ := e.sendFile(http.MethodPost, path, ana, "p1.zip", []byte("PK"), nil); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("third submission: got %d, want 429", resp.StatusCode)
+	}
+
+	// Another student from the same address still has their quota
+	if resp, body := e.sendFile(http.MethodPost, path, carlos, "p1.zip", []byte("PK"), nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("submission by another user: %d %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+// TagsRequest lists tags to add to or remove from a package
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// PackageTags adds (POST) or removes (DELETE) tags on a package. Admins and
+// the professors of the package's course may change tags.
+func (s *Server) PackageTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.getCurrentUser(r)
+	if err != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized - login required"})
+		return
+	}
+
+	user, err := s.db.GetUserByID(claims.UserID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	pkg, err := s.db.GetPackage(id)
+	if err != nil {
+		http.Error(w, "Package not found", http.StatusNotFound)
+		return
+	}
+
+	if !canEditPackage(claims, user, pkg) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "You don't have permission to edit this package",
+		})
+		return
+	}
+
+	var req TagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	tags := models.NormalizeTags(req.Tags)
+	if len(tags) == 0 {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "No tags given"})
+		return
+	}
+	if err := validateTags(tags); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		err = s.db.AddPackageTags(id, tags)
+	} else {
+		err = s.db.RemovePackageTags(id, tags)
+	}
+	if err != nil {
+		if err == storage.ErrPackageNotFound {
+			http.Error(w, "Package not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error changing tags of package %d: %v", id, err)
+		http.Error(w, "Error updating tags", http.StatusInternalServerError)
+		return
+	}
+
+	s.cache.Invalidate()
+
+	log.Printf("Package %d tags changed by %s: %s %v", id, user.Email, r.Method, tags)
+	tagChange := "added"
+	if r.Method != http.MethodPost {
+		tagChange = "removed"
+	}
+	s.audit(r, models.AuditPackageTags, models.AuditTargetPackage, auditID(id), map[string][]string{tagChange: tags})
+
+	if updated, err := s.db.GetPackage(id); err == nil {
+		pkg = updated
+	}
+	respondJSON(w, http.StatusOK, pkg)
+}
+
+// GetTags returns tag counts for the packages matching the listing filters,
+// most used first, for the facet sidebar
+func (s *Server) GetTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := packageFilterParams(r.URL.Query())
+	q.Viewer = s.viewer(r)
+
+	tags, err := s.db.GetTagCounts(q)
+	if err != nil {
+		log.Printf("Error counting tags: %v", err)
+		http.Error(w, "Error fetching tags", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, tags)
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+// defaultTrashRetention is how long deleted packages stay restorable
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashedPackage is a package in the trash and when it will be purged
+type TrashedPackage struct {
+	*models.Package
+	PurgeAt *time.Time `json:"purge_at,omitempty"` // Absent when the trash is kept until purged by hand
+}
+
+// SetTrashRetention sets how long deleted packages stay in the trash before
+// the purger removes them; 0 keeps them until purged by hand
+func (s *Server) SetTrashRetention(retention time.Duration) {
+	s.trashRetention = retention
+}
+
+// trashedPackage adds the purge time to a package in the trash
+func (s *Server) trashedPackage(pkg *models.Package) *TrashedPackage {
+	t := &TrashedPackage{Package: pkg}
+	if s.trashRetention > 0 && pkg.DeletedAt != nil {
+		purgeAt := pkg.DeletedAt.Add(s.trashRetention)
+		t.PurgeAt = &purgeAt
+	}
+	return t
+}
+
+// Trash lists the packages in the trash (GET) and purges them for good
+// (DELETE ?id=, or the whole trash without id). Admin only.
+func (s *Server) Trash(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		packages, err := s.db.ListTrash(nil)
+		if err != nil {
+			log.Printf("Error listing trash: %v", err)
+			http.Error(w, "Error fetching trash", http.StatusInternalServerError)
+			return
+		}
+
+		trashed := make([]*TrashedPackage, len(packages))
+		for i, pkg := range packages {
+			trashed[i] = s.trashedPackage(pkg)
+		}
+		respondJSON(w, http.StatusOK, trashed)
+
+	case http.MethodDelete:
+		var packages []*models.Package
+		if v := r.URL.Query().Get("id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			pkg, err := s.db.GetTrashedPackage(id)
+			if err != nil {
+				respondJSON(w, http.StatusNotFound, map[string]string{"error": "Package not found in trash"})
+				return
+			}
+			packages = append(packages, pkg)
+		} else {
+			var err error
+			if packages, err = s.db.ListTrash(nil); err != nil {
+				log.Printf("Error listing trash: %v", err)
+				http.Error(w, "Error fetching trash", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		purged := s.purgePackages(r, packages)
+		respondJSON(w, http.StatusOK, map[string]interface{}{"purged": purged})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RestorePackage takes a package out of the trash (POST ?id=), with its
+// file, revisions, tags and download history. Admin only.
+func (s *Server) RestorePackage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	switch err := s.db.RestorePackage(id); err {
+	case nil:
+	case storage.ErrPackageNotFound:
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Package not found in trash"})
+		return
+	default:
+		log.Printf("Error restoring package %d: %v", id, err)
+		http.Error(w, "Error restoring package", http.StatusInternalServerError)
+		return
+	}
+
+	s.cache.Invalidate()
+	log.Printf("Package restored from trash: ID=%d", id)
+	s.audit(r, models.AuditPackageRestore, models.AuditTargetPackage, auditID(id), nil)
+
+	pkg, err := s.db.GetPackage(id)
+	if err != nil {
+		log.Printf("Error reloading package %d: %v", id, err)
+		http.Error(w, "Error fetching package", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, pkg)
+}
+
+// purgePackages removes packages from the trash for good and returns how
+// many were purged. Failures are logged and the package is left in place.
+// r is the admin's request, or nil when the purger expires them.
+func (s *Server) purgePackages(r *http.Request, packages []*models.Package) int {
+	purged := 0
+	for _, pkg := range packages {
+		err := s.purgePackage(pkg)
+		if err == storage.ErrPackageNotInTrash {
+			log.Printf("Package %d left the trash before it was purged", pkg.ID)
+			continue
+		}
+		if err != nil {
+			log.Printf("Error purging package %d: %v", pkg.ID, err)
+			continue
+		}
+		s.audit(r, models.AuditPackagePurge, models.AuditTargetPackage, auditID(pkg.ID), auditPackage(pkg))
+		purged++
+	}
+	if purged > 0 {
+		s.cache.Invalidate()
+	}
+	return purged
+}
+
+// purgePackage deletes a package row with its download records and
+// revisions, then releases its files. It returns
+// storage.ErrPackageNotInTrash, touching nothing, when the package was
+// restored since it was listed.
+func (s *Server) purgePackage(pkg *models.Package) error {
+	// Previous files must be released along with the current one
+	revisions, err := s.db.GetPackageRevisions(pkg.ID)
+	if err != nil {
+		log.Printf("Warning: Error fetching revisions of package %d: %v", pkg.ID, err)
+	}
+
+	if err := s.db.PurgePackage(pkg.ID); err != nil {
+		return err
+	}
+
+	// Delete the file unless another package shares the same blob
+	s.releaseBlob(pkg.FilePath)
+	for _, rev := range revisions {
+		s.releaseBlob(rev.FilePath)
+	}
+
+	if pkg.ThumbnailPath != "" {
+		if err := s.blobs.Delete(pkg.ThumbnailPath); err != nil {
+			log.Printf("Warning: Error deleting thumbnail %s: %v", pkg.ThumbnailPath, err)
+		}
+	}
+
+	log.Printf("Package purged: ID=%d, Name=%s, Version=%s, File=%s",
+		pkg.ID, pkg.Name, pkg.Version, pkg.FilePath)
+	return nil
+}
+
+// PurgeExpiredTrash purges packages that have been in the trash longer
+// than the retention period and returns how many were purged
+func (s *Server) PurgeExpiredTrash() int {
+	if s.trashRetention <= 0 {
+		return 0
+	}
+
+	cutoff := time.Now().Add(-s.trashRetention)
+	packages, err := s.db.ListTrash(&cutoff)
+	if err != nil {
+		log.Printf("Error listing expired trash: %v", err)
+		return 0
+	}
+	return s.purgePackages(nil, packages)
+}
+
+// RunTrashPurger purges expired trash every interval. It is meant to run
+// in the background for the life of the server.
+func (s *Server) RunTrashPurger(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n := s.PurgeExpiredTrash(); n > 0 {
+			log.Printf("Trash: purged %d expired packages", n)
+		}
+		<-ticker.C
+	}
+}
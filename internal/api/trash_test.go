@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+func TestPurgeSkipsRestoredPackages(t *testing.T) {
+	e := newTestEnv(t)
+	restored := newCoursePackage(t, e, "Apuntes", "Redes", models.VisibilityPublic)
+	purged := newCoursePackage(t, e, "Examen", "Redes", models.VisibilityPublic)
+	adminID := e.user("admin@uni.edu").ID
+	for _, pkg := range []*models.Package{restored, purged} {
+		if err := e.db.TrashPackage(pkg.ID, adminID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The purger lists the trash, then an admin restores one package
+	packages, err := e.db.ListTrash(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, _ := e.login("admin@uni.edu")
+	path := fmt.Sprintf("/api/admin/trash/restore?id=%d", restored.ID)
+	if resp, body := e.do(http.MethodPost, path, admin, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("restore: %d %s", resp.StatusCode, body)
+	}
+
+	if n := e.srv.purgePackages(nil, packages); n != 1 {
+		t.Errorf("purged %d packages, want 1", n)
+	}
+	if _, err := e.db.GetPackage(restored.ID); err != nil {
+		t.Errorf("restored package: %v", err)
+	}
+	if _, err := e.db.GetTrashedPackage(purged.ID); err == nil {
+		t.Errorf("package still in the trash after the purge")
+	}
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+// forcedResetExpiry is how long the reset token of a forced password reset
+// stays valid; longer than a self-service reset, since an admin hands it over
+const forcedResetExpiry = 72 * time.Hour
+
+// UserListResponse is the envelope returned by GET /api/admin/users
+type UserListResponse struct {
+	Users  []*models.User `json:"users"`
+	Total  int64          `json:"total"` // Matches across all pages
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// UserUpdateRequest holds the fields an admin may change on a user. Absent
+// fields are left unchanged.
+type UserUpdateRequest struct {
+	Role            *models.UserRole `json:"role"`
+	IsActive        *bool            `json:"is_active"`
+	AssignedCourses *[]string        `json:"assigned_courses"` // Course names; professors only
+}
+
+// ManageUsers lists and searches users (GET, or GET ?id= for one user) and
+// changes a user's role, activation and assigned courses (PATCH ?id=).
+// Admin only.
+func (s *Server) ManageUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("id") != "" {
+			s.getUser(w, r)
+		} else {
+			s.listUsers(w, r)
+		}
+	case http.MethodPatch:
+		s.updateUser(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listUsers lists users by email, filtered by ?q= (email or name), ?role=
+// and ?active=true|false, with limit and offset pagination
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := &storage.UserQuery{
+		Search: strings.TrimSpace(params.Get("q")),
+		Role:   models.UserRole(params.Get("role")),
+		Limit:  defaultPageSize,
+	}
+
+	if q.Role != "" && !models.ValidRole(q.Role) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid role"})
+		return
+	}
+
+	if v := params.Get("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid active (true, false)"})
+			return
+		}
+		q.Active = &active
+	}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		q.Limit = min(n, maxPageSize)
+	}
+
+	if v := params.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		q.Offset = n
+	}
+
+	page, err := s.db.ListUsers(q)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, UserListResponse{
+		Users:  page.Users,
+		Total:  page.Total,
+		Limit:  q.Limit,
+		Offset: q.Offset,
+	})
+}
+
+// getUser returns the user ?id=
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, user)
+}
+
+// updateUser applies a UserUpdateRequest to the user ?id=. Demoting or
+// deactivating a user ends their sessions; admins cannot do either to
+// themselves.
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req UserUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	role := user.Role
+	if req.Role != nil {
+		role = *req.Role
+		if !models.ValidRole(role) {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid role"})
+			return
+		}
+	}
+	active := user.IsActive
+	if req.IsActive != nil {
+		active = *req.IsActive
+	}
+
+	if claims, err := s.getCurrentUser(r); err == nil && claims.UserID == user.ID &&
+		(role != user.Role || !active) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "You cannot change the role of or deactivate your own account",
+		})
+		return
+	}
+
+	// Only professors teach courses; other roles lose their assignments
+	var courseIDs []int64
+	setCourses := role != models.RoleProfessor && len(user.Courses()) > 0
+	if req.AssignedCourses != nil {
+		if len(*req.AssignedCourses) > 0 && role != models.RoleProfessor {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Only professors can be assigned to courses"})
+			return
+		}
+		for _, name := range *req.AssignedCourses {
+			course, err := s.db.GetCourseByName(strings.TrimSpace(name))
+			if err != nil {
+				if err == storage.ErrCourseNotFound {
+					respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown course: " + name})
+					return
+				}
+				log.Printf("Error fetching course %q: %v", name, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			courseIDs = append(courseIDs, course.ID)
+		}
+		setCourses = true
+	}
+
+	if role != user.Role {
+		if err := s.db.UpdateUserRole(user.ID, role); err != nil {
+			s.userUpdateError(w, user.ID, err)
+			return
+		}
+	}
+	if active != user.IsActive {
+		if err := s.db.SetUserActive(user.ID, active); err != nil {
+			s.userUpdateError(w, user.ID, err)
+			return
+		}
+	}
+	if setCourses {
+		if err := s.db.SetUserCourses(user.ID, courseIDs); err != nil {
+			s.userUpdateError(w, user.ID, err)
+			return
+		}
+	}
+
+	// Tokens carry the role; make the user log in again to pick it up.
+	// Personal access tokens follow the live role, so only deactivating
+	// the account revokes them.
+	if role != user.Role || !active && user.IsActive {
+		if err := s.endUserSessions(user.ID); err != nil {
+			log.Printf("Error deleting sessions of user %d: %v", user.ID, err)
+		}
+	}
+	if !active && user.IsActive {
+		if n, err := s.db.DeleteUserAccessTokens(user.ID); err != nil {
+			log.Printf("Error revoking access tokens of user %d: %v", user.ID, err)
+		} else if n > 0 {
+			log.Printf("Revoked %d access tokens of deactivated user %d", n, user.ID)
+		}
+	}
+
+	updated, err := s.db.GetUserByID(user.ID)
+	if err != nil {
+		log.Printf("Error reloading user %d: %v", user.ID, err)
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+
+	if changes := auditChanges(user, updated); len(changes) > 0 {
+		log.Printf("User %d (%s) updated: %v", user.ID, user.Email, changes)
+		s.audit(r, models.AuditUserUpdate, models.AuditTargetUser, auditID(user.ID), changes)
+	}
+
+	respondJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) userUpdateError(w http.ResponseWriter, userID int64, err error) {
+	if err == storage.ErrUserNotFound {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+	log.Printf("Error updating user %d: %v", userID, err)
+	http.Error(w, "Error updating user", http.StatusInternalServerError)
+}
+
+// ForceLogout ends every session of the user ?id= (POST). Admin only.
+func (s *Server) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.endUserSessions(user.ID); err != nil {
+		log.Printf("Error deleting sessions of user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d (%s) logged out by an admin", user.ID, user.Email)
+	s.audit(r, models.AuditUserForceLogout, models.AuditTargetUser, auditID(user.ID), nil)
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "User logged out from all devices"})
+}
+
+// ForcePasswordReset disables the password of the user ?id= (POST), ends
+// their sessions and issues a reset token for /api/auth/reset-password. The
+// reset link is emailed to the user, and the token is also returned so the
+// admin can pass it on. Admin only.
+func (s *Server) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	resetToken, err := auth.GenerateVerificationToken()
+	if err != nil {
+		log.Printf("Error generating reset token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	expiry := time.Now().Add(forcedResetExpiry)
+	if err := s.db.ForcePasswordReset(user.ID, resetToken, expiry); err != nil {
+		s.userUpdateError(w, user.ID, err)
+		return
+	}
+	if err := s.endUserSessions(user.ID); err != nil {
+		log.Printf("Error deleting sessions of user %d: %v", user.ID, err)
+	}
+
+	s.sendPasswordResetEmail(r, user, resetToken, expiry)
+
+	log.Printf("Password reset forced for user %d (%s)", user.ID, user.Email)
+	s.audit(r, models.AuditUserForcePasswordReset, models.AuditTargetUser, auditID(user.ID), nil)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":     "Password disabled; the user must set a new one with the reset token",
+		"reset_token": resetToken,
+		"expires_at":  expiry.UTC(),
+	})
+}
+
+// targetUser loads the user named by the id query parameter. It writes the
+// error response and returns false when there is none.
+func (s *Server) targetUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := s.db.GetUserByID(id)
+	if err != nil {
+		if err == storage.ErrUserNotFound {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+			return nil, false
+		}
+		log.Printf("Error getting user %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
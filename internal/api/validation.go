@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
 )
 
 // Allowed MIME types for uploads
@@ -98,15 +100,25 @@ var dangerousPatterns = []*regexp.Regexp{
 
 // validateFileType checks if the file type is allowed
 func validateFileType(header *multipart.FileHeader) error {
+	// Check MIME type (if available)
+	mimeType := ""
+	if len(header.Header["Content-Type"]) > 0 {
+		mimeType = header.Header["Content-Type"][0]
+	}
+
+	return validateFileNameAndMIME(header.Filename, mimeType)
+}
+
+// validateFileNameAndMIME checks a filename extension and an optional MIME type
+// against the upload allowlists
+func validateFileNameAndMIME(filename, mimeType string) error {
 	// Check file extension
-	ext := strings.ToLower(filepath.Ext(header.Filename))
+	ext := strings.ToLower(filepath.Ext(filename))
 	if !allowedExtensions[ext] {
 		return fmt.Errorf("file type not allowed: %s", ext)
 	}
 
-	// Check MIME type (if available)
-	if len(header.Header["Content-Type"]) > 0 {
-		mimeType := header.Header["Content-Type"][0]
+	if mimeType != "" {
 		// Some MIME types include charset, extract just the type
 		mimeType = strings.Split(mimeType, ";")[0]
 		mimeType = strings.TrimSpace(mimeType)
@@ -196,3 +208,91 @@ func detectContentType(file multipart.File) (string, error) {
 	contentType := http.DetectContentType(buffer[:n])
 	return contentType, nil
 }
+
+// UploadMetadata holds the user-supplied package fields for an upload
+type UploadMetadata struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	Category    string            `json:"category"`
+	Platform    string            `json:"platform"`
+	Description string            `json:"description,omitempty"`
+	ContentType string            `json:"content_type"`          // "tool" or "material"
+	CourseName  string            `json:"course_name,omitempty"` // Optional, for materials
+	Tags        []string          `json:"tags,omitempty"`
+	Visibility  models.Visibility `json:"visibility,omitempty"` // Defaults to public
+}
+
+// validate checks required fields and fills in defaults
+func (m *UploadMetadata) validate() error {
+	// Default to "tool" if not specified
+	if m.ContentType == "" {
+		m.ContentType = "tool"
+	}
+
+	if m.Name == "" || m.Version == "" || m.Category == "" {
+		return fmt.Errorf("Missing required fields")
+	}
+
+	// For materials, course_name is recommended
+	if m.ContentType == "material" && m.CourseName == "" {
+		m.CourseName = "General"
+	}
+
+	if m.Visibility == "" {
+		m.Visibility = models.VisibilityPublic
+	}
+	if err := validateVisibility(m.Visibility, m.CourseName); err != nil {
+		return err
+	}
+
+	m.Tags = models.NormalizeTags(m.Tags)
+	return validateTags(m.Tags)
+}
+
+// validateVisibility checks that v is a known level and that course-restricted
+// packages have a course
+func validateVisibility(v models.Visibility, courseName string) error {
+	if !models.ValidVisibility(v) {
+		return fmt.Errorf("Invalid visibility %q (public, authenticated, enrolled, staff)", v)
+	}
+	if v == models.VisibilityEnrolled && courseName == "" {
+		return fmt.Errorf("Course-restricted packages need a course_name")
+	}
+	return nil
+}
+
+// maxTagsPerRequest bounds how many tags one upload or tag request may add
+const maxTagsPerRequest = 20
+
+// validateTags checks normalized tags for length and count
+func validateTags(tags []string) error {
+	if len(tags) > maxTagsPerRequest {
+		return fmt.Errorf("Too many tags (max %d)", maxTagsPerRequest)
+	}
+	for _, tag := range tags {
+		if len(tag) > models.MaxTagLength {
+			return fmt.Errorf("Tag too long: %s", tag)
+		}
+	}
+	return nil
+}
+
+// toPackage builds the package record for an uploaded file; FilePath is
+// filled in once the file is placed in the blob store
+func (m *UploadMetadata) toPackage(fileName string, fileSize int64, blake3Hash, sha256Hash string) *models.Package {
+	return &models.Package{
+		Name:        m.Name,
+		Version:     m.Version,
+		Description: m.Description,
+		Category:    m.Category,
+		ContentType: m.ContentType,
+		CourseName:  m.CourseName,
+		FileName:    fileName,
+		FileSize:    fileSize,
+		BLAKE3Hash:  blake3Hash,
+		SHA256Hash:  sha256Hash,
+		Platform:    m.Platform,
+		Tags:        m.Tags,
+		Visibility:  m.Visibility,
+	}
+}
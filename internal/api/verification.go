@@ -0,0 +1,229 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/auth"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+const (
+	// verificationExpiry is how long a verification link stays valid
+	verificationExpiry = 48 * time.Hour
+	// verificationResends bounds verification emails per address and hour
+	verificationResends = 3
+)
+
+// What an unverified email address keeps a user from doing
+const (
+	RequireVerifiedNone   = ""
+	RequireVerifiedUpload = "upload"
+	RequireVerifiedLogin  = "login" // Also blocks uploads
+)
+
+// VerificationConfig decides what users may do before confirming their
+// email address, and which addresses may register themselves. Admins are
+// never blocked, so that enabling it cannot lock out the operators.
+type VerificationConfig struct {
+	Require        string   // RequireVerifiedNone, RequireVerifiedUpload or RequireVerifiedLogin
+	AllowedDomains []string // Email domains, and their subdomains, open to self-registration; empty allows any
+}
+
+// blocks reports whether the policy stops user from doing action, one of
+// RequireVerifiedUpload or RequireVerifiedLogin
+func (c VerificationConfig) blocks(user *models.User, action string) bool {
+	if user.EmailVerified || user.IsAdminRole() || c.Require == RequireVerifiedNone {
+		return false
+	}
+	return c.Require == RequireVerifiedLogin || action == RequireVerifiedUpload
+}
+
+// domainAllowed reports whether email may register itself
+func (c VerificationConfig) domainAllowed(email string) bool {
+	if len(c.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range c.AllowedDomains {
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseVerificationRequirement validates the value of the email
+// verification requirement option
+func ParseVerificationRequirement(value string) (string, error) {
+	switch value {
+	case RequireVerifiedNone, RequireVerifiedUpload, RequireVerifiedLogin:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown requirement %q (upload, login)", value)
+}
+
+// ParseDomains parses a comma-separated list of email domains, e.g.
+// "uni.edu,alumnos.uni.edu"
+func ParseDomains(list string) []string {
+	var domains []string
+	for _, d := range strings.Split(list, ",") {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// rejectRegistration writes the error response for an email outside the
+// registration allowlist
+func (s *Server) rejectRegistration(w http.ResponseWriter) {
+	respondJSON(w, http.StatusForbidden, map[string]string{
+		"error": "Registration is restricted to addresses of: " + strings.Join(s.verification.AllowedDomains, ", "),
+	})
+}
+
+// checkVerifiedUpload writes the error response and returns false when the
+// verification policy keeps user from uploading
+func (s *Server) checkVerifiedUpload(w http.ResponseWriter, user *models.User) bool {
+	if s.verification.blocks(user, RequireVerifiedUpload) {
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "Verify your email address before uploading",
+		})
+		return false
+	}
+	return true
+}
+
+// withVerifiedEmail middleware applies the verification policy to uploads
+func (s *Server) withVerifiedEmail(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := s.currentUser(w, r)
+		if !ok || !s.checkVerifiedUpload(w, user) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// issueVerification gives user a new verification token and emails it
+func (s *Server) issueVerification(r *http.Request, user *models.User) error {
+	token, err := auth.GenerateVerificationToken()
+	if err != nil {
+		return err
+	}
+	if err := s.db.SetUserVerificationToken(user.ID, token, time.Now().Add(verificationExpiry)); err != nil {
+		return err
+	}
+	s.sendVerificationEmail(r, user, token)
+	return nil
+}
+
+// VerifyEmail confirms the email address of the user holding the token
+// from a verification email (POST {"token": ...})
+func (s *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	user, err := s.db.GetUserByVerificationToken(req.Token)
+	if err != nil {
+		if err == storage.ErrInvalidToken {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired verification token"})
+			return
+		}
+		log.Printf("Error getting user by verification token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.SetUserEmailVerified(user.ID); err != nil {
+		log.Printf("Error verifying email of user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.auditUser(r, user, models.AuditEmailVerify, nil)
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Email verified successfully"})
+}
+
+// ResendVerification sends a new verification email (POST) to the logged-in
+// user, or to {"email": ...} for users who cannot log in yet. At most
+// verificationResends emails go to an address per hour.
+func (s *Server) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var user *models.User
+	if claims, err := s.getCurrentUser(r); err == nil {
+		if user, err = s.db.GetUserByID(claims.UserID); err != nil {
+			log.Printf("Error getting user: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if user.EmailVerified {
+			respondJSON(w, http.StatusOK, map[string]string{"message": "Email already verified"})
+			return
+		}
+	}
+
+	email := ""
+	if user != nil {
+		email = user.Email
+	} else {
+		var req models.PasswordReset
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+			return
+		}
+		email = strings.TrimSpace(req.Email)
+	}
+
+	// Throttle by address, whether or not it has an account, so the limit
+	// does not reveal which addresses are registered
+	if !s.verifyLimiter.Allow(strings.ToLower(email)) {
+		w.Header().Set("Retry-After", "3600")
+		respondJSON(w, http.StatusTooManyRequests, map[string]string{
+			"error": "Too many verification emails requested, try again later",
+		})
+		return
+	}
+
+	if user == nil {
+		if found, err := s.db.GetUserByEmail(email); err == nil && !found.EmailVerified && found.IsActive {
+			user = found
+		}
+	}
+	if user != nil {
+		if err := s.issueVerification(r, user); err != nil {
+			log.Printf("Error issuing verification token for user %d: %v", user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message": "If the account exists and is not verified, a verification email will be sent",
+	})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// packageLinkExpiry is how long a signed package link stays valid
+const packageLinkExpiry = 10 * time.Minute
+
+// PackageLinkResponse is a signed link to a package that may be opened
+// without an Authorization header, e.g. by the browser
+type PackageLinkResponse struct {
+	URL       string    `json:"url"`   // Download URL
+	Query     string    `json:"query"` // Also accepted by thumbnail, checksum and archive endpoints
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// viewer returns the requesting user for visibility checks, or nil for
+// anonymous visitors, invalid tokens and deactivated accounts
+func (s *Server) viewer(r *http.Request) *models.Viewer {
+	claims, err := s.getCurrentUser(r)
+	if err != nil {
+		return nil
+	}
+
+	user, err := s.db.GetUserByID(claims.UserID)
+	if err != nil || !user.IsActive {
+		return nil
+	}
+
+	return user.Viewer()
+}
+
+// viewerCacheKey identifies the set of packages v may see, so cached
+// listings are only shared between viewers who see the same packages
+func viewerCacheKey(v *models.Viewer) string {
+	switch {
+	case v == nil:
+		return "anon"
+	case v.SeesAll():
+		return "all"
+	}
+	levels := make([]string, 0, 3)
+	for _, level := range v.Levels() {
+		levels = append(levels, string(level))
+	}
+	return strings.Join(levels, ",") + "|" + strings.Join(v.Courses, ",")
+}
+
+// visiblePackage loads package id and checks the requester may see it,
+// either as a logged-in user or through a signed link. Packages the
+// requester may not see are reported as not found.
+func (s *Server) visiblePackage(w http.ResponseWriter, r *http.Request, id int64) (*models.Package, bool) {
+	pkg, err := s.db.GetPackage(id)
+	if err != nil {
+		http.Error(w, "Package not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if pkg.VisibleTo(nil) || s.validPackageLink(r, id) || pkg.VisibleTo(s.viewer(r)) {
+		return pkg, true
+	}
+
+	http.Error(w, "Package not found", http.StatusNotFound)
+	return nil, false
+}
+
+// signPackageLink returns the expires and signature query parameters that
+// grant access to package id until expires
+func (s *Server) signPackageLink(id int64, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{
+		"expires":   {exp},
+		"signature": {s.jwtManager.SignData(fmt.Sprintf("package:%d:%s", id, exp))},
+	}.Encode()
+}
+
+// validPackageLink reports whether the request carries an unexpired link
+// signature for package id
+func (s *Server) validPackageLink(r *http.Request, id int64) bool {
+	params := r.URL.Query()
+	exp, signature := params.Get("expires"), params.Get("signature")
+	if exp == "" || signature == "" {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	return s.jwtManager.VerifyData(fmt.Sprintf("package:%d:%s", id, exp), signature)
+}
+
+// GetPackageLink issues a short-lived signed link to a package the
+// requester may see. Non-public packages need one to be downloaded by the
+// browser, which cannot attach the access token to a plain link.
+func (s *Server) GetPackageLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	pkg, err := s.db.GetPackage(id)
+	if err != nil || !pkg.VisibleTo(s.viewer(r)) {
+		http.Error(w, "Package not found", http.StatusNotFound)
+		return
+	}
+
+	expires := time.Now().Add(packageLinkExpiry)
+	query := s.signPackageLink(id, expires)
+	respondJSON(w, http.StatusOK, PackageLinkResponse{
+		URL:       fmt.Sprintf("/download/?id=%d&%s", id, query),
+		Query:     query,
+		ExpiresAt: expires.UTC().Truncate(time.Second),
+	})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+func TestPackageVisibilityFiltering(t *testing.T) {
+	e := newTestEnv(t)
+	packages := map[string]*models.Package{}
+	for _, v := range []models.Visibility{
+		models.VisibilityPublic, models.VisibilityAuthenticated,
+		models.VisibilityEnrolled, models.VisibilityStaff,
+	} {
+		packages[string(v)] = newCoursePackage(t, e, string(v), "Redes", v)
+	}
+	course, err := e.db.GetCourseByName("Redes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.db.EnrollStudent(course.ID, e.user("ana@uni.edu").ID); err != nil {
+		t.Fatal(err)
+	}
+
+	admin, _ := e.login("admin@uni.edu")
+	prof, _ := e.login("prof@uni.edu")
+	ana, _ := e.login("ana@uni.edu")
+	carlos, _ := e.login("carlos@uni.edu")
+
+	for _, tc := range []struct {
+		viewer string
+		token  string
+		want   string
+	}{
+		{"anonymous", "", "public"},
+		{"student", carlos, "authenticated,public"},
+		{"enrolled student", ana, "authenticated,enrolled,public"},
+		{"professor of another course", prof, "authenticated,public,staff"},
+		{"admin", admin, "authenticated,enrolled,public,staff"},
+	} {
+		resp, body := e.do(http.MethodGet, "/api/packages", tc.token, "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("listing as %s: %d %s", tc.viewer, resp.StatusCode, body)
+		}
+		var list PackageListResponse
+		e.decode(body, &list)
+		var names []string
+		for _, pkg := range list.Packages {
+			names = append(names, pkg.Name)
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, ","); got != tc.want {
+			t.Errorf("%s lists %q, want %q", tc.viewer, got, tc.want)
+		}
+
+		// Packages left out of the listing are not found by ID either
+		for name, pkg := range packages {
+			want := http.StatusNotFound
+			if strings.Contains(","+tc.want+",", ","+name+",") {
+				want = http.StatusOK
+			}
+			resp, _ := e.do(http.MethodGet, fmt.Sprintf("/api/packages/?id=%d", pkg.ID), tc.token, "")
+			if resp.StatusCode != want {
+				t.Errorf("%s getting %s package: got %d, want %d", tc.viewer, name, resp.StatusCode, want)
+			}
+		}
+	}
+}
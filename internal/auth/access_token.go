@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// AccessTokenPrefix starts every personal access token, which tells them
+// apart from JWTs and makes leaked tokens easy to search for
+const AccessTokenPrefix = "fccur_"
+
+// accessTokenShown is how much of a token is kept to identify it in listings
+const accessTokenShown = len(AccessTokenPrefix) + 6
+
+// GenerateAccessToken returns a new random personal access token and the
+// prefix of it that is stored in clear
+func GenerateAccessToken() (token, prefix string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, token[:accessTokenShown], nil
+}
+
+// IsAccessToken reports whether a bearer token is a personal access token
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// HashAccessToken returns the stored form of a personal access token. The
+// tokens are random, so a fast hash suffices.
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AllowsCourse reports whether a request may act on packages of a course.
+// Only access tokens limited to some courses restrict it.
+func (c *JWTClaims) AllowsCourse(name string) bool {
+	if len(c.Courses) == 0 {
+		return true
+	}
+	for _, course := range c.Courses {
+		if course == name {
+			return true
+		}
+	}
+	return false
+}
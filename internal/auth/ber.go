@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Just enough BER (X.690) to speak LDAP: definite lengths and single-byte
+// tags, which is all RFC 4511 uses.
+
+// BER universal tags
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+)
+
+// maxBERLength bounds a single LDAP message read from the server
+const maxBERLength = 8 << 20
+
+var errBERMalformed = errors.New("malformed BER data")
+
+// berTLV is a decoded tag-length-value element
+type berTLV struct {
+	tag   byte
+	value []byte
+}
+
+// berEncode returns the element tag holding the concatenated contents
+func berEncode(tag byte, contents ...[]byte) []byte {
+	n := 0
+	for _, c := range contents {
+		n += len(c)
+	}
+
+	out := []byte{tag}
+	if n < 0x80 {
+		out = append(out, byte(n))
+	} else {
+		var length []byte
+		for l := n; l > 0; l >>= 8 {
+			length = append([]byte{byte(l)}, length...)
+		}
+		out = append(out, 0x80|byte(len(length)))
+		out = append(out, length...)
+	}
+	for _, c := range contents {
+		out = append(out, c...)
+	}
+	return out
+}
+
+// berInt encodes v as a two's complement integer with tag
+func berInt(tag byte, v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return berEncode(tag, b)
+}
+
+// berString encodes s as an octet string with tag
+func berString(tag byte, s string) []byte {
+	return berEncode(tag, []byte(s))
+}
+
+// berBool encodes v as a boolean
+func berBool(v bool) []byte {
+	if v {
+		return berEncode(berBoolean, []byte{0xff})
+	}
+	return berEncode(berBoolean, []byte{0x00})
+}
+
+// readBER reads one element from r
+func readBER(r *bufio.Reader) (berTLV, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return berTLV{}, err
+	}
+	if tag&0x1f == 0x1f {
+		return berTLV{}, fmt.Errorf("%w: multi-byte tag", errBERMalformed)
+	}
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return berTLV{}, err
+	}
+	n := int(first)
+	if first&0x80 != 0 {
+		size := int(first & 0x7f)
+		if size == 0 || size > 4 {
+			return berTLV{}, fmt.Errorf("%w: unsupported length", errBERMalformed)
+		}
+		n = 0
+		for i := 0; i < size; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return berTLV{}, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	// Four length bytes overflow int where it has 32 bits
+	if n < 0 || n > maxBERLength {
+		return berTLV{}, fmt.Errorf("%w: element of %d bytes", errBERMalformed, n)
+	}
+
+	value := make([]byte, n)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return berTLV{}, err
+	}
+	return berTLV{tag: tag, value: value}, nil
+}
+
+// berChildren decodes the elements inside a constructed element
+func berChildren(b []byte) ([]berTLV, error) {
+	var children []berTLV
+	for len(b) > 0 {
+		if len(b) < 2 || b[0]&0x1f == 0x1f {
+			return nil, errBERMalformed
+		}
+		tag, n, header := b[0], int(b[1]), 2
+		if b[1]&0x80 != 0 {
+			size := int(b[1] & 0x7f)
+			if size == 0 || size > 4 || len(b) < 2+size {
+				return nil, errBERMalformed
+			}
+			n = 0
+			for _, c := range b[2 : 2+size] {
+				n = n<<8 | int(c)
+			}
+			header += size
+		}
+		if n < 0 || len(b)-header < n {
+			return nil, errBERMalformed
+		}
+		children = append(children, berTLV{tag: tag, value: b[header : header+n]})
+		b = b[header+n:]
+	}
+	return children, nil
+}
+
+// int decodes the element as a two's complement integer
+func (t berTLV) int() (int64, error) {
+	if len(t.value) == 0 || len(t.value) > 8 {
+		return 0, errBERMalformed
+	}
+	v := int64(int8(t.value[0]))
+	for _, b := range t.value[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+// ldapFilter encodes an RFC 4515 string filter such as
+// "(&(objectClass=person)(uid=jdoe))" as an RFC 4511 Filter. Extensible
+// matches are not supported.
+func ldapFilter(s string) ([]byte, error) {
+	filter, rest, err := parseLDAPFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid LDAP filter %q: trailing %q", s, rest)
+	}
+	return filter, nil
+}
+
+// parseLDAPFilter encodes the filter at the start of s and returns what
+// follows it
+func parseLDAPFilter(s string) ([]byte, string, error) {
+	if !strings.HasPrefix(s, "(") || len(s) < 2 {
+		return nil, "", fmt.Errorf("invalid LDAP filter %q: expected (", s)
+	}
+	s = s[1:]
+
+	switch s[0] {
+	case '&', '|', '!':
+		op := s[0]
+		s = s[1:]
+		var children [][]byte
+		for strings.HasPrefix(s, "(") {
+			child, rest, err := parseLDAPFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			children = append(children, child)
+			s = rest
+		}
+		if !strings.HasPrefix(s, ")") {
+			return nil, "", fmt.Errorf("invalid LDAP filter: expected ) before %q", s)
+		}
+		switch op {
+		case '&':
+			return berEncode(0xa0, children...), s[1:], nil
+		case '|':
+			return berEncode(0xa1, children...), s[1:], nil
+		default:
+			if len(children) != 1 {
+				return nil, "", errors.New("invalid LDAP filter: ! takes one filter")
+			}
+			return berEncode(0xa2, children[0]), s[1:], nil
+		}
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", fmt.Errorf("invalid LDAP filter: unterminated %q", s)
+	}
+	item, err := ldapFilterItem(s[:end])
+	if err != nil {
+		return nil, "", err
+	}
+	return item, s[end+1:], nil
+}
+
+// ldapFilterItem encodes a single attribute assertion such as "uid=jdoe",
+// "cn=J*" or "mail=*"
+func ldapFilterItem(item string) ([]byte, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("invalid LDAP filter item %q", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+
+	var tag byte = 0xa3 // equalityMatch
+	switch attr[len(attr)-1] {
+	case '>':
+		tag = 0xa5 // greaterOrEqual
+	case '<':
+		tag = 0xa6 // lessOrEqual
+	case '~':
+		tag = 0xa8 // approxMatch
+	case ':':
+		return nil, fmt.Errorf("unsupported LDAP filter item %q: extensible match", item)
+	}
+	if tag != 0xa3 {
+		attr = attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return nil, fmt.Errorf("invalid LDAP filter item %q", item)
+	}
+
+	if tag == 0xa3 && value == "*" {
+		return berString(0x87, attr), nil // present
+	}
+	if tag == 0xa3 && strings.Contains(value, "*") {
+		return ldapSubstrings(attr, value)
+	}
+
+	v, err := unescapeLDAPFilter(value)
+	if err != nil {
+		return nil, err
+	}
+	return berEncode(tag, berString(berOctetString, attr), berString(berOctetString, v)), nil
+}
+
+// ldapSubstrings encodes a substrings assertion such as "cn=Ja*Do*e"
+func ldapSubstrings(attr, value string) ([]byte, error) {
+	parts := strings.Split(value, "*")
+	var subs [][]byte
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		v, err := unescapeLDAPFilter(part)
+		if err != nil {
+			return nil, err
+		}
+		var tag byte = 0x81 // any
+		switch i {
+		case 0:
+			tag = 0x80 // initial
+		case len(parts) - 1:
+			tag = 0x82 // final
+		}
+		subs = append(subs, berString(tag, v))
+	}
+	return berEncode(0xa4, berString(berOctetString, attr), berEncode(berSequence, subs...)), nil
+}
+
+// unescapeLDAPFilter decodes the \XX escapes of a filter value
+func unescapeLDAPFilter(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("invalid escape in LDAP filter value %q", s)
+		}
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in LDAP filter value %q", s)
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// EscapeLDAPFilter escapes s for use as a value in an LDAP filter, so that
+// user input cannot change the filter (RFC 4515)
+func EscapeLDAPFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, `\%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReadBERLengths(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"short form", []byte{berOctetString, 0x02, 'o', 'k'}, nil},
+		{"long form", append([]byte{berOctetString, 0x81, 0x80}, make([]byte, 0x80)...), nil},
+		{"four length bytes with the top bit set", []byte{berSequence, 0x84, 0x80, 0x00, 0x00, 0x00}, errBERMalformed},
+		{"four length bytes over the limit", []byte{berSequence, 0x84, 0x7f, 0xff, 0xff, 0xff}, errBERMalformed},
+		{"five length bytes", []byte{berSequence, 0x85, 0x00, 0x00, 0x00, 0x00, 0x01}, errBERMalformed},
+		{"indefinite length", []byte{berSequence, 0x80}, errBERMalformed},
+	} {
+		_, err := readBER(bufio.NewReader(bytes.NewReader(tc.data)))
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.err)
+		}
+	}
+}
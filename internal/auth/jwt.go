@@ -16,6 +16,7 @@ import (
 var (
 	ErrInvalidToken     = errors.New("invalid token")
 	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenRevoked     = errors.New("token revoked")
 	ErrWeakPassword     = errors.New("password does not meet requirements")
 	ErrInvalidEmail     = errors.New("invalid email address")
 )
@@ -28,6 +29,11 @@ type JWTClaims struct {
 	IsAdmin   bool   `json:"is_admin"` // Deprecated: use Role instead
 	ExpiresAt int64  `json:"exp"`
 	IssuedAt  int64  `json:"iat"`
+	JTI       string `json:"jti,omitempty"` // Names the session; ending it revokes the token
+
+	// Set for requests made with a personal access token, never signed
+	Scope   string   `json:"-"`
+	Courses []string `json:"-"` // Courses the token is limited to; empty allows any
 }
 
 // JWTManager handles JWT operations
@@ -46,8 +52,8 @@ func NewJWTManager(secret string, accessExpiration, refreshExpiration time.Durat
 	}
 }
 
-// GenerateToken creates a new JWT token
-func (j *JWTManager) GenerateToken(userID int64, email string, role string, isAdmin bool) (string, time.Time, error) {
+// GenerateToken creates a new JWT token for the session jti
+func (j *JWTManager) GenerateToken(userID int64, email string, role string, isAdmin bool, jti string) (string, time.Time, error) {
 	now := time.Now()
 	expiresAt := now.Add(j.accessExpiration)
 
@@ -58,6 +64,7 @@ func (j *JWTManager) GenerateToken(userID int64, email string, role string, isAd
 		IsAdmin:   isAdmin,
 		ExpiresAt: expiresAt.Unix(),
 		IssuedAt:  now.Unix(),
+		JTI:       jti,
 	}
 
 	// Simple JWT implementation (header.payload.signature)
@@ -85,6 +92,21 @@ func (j *JWTManager) GenerateRefreshToken() (string, error) {
 	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
+// HashRefreshToken returns the form in which refresh tokens are kept once
+// rotated. Like access tokens they are random, so a fast hash suffices.
+func HashRefreshToken(token string) string {
+	return HashAccessToken(token)
+}
+
+// GenerateSessionID creates a random session ID for the jti claim
+func GenerateSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 // ValidateToken validates and parses a JWT token
 func (j *JWTManager) ValidateToken(token string) (*JWTClaims, error) {
 	parts := strings.Split(token, ".")
@@ -126,6 +148,16 @@ func (j *JWTManager) sign(data string) string {
 	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
 }
 
+// SignData signs arbitrary data with the token secret, e.g. for signed links
+func (j *JWTManager) SignData(data string) string {
+	return j.sign(data)
+}
+
+// VerifyData checks a signature made with SignData
+func (j *JWTManager) VerifyData(data, signature string) bool {
+	return hmac.Equal([]byte(j.sign(data)), []byte(signature))
+}
+
 // HashPassword hashes a password using bcrypt
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
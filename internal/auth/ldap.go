@@ -0,0 +1,479 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrLDAPInvalidCredentials = errors.New("invalid directory credentials")
+	ErrLDAPAmbiguousUser      = errors.New("directory search matched more than one user")
+)
+
+// LDAP protocol operations (RFC 4511) as application tags
+const (
+	ldapBindRequest       = 0x60
+	ldapBindResponse      = 0x61
+	ldapUnbindRequest     = 0x42
+	ldapSearchRequest     = 0x63
+	ldapSearchResultEntry = 0x64
+	ldapSearchResultDone  = 0x65
+	ldapSearchResultRef   = 0x73
+	ldapExtendedRequest   = 0x77
+	ldapExtendedResponse  = 0x78
+)
+
+// LDAP result codes
+const (
+	ldapSuccess            = 0
+	ldapSizeLimitExceeded  = 4
+	ldapInvalidCredentials = 49
+)
+
+const (
+	ldapStartTLSOID       = "1.3.6.1.4.1.1466.20037"
+	ldapNoAttributes      = "1.1" // Asks a search for entry names only
+	ldapScopeWholeSubtree = 2
+	ldapNeverDerefAliases = 0
+	// ldapUserSearchSizeLimit tells a unique match from an ambiguous one
+	ldapUserSearchSizeLimit = 2
+	ldapDefaultTimeout      = 10 * time.Second
+)
+
+// LDAPConfig configures password authentication against an LDAP directory
+// such as OpenLDAP or Active Directory
+type LDAPConfig struct {
+	URL          string      // ldap://host:389 or ldaps://host:636
+	StartTLS     bool        // Upgrade ldap:// connections before sending any password
+	TLSConfig    *tls.Config // Defaults to the system roots and the URL's host name
+	BindDN       string      // Service account that searches for users; empty binds anonymously
+	BindPassword string
+	BaseDN       string // Where users are searched, e.g. "ou=people,dc=uni,dc=edu"
+	UserFilter   string // %s is replaced by the escaped login name, e.g. "(uid=%s)"
+
+	EmailAttribute string // Defaults to mail
+	NameAttribute  string // Defaults to displayName, falling back to cn
+	GroupAttribute string // Group DNs on the user entry; defaults to memberOf
+	GroupBaseDN    string // Where groups are searched; defaults to BaseDN
+	GroupFilter    string // %s is replaced by the escaped user DN, e.g. "(member=%s)"; empty skips the search
+
+	Timeout time.Duration // Defaults to 10 seconds per login
+}
+
+// LDAPAuthenticator checks passwords by binding to the directory as the
+// user. Each login uses its own connection.
+type LDAPAuthenticator struct {
+	LDAPConfig
+	address string
+	useTLS  bool // ldaps://
+}
+
+// LDAPUser is a directory entry whose password was checked
+type LDAPUser struct {
+	DN       string
+	Email    string
+	FullName string
+	Groups   []string // DNs of the groups the user belongs to
+}
+
+// NewLDAPAuthenticator validates config and fills in its defaults
+func NewLDAPAuthenticator(config LDAPConfig) (*LDAPAuthenticator, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %v", err)
+	}
+
+	a := &LDAPAuthenticator{address: u.Host}
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			a.address = net.JoinHostPort(u.Hostname(), "389")
+		}
+	case "ldaps":
+		if config.StartTLS {
+			return nil, errors.New("StartTLS cannot be used with ldaps://")
+		}
+		a.useTLS = true
+		if u.Port() == "" {
+			a.address = net.JoinHostPort(u.Hostname(), "636")
+		}
+	default:
+		return nil, fmt.Errorf("LDAP URL must start with ldap:// or ldaps://, got %q", config.URL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("LDAP URL %q has no host", config.URL)
+	}
+
+	if config.BaseDN == "" || !strings.Contains(config.UserFilter, "%s") {
+		return nil, errors.New("LDAP base DN and a user filter containing %s are required")
+	}
+	if _, err := ldapFilter(strings.ReplaceAll(config.UserFilter, "%s", "x")); err != nil {
+		return nil, err
+	}
+	if config.GroupFilter != "" {
+		if _, err := ldapFilter(strings.ReplaceAll(config.GroupFilter, "%s", "x")); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.TLSConfig == nil {
+		config.TLSConfig = &tls.Config{}
+	}
+	if config.TLSConfig.ServerName == "" {
+		config.TLSConfig = config.TLSConfig.Clone()
+		config.TLSConfig.ServerName = u.Hostname()
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.NameAttribute == "" {
+		config.NameAttribute = "displayName"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.GroupBaseDN == "" {
+		config.GroupBaseDN = config.BaseDN
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = ldapDefaultTimeout
+	}
+
+	a.LDAPConfig = config
+	return a, nil
+}
+
+// Secure reports whether passwords travel over TLS
+func (a *LDAPAuthenticator) Secure() bool {
+	return a.useTLS || a.StartTLS
+}
+
+// Authenticate finds the user called username with the service account and
+// binds as them with password. It returns ErrLDAPInvalidCredentials when
+// there is no such user or the password is wrong.
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*LDAPUser, error) {
+	// An empty password would be an unauthenticated bind, which servers
+	// accept for any DN (RFC 4513 section 5.1.2)
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	c, err := a.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	if err := c.bind(a.BindDN, a.BindPassword); err != nil {
+		return nil, fmt.Errorf("ldap service bind: %w", err)
+	}
+
+	filter := strings.ReplaceAll(a.UserFilter, "%s", EscapeLDAPFilter(username))
+	attributes := []string{a.EmailAttribute, a.NameAttribute, "cn", a.GroupAttribute}
+	entries, err := c.search(a.BaseDN, filter, attributes, ldapUserSearchSizeLimit)
+	if err != nil {
+		return nil, fmt.Errorf("ldap user search: %w", err)
+	}
+	switch {
+	case len(entries) == 0:
+		return nil, ErrLDAPInvalidCredentials
+	case len(entries) > 1:
+		return nil, fmt.Errorf("%w: %s", ErrLDAPAmbiguousUser, filter)
+	}
+	entry := entries[0]
+
+	user := &LDAPUser{
+		DN:       entry.dn,
+		Email:    entry.first(a.EmailAttribute),
+		FullName: entry.first(a.NameAttribute),
+		Groups:   entry.attributes[strings.ToLower(a.GroupAttribute)],
+	}
+	if user.FullName == "" {
+		user.FullName = entry.first("cn")
+	}
+
+	if a.GroupFilter != "" {
+		filter := strings.ReplaceAll(a.GroupFilter, "%s", EscapeLDAPFilter(entry.dn))
+		groups, err := c.search(a.GroupBaseDN, filter, []string{ldapNoAttributes}, 0)
+		if err != nil {
+			return nil, fmt.Errorf("ldap group search: %w", err)
+		}
+		for _, g := range groups {
+			user.Groups = append(user.Groups, g.dn)
+		}
+	}
+
+	if err := c.bind(entry.dn, password); err != nil {
+		var result *ldapResultError
+		if errors.As(err, &result) && result.code == ldapInvalidCredentials {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user bind: %w", err)
+	}
+	return user, nil
+}
+
+// dial connects to the directory, upgrading the connection with StartTLS
+// when configured
+func (a *LDAPAuthenticator) dial(ctx context.Context) (*ldapConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.Timeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	var conn net.Conn
+	var err error
+	if a.useTLS {
+		dialer := &tls.Dialer{Config: a.TLSConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", a.address)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", a.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap connect: %w", err)
+	}
+	// The whole login shares the timeout
+	conn.SetDeadline(deadline)
+
+	c := &ldapConn{conn: conn, r: bufio.NewReader(conn)}
+	if a.StartTLS {
+		if err := c.startTLS(a.TLSConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap StartTLS: %w", err)
+		}
+		c.conn.SetDeadline(deadline)
+	}
+	return c, nil
+}
+
+// ldapResultError is an LDAPResult other than success
+type ldapResultError struct {
+	code    int64
+	message string
+}
+
+func (e *ldapResultError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("result code %d", e.code)
+	}
+	return fmt.Sprintf("result code %d: %s", e.code, e.message)
+}
+
+// ldapEntry is a search result
+type ldapEntry struct {
+	dn         string
+	attributes map[string][]string // By lower-case attribute name
+}
+
+// first returns the first value of the attribute, or ""
+func (e *ldapEntry) first(attribute string) string {
+	if values := e.attributes[strings.ToLower(attribute)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ldapConn is a connection speaking one request at a time
+type ldapConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	lastID int64
+}
+
+// send writes the protocol operation op in a new message and returns its ID
+func (c *ldapConn) send(op []byte) (int64, error) {
+	c.lastID++
+	msg := berEncode(berSequence, berInt(berInteger, c.lastID), op)
+	if _, err := c.conn.Write(msg); err != nil {
+		return 0, err
+	}
+	return c.lastID, nil
+}
+
+// receive reads the next message of request id and returns its protocol
+// operation
+func (c *ldapConn) receive(id int64) (berTLV, error) {
+	for {
+		msg, err := readBER(c.r)
+		if err != nil {
+			return berTLV{}, err
+		}
+		if msg.tag != berSequence {
+			return berTLV{}, errBERMalformed
+		}
+		parts, err := berChildren(msg.value)
+		if err != nil || len(parts) < 2 {
+			return berTLV{}, errBERMalformed
+		}
+		msgID, err := parts[0].int()
+		if err != nil {
+			return berTLV{}, err
+		}
+		if msgID == 0 {
+			// Notice of disconnection (RFC 4511 section 4.4.1)
+			return berTLV{}, errors.New("server closed the connection")
+		}
+		if msgID == id {
+			return parts[1], nil
+		}
+	}
+}
+
+// ldapResult decodes the LDAPResult that starts the response op, returning an
+// ldapResultError for anything but success
+func ldapResult(op berTLV) error {
+	parts, err := berChildren(op.value)
+	if err != nil || len(parts) < 3 || parts[0].tag != berEnumerated {
+		return errBERMalformed
+	}
+	code, err := parts[0].int()
+	if err != nil {
+		return err
+	}
+	if code != ldapSuccess {
+		return &ldapResultError{code: code, message: string(parts[2].value)}
+	}
+	return nil
+}
+
+// startTLS upgrades the connection to TLS (RFC 4511 section 4.14)
+func (c *ldapConn) startTLS(config *tls.Config) error {
+	id, err := c.send(berEncode(ldapExtendedRequest, berString(0x80, ldapStartTLSOID)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != ldapExtendedResponse {
+		return errBERMalformed
+	}
+	if err := ldapResult(op); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	c.r = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// bind authenticates the connection as dn with a simple bind
+func (c *ldapConn) bind(dn, password string) error {
+	id, err := c.send(berEncode(ldapBindRequest,
+		berInt(berInteger, 3),
+		berString(berOctetString, dn),
+		berString(0x80, password), // simple
+	))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != ldapBindResponse {
+		return errBERMalformed
+	}
+	return ldapResult(op)
+}
+
+// search returns the entries under base matching filter, with the
+// requested attributes. A sizeLimit of 0 leaves the limit to the server.
+func (c *ldapConn) search(base, filter string, attributes []string, sizeLimit int64) ([]*ldapEntry, error) {
+	encodedFilter, err := ldapFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	var attrs [][]byte
+	for _, a := range attributes {
+		attrs = append(attrs, berString(berOctetString, a))
+	}
+
+	id, err := c.send(berEncode(ldapSearchRequest,
+		berString(berOctetString, base),
+		berInt(berEnumerated, ldapScopeWholeSubtree),
+		berInt(berEnumerated, ldapNeverDerefAliases),
+		berInt(berInteger, sizeLimit),
+		berInt(berInteger, 0), // No time limit; the connection deadline applies
+		berBool(false),        // typesOnly
+		encodedFilter,
+		berEncode(berSequence, attrs...),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*ldapEntry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case ldapSearchResultEntry:
+			entry, err := parseLDAPEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case ldapSearchResultRef:
+			// Referrals to other servers are not followed
+		case ldapSearchResultDone:
+			err := ldapResult(op)
+			var result *ldapResultError
+			if errors.As(err, &result) && result.code == ldapSizeLimitExceeded && sizeLimit > 0 {
+				err = nil
+			}
+			return entries, err
+		default:
+			return nil, errBERMalformed
+		}
+	}
+}
+
+// parseLDAPEntry decodes a SearchResultEntry
+func parseLDAPEntry(op berTLV) (*ldapEntry, error) {
+	parts, err := berChildren(op.value)
+	if err != nil || len(parts) != 2 {
+		return nil, errBERMalformed
+	}
+	entry := &ldapEntry{dn: string(parts[0].value), attributes: make(map[string][]string)}
+
+	attributes, err := berChildren(parts[1].value)
+	if err != nil {
+		return nil, err
+	}
+	for _, attribute := range attributes {
+		fields, err := berChildren(attribute.value)
+		if err != nil || len(fields) != 2 {
+			return nil, errBERMalformed
+		}
+		values, err := berChildren(fields[1].value)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(string(fields[0].value))
+		for _, v := range values {
+			entry.attributes[name] = append(entry.attributes[name], string(v.value))
+		}
+	}
+	return entry, nil
+}
+
+// close unbinds and closes the connection
+func (c *ldapConn) close() {
+	c.send(berEncode(ldapUnbindRequest))
+	c.conn.Close()
+}
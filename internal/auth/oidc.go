@@ -0,0 +1,541 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // SHA-384 and SHA-512 for RS384, RS512 and ES384
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOIDCDiscovery   = errors.New("oidc discovery failed")
+	ErrInvalidIDToken  = errors.New("invalid id token")
+	ErrOIDCUnknownKey  = errors.New("id token signed with an unknown key")
+	ErrOIDCUserInfo    = errors.New("oidc userinfo request failed")
+	errOIDCUnsupported = errors.New("unsupported signing algorithm")
+)
+
+const (
+	// oidcLeeway absorbs clock drift when checking ID token times
+	oidcLeeway = time.Minute
+	// oidcKeysRefresh bounds how often the signing keys are fetched again
+	// when a token names a key that is not known yet, e.g. after the
+	// provider rotated its keys
+	oidcKeysRefresh = 10 * time.Second
+	// oidcKeysMaxAge is how long fetched signing keys are trusted
+	oidcKeysMaxAge = time.Hour
+)
+
+// OIDCConfig configures an OpenID Connect provider such as Keycloak,
+// Google Workspace or Microsoft Entra ID
+type OIDCConfig struct {
+	Name         string // Identifies the provider in URLs, e.g. "keycloak"
+	DisplayName  string // Shown on the login button
+	Issuer       string // Discovery document is at Issuer + "/.well-known/openid-configuration"
+	ClientID     string
+	ClientSecret string // Empty for public clients, which rely on PKCE alone
+	RedirectURL  string
+	Scopes       []string     // Defaults to openid, email and profile
+	HTTPClient   *http.Client // Defaults to a client with a 10 second timeout
+}
+
+// OIDCProvider signs users in with the authorization code flow, PKCE and a
+// nonce. Its endpoints and signing keys are discovered on first use and
+// cached, so a provider that is down at startup is retried later.
+type OIDCProvider struct {
+	OIDCConfig
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]crypto.PublicKey // By key ID
+	keysFetched time.Time
+}
+
+// oidcDiscovery is the part of the discovery document that is used
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider creates a provider; nothing is fetched until it is used
+func NewOIDCProvider(config OIDCConfig) *OIDCProvider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.DisplayName == "" {
+		config.DisplayName = config.Name
+	}
+	return &OIDCProvider{OIDCConfig: config}
+}
+
+// GenerateOIDCSecret returns a random value for a state, nonce or PKCE
+// code verifier (RFC 7636 allows its 43 URL-safe characters)
+func GenerateOIDCSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceChallenge returns the S256 code challenge of a code verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the provider's authorization URL for a login with
+// state, nonce and PKCE code verifier
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("client_id", p.ClientID)
+	params.Set("response_type", "code")
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", pkceChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange trades an authorization code and its PKCE code verifier for
+// tokens
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier string) (*OAuth2Token, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", p.RedirectURL)
+	data.Set("client_id", p.ClientID)
+	data.Set("code_verifier", verifier)
+	if p.ClientSecret != "" {
+		data.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", d.TokenEndpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token OAuth2Token
+	if err := p.getJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuthExchange, err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrOAuthExchange)
+	}
+	return &token, nil
+}
+
+// VerifyIDToken checks the signature of an ID token against the provider's
+// published keys, its issuer, audience and lifetime, and that it carries
+// the nonce of the login. It returns the token's claims.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (OIDCClaims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidIDToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidIDToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidIDToken)
+	}
+
+	key, err := p.signingKey(ctx, d, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	claims := OIDCClaims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidIDToken)
+	}
+	if err := claims.check(d.Issuer, p.ClientID, nonce, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	return claims, nil
+}
+
+// UserInfo fetches the claims of the userinfo endpoint, for providers that
+// leave the email address out of the ID token
+func (p *OIDCProvider) UserInfo(ctx context.Context, accessToken string) (OIDCClaims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if d.UserInfoEndpoint == "" {
+		return nil, fmt.Errorf("%w: provider has no userinfo endpoint", ErrOIDCUserInfo)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", d.UserInfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	claims := OIDCClaims{}
+	if err := p.getJSON(req, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCUserInfo, err)
+	}
+	return claims, nil
+}
+
+// discover returns the provider's discovery document, fetching it once
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var d oidcDiscovery
+	if err := p.getJSON(req, &d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCDiscovery, err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrOIDCDiscovery, d.Issuer, p.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: missing endpoints", ErrOIDCDiscovery)
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// signingKey returns the key with ID kid, fetching the key set again when
+// it is stale or does not have the key, e.g. after the provider rotated
+// its keys. A token without a key ID is accepted from a single-key set.
+func (p *OIDCProvider) signingKey(ctx context.Context, d *oidcDiscovery, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	age := time.Since(p.keysFetched)
+	if key, ok := p.lookupKey(kid); ok && age < oidcKeysMaxAge {
+		return key, nil
+	}
+	if age >= oidcKeysRefresh {
+		keys, err := p.fetchKeys(ctx, d.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+		p.keys = keys
+		p.keysFetched = time.Now()
+	}
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, ErrOIDCUnknownKey
+}
+
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// jsonWebKey is a key of a JWKS document (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchKeys downloads the provider's signing keys. Encryption keys and key
+// types other than RSA and EC are skipped.
+func (p *OIDCProvider) fetchKeys(ctx context.Context, jwksURI string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("%w: fetching keys: %v", ErrOIDCDiscovery, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifySignature checks a JWS signature made with alg. Only asymmetric
+// algorithms are accepted, so "none" and HMAC with a public key as the
+// secret are refused.
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w %q", errOIDCUnsupported, alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return errors.New("algorithm does not match key")
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return errors.New("algorithm does not match key")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	}
+	return errors.New("unsupported key")
+}
+
+// getJSON sends req and decodes a successful JSON response into v
+func (p *OIDCProvider) getJSON(req *http.Request, v interface{}) error {
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// OIDCClaims are the claims of an ID token or userinfo response
+type OIDCClaims map[string]interface{}
+
+// check validates the registered claims of an ID token
+func (c OIDCClaims) check(issuer, clientID, nonce string, now time.Time) error {
+	if strings.TrimSuffix(c.String("iss"), "/") != strings.TrimSuffix(issuer, "/") {
+		return errors.New("issuer mismatch")
+	}
+
+	var audience []string
+	switch aud := c["aud"].(type) {
+	case string:
+		audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+	}
+	found := false
+	for _, a := range audience {
+		found = found || a == clientID
+	}
+	if !found {
+		return errors.New("audience mismatch")
+	}
+	if azp := c.String("azp"); len(audience) > 1 && azp != clientID {
+		return errors.New("authorized party mismatch")
+	}
+
+	exp, ok := c["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcLeeway)) {
+		return ErrTokenExpired
+	}
+	if iat, ok := c["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(oidcLeeway)) {
+		return errors.New("issued in the future")
+	}
+	if c.String("nonce") != nonce || nonce == "" {
+		return errors.New("nonce mismatch")
+	}
+	if c.Subject() == "" {
+		return errors.New("missing subject")
+	}
+	return nil
+}
+
+// Lookup returns the claim at a dotted path, e.g. "realm_access.roles"
+func (c OIDCClaims) Lookup(path string) (interface{}, bool) {
+	var value interface{} = map[string]interface{}(c)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// String returns a string claim, or "" when absent
+func (c OIDCClaims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Subject returns the provider's identifier of the user
+func (c OIDCClaims) Subject() string {
+	return c.String("sub")
+}
+
+// Email returns the user's email address
+func (c OIDCClaims) Email() string {
+	return strings.TrimSpace(c.String("email"))
+}
+
+// EmailVerified reports the email_verified claim, and whether it is
+// present; some providers send it as a string
+func (c OIDCClaims) EmailVerified() (verified, present bool) {
+	switch v := c["email_verified"].(type) {
+	case bool:
+		return v, true
+	case string:
+		return v == "true", true
+	}
+	return false, false
+}
+
+// FullName returns the user's display name
+func (c OIDCClaims) FullName() string {
+	if name := c.String("name"); name != "" {
+		return name
+	}
+	return strings.TrimSpace(c.String("given_name") + " " + c.String("family_name"))
+}
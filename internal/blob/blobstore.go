@@ -0,0 +1,105 @@
+package blob
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("blob not found")
+	ErrInvalidKey  = errors.New("invalid blob key")
+	ErrInvalidHash = errors.New("invalid blob hash")
+)
+
+// BlobStore stores package files and thumbnails under slash-separated keys
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any existing object
+	Put(key string, r io.Reader, size int64) error
+	// Get returns length bytes of the object starting at offset;
+	// a negative length reads to the end of the object
+	Get(key string, offset, length int64) (io.ReadCloser, error)
+	// Stat returns object metadata or ErrNotFound
+	Stat(key string) (*Info, error)
+	// Delete removes an object
+	Delete(key string) error
+	// List returns all objects whose keys start with prefix
+	List(prefix string) ([]Info, error)
+}
+
+// FilePutter is implemented by stores that can adopt a local file without
+// copying it, such as the local filesystem backend
+type FilePutter interface {
+	PutFile(key, srcPath string) error
+}
+
+// Info describes a stored object
+type Info struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Key returns the content-addressed key for a BLAKE3 hash: blobs/ab/cd/<hash>
+func Key(hash string) (string, error) {
+	if !validHash(hash) {
+		return "", ErrInvalidHash
+	}
+	return "blobs/" + hash[0:2] + "/" + hash[2:4] + "/" + hash, nil
+}
+
+// IsKey reports whether filePath is a content-addressed key rather than a
+// legacy filesystem path
+func IsKey(filePath string) bool {
+	parts := strings.Split(filePath, "/")
+	if len(parts) != 4 || parts[0] != "blobs" {
+		return false
+	}
+	key, err := Key(parts[3])
+	return err == nil && key == filePath
+}
+
+// PutFile moves the local file at srcPath into the store under key. The
+// source file is always consumed.
+func PutFile(store BlobStore, key, srcPath string) error {
+	if fp, ok := store.(FilePutter); ok {
+		return fp.PutFile(key, srcPath)
+	}
+	defer os.Remove(srcPath)
+
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	return store.Put(key, file, info.Size())
+}
+
+// validKey rejects empty keys and keys that could escape the store root
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// validHash checks that hash is a lowercase hex BLAKE3 digest
+func validHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	return strings.Trim(hash, "0123456789abcdef") == ""
+}
@@ -0,0 +1,28 @@
+package blob
+
+import "fmt"
+
+// Supported storage backends
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Config selects and configures a storage backend
+type Config struct {
+	Backend  string // "local" (default) or "s3"
+	LocalDir string // Root directory for the local backend
+	S3       S3Config
+}
+
+// New creates the blob store described by config
+func New(config Config) (BlobStore, error) {
+	switch config.Backend {
+	case "", BackendLocal:
+		return NewLocal(config.LocalDir)
+	case BackendS3:
+		return NewS3(config.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %q", config.Backend)
+	}
+}
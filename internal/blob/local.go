@@ -0,0 +1,201 @@
+package blob
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores blobs as files under a root directory
+type Local struct {
+	root string
+}
+
+// NewLocal creates a local filesystem blob store rooted at dir
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{root: dir}, nil
+}
+
+// Put writes the object to a temporary file and renames it into place
+func (l *Local) Put(key string, r io.Reader, size int64) error {
+	dest, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.CopyN(tmp, r, size); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+// PutFile renames srcPath into place, avoiding a copy
+func (l *Local) PutFile(key, srcPath string) error {
+	dest, err := l.path(key)
+	if err != nil {
+		os.Remove(srcPath)
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		os.Remove(srcPath)
+		return err
+	}
+
+	if err := os.Rename(srcPath, dest); err != nil {
+		os.Remove(srcPath)
+		return err
+	}
+	return nil
+}
+
+// Get opens the object and positions it at offset
+func (l *Local) Get(key string, offset, length int64) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+	return &limitedFile{Reader: io.LimitReader(file, length), file: file}, nil
+}
+
+// Stat returns the object's size and modification time
+func (l *Local) Stat(key string) (*Info, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{Key: key, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// Delete removes the object and prunes empty parent directories
+func (l *Local) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	// Remove empty fan-out directories, stopping at the first non-empty one
+	root := filepath.Clean(l.root)
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// List walks the directory holding prefix and returns matching objects
+func (l *Local) List(prefix string) ([]Info, error) {
+	var infos []Info
+
+	err := filepath.WalkDir(l.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(l.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if key == "." {
+				return nil
+			}
+			// Skip staging areas and directories that cannot contain matching keys
+			if strings.HasPrefix(d.Name(), ".") ||
+				(!strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasPrefix(key, prefix) || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		infos = append(infos, Info{Key: key, Size: fi.Size(), ModTime: fi.ModTime()})
+		return nil
+	})
+
+	return infos, err
+}
+
+// path maps a key to a file under the root directory
+func (l *Local) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// limitedFile closes the underlying file of a length-limited read
+type limitedFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (f *limitedFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,183 @@
+package blob
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jesus/FCCUR/internal/hash"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+// MigrationResult summarizes a legacy file migration
+type MigrationResult struct {
+	Moved   int // Files moved into the blob layout
+	Deduped int // Files dropped because an identical blob already existed
+	Shared  int // Packages repointed at a legacy file another package already migrated
+	Skipped int // Packages already in the store or with missing files
+}
+
+// migratedFile is the blob a legacy file was migrated to
+type migratedFile struct {
+	key        string
+	blake3Hash string
+	sha256Hash string
+	size       int64
+}
+
+// MigrateLegacyFiles moves package files stored by filename into the
+// content-addressable layout of store and repoints packages.file_path at the
+// blob keys. Thumbnails found under packagesDir are copied into the store if
+// it does not have them yet. Each file is re-hashed so a stale hash never
+// files content under the wrong key. Packages sharing a legacy file all
+// point at its blob, and packages in the trash are migrated too so they
+// still work when restored. It is safe to run more than once.
+func MigrateLegacyFiles(db storage.Database, store BlobStore, packagesDir string) (*MigrationResult, error) {
+	packages, err := db.GetPackages()
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := db.ListTrash(nil)
+	if err != nil {
+		return nil, err
+	}
+	packages = append(packages, trashed...)
+
+	result := &MigrationResult{}
+	migrated := make(map[string]*migratedFile) // By legacy path
+	for _, pkg := range packages {
+		if pkg.ThumbnailPath != "" {
+			migrateThumbnail(store, packagesDir, pkg.ThumbnailPath)
+		}
+
+		if IsKey(pkg.FilePath) {
+			result.Skipped++
+			continue
+		}
+
+		// Several packages may share a legacy file, which the first moved
+		legacyPath := pkg.FilePath
+		if blob, ok := migrated[legacyPath]; ok {
+			if err := repointPackage(db, pkg, blob, legacyPath); err != nil {
+				return result, err
+			}
+			result.Shared++
+			continue
+		}
+
+		file, err := os.Open(legacyPath)
+		if err != nil {
+			// A previous run may have moved it before reaching this package
+			if blob := migratedBefore(store, pkg); blob != nil && os.IsNotExist(err) {
+				migrated[legacyPath] = blob
+				if err := repointPackage(db, pkg, blob, legacyPath); err != nil {
+					return result, err
+				}
+				result.Shared++
+				continue
+			}
+			log.Printf("Warning: Skipping package %d, cannot open %s: %v", pkg.ID, legacyPath, err)
+			result.Skipped++
+			continue
+		}
+
+		blake3Hash, sha256Hash, err := hash.DualHash(file)
+		info, statErr := file.Stat()
+		file.Close()
+		if err != nil {
+			return result, err
+		}
+		if statErr != nil {
+			return result, statErr
+		}
+
+		if blake3Hash != pkg.BLAKE3Hash {
+			log.Printf("Warning: Package %d hash mismatch, recorded %s, actual %s",
+				pkg.ID, pkg.BLAKE3Hash, blake3Hash)
+		}
+
+		key, err := Key(blake3Hash)
+		if err != nil {
+			return result, err
+		}
+
+		if _, err := store.Stat(key); err == nil {
+			// Deduplicate: identical content is already stored
+			os.Remove(legacyPath)
+			result.Deduped++
+		} else if err == ErrNotFound {
+			if err := PutFile(store, key, legacyPath); err != nil {
+				return result, err
+			}
+			result.Moved++
+		} else {
+			return result, err
+		}
+
+		blob := &migratedFile{key: key, blake3Hash: blake3Hash, sha256Hash: sha256Hash, size: info.Size()}
+		migrated[legacyPath] = blob
+		if err := repointPackage(db, pkg, blob, legacyPath); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// repointPackage points pkg, stored at legacyPath, at blob
+func repointPackage(db storage.Database, pkg *models.Package, blob *migratedFile, legacyPath string) error {
+	pkg.FileName = pkg.GetFileName()
+	pkg.FilePath = blob.key
+	pkg.FileSize = blob.size
+	pkg.BLAKE3Hash = blob.blake3Hash
+	pkg.SHA256Hash = blob.sha256Hash
+
+	if err := db.UpdatePackageFile(pkg); err != nil {
+		return err
+	}
+
+	log.Printf("Migrated package %d: %s -> %s", pkg.ID, legacyPath, blob.key)
+	return nil
+}
+
+// migratedBefore returns the blob of pkg's recorded hash when the store
+// has it, or nil. Blobs are keyed by content, so one with that key holds
+// the package's file.
+func migratedBefore(store BlobStore, pkg *models.Package) *migratedFile {
+	key, err := Key(pkg.BLAKE3Hash)
+	if err != nil {
+		return nil
+	}
+	info, err := store.Stat(key)
+	if err != nil {
+		return nil
+	}
+	return &migratedFile{key: key, blake3Hash: pkg.BLAKE3Hash, sha256Hash: pkg.SHA256Hash, size: info.Size}
+}
+
+// migrateThumbnail uploads a thumbnail kept under packagesDir when the store
+// does not hold it, e.g. after switching to a remote backend
+func migrateThumbnail(store BlobStore, packagesDir, key string) {
+	if _, err := store.Stat(key); err != ErrNotFound {
+		return
+	}
+
+	localPath := filepath.Join(packagesDir, filepath.FromSlash(key))
+	file, err := os.Open(localPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+
+	if err := store.Put(key, file, info.Size()); err != nil {
+		log.Printf("Warning: Error copying thumbnail %s: %v", key, err)
+		return
+	}
+	log.Printf("Copied thumbnail %s", key)
+}
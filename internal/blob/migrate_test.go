@@ -0,0 +1,190 @@
+package blob
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jesus/FCCUR/internal/hash"
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/storage"
+)
+
+func newMigrationDB(t *testing.T, dir string) storage.Database {
+	t.Helper()
+	storage.SetMigrationsPath(filepath.Join("..", "..", "migrations"))
+	path := filepath.Join(dir, "fccur.db")
+	db, err := storage.NewDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Migrate closes the connection it runs on
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = storage.NewDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createLegacyPackage stores a package whose file_path is the legacy path
+// of a file holding data
+func createLegacyPackage(t *testing.T, db storage.Database, name, path string, data []byte) int64 {
+	t.Helper()
+	blake3Hash, sha256Hash, err := hash.DualHash(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := db.CreatePackage(&models.Package{
+		Name: name, Version: "1", Category: "tool", ContentType: "tool",
+		FilePath: path, FileSize: int64(len(data)), BLAKE3Hash: blake3Hash, SHA256Hash: sha256Hash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestMigrateLegacyFilesSharedPaths(t *testing.T) {
+	dir := t.TempDir()
+	db := newMigrationDB(t, dir)
+	packagesDir := filepath.Join(dir, "packages")
+	store, err := NewLocal(packagesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := filepath.Join(packagesDir, "gcc.tar.gz")
+	copied := filepath.Join(packagesDir, "gcc-copy.tar.gz")
+	data := []byte("the same compiler, uploaded as several packages")
+	for _, path := range []string{shared, copied} {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Three packages point at one legacy file, a fourth at a copy of it
+	var ids []int64
+	for _, name := range []string{"gcc", "gcc-linux", "gcc-windows"} {
+		ids = append(ids, createLegacyPackage(t, db, name, shared, data))
+	}
+	ids = append(ids, createLegacyPackage(t, db, "gcc-copy", copied, data))
+
+	result, err := MigrateLegacyFiles(db, store, packagesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MigrationResult{Moved: 1, Deduped: 1, Shared: 2}
+	if *result != want {
+		t.Errorf("result = %+v, want %+v", *result, want)
+	}
+
+	for _, id := range ids {
+		pkg, err := db.GetPackage(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsKey(pkg.FilePath) {
+			t.Errorf("package %d still points at %s", id, pkg.FilePath)
+			continue
+		}
+		r, err := store.Get(pkg.FilePath, 0, -1)
+		if err != nil {
+			t.Errorf("package %d: %v", id, err)
+			continue
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if !bytes.Equal(got, data) {
+			t.Errorf("package %d serves %q, want %q", id, got, data)
+		}
+	}
+
+	// Running again leaves everything in place
+	result, err = MigrateLegacyFiles(db, store, packagesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MigrationResult{Skipped: len(ids)}); *result != want {
+		t.Errorf("second run result = %+v, want %+v", *result, want)
+	}
+}
+
+func TestMigrateLegacyFilesMovedByEarlierRun(t *testing.T) {
+	dir := t.TempDir()
+	db := newMigrationDB(t, dir)
+	packagesDir := filepath.Join(dir, "packages")
+	store, err := NewLocal(packagesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An interrupted run moved the file but did not repoint this package
+	data := []byte("moved before the interruption")
+	id := createLegacyPackage(t, db, "tool", filepath.Join(packagesDir, "tool.zip"), data)
+	pkg, err := db.GetPackage(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := Key(pkg.BLAKE3Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(key, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := MigrateLegacyFiles(db, store, packagesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MigrationResult{Shared: 1}); *result != want {
+		t.Errorf("result = %+v, want %+v", *result, want)
+	}
+	if pkg, _ = db.GetPackage(id); pkg.FilePath != key || pkg.FileSize != int64(len(data)) {
+		t.Errorf("package points at %s (%d bytes), want %s (%d bytes)", pkg.FilePath, pkg.FileSize, key, len(data))
+	}
+}
+
+func TestMigrateLegacyFilesTrashed(t *testing.T) {
+	dir := t.TempDir()
+	db := newMigrationDB(t, dir)
+	packagesDir := filepath.Join(dir, "packages")
+	store, err := NewLocal(packagesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(packagesDir, "old.zip")
+	data := []byte("deleted before the migration, restored after it")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	id := createLegacyPackage(t, db, "old", path, data)
+	if err := db.TrashPackage(id, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := MigrateLegacyFiles(db, store, packagesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MigrationResult{Moved: 1}); *result != want {
+		t.Errorf("result = %+v, want %+v", *result, want)
+	}
+
+	if err := db.RestorePackage(id); err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := db.GetPackage(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Stat(pkg.FilePath); err != nil {
+		t.Errorf("restored package points at %s: %v", pkg.FilePath, err)
+	}
+}
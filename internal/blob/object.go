@@ -0,0 +1,108 @@
+package blob
+
+import (
+	"errors"
+	"io"
+)
+
+// Object is a seekable, random-access view of a stored blob. Reads are
+// served by ranged Get calls, so it works for remote backends as well as
+// local files and can be handed to http.ServeContent or zip.NewReader.
+type Object struct {
+	store  BlobStore
+	info   *Info
+	offset int64
+	body   io.ReadCloser
+}
+
+// Open returns a reader for the blob stored under key
+func Open(store BlobStore, key string) (*Object, error) {
+	info, err := store.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{store: store, info: info}, nil
+}
+
+// Info returns the object's metadata
+func (o *Object) Info() *Info {
+	return o.info
+}
+
+// Read reads sequentially from the current offset
+func (o *Object) Read(p []byte) (int, error) {
+	if o.offset >= o.info.Size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		body, err := o.store.Get(o.info.Key, o.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+// Seek sets the offset for the next Read
+func (o *Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.info.Size
+	default:
+		return 0, errors.New("blob: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("blob: negative position")
+	}
+
+	if offset != o.offset {
+		o.closeBody()
+		o.offset = offset
+	}
+	return offset, nil
+}
+
+// ReadAt reads len(p) bytes starting at off without moving the offset
+func (o *Object) ReadAt(p []byte, off int64) (int, error) {
+	if off >= o.info.Size {
+		return 0, io.EOF
+	}
+
+	length := int64(len(p))
+	if off+length > o.info.Size {
+		length = o.info.Size - off
+	}
+
+	body, err := o.store.Get(o.info.Key, off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, p[:length])
+	if err == nil && int64(n) < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close releases any open read stream
+func (o *Object) Close() error {
+	o.closeBody()
+	return nil
+}
+
+func (o *Object) closeBody() {
+	if o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+}
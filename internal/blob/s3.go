@@ -0,0 +1,425 @@
+package blob
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// s3PartSize is the part size of multipart uploads. Objects up to this
+	// size go in a single PUT; S3 refuses single PUTs over 5 GiB.
+	s3PartSize = 64 << 20
+	// s3MaxParts is the most parts S3 accepts in one multipart upload
+	s3MaxParts = 10000
+)
+
+// S3Config holds settings for an S3-compatible backend (AWS S3, MinIO, ...)
+type S3Config struct {
+	Endpoint  string // e.g. http://localhost:9000 or https://s3.us-east-1.amazonaws.com
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Prefix    string // Optional key prefix inside the bucket
+}
+
+// S3 stores blobs in an S3-compatible bucket using path-style requests
+// signed with AWS Signature Version 4
+type S3 struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	partSize int64 // Larger objects are uploaded in parts
+}
+
+// NewS3 creates an S3-compatible blob store
+func NewS3(config S3Config) (*S3, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, errors.New("s3 access key and secret key are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid s3 endpoint scheme: %q", endpoint.Scheme)
+	}
+
+	// No overall client timeout: downloads of large packages may stream for a
+	// long time. Connection setup and response headers are bounded instead.
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		MaxIdleConnsPerHost:   16,
+	}
+
+	return &S3{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Transport: transport},
+		partSize: s3PartSize,
+	}, nil
+}
+
+// Put uploads the object with a single PUT request, or as a multipart
+// upload when it is larger than one part
+func (s *S3) Put(key string, r io.Reader, size int64) error {
+	if size > s.partSize {
+		return s.putMultipart(key, r, size)
+	}
+	if size == 0 {
+		r = http.NoBody
+	}
+
+	req, err := s.newRequest(http.MethodPut, key, nil, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := s.do(req, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// putMultipart uploads the object in parts streamed from r, aborting the
+// upload if any part fails so the bucket is not left holding its parts
+func (s *S3) putMultipart(key string, r io.Reader, size int64) error {
+	partSize := s.partSize
+	if minPart := (size + s3MaxParts - 1) / s3MaxParts; partSize < minPart {
+		partSize = minPart
+	}
+
+	uploadID, err := s.createMultipartUpload(key)
+	if err != nil {
+		return err
+	}
+
+	var parts []completedPart
+	for number := 1; size > 0; number++ {
+		n := partSize
+		if size < n {
+			n = size
+		}
+		etag, err := s.uploadPart(key, uploadID, number, io.LimitReader(r, n), n)
+		if err != nil {
+			s.abortMultipartUpload(key, uploadID)
+			return err
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+		size -= n
+	}
+
+	if err := s.completeMultipartUpload(key, uploadID, parts); err != nil {
+		s.abortMultipartUpload(key, uploadID)
+		return err
+	}
+	return nil
+}
+
+// createMultipartUpload starts a multipart upload and returns its ID
+func (s *S3) createMultipartUpload(key string) (string, error) {
+	query := url.Values{}
+	query.Set("uploads", "")
+	req, err := s.newRequest(http.MethodPost, key, query, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := s.do(req, emptyPayload)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("s3 create multipart upload: %w", err)
+	}
+	if result.UploadID == "" {
+		return "", errors.New("s3 create multipart upload: no upload ID")
+	}
+	return result.UploadID, nil
+}
+
+// uploadPart uploads size bytes read from r as part number of uploadID and
+// returns its ETag
+func (s *S3) uploadPart(key, uploadID string, number int, r io.Reader, size int64) (string, error) {
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(number))
+	query.Set("uploadId", uploadID)
+	req, err := s.newRequest(http.MethodPut, key, query, r)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
+
+	resp, err := s.do(req, unsignedPayload)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", fmt.Errorf("s3 upload part %d: no ETag", number)
+	}
+	return etag, nil
+}
+
+// completedPart is a part listed in a CompleteMultipartUpload request
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// completeMultipartUpload assembles the uploaded parts into the object
+func (s *S3) completeMultipartUpload(key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+	req, err := s.newRequest(http.MethodPost, key, query, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+
+	resp, err := s.do(req, sha256Hex(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// S3 may report a failure to complete in a 200 response
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("s3 complete multipart upload: %w", err)
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("s3 complete multipart upload: %s: %s", result.Code, result.Message)
+	}
+	return nil
+}
+
+// abortMultipartUpload discards the parts of uploadID. Errors are ignored:
+// the upload already failed, and a lifecycle rule can clean up leftovers.
+func (s *S3) abortMultipartUpload(key, uploadID string) {
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+	req, err := s.newRequest(http.MethodDelete, key, query, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := s.do(req, emptyPayload); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// Get downloads the object, using a Range request for partial reads
+func (s *S3) Get(key string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	req, err := s.newRequest(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := s.do(req, emptyPayload)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat issues a HEAD request for the object
+func (s *S3) Stat(key string) (*Info, error) {
+	req, err := s.newRequest(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req, emptyPayload)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	info := &Info{Key: key, Size: resp.ContentLength}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+	return info, nil
+}
+
+// Delete removes the object
+func (s *S3) Delete(key string) error {
+	req, err := s.newRequest(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req, emptyPayload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listBucketResult is the subset of a ListObjectsV2 response we use
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// List pages through ListObjectsV2 results for prefix
+func (s *S3) List(prefix string) ([]Info, error) {
+	var infos []Info
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", s.objectName(prefix))
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := s.do(req, emptyPayload)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			key := obj.Key
+			if s.config.Prefix != "" {
+				key = strings.TrimPrefix(key, s.config.Prefix+"/")
+			}
+			infos = append(infos, Info{Key: key, Size: obj.Size, ModTime: obj.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return infos, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// objectName applies the configured prefix to a key
+func (s *S3) objectName(key string) string {
+	if s.config.Prefix == "" {
+		return key
+	}
+	return s.config.Prefix + "/" + key
+}
+
+// newRequest builds a path-style request for key (or the bucket when key is empty)
+func (s *S3) newRequest(method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	if key != "" && !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	path := s.endpoint.EscapedPath() + "/" + uriEscape(s.config.Bucket, true)
+	if key != "" {
+		path += "/" + uriEscape(s.objectName(key), false)
+	} else {
+		path += "/"
+	}
+
+	u := *s.endpoint
+	u.RawPath = path
+	u.Path, _ = url.PathUnescape(path)
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	return http.NewRequest(method, u.String(), body)
+}
+
+// do signs and sends a request, mapping S3 error responses to Go errors
+func (s *S3) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	signV4(req, s.config.AccessKey, s.config.SecretKey, s.config.Region, payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	case resp.StatusCode >= 300:
+		defer resp.Body.Close()
+		var s3Err struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+			return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, s3Err.Code, s3Err.Message)
+		}
+		return nil, fmt.Errorf("s3 %s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,142 @@
+package blob
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeS3 serves the object and multipart upload requests of one bucket
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte // Parts by upload ID
+	puts    int                       // Single PUT requests
+	aborted int
+	failAt  int // Part number to refuse, if any
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3) {
+	t.Helper()
+	f := &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+	ts := httptest.NewServer(f)
+	t.Cleanup(ts.Close)
+
+	store, err := NewS3(S3Config{Endpoint: ts.URL, Bucket: "fccur", AccessKey: "key", SecretKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, store
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := r.URL.Path
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		if !ok || number == f.failAt {
+			http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+			return
+		}
+		parts[number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		var complete struct {
+			Parts []completedPart `xml:"Part"`
+		}
+		if !ok || xml.Unmarshal(body, &complete) != nil {
+			http.Error(w, "<Error><Code>NoSuchUpload</Code></Error>", http.StatusNotFound)
+			return
+		}
+		var data []byte
+		for i, part := range complete.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"etag-%d"`, i+1) {
+				http.Error(w, "<Error><Code>InvalidPart</Code></Error>", http.StatusBadRequest)
+				return
+			}
+			data = append(data, parts[part.PartNumber]...)
+		}
+		f.objects[key] = data
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		f.aborted++
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		f.puts++
+		f.objects[key] = body
+
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestS3PutMultipart(t *testing.T) {
+	f, store := newFakeS3(t)
+	store.partSize = 1000
+
+	small := bytes.Repeat([]byte("s"), 1000)
+	if err := store.Put("blobs/small", bytes.NewReader(small), int64(len(small))); err != nil {
+		t.Fatal(err)
+	}
+	if f.puts != 1 || len(f.objects) != 1 {
+		t.Errorf("object of one part: %d PUTs, %d objects; want a single PUT", f.puts, len(f.objects))
+	}
+
+	data := make([]byte, 2500)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := store.Put("blobs/large", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if f.puts != 1 {
+		t.Errorf("large object sent with a single PUT")
+	}
+	if got := f.objects["/fccur/blobs/large"]; !bytes.Equal(got, data) {
+		t.Errorf("assembled object is %d bytes, want the %d uploaded", len(got), len(data))
+	}
+	if len(f.uploads) != 0 {
+		t.Errorf("%d multipart uploads left open", len(f.uploads))
+	}
+}
+
+func TestS3PutMultipartAbortsOnFailure(t *testing.T) {
+	f, store := newFakeS3(t)
+	store.partSize = 1000
+	f.failAt = 2
+
+	data := bytes.Repeat([]byte("x"), 2500)
+	if err := store.Put("blobs/large", bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Fatal("Put succeeded with a failing part")
+	}
+	if f.aborted != 1 || len(f.uploads) != 0 {
+		t.Errorf("aborted %d uploads, %d left open; want the upload aborted", f.aborted, len(f.uploads))
+	}
+	if len(f.objects) != 0 {
+		t.Errorf("%d objects stored after a failed upload", len(f.objects))
+	}
+}
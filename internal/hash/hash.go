@@ -4,6 +4,7 @@ package hash
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	stdhash "hash"
 	"io"
 	"runtime"
 	"sync"
@@ -134,3 +135,37 @@ func (pr *progressReader) Read(p []byte) (n int, err error) {
 	}
 	return n, err
 }
+
+// DualHasher incrementally computes BLAKE3 and SHA256 over everything written
+// to it, so hash state can be carried across separate chunks of a file
+type DualHasher struct {
+	b3      *blake3.Hasher
+	s256    stdhash.Hash
+	written int64
+}
+
+// NewDualHasher creates an empty incremental dual hasher
+func NewDualHasher() *DualHasher {
+	return &DualHasher{
+		b3:   blake3.New(),
+		s256: sha256.New(),
+	}
+}
+
+// Write feeds data into both hashes
+func (d *DualHasher) Write(p []byte) (int, error) {
+	d.b3.Write(p)
+	d.s256.Write(p)
+	d.written += int64(len(p))
+	return len(p), nil
+}
+
+// Written returns the number of bytes hashed so far
+func (d *DualHasher) Written() int64 {
+	return d.written
+}
+
+// Sums returns the hex-encoded BLAKE3 and SHA256 of the data written so far
+func (d *DualHasher) Sums() (blake3Hash, sha256Hash string) {
+	return hex.EncodeToString(d.b3.Sum(nil)), hex.EncodeToString(d.s256.Sum(nil))
+}
@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogMailerOmitsBody(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	mailer, err := New(Config{From: "FCCUR <no-reply@uni.edu>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mailer.Send(&Message{
+		To:      "ana@uni.edu",
+		Subject: "Restablecer contraseña",
+		Body:    "https://fccur.uni.edu/auth.html?reset=secret-reset-token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logged := buf.String()
+	if strings.Contains(logged, "secret-reset-token") {
+		t.Errorf("log contains the message body: %q", logged)
+	}
+	if !strings.Contains(logged, "ana@uni.edu") || !strings.Contains(logged, "Restablecer contraseña") {
+		t.Errorf("log lacks the recipient or subject: %q", logged)
+	}
+}
@@ -0,0 +1,113 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Supported mail backends
+const (
+	BackendSMTP = "smtp"
+	BackendFile = "file"
+	BackendLog  = "log"
+)
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// Message is a plain-text email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Config selects and configures a mail backend
+type Config struct {
+	Backend string // "smtp", "file" or "log" (default)
+	From    string // Sender address, e.g. "FCCUR <no-reply@example.edu>"
+	Dir     string // Output directory for the file backend
+	SMTP    SMTPConfig
+}
+
+// New creates the mailer described by config
+func New(config Config) (Mailer, error) {
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", config.From, err)
+	}
+
+	switch config.Backend {
+	case "", BackendLog:
+		return NewLog(config.From), nil
+	case BackendFile:
+		return NewFile(config.Dir, config.From)
+	case BackendSMTP:
+		return NewSMTP(config.SMTP, config.From)
+	default:
+		return nil, fmt.Errorf("unknown mail backend: %q", config.Backend)
+	}
+}
+
+// compose formats msg as an RFC 5322 message from sender, with a UTF-8
+// quoted-printable body
+func compose(from string, msg *Message) ([]byte, error) {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("invalid header value")
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// messageID returns a unique Message-ID in the sender's domain
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// address returns the bare address of a sender or recipient, as SMTP
+// envelopes need it
+func address(s string) (string, error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
@@ -0,0 +1,108 @@
+package mail
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+const defaultSMTPTimeout = 30 * time.Second
+
+// SMTPConfig configures delivery through an SMTP relay
+type SMTPConfig struct {
+	Host       string
+	Port       int // Defaults to 587
+	Username   string
+	Password   string
+	RequireTLS bool // Fail instead of sending in clear text when the server does not offer STARTTLS
+	Timeout    time.Duration
+}
+
+// SMTPMailer sends messages through an SMTP relay, upgrading the connection
+// with STARTTLS whenever the server offers it. Local stand-ins such as
+// MailHog accept plain connections without authentication.
+type SMTPMailer struct {
+	config SMTPConfig
+	from   string
+}
+
+// NewSMTP creates an SMTP mailer that sends as from
+func NewSMTP(config SMTPConfig, from string) (*SMTPMailer, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("SMTP host is required")
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultSMTPTimeout
+	}
+	return &SMTPMailer{config: config, from: from}, nil
+}
+
+// Send delivers msg in a new SMTP session
+func (m *SMTPMailer) Send(msg *Message) error {
+	from, err := address(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender: %w", err)
+	}
+	to, err := address(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+	data, err := compose(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	conn, err := net.DialTimeout("tcp", addr, m.config.Timeout)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(m.config.Timeout))
+
+	c, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("starting SMTP session: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return fmt.Errorf("STARTTLS: %w", err)
+		}
+	} else if m.config.RequireTLS {
+		return fmt.Errorf("%s does not support STARTTLS", addr)
+	}
+
+	if m.config.Username != "" {
+		// PlainAuth refuses to send credentials over clear text, except to localhost
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication: %w", err)
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
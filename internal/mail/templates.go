@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Message templates
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplatePasswordReset = "password_reset"
+	TemplateNewLogin      = "new_login"
+)
+
+// DefaultLanguage is used when neither the recipient nor the server asks
+// for a supported language
+const DefaultLanguage = "es"
+
+// templates/<lang>/<name>.txt define a "subject" and a "body" template
+//
+//go:embed templates
+var templateFS embed.FS
+
+// templates maps language, then template name, to the parsed template
+var templates = map[string]map[string]*template.Template{}
+
+func init() {
+	langs, err := templateFS.ReadDir("templates")
+	if err != nil {
+		panic(err)
+	}
+	for _, lang := range langs {
+		files, err := templateFS.ReadDir("templates/" + lang.Name())
+		if err != nil {
+			panic(err)
+		}
+		templates[lang.Name()] = map[string]*template.Template{}
+		for _, f := range files {
+			name := strings.TrimSuffix(f.Name(), ".txt")
+			t := template.Must(template.ParseFS(templateFS, "templates/"+lang.Name()+"/"+f.Name()))
+			templates[lang.Name()][name] = t
+		}
+	}
+}
+
+// Supported reports whether there are templates in lang
+func Supported(lang string) bool {
+	_, ok := templates[lang]
+	return ok
+}
+
+// Language picks the first supported language of an Accept-Language
+// header, or fallback when there is none
+func Language(acceptLanguage, fallback string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if Supported(lang) {
+			return lang
+		}
+	}
+	return fallback
+}
+
+// Render builds the message of template name in lang, falling back to
+// DefaultLanguage, addressed to to
+func Render(lang, name, to string, data interface{}) (*Message, error) {
+	set, ok := templates[lang]
+	if !ok {
+		set = templates[DefaultLanguage]
+	}
+	t, ok := set[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mail template: %q", name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := t.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := t.ExecuteTemplate(&body, "body", data); err != nil {
+		return nil, err
+	}
+	return &Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    strings.TrimSpace(body.String()) + "\n",
+	}, nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit actions, named "<target>.<verb>"
+const (
+	AuditRegister             = "auth.register"
+	AuditLogin                = "auth.login"
+	AuditLoginFailed          = "auth.login_failed"
+	AuditLogout               = "auth.logout"
+	AuditLogoutAll            = "auth.logout_all"
+	AuditOAuth2Login          = "auth.oauth2_login"
+	AuditOIDCLogin            = "auth.oidc_login"
+	AuditLDAPLogin            = "auth.ldap_login"
+	AuditPasswordChange       = "auth.password_change"
+	AuditPasswordResetRequest = "auth.password_reset_request"
+	AuditPasswordReset        = "auth.password_reset"
+	AuditEmailVerify          = "auth.email_verify"
+	AuditMFAEnable            = "auth.mfa_enable"
+	AuditMFADisable           = "auth.mfa_disable"
+	AuditMFARecoveryCodes     = "auth.mfa_recovery_codes"
+	AuditMFARecoveryCodeUsed  = "auth.mfa_recovery_code_used"
+	AuditTokenCreate          = "auth.token_create"
+	AuditTokenRevoke          = "auth.token_revoke"
+	AuditRefreshTokenReuse    = "auth.refresh_token_reuse"
+
+	AuditUserUpdate             = "user.update"
+	AuditUserForceLogout        = "user.force_logout"
+	AuditUserForcePasswordReset = "user.force_password_reset"
+	AuditUserResetMFA           = "user.reset_mfa"
+
+	AuditPackageUpload  = "package.upload"
+	AuditPackageUpdate  = "package.update"
+	AuditPackageReplace = "package.replace"
+	AuditPackageTags    = "package.tags"
+	AuditPackageReview  = "package.review"
+	AuditPackageDelete  = "package.delete"
+	AuditPackageRestore = "package.restore"
+	AuditPackagePurge   = "package.purge"
+
+	AuditCategoryCreate = "category.create"
+	AuditCategoryUpdate = "category.update"
+	AuditCategoryDelete = "category.delete"
+
+	AuditCourseCreate          = "course.create"
+	AuditCourseUpdate          = "course.update"
+	AuditCourseDelete          = "course.delete"
+	AuditCourseProfessorAdd    = "course.professor_add"
+	AuditCourseProfessorRemove = "course.professor_remove"
+	AuditCourseStudentAdd      = "course.student_add"
+	AuditCourseStudentRemove   = "course.student_remove"
+)
+
+// Audit target types
+const (
+	AuditTargetUser     = "user"
+	AuditTargetPackage  = "package"
+	AuditTargetCategory = "category"
+	AuditTargetCourse   = "course"
+)
+
+// AuditEvent records who did what to which object, and from where
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	ActorID    int64           `json:"actor_id,omitempty"`    // Absent for anonymous actions such as failed logins
+	ActorEmail string          `json:"actor_email,omitempty"` // As it was at the time of the action
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	IPAddress  string          `json:"ip_address,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Diff       json.RawMessage `json:"diff,omitempty"` // Changed fields as {"field": {"old": ..., "new": ...}}, or details of the action
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditChange is the value of a field before and after an action
+type AuditChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Course is a university course that materials are published under.
+// Packages refer to it by name.
+type Course struct {
+	ID           int64           `json:"id"`
+	Name         string          `json:"name"`
+	Code         string          `json:"code,omitempty"` // Official course code, e.g. "IC-6600"
+	Description  string          `json:"description,omitempty"`
+	Professors   []*CourseMember `json:"professors,omitempty"`
+	PackageCount int64           `json:"package_count"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// CourseMember is a professor assigned to, or a student enrolled in, a course
+type CourseMember struct {
+	UserID   int64  `json:"user_id"`
+	Email    string `json:"email"`
+	FullName string `json:"full_name,omitempty"`
+}
+
+// ParseCourseList reads a list of course names stored as a JSON array or,
+// in older records, as a comma-separated string
+func ParseCourseList(list string) []string {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return nil
+	}
+
+	var names []string
+	if strings.HasPrefix(list, "[") && json.Unmarshal([]byte(list), &names) == nil {
+		return names
+	}
+
+	names = nil
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// FormatCourseList encodes course names as a JSON array
+func FormatCourseList(names []string) string {
+	if names == nil {
+		names = []string{}
+	}
+	data, _ := json.Marshal(names)
+	return string(data)
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// PackageStatus is the review state of a package
+type PackageStatus string
+
+const (
+	StatusPublished PackageStatus = "published" // Listed and downloadable
+	StatusPending   PackageStatus = "pending"   // Awaiting review by an admin
+	StatusRejected  PackageStatus = "rejected"  // Turned down; see ReviewReason
+)
+
+// ValidPackageStatus reports whether s is a known package status
+func ValidPackageStatus(s PackageStatus) bool {
+	switch s {
+	case StatusPublished, StatusPending, StatusRejected:
+		return true
+	}
+	return false
+}
+
+// Published reports whether the package has passed review, or never
+// needed it
+func (p *Package) Published() bool {
+	return p.Status == StatusPublished || p.Status == ""
+}
+
+// Notification kinds
+const (
+	NotifyPackagePending  = "package_pending"
+	NotifyPackageApproved = "package_approved"
+	NotifyPackageRejected = "package_rejected"
+)
+
+// Notification is a message shown to a user, e.g. the outcome of a review
+type Notification struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	Kind      string     `json:"kind"`
+	Message   string     `json:"message"`
+	PackageID int64      `json:"package_id,omitempty"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -1,25 +1,70 @@
 package models
 
-import "time"
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
 
 // Package represents a software package or course material in the repository
 type Package struct {
-	ID            int64     `json:"id"`
-	Name          string    `json:"name"`
-	Version       string    `json:"version"`
-	Description   string    `json:"description,omitempty"`
-	Category      string    `json:"category"`
-	ContentType   string    `json:"content_type"` // "tool" or "material"
-	CourseName    string    `json:"course_name,omitempty"`
-	FilePath      string    `json:"file_path"`
-	FileSize      int64     `json:"file_size"`
-	BLAKE3Hash    string    `json:"blake3_hash"`
-	SHA256Hash    string    `json:"sha256_hash"`
-	DownloadURL   string    `json:"download_url,omitempty"`
-	Platform      string    `json:"platform"`
-	ThumbnailPath string    `json:"thumbnail_path,omitempty"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            int64         `json:"id"`
+	Name          string        `json:"name"`
+	Version       string        `json:"version"`
+	Description   string        `json:"description,omitempty"`
+	Category      string        `json:"category"`
+	ContentType   string        `json:"content_type"` // "tool" or "material"
+	CourseName    string        `json:"course_name,omitempty"`
+	FilePath      string        `json:"file_path"`
+	FileName      string        `json:"file_name"` // Original (sanitized) upload filename
+	FileSize      int64         `json:"file_size"`
+	BLAKE3Hash    string        `json:"blake3_hash"`
+	SHA256Hash    string        `json:"sha256_hash"`
+	DownloadURL   string        `json:"download_url,omitempty"`
+	Platform      string        `json:"platform"`
+	ThumbnailPath string        `json:"thumbnail_path,omitempty"`
+	Tags          []string      `json:"tags,omitempty"`
+	Visibility    Visibility    `json:"visibility"`
+	Status        PackageStatus `json:"status"`
+	UploadedBy    int64         `json:"uploaded_by,omitempty"`
+	ReviewReason  string        `json:"review_reason,omitempty"` // Why the package was rejected
+	ReviewedBy    int64         `json:"reviewed_by,omitempty"`
+	ReviewedAt    *time.Time    `json:"reviewed_at,omitempty"`
+	DeletedAt     *time.Time    `json:"deleted_at,omitempty"` // Set while the package is in the trash
+	DeletedBy     int64         `json:"deleted_by,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// PackageChange records a single field edit made to a package's metadata
+type PackageChange struct {
+	ID        int64     `json:"id"`
+	PackageID int64     `json:"package_id"`
+	UserID    int64     `json:"user_id,omitempty"`
+	UserEmail string    `json:"user_email,omitempty"`
+	Field     string    `json:"field"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// PackageRevision is a previous file of a package, kept when the file is replaced
+type PackageRevision struct {
+	ID         int64     `json:"id"`
+	PackageID  int64     `json:"package_id"`
+	FilePath   string    `json:"file_path"`
+	FileName   string    `json:"file_name"`
+	FileSize   int64     `json:"file_size"`
+	BLAKE3Hash string    `json:"blake3_hash"`
+	SHA256Hash string    `json:"sha256_hash"`
+	ReplacedBy int64     `json:"replaced_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"` // When this file was replaced
+}
+
+// SearchResult is a package matched by a full-text search
+type SearchResult struct {
+	*Package
+	Rank float64 `json:"rank"` // Higher is a better match
 }
 
 // DownloadStats represents download statistics for a package
@@ -29,3 +74,38 @@ type DownloadStats struct {
 	TotalDownloads int       `json:"total_downloads"`
 	LastDownload   time.Time `json:"last_download,omitempty"`
 }
+
+// GetFileName returns the filename to present for downloads
+// Falls back to the stored path for packages uploaded before file_name existed
+func (p *Package) GetFileName() string {
+	if p.FileName != "" {
+		return p.FileName
+	}
+	return filepath.Base(p.FilePath)
+}
+
+// Family returns the slug identifying all versions of this package,
+// e.g. "Visual Studio Code" -> "visual-studio-code". Together with the
+// platform it groups builds of the same software.
+func (p *Package) Family() string {
+	return FamilySlug(p.Name)
+}
+
+// FamilySlug normalizes a package name into a family slug
+func FamilySlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r == ' ' || r == '_' || r == '-' || r == '/' || r == '.':
+			dash = b.Len() > 0
+		default:
+			if dash {
+				b.WriteByte('-')
+				dash = false
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SubmissionBox is an assignment a course's students hand files in to
+type SubmissionBox struct {
+	ID                int64     `json:"id"`
+	CourseID          int64     `json:"course_id"`
+	CourseName        string    `json:"course_name"`
+	Title             string    `json:"title"`
+	Description       string    `json:"description,omitempty"`
+	Deadline          time.Time `json:"deadline"`
+	AllowedExtensions []string  `json:"allowed_extensions"` // e.g. [".zip", ".pdf"]; empty allows any upload type
+	MaxSize           int64     `json:"max_size"`           // Bytes; 0 uses the upload limit
+	AcceptLate        bool      `json:"accept_late"`        // Late files are accepted and flagged
+	CreatedBy         int64     `json:"created_by,omitempty"`
+	SubmissionCount   int64     `json:"submission_count"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Submission is a student's file in a submission box. Resubmitting replaces
+// the previous file.
+type Submission struct {
+	ID          int64     `json:"id"`
+	BoxID       int64     `json:"box_id"`
+	UserID      int64     `json:"user_id"`
+	UserEmail   string    `json:"user_email,omitempty"`
+	UserName    string    `json:"user_name,omitempty"`
+	FilePath    string    `json:"-"`
+	FileName    string    `json:"file_name"`
+	FileSize    int64     `json:"file_size"`
+	BLAKE3Hash  string    `json:"blake3_hash"`
+	SHA256Hash  string    `json:"sha256_hash"`
+	Late        bool      `json:"late"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// AllowsFile reports whether filename has one of the box's extensions
+func (b *SubmissionBox) AllowsFile(filename string) bool {
+	if len(b.AllowedExtensions) == 0 {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, allowed := range b.AllowedExtensions {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLate reports whether a file handed in at t misses the deadline
+func (b *SubmissionBox) IsLate(t time.Time) bool {
+	return t.After(b.Deadline)
+}
+
+// ParseExtensions normalizes a comma-separated extension list to lowercase
+// extensions with a leading dot, dropping blanks and duplicates
+func ParseExtensions(list string) []string {
+	exts := []string{}
+	seen := make(map[string]bool)
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if !seen[ext] {
+			seen[ext] = true
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// MaxTagLength is the longest tag accepted after normalization
+const MaxTagLength = 50
+
+// Tag is a free-form label attached to any number of packages
+type Tag struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"` // Packages carrying the tag
+}
+
+// Category is an entry of the admin-managed category taxonomy. Packages
+// refer to it by slug.
+type Category struct {
+	ID        int64     `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`     // Background of the default icon, e.g. "#2563eb"
+	Icon      string    `json:"icon"`      // Short text or emoji drawn on the default icon
+	Moderated bool      `json:"moderated"` // Uploads need admin approval
+	Count     int64     `json:"count"`     // Packages in the category
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NormalizeTag turns user input into a tag name using the same rules as
+// family slugs, e.g. "Data Science" -> "data-science"
+func NormalizeTag(name string) string {
+	return FamilySlug(name)
+}
+
+// NormalizeCategorySlug turns user input into a category slug, using the
+// same rules as tags
+func NormalizeCategorySlug(slug string) string {
+	return FamilySlug(slug)
+}
+
+// NormalizeTags normalizes names, dropping empty ones and duplicates
+func NormalizeTags(names []string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		tag := NormalizeTag(name)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// SplitTags parses a comma-separated tag list such as a form field
+func SplitTags(list string) []string {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+	return NormalizeTags(strings.Split(list, ","))
+}
@@ -12,23 +12,37 @@ const (
 	RoleAdmin     UserRole = "admin"
 )
 
+// ValidRole reports whether r is a known user role
+func ValidRole(r UserRole) bool {
+	switch r {
+	case RoleGuest, RoleStudent, RoleProfessor, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 // User represents a registered user
 type User struct {
-	ID                int64     `json:"id"`
-	Email             string    `json:"email"`
-	PasswordHash      string    `json:"-"` // Never expose in JSON
-	FullName          string    `json:"full_name,omitempty"`
-	Role              UserRole  `json:"role"`
-	AssignedCourses   string    `json:"assigned_courses,omitempty"` // JSON array of course names for professors
-	IsActive          bool      `json:"is_active"`
-	IsAdmin           bool      `json:"is_admin"` // Deprecated: use Role instead
-	EmailVerified     bool      `json:"email_verified"`
-	VerificationToken string    `json:"-"`
-	ResetToken        string    `json:"-"`
-	ResetTokenExpiry  time.Time `json:"-"`
-	LastLogin         time.Time `json:"last_login,omitempty"`
-	CreatedAt         time.Time `json:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
+	ID                      int64     `json:"id"`
+	Email                   string    `json:"email"`
+	PasswordHash            string    `json:"-"` // Never expose in JSON
+	FullName                string    `json:"full_name,omitempty"`
+	Role                    UserRole  `json:"role"`
+	AssignedCourses         string    `json:"assigned_courses,omitempty"` // JSON array of course names for professors, from course_professors
+	EnrolledCourses         string    `json:"enrolled_courses,omitempty"` // JSON array of course names for students, from course_enrollments
+	IsActive                bool      `json:"is_active"`
+	IsAdmin                 bool      `json:"is_admin"` // Deprecated: use Role instead
+	EmailVerified           bool      `json:"email_verified"`
+	VerificationToken       string    `json:"-"`
+	VerificationTokenExpiry time.Time `json:"-"`
+	ResetToken              string    `json:"-"`
+	ResetTokenExpiry        time.Time `json:"-"`
+	MFAEnabled              bool      `json:"mfa_enabled"`
+	MFASecret               string    `json:"-"` // TOTP secret, pending until MFAEnabled
+	MFALastStep             int64     `json:"-"` // Last TOTP time step accepted
+	LastLogin               time.Time `json:"last_login,omitempty"`
+	CreatedAt               time.Time `json:"created_at"`
+	UpdatedAt               time.Time `json:"updated_at"`
 }
 
 // HasRole checks if user has a specific role
@@ -59,29 +73,102 @@ func (u *User) CanUploadToCourse(courseName string) bool {
 	if u.Role != RoleProfessor {
 		return false
 	}
-	// Parse assigned courses (simple comma-separated for now)
-	// In production, use proper JSON parsing
-	if u.AssignedCourses == "" {
-		return false
+	for _, name := range u.Courses() {
+		if name == courseName {
+			return true
+		}
 	}
-	// Simple contains check (improve with JSON parsing)
-	return contains(u.AssignedCourses, courseName)
+	return false
 }
 
-func contains(str, substr string) bool {
-	return len(str) > 0 && len(substr) > 0 && (str == substr || len(str) > len(substr))
+// Courses returns the names of the courses assigned to a professor
+func (u *User) Courses() []string {
+	return ParseCourseList(u.AssignedCourses)
+}
+
+// EnrolledIn reports whether the user is enrolled in a course as a student
+func (u *User) EnrolledIn(courseName string) bool {
+	for _, name := range ParseCourseList(u.EnrolledCourses) {
+		if name == courseName {
+			return true
+		}
+	}
+	return false
+}
+
+// Viewer returns the user as a viewer for package visibility checks
+func (u *User) Viewer() *Viewer {
+	return &Viewer{
+		UserID:  u.ID,
+		Role:    u.Role,
+		Courses: append(u.Courses(), ParseCourseList(u.EnrolledCourses)...),
+	}
 }
 
 // Session represents an active user session
 type Session struct {
-	ID           int64     `json:"id"`
-	UserID       int64     `json:"user_id"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	IPAddress    string    `json:"ip_address,omitempty"`
-	UserAgent    string    `json:"user_agent,omitempty"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID               int64     `json:"id"`
+	UserID           int64     `json:"user_id"`
+	JTI              string    `json:"-"` // The jti claim of the session's access token
+	FamilyID         string    `json:"-"` // Shared by the sessions refreshed from one login
+	Token            string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	IPAddress        string    `json:"ip_address,omitempty"`
+	UserAgent        string    `json:"user_agent,omitempty"`
+	ExpiresAt        time.Time `json:"expires_at"`         // When the access token expires
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"` // When the family can no longer be refreshed
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// RotatedRefreshToken is a refresh token that was exchanged for a new
+// session. Presenting it again means it was copied, so its family ends.
+type RotatedRefreshToken struct {
+	TokenHash string    `json:"-"`
+	FamilyID  string    `json:"-"`
+	UserID    int64     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"` // When the family expires; kept until then
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// TokenScope limits what a personal access token can do
+type TokenScope string
+
+// Access token scopes
+const (
+	ScopeRead   TokenScope = "read"   // Read-only requests
+	ScopeUpload TokenScope = "upload" // Uploads and package edits, optionally in some courses only
+	ScopeAdmin  TokenScope = "admin"  // Everything the owner can do, admin endpoints included
+)
+
+// ValidScope reports whether s is a known token scope
+func ValidScope(s TokenScope) bool {
+	switch s {
+	case ScopeRead, ScopeUpload, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// AccessToken is a personal access token that scripts send instead of a
+// JWT. Only the SHA-256 hash of the token is stored; Prefix identifies it
+// in listings.
+type AccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-"`
+	Scope      TokenScope `json:"scope"`
+	Courses    []string   `json:"courses,omitempty"` // Courses an upload token is limited to; empty allows any
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Expired reports whether the token can no longer be used
+func (t *AccessToken) Expired() bool {
+	return !time.Now().Before(t.ExpiresAt)
 }
 
 // UserRegistration is the payload for user registration
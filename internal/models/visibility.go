@@ -0,0 +1,81 @@
+package models
+
+// Visibility controls who may see and download a package
+type Visibility string
+
+const (
+	VisibilityPublic        Visibility = "public"        // Anyone, without logging in
+	VisibilityAuthenticated Visibility = "authenticated" // Any logged-in user
+	VisibilityEnrolled      Visibility = "enrolled"      // Students and professors of the package's course
+	VisibilityStaff         Visibility = "staff"         // Professors and admins
+)
+
+// ValidVisibility reports whether v is a known visibility level
+func ValidVisibility(v Visibility) bool {
+	switch v {
+	case VisibilityPublic, VisibilityAuthenticated, VisibilityEnrolled, VisibilityStaff:
+		return true
+	}
+	return false
+}
+
+// Viewer is the user packages are shown to; a nil Viewer is an anonymous
+// visitor
+type Viewer struct {
+	UserID  int64
+	Role    UserRole
+	Courses []string // Courses the user teaches or is enrolled in
+}
+
+// SeesAll reports whether v may see every package regardless of visibility
+func (v *Viewer) SeesAll() bool {
+	return v != nil && v.Role == RoleAdmin
+}
+
+// Levels returns the visibility levels v may see on any package. Enrolled
+// packages are visible only for the courses in v.Courses.
+func (v *Viewer) Levels() []Visibility {
+	levels := []Visibility{VisibilityPublic}
+	if v == nil {
+		return levels
+	}
+	levels = append(levels, VisibilityAuthenticated)
+	if v.Role == RoleProfessor || v.Role == RoleAdmin {
+		levels = append(levels, VisibilityStaff)
+	}
+	return levels
+}
+
+// InCourse reports whether v teaches or is enrolled in courseName
+func (v *Viewer) InCourse(courseName string) bool {
+	if v == nil || courseName == "" {
+		return false
+	}
+	for _, name := range v.Courses {
+		if name == courseName {
+			return true
+		}
+	}
+	return false
+}
+
+// VisibleTo reports whether v may see and download the package. Packages
+// that have not been published are only visible to admins and their
+// uploader.
+func (p *Package) VisibleTo(v *Viewer) bool {
+	if v.SeesAll() {
+		return true
+	}
+	if !p.Published() {
+		return v != nil && p.UploadedBy != 0 && v.UserID == p.UploadedBy
+	}
+	if p.Visibility == VisibilityEnrolled {
+		return v.InCourse(p.CourseName)
+	}
+	for _, level := range v.Levels() {
+		if p.Visibility == level || p.Visibility == "" && level == VisibilityPublic {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,303 @@
+package search
+
+// Stem reduces a lowercase Spanish word to its stem using the Snowball
+// Spanish algorithm (https://snowballstem.org/algorithms/spanish/stemmer.html).
+// Acute accents are removed from the result.
+func Stem(word string) string {
+	w := []rune(word)
+	if len(w) < 3 {
+		return string(removeAccents(w))
+	}
+
+	rv, r1, r2 := regions(w)
+
+	w = attachedPronoun(w, rv)
+
+	// Verb suffixes are only tried when no standard suffix was removed
+	n := len(w)
+	w = standardSuffix(w, r1, r2)
+	if len(w) == n {
+		w = verbSuffix(w, rv)
+	}
+
+	w = residualSuffix(w, rv)
+
+	return string(removeAccents(w))
+}
+
+func isVowel(r rune) bool {
+	switch r {
+	case 'a', 'e', 'i', 'o', 'u', 'á', 'é', 'í', 'ó', 'ú', 'ü':
+		return true
+	}
+	return false
+}
+
+// regions computes the start of RV, R1 and R2 as rune offsets
+func regions(w []rune) (rv, r1, r2 int) {
+	n := len(w)
+
+	rv = n
+	switch {
+	case n < 2:
+	case !isVowel(w[1]):
+		// Region after the next vowel following the second letter
+		for i := 2; i < n; i++ {
+			if isVowel(w[i]) {
+				rv = i + 1
+				break
+			}
+		}
+	case isVowel(w[0]) && isVowel(w[1]):
+		// Region after the next consonant
+		for i := 2; i < n; i++ {
+			if !isVowel(w[i]) {
+				rv = i + 1
+				break
+			}
+		}
+	default:
+		rv = 3
+	}
+	if rv > n {
+		rv = n
+	}
+
+	r1 = afterNonVowel(w, 0)
+	r2 = afterNonVowel(w, r1)
+	return rv, r1, r2
+}
+
+// afterNonVowel returns the position after the first non-vowel following a
+// vowel, searching from start
+func afterNonVowel(w []rune, start int) int {
+	for i := start + 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+// longestSuffix returns the longest suffix of w found in suffixes
+func longestSuffix(w []rune, suffixes []string) string {
+	best := ""
+	for _, s := range suffixes {
+		if len([]rune(s)) > len([]rune(best)) && hasSuffix(w, s) {
+			best = s
+		}
+	}
+	return best
+}
+
+func hasSuffix(w []rune, suffix string) bool {
+	s := []rune(suffix)
+	if len(s) > len(w) {
+		return false
+	}
+	for i := range s {
+		if w[len(w)-len(s)+i] != s[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// suffixStart returns the offset where suffix begins in w
+func suffixStart(w []rune, suffix string) int {
+	return len(w) - len([]rune(suffix))
+}
+
+func trimSuffix(w []rune, suffix string) []rune {
+	return w[:suffixStart(w, suffix)]
+}
+
+func replaceSuffix(w []rune, suffix, with string) []rune {
+	out := append([]rune(nil), trimSuffix(w, suffix)...)
+	return append(out, []rune(with)...)
+}
+
+var pronounSuffixes = []string{
+	"me", "se", "sela", "selo", "selas", "selos", "la", "le", "lo", "las", "les", "los", "nos",
+}
+
+// Verb endings a pronoun may be attached to; accented ones lose the accent
+var pronounVerbEndings = []string{
+	"iéndo", "ándo", "ár", "ér", "ír", "ando", "iendo", "ar", "er", "ir", "yendo",
+}
+
+// attachedPronoun implements step 0: "haciéndola" -> "haciendo"
+func attachedPronoun(w []rune, rv int) []rune {
+	pronoun := longestSuffix(w, pronounSuffixes)
+	if pronoun == "" {
+		return w
+	}
+
+	stem := trimSuffix(w, pronoun)
+	ending := longestSuffix(stem, pronounVerbEndings)
+	if ending == "" || suffixStart(stem, ending) < rv {
+		return w
+	}
+	if ending == "yendo" && !hasSuffix(trimSuffix(stem, ending), "u") {
+		return w
+	}
+
+	out := append([]rune(nil), stem...)
+	removeAccents(out[suffixStart(out, ending):])
+	return out
+}
+
+var standardSuffixes = []string{
+	"anza", "anzas", "ico", "ica", "icos", "icas", "ismo", "ismos", "able", "ables", "ible",
+	"ibles", "ista", "istas", "oso", "osa", "osos", "osas", "amiento", "amientos", "imiento",
+	"imientos",
+	"adora", "ador", "ación", "adoras", "adores", "aciones", "ante", "antes", "ancia", "ancias",
+	"logía", "logías",
+	"ución", "uciones",
+	"encia", "encias",
+	"amente",
+	"mente",
+	"idad", "idades",
+	"iva", "ivo", "ivas", "ivos",
+}
+
+// standardSuffix implements step 1
+func standardSuffix(w []rune, r1, r2 int) []rune {
+	suffix := longestSuffix(w, standardSuffixes)
+	if suffix == "" {
+		return w
+	}
+	inR2 := func(w []rune, s string) bool { return hasSuffix(w, s) && suffixStart(w, s) >= r2 }
+	if !inR2(w, suffix) && !(suffix == "amente" && suffixStart(w, suffix) >= r1) {
+		return w
+	}
+
+	switch suffix {
+	case "adora", "ador", "ación", "adoras", "adores", "aciones", "ante", "antes", "ancia", "ancias":
+		w = trimSuffix(w, suffix)
+		if inR2(w, "ic") {
+			w = trimSuffix(w, "ic")
+		}
+	case "logía", "logías":
+		w = replaceSuffix(w, suffix, "log")
+	case "ución", "uciones":
+		w = replaceSuffix(w, suffix, "u")
+	case "encia", "encias":
+		w = replaceSuffix(w, suffix, "ente")
+	case "amente":
+		w = trimSuffix(w, suffix)
+		if inR2(w, "iv") {
+			w = trimSuffix(w, "iv")
+			if inR2(w, "at") {
+				w = trimSuffix(w, "at")
+			}
+		} else {
+			for _, s := range []string{"os", "ic", "ad"} {
+				if inR2(w, s) {
+					w = trimSuffix(w, s)
+					break
+				}
+			}
+		}
+	case "mente":
+		w = trimSuffix(w, suffix)
+		for _, s := range []string{"ante", "able", "ible"} {
+			if inR2(w, s) {
+				w = trimSuffix(w, s)
+				break
+			}
+		}
+	case "idad", "idades":
+		w = trimSuffix(w, suffix)
+		for _, s := range []string{"abil", "ic", "iv"} {
+			if inR2(w, s) {
+				w = trimSuffix(w, s)
+				break
+			}
+		}
+	case "iva", "ivo", "ivas", "ivos":
+		w = trimSuffix(w, suffix)
+		if inR2(w, "at") {
+			w = trimSuffix(w, "at")
+		}
+	default:
+		w = trimSuffix(w, suffix)
+	}
+
+	return w
+}
+
+var ySuffixes = []string{
+	"ya", "ye", "yan", "yen", "yeron", "yendo", "yo", "yó", "yas", "yes", "yais", "yamos",
+}
+
+var verbSuffixes = []string{
+	"en", "es", "éis", "emos",
+	"arían", "arías", "arán", "arás", "aríais", "aría", "aréis", "aríamos", "aremos", "ará",
+	"aré", "erían", "erías", "erán", "erás", "eríais", "ería", "eréis", "eríamos", "eremos",
+	"erá", "eré", "irían", "irías", "irán", "irás", "iríais", "iría", "iréis", "iríamos",
+	"iremos", "irá", "iré", "aba", "ada", "ida", "ía", "ara", "iera", "ad", "ed", "id", "ase",
+	"iese", "aste", "iste", "an", "aban", "ían", "aran", "ieran", "asen", "iesen", "aron",
+	"ieron", "ado", "ido", "ando", "iendo", "ió", "ar", "er", "ir", "as", "abas", "adas",
+	"idas", "ías", "aras", "ieras", "ases", "ieses", "ís", "áis", "abais", "íais", "arais",
+	"ierais", "aseis", "ieseis", "asteis", "isteis", "ados", "idos", "amos", "ábamos",
+	"íamos", "imos", "áramos", "iéramos", "iésemos", "ásemos",
+}
+
+// verbSuffix implements steps 2a and 2b
+func verbSuffix(w []rune, rv int) []rune {
+	if suffix := longestSuffix(w, ySuffixes); suffix != "" && suffixStart(w, suffix) >= rv {
+		if hasSuffix(trimSuffix(w, suffix), "u") {
+			return trimSuffix(w, suffix)
+		}
+	}
+
+	suffix := longestSuffix(w, verbSuffixes)
+	if suffix == "" || suffixStart(w, suffix) < rv {
+		return w
+	}
+
+	switch suffix {
+	case "en", "es", "éis", "emos":
+		w = trimSuffix(w, suffix)
+		if hasSuffix(w, "gu") {
+			w = trimSuffix(w, "u")
+		}
+	default:
+		w = trimSuffix(w, suffix)
+	}
+	return w
+}
+
+// residualSuffix implements step 3
+func residualSuffix(w []rune, rv int) []rune {
+	suffix := longestSuffix(w, []string{"os", "a", "o", "á", "í", "ó", "e", "é"})
+	if suffix == "" || suffixStart(w, suffix) < rv {
+		return w
+	}
+
+	w = trimSuffix(w, suffix)
+	if (suffix == "e" || suffix == "é") && hasSuffix(w, "gu") && suffixStart(w, "u") >= rv {
+		w = trimSuffix(w, "u")
+	}
+	return w
+}
+
+// removeAccents replaces accented vowels in place with their plain forms
+func removeAccents(w []rune) []rune {
+	for i, r := range w {
+		switch r {
+		case 'á':
+			w[i] = 'a'
+		case 'é':
+			w[i] = 'e'
+		case 'í':
+			w[i] = 'i'
+		case 'ó':
+			w[i] = 'o'
+		case 'ú', 'ü':
+			w[i] = 'u'
+		}
+	}
+	return w
+}
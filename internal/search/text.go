@@ -0,0 +1,49 @@
+// Package search prepares text for the full-text package index: it splits
+// text into words, drops common Spanish stopwords and stems the rest so that
+// "programación" and "programar" match each other.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopwords are frequent Spanish words that carry no meaning for search
+var stopwords = map[string]bool{
+	"a": true, "al": true, "con": true, "de": true, "del": true, "el": true, "en": true,
+	"es": true, "la": true, "las": true, "lo": true, "los": true, "o": true, "para": true,
+	"por": true, "que": true, "se": true, "sin": true, "su": true, "sus": true, "un": true,
+	"una": true, "unos": true, "unas": true, "y": true, "e": true, "u": true, "como": true,
+	"mas": true, "pero": true, "sobre": true, "entre": true, "este": true, "esta": true,
+}
+
+// Words splits text into lowercase words of letters and digits, dropping
+// stopwords
+func Words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	words := fields[:0]
+	for _, f := range fields {
+		if !stopwords[string(removeAccents([]rune(f)))] {
+			words = append(words, f)
+		}
+	}
+	return words
+}
+
+// Terms returns the stemmed index terms of text
+func Terms(text string) []string {
+	words := Words(text)
+	for i, w := range words {
+		words[i] = Stem(w)
+	}
+	return words
+}
+
+// Normalize returns text as space-separated stemmed terms, the form stored
+// in the search index and matched against queries
+func Normalize(text string) string {
+	return strings.Join(Terms(text), " ")
+}
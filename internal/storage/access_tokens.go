@@ -0,0 +1,39 @@
+package storage
+
+import "github.com/jesus/FCCUR/internal/models"
+
+// accessTokenColumns lists access token columns in the order
+// scanAccessToken expects
+const accessTokenColumns = `id, user_id, name, token_prefix, token_hash, scope, courses, expires_at,
+	last_used_at, COALESCE(last_used_ip, ''), created_at`
+
+// scanAccessToken scans a row selected with accessTokenColumns into t
+func scanAccessToken(row rowScanner, t *models.AccessToken) error {
+	var courses string
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.TokenHash, &t.Scope, &courses,
+		&t.ExpiresAt, &t.LastUsedAt, &t.LastUsedIP, &t.CreatedAt)
+	t.Courses = models.ParseCourseList(courses)
+	return err
+}
+
+// scanAccessTokens reads rows selected with accessTokenColumns
+func scanAccessTokens(rows rowIterator) ([]*models.AccessToken, error) {
+	tokens := []*models.AccessToken{}
+	for rows.Next() {
+		t := &models.AccessToken{}
+		if err := scanAccessToken(rows, t); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// formatTokenCourses stores the courses of an access token, leaving the
+// column empty when the token is not limited to any
+func formatTokenCourses(courses []string) string {
+	if len(courses) == 0 {
+		return ""
+	}
+	return models.FormatCourseList(courses)
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// AuditQuery filters and paginates the audit log, newest first. Empty
+// filters match everything.
+type AuditQuery struct {
+	ActorID    int64
+	ActorEmail string
+	Action     string // Exact action, or every action of a target when it ends in "." (e.g. "auth.")
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	Limit      int
+	BeforeID   int64 // Continue after the event with this ID; 0 for the first page
+}
+
+// AuditPage is one page of the audit log
+type AuditPage struct {
+	Events []*models.AuditEvent
+	Total  int64 // Events matching the filters, across all pages
+	Next   int64 // BeforeID of the next page; 0 on the last page
+}
+
+// auditColumns lists audit event columns in the order scanAuditEvent
+// expects
+const auditColumns = `id, COALESCE(actor_id, 0), actor_email, action, target_type, target_id,
+	ip_address, user_agent, COALESCE(CAST(diff AS TEXT), ''), created_at`
+
+// scanAuditEvent scans a row selected with auditColumns into e
+func scanAuditEvent(row rowScanner, e *models.AuditEvent) error {
+	var diff string
+	if err := row.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.Action, &e.TargetType, &e.TargetID,
+		&e.IPAddress, &e.UserAgent, &diff, &e.CreatedAt); err != nil {
+		return err
+	}
+	if diff != "" {
+		e.Diff = json.RawMessage(diff)
+	}
+	return nil
+}
+
+// auditDiff returns the stored form of an event's diff; nil when empty
+func auditDiff(e *models.AuditEvent) interface{} {
+	if len(e.Diff) == 0 {
+		return nil
+	}
+	return string(e.Diff)
+}
+
+// auditFilters returns the WHERE conditions for the filters in q, not
+// including the page position
+func auditFilters(q *AuditQuery, a *queryArgs) string {
+	conds := []string{"1 = 1"}
+	if q.ActorID != 0 {
+		conds = append(conds, `actor_id = `+a.bind(q.ActorID))
+	}
+	if q.ActorEmail != "" {
+		conds = append(conds, `lower(actor_email) = `+a.bind(strings.ToLower(q.ActorEmail)))
+	}
+	if strings.HasSuffix(q.Action, ".") {
+		conds = append(conds, `action LIKE `+a.bind(q.Action+"%"))
+	} else if q.Action != "" {
+		conds = append(conds, `action = `+a.bind(q.Action))
+	}
+	if q.TargetType != "" {
+		conds = append(conds, `target_type = `+a.bind(q.TargetType))
+	}
+	if q.TargetID != "" {
+		conds = append(conds, `target_id = `+a.bind(q.TargetID))
+	}
+	if q.Since != nil {
+		conds = append(conds, `created_at >= `+a.bind(*q.Since))
+	}
+	if q.Until != nil {
+		conds = append(conds, `created_at < `+a.bind(*q.Until))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// auditListSQL builds the page query for q, selecting one row more than
+// the limit so the caller can tell whether another page follows
+func auditListSQL(q *AuditQuery, a *queryArgs) string {
+	query := `SELECT ` + auditColumns + ` FROM audit_events WHERE ` + auditFilters(q, a)
+	if q.BeforeID != 0 {
+		query += ` AND id < ` + a.bind(q.BeforeID)
+	}
+	return query + ` ORDER BY id DESC LIMIT ` + a.bind(q.Limit+1)
+}
+
+// scanAuditPage reads rows from auditListSQL into a page, trimming the
+// extra row
+func scanAuditPage(rows rowIterator, q *AuditQuery) (*AuditPage, error) {
+	page := &AuditPage{Events: []*models.AuditEvent{}}
+	for rows.Next() {
+		e := &models.AuditEvent{}
+		if err := scanAuditEvent(rows, e); err != nil {
+			return nil, err
+		}
+		page.Events = append(page.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Events) > q.Limit {
+		page.Events = page.Events[:q.Limit]
+		page.Next = page.Events[q.Limit-1].ID
+	}
+	return page, nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// courseColumns lists course columns in the order scanCourse expects,
+// including the number of packages published under each one
+const courseColumns = `id, name, code, description,
+	(SELECT COUNT(*) FROM packages WHERE packages.course_name = courses.name),
+	created_at, updated_at`
+
+// scanCourse scans a row selected with courseColumns into c
+func scanCourse(row rowScanner, c *models.Course) error {
+	return row.Scan(&c.ID, &c.Name, &c.Code, &c.Description, &c.PackageCount, &c.CreatedAt, &c.UpdatedAt)
+}
+
+// Membership tables linking users to courses
+const (
+	courseProfessorsTable  = "course_professors"
+	courseEnrollmentsTable = "course_enrollments"
+)
+
+// courseMembersSQL selects the course ID and user of every row of a
+// membership table, optionally restricted to one course
+func courseMembersSQL(table string, courseID int64, a *queryArgs) string {
+	query := `
+		SELECT m.course_id, u.id, u.email, COALESCE(u.full_name, '')
+		FROM ` + table + ` m JOIN users u ON u.id = m.user_id`
+	if courseID != 0 {
+		query += ` WHERE m.course_id = ` + a.bind(courseID)
+	}
+	return query + ` ORDER BY u.email`
+}
+
+// scanCourseMembers reads rows from courseMembersSQL for a single course
+func scanCourseMembers(rows rowIterator) ([]*models.CourseMember, error) {
+	members := []*models.CourseMember{}
+	for rows.Next() {
+		var courseID int64
+		m := &models.CourseMember{}
+		if err := rows.Scan(&courseID, &m.UserID, &m.Email, &m.FullName); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// scanCourseProfessors reads course_professors rows from courseMembersSQL
+// onto courses
+func scanCourseProfessors(rows rowIterator, courses []*models.Course) error {
+	byID := make(map[int64]*models.Course, len(courses))
+	for _, c := range courses {
+		c.Professors = []*models.CourseMember{}
+		byID[c.ID] = c
+	}
+
+	for rows.Next() {
+		var courseID int64
+		prof := &models.CourseMember{}
+		if err := rows.Scan(&courseID, &prof.UserID, &prof.Email, &prof.FullName); err != nil {
+			return err
+		}
+		if c := byID[courseID]; c != nil {
+			c.Professors = append(c.Professors, prof)
+		}
+	}
+	return rows.Err()
+}
+
+// userCoursesSQL selects the names of the courses a user belongs to in a
+// membership table
+func userCoursesSQL(table string, userID int64, a *queryArgs) string {
+	return `
+		SELECT c.name FROM courses c JOIN ` + table + ` m ON m.course_id = c.id
+		WHERE m.user_id = ` + a.bind(userID) + `
+		ORDER BY c.name`
+}
+
+// scanCourseNames reads rows from userCoursesSQL into a course list
+func scanCourseNames(rows rowIterator) (string, error) {
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return models.FormatCourseList(names), nil
+}
+
+// legacyAssignmentsSQL selects users whose assigned_courses column still
+// holds course names from before course_professors existed
+const legacyAssignmentsSQL = `
+	SELECT id, assigned_courses FROM users
+	WHERE assigned_courses IS NOT NULL AND assigned_courses != ''`
+
+// legacyAssignment is a users.assigned_courses value awaiting import
+type legacyAssignment struct {
+	userID  int64
+	courses []string
+}
+
+// scanLegacyAssignments reads rows from legacyAssignmentsSQL
+func scanLegacyAssignments(rows rowIterator) ([]legacyAssignment, error) {
+	var assignments []legacyAssignment
+	for rows.Next() {
+		var a legacyAssignment
+		var list string
+		if err := rows.Scan(&a.userID, &list); err != nil {
+			return nil, err
+		}
+		a.courses = models.ParseCourseList(list)
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+// unassignedCoursesSQL deletes a professor's assignments to courses other
+// than courseIDs
+func unassignedCoursesSQL(userID int64, courseIDs []int64, a *queryArgs) string {
+	query := `DELETE FROM ` + courseProfessorsTable + ` WHERE user_id = ` + a.bind(userID)
+	if len(courseIDs) == 0 {
+		return query
+	}
+	ids := make([]string, len(courseIDs))
+	for i, id := range courseIDs {
+		ids[i] = a.bind(id)
+	}
+	return query + ` AND course_id NOT IN (` + strings.Join(ids, ", ") + `)`
+}
@@ -4,7 +4,8 @@ import "errors"
 
 // Package errors
 var (
-	ErrPackageNotFound = errors.New("package not found")
+	ErrPackageNotFound   = errors.New("package not found")
+	ErrPackageNotInTrash = errors.New("package not in trash")
 )
 
 // User errors
@@ -14,4 +15,26 @@ var (
 	ErrInvalidToken    = errors.New("invalid or expired token")
 	ErrSessionNotFound = errors.New("session not found")
 	ErrSessionExpired  = errors.New("session expired")
+
+	ErrAccessTokenNotFound = errors.New("access token not found")
+)
+
+// Category errors
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryExists   = errors.New("category already exists")
+	ErrCategoryInUse    = errors.New("category is used by packages")
+)
+
+// Course errors
+var (
+	ErrCourseNotFound = errors.New("course not found")
+	ErrCourseExists   = errors.New("course already exists")
+	ErrCourseInUse    = errors.New("course is used by packages or submission boxes")
+)
+
+// Submission errors
+var (
+	ErrSubmissionBoxNotFound = errors.New("submission box not found")
+	ErrSubmissionNotFound    = errors.New("submission not found")
 )
@@ -13,9 +13,72 @@ type Database interface {
 	CreatePackage(pkg *models.Package) (int64, error)
 	GetPackage(id int64) (*models.Package, error)
 	GetPackages() ([]*models.Package, error)
-	ListPackages(limit, offset int, category, platform, contentType, courseName string) ([]*models.Package, error)
+	ListPackages(q *PackageQuery) (*PackagePage, error)
 	DeletePackage(id int64) error
 	FindPackageByHash(hash string) (*models.Package, error)
+	UpdatePackageFile(pkg *models.Package) error
+	CountPackagesByFilePath(filePath string) (int64, error)
+	UpdatePackage(pkg *models.Package, changes []*models.PackageChange) error
+	GetPackageHistory(packageID int64) ([]*models.PackageChange, error)
+	ReplacePackageFile(pkg *models.Package, previous *models.PackageRevision) error
+	GetPackageRevisions(packageID int64) ([]*models.PackageRevision, error)
+	GetPackageRevision(id int64) (*models.PackageRevision, error)
+
+	// Trash; PurgePackage removes a package in the trash for good
+	TrashPackage(id, userID int64) error
+	RestorePackage(id int64) error
+	GetTrashedPackage(id int64) (*models.Package, error)
+	ListTrash(deletedBefore *time.Time) ([]*models.Package, error)
+	PurgePackage(id int64) error
+
+	// Moderation and notifications
+	ReviewPackage(id int64, status models.PackageStatus, reason string, reviewerID int64) error
+	CreateNotification(n *models.Notification) error
+	ListNotifications(userID int64, unreadOnly bool, limit int) ([]*models.Notification, error)
+	MarkNotificationsRead(userID, id int64) error
+
+	// Audit log
+	CreateAuditEvent(e *models.AuditEvent) error
+	ListAuditEvents(q *AuditQuery) (*AuditPage, error)
+
+	// Full-text search
+	SearchPackages(query string, filters *PackageQuery, limit, offset int) ([]*models.SearchResult, error)
+	SetPackageReadme(packageID int64, readme string) error
+	GetPackagesWithoutReadme(afterID int64, limit int) ([]*models.Package, error)
+
+	// Tags and categories
+	AddPackageTags(packageID int64, tags []string) error
+	RemovePackageTags(packageID int64, tags []string) error
+	GetTagCounts(q *PackageQuery) ([]*models.Tag, error)
+	ListCategories() ([]*models.Category, error)
+	GetCategory(slug string) (*models.Category, error)
+	CreateCategory(c *models.Category) error
+	UpdateCategory(c *models.Category) error
+	DeleteCategory(slug string) error
+
+	// Courses
+	ListCourses() ([]*models.Course, error)
+	GetCourse(id int64) (*models.Course, error)
+	GetCourseByName(name string) (*models.Course, error)
+	CreateCourse(c *models.Course) error
+	UpdateCourse(c *models.Course) error
+	DeleteCourse(id int64) error
+	AddCourseProfessor(courseID, userID int64) error
+	RemoveCourseProfessor(courseID, userID int64) error
+	ListCourseStudents(courseID int64) ([]*models.CourseMember, error)
+	EnrollStudent(courseID, userID int64) error
+	UnenrollStudent(courseID, userID int64) error
+
+	// Assignment submission boxes
+	ListSubmissionBoxes(courseID int64) ([]*models.SubmissionBox, error)
+	GetSubmissionBox(id int64) (*models.SubmissionBox, error)
+	CreateSubmissionBox(b *models.SubmissionBox) error
+	UpdateSubmissionBox(b *models.SubmissionBox) error
+	DeleteSubmissionBox(id int64) error
+	SaveSubmission(sub *models.Submission) error
+	GetSubmission(id int64) (*models.Submission, error)
+	GetUserSubmission(boxID, userID int64) (*models.Submission, error)
+	ListSubmissions(boxID int64) ([]*models.Submission, error)
 
 	// Download tracking
 	RecordDownload(packageID int64, ipAddress, userAgent string) error
@@ -33,18 +96,46 @@ type Database interface {
 	GetUserByID(id int64) (*models.User, error)
 	GetUserByEmail(email string) (*models.User, error)
 	GetUserByResetToken(token string) (*models.User, error)
+	GetUserByVerificationToken(token string) (*models.User, error)
 	UpdateUserLastLogin(userID int64) error
 	UpdateUserPassword(userID int64, passwordHash string) error
 	SetUserResetToken(userID int64, token string, expiry time.Time) error
+	SetUserVerificationToken(userID int64, token string, expiry time.Time) error
 	SetUserEmailVerified(userID int64) error
+	ListUsers(q *UserQuery) (*UserPage, error)
+	UpdateUserRole(userID int64, role models.UserRole) error
+	SetUserActive(userID int64, active bool) error
+	SetUserCourses(userID int64, courseIDs []int64) error
+	ForcePasswordReset(userID int64, token string, expiry time.Time) error
+
+	// Two-factor authentication
+	SetUserMFASecret(userID int64, secret string) error
+	EnableUserMFA(userID int64, step int64, codeHashes []string) error
+	DisableUserMFA(userID int64) error
+	ReplaceRecoveryCodes(userID int64, codeHashes []string) error
+	UseTOTPStep(userID int64, step int64) (bool, error)
+	UseRecoveryCode(userID int64, codeHash string) (bool, error)
+	CountRecoveryCodes(userID int64) (int, error)
+
+	// Personal access tokens
+	CreateAccessToken(t *models.AccessToken) error
+	GetAccessTokenByHash(tokenHash string) (*models.AccessToken, error)
+	ListAccessTokens(userID int64) ([]*models.AccessToken, error)
+	DeleteAccessToken(userID, id int64) error
+	DeleteUserAccessTokens(userID int64) (int64, error)
+	TouchAccessToken(id int64, ipAddress string) error
 
 	// Session operations
-	CreateSession(userID int64, token, refreshToken, ipAddress, userAgent string, expiresAt time.Time) (*models.Session, error)
+	CreateSession(session *models.Session) (*models.Session, error)
+	RotateSession(oldID int64, rotatedHash string, next *models.Session) (*models.Session, error)
 	GetSessionByID(id int64) (*models.Session, error)
+	GetSessionByJTI(jti string) (*models.Session, error)
 	GetSessionByToken(token string) (*models.Session, error)
 	GetSessionByRefreshToken(refreshToken string) (*models.Session, error)
 	DeleteSession(token string) error
 	DeleteUserSessions(userID int64) error
+	DeleteSessionFamily(familyID string) ([]*models.Session, error)
+	GetRotatedRefreshToken(tokenHash string) (*models.RotatedRefreshToken, error)
 	CleanExpiredSessions() error
 	ListUserSessions(userID int64) ([]*models.Session, error)
 
@@ -0,0 +1,25 @@
+package storage
+
+import "github.com/jesus/FCCUR/internal/models"
+
+// notificationColumns lists notification columns in the order
+// scanNotification expects
+const notificationColumns = `id, user_id, kind, message, COALESCE(package_id, 0), read_at, created_at`
+
+// scanNotification scans a row selected with notificationColumns into n
+func scanNotification(row rowScanner, n *models.Notification) error {
+	return row.Scan(&n.ID, &n.UserID, &n.Kind, &n.Message, &n.PackageID, &n.ReadAt, &n.CreatedAt)
+}
+
+// scanNotifications reads rows selected with notificationColumns
+func scanNotifications(rows rowIterator) ([]*models.Notification, error) {
+	notifications := []*models.Notification{}
+	for rows.Next() {
+		n := &models.Notification{}
+		if err := scanNotification(rows, n); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// PackageSort selects the order of a package listing
+type PackageSort string
+
+const (
+	SortNewest    PackageSort = "newest"
+	SortName      PackageSort = "name"
+	SortSize      PackageSort = "size"
+	SortDownloads PackageSort = "downloads"
+)
+
+// sortSpecs maps each sort to its SQL key and default direction
+var sortSpecs = map[PackageSort]struct {
+	key  string
+	desc bool
+}{
+	SortNewest:    {key: "created_at", desc: true},
+	SortName:      {key: "lower(name)", desc: false},
+	SortSize:      {key: "file_size", desc: true},
+	SortDownloads: {key: "COALESCE(d.downloads, 0)", desc: true},
+}
+
+// ValidSort reports whether s is a supported package sort
+func ValidSort(s PackageSort) bool {
+	_, ok := sortSpecs[s]
+	return ok
+}
+
+// PackageQuery filters, sorts and paginates a package listing. Empty
+// filters match everything.
+type PackageQuery struct {
+	Category    string
+	Platform    string
+	ContentType string
+	CourseName  string
+	Tags        []string             // Packages must carry every tag
+	Viewer      *models.Viewer       // Only packages visible to Viewer match; nil is anonymous
+	Status      models.PackageStatus // Empty lists published packages
+	UploadedBy  int64
+	Sort        PackageSort
+	Ascending   *bool // nil uses the sort's natural direction
+	Limit       int
+	After       *PackageCursor // Position to continue from; nil for the first page
+}
+
+// PackageCursor is the sort position of the last package on a page. Only
+// the field matching the sort is set, plus the ID as a tiebreaker.
+type PackageCursor struct {
+	Time time.Time `json:"t,omitempty"`
+	Name string    `json:"n,omitempty"`
+	Num  int64     `json:"v,omitempty"`
+	ID   int64     `json:"id"`
+}
+
+// PackagePage is one page of a package listing
+type PackagePage struct {
+	Packages []*models.Package
+	Total    int64          // Packages matching the filters, across all pages
+	Next     *PackageCursor // nil on the last page
+}
+
+// queryArgs collects positional arguments for a backend's placeholder style
+type queryArgs struct {
+	args        []interface{}
+	placeholder func(n int) string
+	timeArg     func(t time.Time) interface{}
+}
+
+func (a *queryArgs) bind(v interface{}) string {
+	if t, ok := v.(time.Time); ok && a.timeArg != nil {
+		v = a.timeArg(t)
+	}
+	a.args = append(a.args, v)
+	return a.placeholder(len(a.args))
+}
+
+// packageFilters returns the WHERE conditions for the filters in q.
+// Only packages in q.Status match, so unreviewed uploads stay out of
+// listings, searches and tag counts; packages in the trash never match.
+func packageFilters(q *PackageQuery, a *queryArgs) string {
+	where := "deleted_at IS NULL AND status = " + a.bind(string(packageStatus(q.Status)))
+	if q.UploadedBy != 0 {
+		where += ` AND uploaded_by = ` + a.bind(q.UploadedBy)
+	}
+	for _, f := range []struct{ column, value string }{
+		{"category", q.Category},
+		{"platform", q.Platform},
+		{"content_type", q.ContentType},
+		{"course_name", q.CourseName},
+	} {
+		if f.value != "" {
+			where += ` AND ` + f.column + ` = ` + a.bind(f.value)
+		}
+	}
+	for _, tag := range q.Tags {
+		where += ` AND id IN (
+			SELECT pt.package_id FROM package_tags pt JOIN tags t ON t.id = pt.tag_id
+			WHERE t.name = ` + a.bind(tag) + `)`
+	}
+	if q.UploadedBy != 0 && q.Viewer != nil && q.Viewer.UserID == q.UploadedBy {
+		// Uploaders always see their own packages
+		return where
+	}
+	return where + visibilityFilter(q.Viewer, a)
+}
+
+// visibilityFilter returns the condition restricting packages to those v
+// may see, mirroring models.Package.VisibleTo
+func visibilityFilter(v *models.Viewer, a *queryArgs) string {
+	if v.SeesAll() {
+		return ""
+	}
+
+	var levels []string
+	for _, level := range v.Levels() {
+		levels = append(levels, a.bind(string(level)))
+	}
+	cond := `visibility IN (` + strings.Join(levels, ", ") + `)`
+
+	if v != nil && len(v.Courses) > 0 {
+		// Bind in SQL order; SQLite placeholders are positional
+		cond += ` OR (visibility = ` + a.bind(string(models.VisibilityEnrolled)) + ` AND course_name IN (`
+		for i, name := range v.Courses {
+			if i > 0 {
+				cond += ", "
+			}
+			cond += a.bind(name)
+		}
+		cond += `))`
+	}
+	return ` AND (` + cond + `)`
+}
+
+// searchFilters returns the listing filters to apply to a search, which
+// may be nil
+func searchFilters(q *PackageQuery) *PackageQuery {
+	if q == nil {
+		return &PackageQuery{}
+	}
+	return q
+}
+
+// packageListSQL builds the page query for q. It selects packageColumns
+// followed by the sort key, and one row more than the limit so the caller
+// can tell whether another page follows.
+func packageListSQL(q *PackageQuery, a *queryArgs) string {
+	spec := sortSpecs[q.Sort]
+	desc := spec.desc
+	if q.Ascending != nil {
+		desc = !*q.Ascending
+	}
+
+	query := `SELECT ` + packageColumns + `, ` + spec.key + ` AS sort_key FROM packages`
+	if q.Sort == SortDownloads {
+		query += ` LEFT JOIN (
+			SELECT package_id, COUNT(*) AS downloads FROM downloads GROUP BY package_id
+		) d ON d.package_id = packages.id`
+	}
+	query += ` WHERE ` + packageFilters(q, a)
+
+	dir, cmp := "ASC", ">"
+	if desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if c := q.After; c != nil {
+		var value interface{}
+		switch q.Sort {
+		case SortNewest:
+			value = c.Time
+		case SortName:
+			value = c.Name
+		default:
+			value = c.Num
+		}
+		query += fmt.Sprintf(` AND (%s %s %s OR (%s = %s AND id %s %s))`,
+			spec.key, cmp, a.bind(value), spec.key, a.bind(value), cmp, a.bind(c.ID))
+	}
+
+	query += fmt.Sprintf(` ORDER BY %s %s, id %s LIMIT %s`, spec.key, dir, dir, a.bind(q.Limit+1))
+	return query
+}
+
+// scanPackagePage reads rows from packageListSQL into a page, trimming the
+// extra row and recording the cursor of the last package
+func scanPackagePage(rows rowIterator, q *PackageQuery) (*PackagePage, error) {
+	page := &PackagePage{Packages: []*models.Package{}}
+	var cursors []*PackageCursor
+
+	for rows.Next() {
+		pkg := &models.Package{}
+		cursor := &PackageCursor{}
+
+		var key interface{}
+		switch q.Sort {
+		case SortNewest:
+			key = &cursor.Time
+		case SortName:
+			key = &cursor.Name
+		default:
+			key = &cursor.Num
+		}
+		if err := scanPackage(extraColumnRow{rows, key}, pkg); err != nil {
+			return nil, err
+		}
+		cursor.ID = pkg.ID
+
+		page.Packages = append(page.Packages, pkg)
+		cursors = append(cursors, cursor)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Packages) > q.Limit {
+		page.Packages = page.Packages[:q.Limit]
+		page.Next = cursors[q.Limit-1]
+	}
+	return page, nil
+}
+
+// sqlitePlaceholder and postgresPlaceholder number positional arguments
+func sqlitePlaceholder(int) string { return "?" }
+
+func postgresPlaceholder(n int) string { return "$" + fmt.Sprint(n) }
+
+// sqliteTime formats a cursor time like SQLite's CURRENT_TIMESTAMP so text
+// comparison against created_at is ordered correctly
+func sqliteTime(t time.Time) interface{} {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
@@ -67,12 +67,17 @@ func (p *PostgresDB) Migrate() error {
 		// Fallback to old schema if migrations not available
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
-		_, err := p.pool.Exec(ctx, postgresSchema)
-		return err
+		if _, err := p.pool.Exec(ctx, postgresSchema); err != nil {
+			return err
+		}
+		return p.importAssignedCourses()
 	}
 	defer migrator.Close()
 
-	return migrator.Up()
+	if err := migrator.Up(); err != nil {
+		return err
+	}
+	return p.importAssignedCourses()
 }
 
 // Helper function to get context with timeout
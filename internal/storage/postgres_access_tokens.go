@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"github.com/jackc/pgx/v5"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// CreateAccessToken stores a new personal access token and sets its ID
+func (p *PostgresDB) CreateAccessToken(t *models.AccessToken) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	return p.pool.QueryRow(ctx, `
+		INSERT INTO access_tokens (user_id, name, token_hash, token_prefix, scope, courses, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, t.UserID, t.Name, t.TokenHash, t.Prefix, t.Scope, formatTokenCourses(t.Courses),
+		t.ExpiresAt, t.CreatedAt).Scan(&t.ID)
+}
+
+// GetAccessTokenByHash retrieves a personal access token by the hash of
+// the token, expired or not
+func (p *PostgresDB) GetAccessTokenByHash(tokenHash string) (*models.AccessToken, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	t := &models.AccessToken{}
+	err := scanAccessToken(p.pool.QueryRow(ctx, `SELECT `+accessTokenColumns+` FROM access_tokens WHERE token_hash = $1`,
+		tokenHash), t)
+	if err == pgx.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ListAccessTokens returns a user's personal access tokens, newest first
+func (p *PostgresDB) ListAccessTokens(userID int64) ([]*models.AccessToken, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+accessTokenColumns+` FROM access_tokens WHERE user_id = $1 ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAccessTokens(rows)
+}
+
+// DeleteAccessToken revokes one of a user's personal access tokens
+func (p *PostgresDB) DeleteAccessToken(userID, id int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `DELETE FROM access_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+// DeleteUserAccessTokens revokes every personal access token of a user and
+// returns how many there were
+func (p *PostgresDB) DeleteUserAccessTokens(userID int64) (int64, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `DELETE FROM access_tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// TouchAccessToken records that a personal access token was just used
+func (p *PostgresDB) TouchAccessToken(id int64, ipAddress string) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	_, err := p.pool.Exec(ctx, `UPDATE access_tokens SET last_used_at = CURRENT_TIMESTAMP, last_used_ip = $1 WHERE id = $2`,
+		ipAddress, id)
+	return err
+}
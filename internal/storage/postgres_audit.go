@@ -0,0 +1,44 @@
+package storage
+
+import "github.com/jesus/FCCUR/internal/models"
+
+// CreateAuditEvent appends an event to the audit log
+func (p *PostgresDB) CreateAuditEvent(e *models.AuditEvent) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	return p.pool.QueryRow(ctx, `
+		INSERT INTO audit_events (actor_id, actor_email, action, target_type, target_id,
+		                          ip_address, user_agent, diff)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, nullableID(e.ActorID), e.ActorEmail, e.Action, e.TargetType, e.TargetID,
+		e.IPAddress, e.UserAgent, auditDiff(e)).Scan(&e.ID)
+}
+
+// ListAuditEvents returns a page of the audit log, newest first
+func (p *PostgresDB) ListAuditEvents(q *AuditQuery) (*AuditPage, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	args := &queryArgs{placeholder: postgresPlaceholder}
+	rows, err := p.pool.Query(ctx, auditListSQL(q, args), args.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page, err := scanAuditPage(rows, q)
+	if err != nil {
+		return nil, err
+	}
+
+	countArgs := &queryArgs{placeholder: postgresPlaceholder}
+	err = p.pool.QueryRow(ctx, `SELECT COUNT(*) FROM audit_events WHERE `+auditFilters(q, countArgs),
+		countArgs.args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"errors"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// attachProfessors loads the professors assigned to each course
+func (p *PostgresDB) attachProfessors(courses []*models.Course, courseID int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	args := &queryArgs{placeholder: postgresPlaceholder}
+	rows, err := p.pool.Query(ctx, courseMembersSQL(courseProfessorsTable, courseID, args), args.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scanCourseProfessors(rows, courses)
+}
+
+// attachCourses sets the courses user teaches and is enrolled in
+func (p *PostgresDB) attachCourses(user *models.User) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	for _, m := range []struct {
+		table string
+		dst   *string
+	}{
+		{courseProfessorsTable, &user.AssignedCourses},
+		{courseEnrollmentsTable, &user.EnrolledCourses},
+	} {
+		args := &queryArgs{placeholder: postgresPlaceholder}
+		rows, err := p.pool.Query(ctx, userCoursesSQL(m.table, user.ID, args), args.args...)
+		if err != nil {
+			return err
+		}
+		*m.dst, err = scanCourseNames(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListCourses returns every course with its professors, ordered by name
+func (p *PostgresDB) ListCourses() ([]*models.Course, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	rows, err := p.pool.Query(ctx, `SELECT `+courseColumns+` FROM courses ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	courses := []*models.Course{}
+	for rows.Next() {
+		c := &models.Course{}
+		if err := scanCourse(rows, c); err != nil {
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return courses, p.attachProfessors(courses, 0)
+}
+
+// GetCourse retrieves a course and its professors by ID
+func (p *PostgresDB) GetCourse(id int64) (*models.Course, error) {
+	return p.getCourse(`id = $1`, id)
+}
+
+// GetCourseByName retrieves a course and its professors by name
+func (p *PostgresDB) GetCourseByName(name string) (*models.Course, error) {
+	return p.getCourse(`name = $1`, name)
+}
+
+func (p *PostgresDB) getCourse(where string, arg interface{}) (*models.Course, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	c := &models.Course{}
+	err := scanCourse(p.pool.QueryRow(ctx, `SELECT `+courseColumns+` FROM courses WHERE `+where, arg), c)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCourseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c, p.attachProfessors([]*models.Course{c}, c.ID)
+}
+
+// CreateCourse adds a course
+func (p *PostgresDB) CreateCourse(c *models.Course) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	err := p.pool.QueryRow(ctx, `
+		INSERT INTO courses (name, code, description)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, c.Name, c.Code, c.Description).Scan(&c.ID)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+		return ErrCourseExists
+	}
+	return err
+}
+
+// UpdateCourse changes the name, code and description of a course. Renaming
+// a course moves its packages along with it.
+func (p *PostgresDB) UpdateCourse(c *models.Course) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var oldName string
+	err = tx.QueryRow(ctx, `SELECT name FROM courses WHERE id = $1 FOR UPDATE`, c.ID).Scan(&oldName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrCourseNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE courses SET name = $1, code = $2, description = $3 WHERE id = $4
+	`, c.Name, c.Code, c.Description, c.ID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+		return ErrCourseExists
+	}
+	if err != nil {
+		return err
+	}
+
+	if oldName != c.Name {
+		_, err := tx.Exec(ctx, `UPDATE packages SET course_name = $1 WHERE course_name = $2`, c.Name, oldName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteCourse removes a course that no package or submission box uses,
+// along with its professor assignments and enrollments
+func (p *PostgresDB) DeleteCourse(id int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		DELETE FROM courses
+		WHERE id = $1
+		  AND NOT EXISTS (SELECT 1 FROM packages WHERE course_name = courses.name)
+		  AND NOT EXISTS (SELECT 1 FROM submission_boxes WHERE course_id = courses.id)
+	`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	if _, err := p.GetCourse(id); err != nil {
+		return err
+	}
+	return ErrCourseInUse
+}
+
+// AddCourseProfessor assigns a professor to a course; assigning twice is a no-op
+func (p *PostgresDB) AddCourseProfessor(courseID, userID int64) error {
+	return p.addCourseMember(courseProfessorsTable, courseID, userID)
+}
+
+// RemoveCourseProfessor unassigns a professor from a course
+func (p *PostgresDB) RemoveCourseProfessor(courseID, userID int64) error {
+	return p.removeCourseMember(courseProfessorsTable, courseID, userID)
+}
+
+// ListCourseStudents returns the students enrolled in a course
+func (p *PostgresDB) ListCourseStudents(courseID int64) ([]*models.CourseMember, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	args := &queryArgs{placeholder: postgresPlaceholder}
+	rows, err := p.pool.Query(ctx, courseMembersSQL(courseEnrollmentsTable, courseID, args), args.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCourseMembers(rows)
+}
+
+// EnrollStudent enrolls a student in a course; enrolling twice is a no-op
+func (p *PostgresDB) EnrollStudent(courseID, userID int64) error {
+	return p.addCourseMember(courseEnrollmentsTable, courseID, userID)
+}
+
+// UnenrollStudent removes a student from a course
+func (p *PostgresDB) UnenrollStudent(courseID, userID int64) error {
+	return p.removeCourseMember(courseEnrollmentsTable, courseID, userID)
+}
+
+func (p *PostgresDB) addCourseMember(table string, courseID, userID int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		INSERT INTO `+table+` (course_id, user_id)
+		SELECT id, $2 FROM courses WHERE id = $1
+		ON CONFLICT DO NOTHING
+	`, courseID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := p.GetCourse(courseID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PostgresDB) removeCourseMember(table string, courseID, userID int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	_, err := p.pool.Exec(ctx, `DELETE FROM `+table+` WHERE course_id = $1 AND user_id = $2`, courseID, userID)
+	return err
+}
+
+// importAssignedCourses moves course names left in users.assigned_courses
+// into course_professors, creating missing courses, and clears the column
+// so the import runs once
+func (p *PostgresDB) importAssignedCourses() error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	rows, err := p.pool.Query(ctx, legacyAssignmentsSQL)
+	if err != nil {
+		return err
+	}
+	assignments, err := scanLegacyAssignments(rows)
+	rows.Close()
+	if err != nil || len(assignments) == 0 {
+		return err
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, a := range assignments {
+		for _, name := range a.courses {
+			_, err := tx.Exec(ctx, `INSERT INTO courses (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, name)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `
+				INSERT INTO course_professors (course_id, user_id)
+				SELECT id, $1 FROM courses WHERE name = $2
+				ON CONFLICT DO NOTHING
+			`, a.userID, name)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(ctx, `UPDATE users SET assigned_courses = '' WHERE id = $1`, a.userID); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Imported course assignments of %d users", len(assignments))
+	return tx.Commit(ctx)
+}
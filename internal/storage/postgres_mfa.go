@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SetUserMFASecret stores a TOTP secret pending confirmation; MFA stays
+// disabled until EnableUserMFA
+func (p *PostgresDB) SetUserMFASecret(userID int64, secret string) error {
+	return p.updateUser(userID, `mfa_secret = $1, mfa_enabled = false`, secret)
+}
+
+// EnableUserMFA turns on MFA with the pending secret, records step as used
+// and replaces the user's recovery codes
+func (p *PostgresDB) EnableUserMFA(userID int64, step int64, codeHashes []string) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET mfa_enabled = true, mfa_last_step = $1
+		WHERE id = $2 AND mfa_secret IS NOT NULL
+	`, step, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := insertRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DisableUserMFA turns off MFA and drops the secret and recovery codes
+func (p *PostgresDB) DisableUserMFA(userID int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET mfa_secret = NULL, mfa_enabled = false, mfa_last_step = 0
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ReplaceRecoveryCodes replaces every recovery code of a user
+func (p *PostgresDB) ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func insertRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int64, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseTOTPStep records step as the last TOTP step accepted for a user. It
+// returns false when step is not newer than the last one, i.e. the code
+// was already used.
+func (p *PostgresDB) UseTOTPStep(userID int64, step int64) (bool, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE users SET mfa_last_step = $1 WHERE id = $2 AND COALESCE(mfa_last_step, 0) < $1
+	`, step, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used. It
+// returns false when the user has no such unused code.
+func (p *PostgresDB) UseRecoveryCode(userID int64, codeHash string) (bool, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM mfa_recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		)
+	`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left
+func (p *PostgresDB) CountRecoveryCodes(userID int64) (int, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	var n int
+	err := p.pool.QueryRow(ctx, `SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`,
+		userID).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,73 @@
+package storage
+
+import "github.com/jesus/FCCUR/internal/models"
+
+// ReviewPackage records the outcome of a package review: its new status,
+// the reason given and who reviewed it
+func (p *PostgresDB) ReviewPackage(id int64, status models.PackageStatus, reason string, reviewerID int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE packages
+		SET status = $1, review_reason = $2, reviewed_by = $3, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, status, reason, nullableID(reviewerID), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPackageNotFound
+	}
+
+	return nil
+}
+
+// CreateNotification stores a notification for a user
+func (p *PostgresDB) CreateNotification(n *models.Notification) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	return p.pool.QueryRow(ctx, `
+		INSERT INTO notifications (user_id, kind, message, package_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, n.UserID, n.Kind, n.Message, nullableID(n.PackageID)).Scan(&n.ID)
+}
+
+// ListNotifications returns up to limit notifications of a user, newest
+// first
+func (p *PostgresDB) ListNotifications(userID int64, unreadOnly bool, limit int) ([]*models.Notification, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE user_id = $1`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+
+	rows, err := p.pool.Query(ctx, query+` ORDER BY created_at DESC, id DESC LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotifications(rows)
+}
+
+// MarkNotificationsRead marks notification id of a user as read, or all of
+// the user's notifications when id is 0
+func (p *PostgresDB) MarkNotificationsRead(userID, id int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	query := `UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL`
+	args := []interface{}{userID}
+	if id != 0 {
+		query += ` AND id = $2`
+		args = append(args, id)
+	}
+
+	_, err := p.pool.Exec(ctx, query, args...)
+	return err
+}
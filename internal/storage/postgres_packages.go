@@ -2,6 +2,9 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
 
 	"github.com/jesus/FCCUR/internal/models"
 )
@@ -15,12 +18,14 @@ func (p *PostgresDB) CreatePackage(pkg *models.Package) (int64, error) {
 	err := p.pool.QueryRow(ctx, `
 		INSERT INTO packages (
 			name, version, description, category, content_type, course_name,
-			file_path, file_size, blake3_hash, sha256_hash, download_url, platform, thumbnail_path
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			file_path, file_name, file_size, blake3_hash, sha256_hash, download_url, platform, thumbnail_path,
+			visibility, status, uploaded_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 		RETURNING id
 	`, pkg.Name, pkg.Version, pkg.Description, pkg.Category, pkg.ContentType,
-		pkg.CourseName, pkg.FilePath, pkg.FileSize, pkg.BLAKE3Hash, pkg.SHA256Hash,
-		pkg.DownloadURL, pkg.Platform, pkg.ThumbnailPath).Scan(&id)
+		pkg.CourseName, pkg.FilePath, pkg.FileName, pkg.FileSize, pkg.BLAKE3Hash, pkg.SHA256Hash,
+		pkg.DownloadURL, pkg.Platform, pkg.ThumbnailPath, packageVisibility(pkg.Visibility),
+		packageStatus(pkg.Status), nullableID(pkg.UploadedBy)).Scan(&id)
 
 	return id, err
 }
@@ -31,22 +36,18 @@ func (p *PostgresDB) GetPackage(id int64) (*models.Package, error) {
 	defer cancel()
 
 	pkg := &models.Package{}
-	err := p.pool.QueryRow(ctx, `
-		SELECT id, name, version, description, category, content_type, course_name,
-		       file_path, file_size, blake3_hash, sha256_hash, download_url, platform,
-		       thumbnail_path, created_at, updated_at
-		FROM packages WHERE id = $1
-	`, id).Scan(
-		&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description, &pkg.Category,
-		&pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileSize,
-		&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL, &pkg.Platform,
-		&pkg.ThumbnailPath, &pkg.CreatedAt, &pkg.UpdatedAt,
-	)
+	err := scanPackage(p.pool.QueryRow(ctx, `
+		SELECT `+packageColumns+`
+		FROM packages WHERE id = $1 AND deleted_at IS NULL
+	`, id), pkg)
 
 	if err == sql.ErrNoRows {
 		return nil, ErrPackageNotFound
 	}
-	return pkg, err
+	if err != nil {
+		return pkg, err
+	}
+	return pkg, p.attachTags([]*models.Package{pkg})
 }
 
 // GetPackages retrieves all packages
@@ -55,10 +56,9 @@ func (p *PostgresDB) GetPackages() ([]*models.Package, error) {
 	defer cancel()
 
 	rows, err := p.pool.Query(ctx, `
-		SELECT id, name, version, description, category, content_type, course_name,
-		       file_path, file_size, blake3_hash, sha256_hash, download_url, platform,
-		       thumbnail_path, created_at, updated_at
+		SELECT `+packageColumns+`
 		FROM packages
+		WHERE deleted_at IS NULL
 		ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -69,91 +69,45 @@ func (p *PostgresDB) GetPackages() ([]*models.Package, error) {
 	var packages []*models.Package
 	for rows.Next() {
 		pkg := &models.Package{}
-		err := rows.Scan(
-			&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description, &pkg.Category,
-			&pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileSize,
-			&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL, &pkg.Platform,
-			&pkg.ThumbnailPath, &pkg.CreatedAt, &pkg.UpdatedAt,
-		)
+		err := scanPackage(rows, pkg)
 		if err != nil {
 			return nil, err
 		}
 		packages = append(packages, pkg)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return packages, rows.Err()
+	return packages, p.attachTags(packages)
 }
 
-// ListPackages retrieves packages with filters and pagination
-func (p *PostgresDB) ListPackages(limit, offset int, category, platform, contentType, courseName string) ([]*models.Package, error) {
+// ListPackages returns one page of packages matching the filters in q,
+// in the requested order, along with the total match count
+func (p *PostgresDB) ListPackages(q *PackageQuery) (*PackagePage, error) {
 	ctx, cancel := p.getContext()
 	defer cancel()
 
-	query := `
-		SELECT id, name, version, description, category, content_type, course_name,
-		       file_path, file_size, blake3_hash, sha256_hash, download_url, platform,
-		       thumbnail_path, created_at, updated_at
-		FROM packages
-		WHERE 1=1
-	`
-	args := []interface{}{}
-	argPos := 1
-
-	if category != "" {
-		query += ` AND category = $` + string(rune(argPos+'0'))
-		args = append(args, category)
-		argPos++
-	}
-	if platform != "" {
-		query += ` AND platform = $` + string(rune(argPos+'0'))
-		args = append(args, platform)
-		argPos++
-	}
-	if contentType != "" {
-		query += ` AND content_type = $` + string(rune(argPos+'0'))
-		args = append(args, contentType)
-		argPos++
-	}
-	if courseName != "" {
-		query += ` AND course_name = $` + string(rune(argPos+'0'))
-		args = append(args, courseName)
-		argPos++
-	}
-
-	query += ` ORDER BY created_at DESC`
-
-	if limit > 0 {
-		query += ` LIMIT $` + string(rune(argPos+'0'))
-		args = append(args, limit)
-		argPos++
-	}
-	if offset > 0 {
-		query += ` OFFSET $` + string(rune(argPos+'0'))
-		args = append(args, offset)
+	args := &queryArgs{placeholder: postgresPlaceholder}
+	rows, err := p.pool.Query(ctx, packageListSQL(q, args), args.args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	rows, err := p.pool.Query(ctx, query, args...)
+	page, err := scanPackagePage(rows, q)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var packages []*models.Package
-	for rows.Next() {
-		pkg := &models.Package{}
-		err := rows.Scan(
-			&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description, &pkg.Category,
-			&pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileSize,
-			&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL, &pkg.Platform,
-			&pkg.ThumbnailPath, &pkg.CreatedAt, &pkg.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		packages = append(packages, pkg)
+	countArgs := &queryArgs{placeholder: postgresPlaceholder}
+	err = p.pool.QueryRow(ctx, `SELECT COUNT(*) FROM packages WHERE `+packageFilters(q, countArgs),
+		countArgs.args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
 	}
 
-	return packages, rows.Err()
+	return page, p.attachTags(page.Packages)
 }
 
 // DeletePackage deletes a package
@@ -171,19 +125,12 @@ func (p *PostgresDB) FindPackageByHash(hash string) (*models.Package, error) {
 	defer cancel()
 
 	pkg := &models.Package{}
-	err := p.pool.QueryRow(ctx, `
-		SELECT id, name, version, description, category, content_type, course_name,
-		       file_path, file_size, blake3_hash, sha256_hash, download_url, platform,
-		       thumbnail_path, created_at, updated_at
+	err := scanPackage(p.pool.QueryRow(ctx, `
+		SELECT `+packageColumns+`
 		FROM packages
-		WHERE blake3_hash = $1 OR sha256_hash = $1
+		WHERE (blake3_hash = $1 OR sha256_hash = $1) AND deleted_at IS NULL
 		LIMIT 1
-	`, hash).Scan(
-		&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description, &pkg.Category,
-		&pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileSize,
-		&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL, &pkg.Platform,
-		&pkg.ThumbnailPath, &pkg.CreatedAt, &pkg.UpdatedAt,
-	)
+	`, hash), pkg)
 
 	if err == sql.ErrNoRows {
 		return nil, nil // No duplicate found
@@ -191,6 +138,203 @@ func (p *PostgresDB) FindPackageByHash(hash string) (*models.Package, error) {
 	return pkg, err
 }
 
+// UpdatePackageFile updates the stored file location, size and hashes of a package
+func (p *PostgresDB) UpdatePackageFile(pkg *models.Package) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE packages
+		SET file_path = $1, file_name = $2, file_size = $3, blake3_hash = $4, sha256_hash = $5
+		WHERE id = $6
+	`, pkg.FilePath, pkg.FileName, pkg.FileSize, pkg.BLAKE3Hash, pkg.SHA256Hash, pkg.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPackageNotFound
+	}
+
+	return nil
+}
+
+// CountPackagesByFilePath counts packages, prior revisions and submissions
+// referencing a stored file
+func (p *PostgresDB) CountPackagesByFilePath(filePath string) (int64, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	var count int64
+	err := p.pool.QueryRow(ctx, `
+		SELECT (SELECT COUNT(*) FROM packages WHERE file_path = $1)
+		     + (SELECT COUNT(*) FROM package_revisions WHERE file_path = $1)
+		     + (SELECT COUNT(*) FROM submissions WHERE file_path = $1)
+	`, filePath).Scan(&count)
+
+	return count, err
+}
+
+// UpdatePackage updates editable package metadata and records the field
+// changes in package_history within a single transaction
+func (p *PostgresDB) UpdatePackage(pkg *models.Package, changes []*models.PackageChange) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE packages
+		SET name = $1, version = $2, description = $3, category = $4, content_type = $5,
+			course_name = $6, platform = $7, visibility = $8, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $9
+	`, pkg.Name, pkg.Version, pkg.Description, pkg.Category, pkg.ContentType,
+		pkg.CourseName, pkg.Platform, packageVisibility(pkg.Visibility), pkg.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPackageNotFound
+	}
+
+	for _, c := range changes {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO package_history (package_id, user_id, field, old_value, new_value)
+			VALUES ($1, $2, $3, $4, $5)
+		`, pkg.ID, nullableID(c.UserID), c.Field, c.OldValue, c.NewValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPackageHistory returns metadata edits for a package, newest first
+func (p *PostgresDB) GetPackageHistory(packageID int64) ([]*models.PackageChange, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	rows, err := p.pool.Query(ctx, `
+		SELECT h.id, h.package_id, h.user_id, COALESCE(u.email, ''), h.field,
+		       COALESCE(h.old_value, ''), COALESCE(h.new_value, ''), h.changed_at
+		FROM package_history h
+		LEFT JOIN users u ON u.id = h.user_id
+		WHERE h.package_id = $1
+		ORDER BY h.changed_at DESC, h.id DESC
+	`, packageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*models.PackageChange
+	for rows.Next() {
+		c := &models.PackageChange{}
+		var userID *int64
+		err := rows.Scan(&c.ID, &c.PackageID, &userID, &c.UserEmail, &c.Field,
+			&c.OldValue, &c.NewValue, &c.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		if userID != nil {
+			c.UserID = *userID
+		}
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
+
+// ReplacePackageFile points a package at a new file and keeps the previous
+// file as a revision, within a single transaction. The package's status and
+// uploader are saved too, since a new file may need review.
+func (p *PostgresDB) ReplacePackageFile(pkg *models.Package, previous *models.PackageRevision) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO package_revisions (package_id, file_path, file_name, file_size,
+			blake3_hash, sha256_hash, replaced_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, pkg.ID, previous.FilePath, previous.FileName, previous.FileSize,
+		previous.BLAKE3Hash, previous.SHA256Hash, nullableID(previous.ReplacedBy)).Scan(&previous.ID)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE packages
+		SET file_path = $1, file_name = $2, file_size = $3, blake3_hash = $4, sha256_hash = $5,
+			status = $6, uploaded_by = $7, readme_text = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8
+	`, pkg.FilePath, pkg.FileName, pkg.FileSize, pkg.BLAKE3Hash, pkg.SHA256Hash,
+		packageStatus(pkg.Status), nullableID(pkg.UploadedBy), pkg.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPackageNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPackageRevisions returns the previous files of a package, newest first
+func (p *PostgresDB) GetPackageRevisions(packageID int64) ([]*models.PackageRevision, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+revisionColumns+`
+		FROM package_revisions
+		WHERE package_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, packageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.PackageRevision
+	for rows.Next() {
+		rev := &models.PackageRevision{}
+		if err := scanRevision(rows, rev); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetPackageRevision retrieves a single revision by ID
+func (p *PostgresDB) GetPackageRevision(id int64) (*models.PackageRevision, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	rev := &models.PackageRevision{}
+	err := scanRevision(p.pool.QueryRow(ctx, `
+		SELECT `+revisionColumns+`
+		FROM package_revisions WHERE id = $1
+	`, id), rev)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPackageNotFound
+	}
+	return rev, err
+}
+
 // RecordDownload records a package download
 func (p *PostgresDB) RecordDownload(packageID int64, ipAddress, userAgent string) error {
 	ctx, cancel := p.getContext()
@@ -233,7 +377,7 @@ func (p *PostgresDB) GetPackageCount() (int64, error) {
 	defer cancel()
 
 	var count int64
-	err := p.pool.QueryRow(ctx, `SELECT COUNT(*) FROM packages`).Scan(&count)
+	err := p.pool.QueryRow(ctx, `SELECT COUNT(*) FROM packages WHERE deleted_at IS NULL`).Scan(&count)
 	return count, err
 }
 
@@ -244,7 +388,7 @@ func (p *PostgresDB) GetTotalSize() (int64, error) {
 
 	var size int64
 	err := p.pool.QueryRow(ctx, `
-		SELECT COALESCE(SUM(file_size), 0) FROM packages
+		SELECT COALESCE(SUM(file_size), 0) FROM packages WHERE deleted_at IS NULL
 	`).Scan(&size)
 	return size, err
 }
@@ -255,10 +399,9 @@ func (p *PostgresDB) GetRecentPackages(limit int) ([]*models.Package, error) {
 	defer cancel()
 
 	rows, err := p.pool.Query(ctx, `
-		SELECT id, name, version, description, category, content_type, course_name,
-		       file_path, file_size, blake3_hash, sha256_hash, download_url, platform,
-		       thumbnail_path, created_at, updated_at
+		SELECT `+packageColumns+`
 		FROM packages
+		WHERE deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT $1
 	`, limit)
@@ -270,19 +413,17 @@ func (p *PostgresDB) GetRecentPackages(limit int) ([]*models.Package, error) {
 	var packages []*models.Package
 	for rows.Next() {
 		pkg := &models.Package{}
-		err := rows.Scan(
-			&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description, &pkg.Category,
-			&pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileSize,
-			&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL, &pkg.Platform,
-			&pkg.ThumbnailPath, &pkg.CreatedAt, &pkg.UpdatedAt,
-		)
+		err := scanPackage(rows, pkg)
 		if err != nil {
 			return nil, err
 		}
 		packages = append(packages, pkg)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return packages, rows.Err()
+	return packages, p.attachTags(packages)
 }
 
 // GetStats retrieves download statistics
@@ -298,6 +439,7 @@ func (p *PostgresDB) GetStats() ([]*models.DownloadStats, error) {
 			COALESCE(MAX(d.downloaded_at), '1970-01-01 00:00:00'::timestamp) as last_download
 		FROM packages p
 		LEFT JOIN downloads d ON p.id = d.package_id
+		WHERE p.deleted_at IS NULL
 		GROUP BY p.id, p.name
 		ORDER BY total DESC
 	`)
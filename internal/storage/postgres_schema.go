@@ -13,23 +13,44 @@ CREATE TABLE IF NOT EXISTS packages (
   category VARCHAR(100) NOT NULL,
   content_type VARCHAR(50) NOT NULL DEFAULT 'tool',
   course_name VARCHAR(255),
-  file_path VARCHAR(500) NOT NULL UNIQUE,
+  file_path VARCHAR(500) NOT NULL,
+  file_name VARCHAR(255) NOT NULL DEFAULT '',
   file_size BIGINT NOT NULL,
   blake3_hash VARCHAR(64) NOT NULL,
   sha256_hash VARCHAR(64) NOT NULL,
   download_url VARCHAR(500),
   platform VARCHAR(100),
   thumbnail_path VARCHAR(500),
+  readme_text TEXT,
+  visibility VARCHAR(20) NOT NULL DEFAULT 'public',
+  status VARCHAR(20) NOT NULL DEFAULT 'published',
+  uploaded_by BIGINT,
+  review_reason TEXT NOT NULL DEFAULT '',
+  reviewed_by BIGINT,
+  reviewed_at TIMESTAMP WITH TIME ZONE,
+  deleted_at TIMESTAMP WITH TIME ZONE,
+  deleted_by BIGINT,
+  search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('spanish', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('spanish', coalesce(description, '')), 'B') ||
+    setweight(to_tsvector('spanish', coalesce(course_name, '')), 'C') ||
+    setweight(to_tsvector('spanish', coalesce(readme_text, '')), 'D')
+  ) STORED,
   created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
   updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE INDEX IF NOT EXISTS idx_packages_category ON packages(category);
+CREATE INDEX IF NOT EXISTS idx_packages_search ON packages USING GIN(search_vector);
 CREATE INDEX IF NOT EXISTS idx_packages_platform ON packages(platform);
 CREATE INDEX IF NOT EXISTS idx_packages_content_type ON packages(content_type);
 CREATE INDEX IF NOT EXISTS idx_packages_course_name ON packages(course_name);
+CREATE INDEX IF NOT EXISTS idx_packages_visibility ON packages(visibility);
+CREATE INDEX IF NOT EXISTS idx_packages_status ON packages(status);
+CREATE INDEX IF NOT EXISTS idx_packages_deleted_at ON packages(deleted_at);
 CREATE INDEX IF NOT EXISTS idx_packages_blake3 ON packages(blake3_hash);
 CREATE INDEX IF NOT EXISTS idx_packages_sha256 ON packages(sha256_hash);
+CREATE INDEX IF NOT EXISTS idx_packages_file_path ON packages(file_path);
 
 -- Downloads table
 CREATE TABLE IF NOT EXISTS downloads (
@@ -56,8 +77,12 @@ CREATE TABLE IF NOT EXISTS users (
   is_admin BOOLEAN DEFAULT FALSE,
   email_verified BOOLEAN DEFAULT FALSE,
   verification_token VARCHAR(255),
+  verification_token_expiry TIMESTAMP WITH TIME ZONE,
   reset_token VARCHAR(255),
   reset_token_expiry TIMESTAMP WITH TIME ZONE,
+  mfa_secret VARCHAR(64),
+  mfa_enabled BOOLEAN DEFAULT FALSE,
+  mfa_last_step BIGINT DEFAULT 0,
   last_login TIMESTAMP WITH TIME ZONE,
   created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
   updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
@@ -66,16 +91,20 @@ CREATE TABLE IF NOT EXISTS users (
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
 CREATE INDEX IF NOT EXISTS idx_users_reset_token ON users(reset_token);
+CREATE INDEX IF NOT EXISTS idx_users_verification_token ON users(verification_token);
 
 -- Sessions table
 CREATE TABLE IF NOT EXISTS sessions (
   id BIGSERIAL PRIMARY KEY,
   user_id BIGINT NOT NULL,
+  jti VARCHAR(64),
+  family_id VARCHAR(64),
   token VARCHAR(500) NOT NULL UNIQUE,
   refresh_token VARCHAR(500) NOT NULL UNIQUE,
   ip_address VARCHAR(45),
   user_agent TEXT,
   expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  refresh_expires_at TIMESTAMP WITH TIME ZONE,
   created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
   FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
@@ -84,6 +113,222 @@ CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
 CREATE INDEX IF NOT EXISTS idx_sessions_refresh_token ON sessions(refresh_token);
 CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
 CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_jti ON sessions(jti);
+CREATE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions(family_id);
+
+-- Package metadata edit history
+CREATE TABLE IF NOT EXISTS package_history (
+  id BIGSERIAL PRIMARY KEY,
+  package_id BIGINT NOT NULL,
+  user_id BIGINT,
+  field VARCHAR(50) NOT NULL,
+  old_value TEXT,
+  new_value TEXT,
+  changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (package_id) REFERENCES packages(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_history_package ON package_history(package_id);
+
+-- Previous files of replaced packages
+CREATE TABLE IF NOT EXISTS package_revisions (
+  id BIGSERIAL PRIMARY KEY,
+  package_id BIGINT NOT NULL,
+  file_path VARCHAR(500) NOT NULL,
+  file_name VARCHAR(255) NOT NULL DEFAULT '',
+  file_size BIGINT NOT NULL,
+  blake3_hash VARCHAR(64) NOT NULL,
+  sha256_hash VARCHAR(64) NOT NULL,
+  replaced_by BIGINT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (package_id) REFERENCES packages(id) ON DELETE CASCADE,
+  FOREIGN KEY (replaced_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_revisions_package ON package_revisions(package_id);
+CREATE INDEX IF NOT EXISTS idx_package_revisions_file_path ON package_revisions(file_path);
+
+CREATE TABLE IF NOT EXISTS tags (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(50) NOT NULL UNIQUE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS package_tags (
+  package_id BIGINT NOT NULL,
+  tag_id BIGINT NOT NULL,
+  PRIMARY KEY (package_id, tag_id),
+  FOREIGN KEY (package_id) REFERENCES packages(id) ON DELETE CASCADE,
+  FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_tags_tag ON package_tags(tag_id);
+
+CREATE TABLE IF NOT EXISTS categories (
+  id BIGSERIAL PRIMARY KEY,
+  slug VARCHAR(100) NOT NULL UNIQUE,
+  name VARCHAR(100) NOT NULL,
+  color VARCHAR(7) NOT NULL DEFAULT '#6b7280',
+  icon VARCHAR(20) NOT NULL DEFAULT '',
+  moderated BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO categories (slug, name, color, icon) VALUES
+  ('os', 'Sistema Operativo', '#2563eb', 'OS'),
+  ('compiler', 'Compilador', '#10b981', '⚙️'),
+  ('ide', 'IDE', '#f59e0b', 'IDE'),
+  ('tool', 'Herramienta', '#6b7280', '🛠️'),
+  ('library', 'Biblioteca', '#8b5cf6', '📚')
+ON CONFLICT (slug) DO NOTHING;
+
+INSERT INTO categories (slug, name)
+  SELECT DISTINCT category, category FROM packages WHERE category IS NOT NULL AND category <> ''
+ON CONFLICT (slug) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS courses (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL UNIQUE,
+  code VARCHAR(50) NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS course_professors (
+  course_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (course_id, user_id),
+  FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_professors_user ON course_professors(user_id);
+
+CREATE TABLE IF NOT EXISTS course_enrollments (
+  course_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (course_id, user_id),
+  FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_enrollments_user ON course_enrollments(user_id);
+
+CREATE TABLE IF NOT EXISTS submission_boxes (
+  id BIGSERIAL PRIMARY KEY,
+  course_id BIGINT NOT NULL,
+  title VARCHAR(255) NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  deadline TIMESTAMP WITH TIME ZONE NOT NULL,
+  allowed_extensions VARCHAR(500) NOT NULL DEFAULT '',
+  max_size BIGINT NOT NULL DEFAULT 0,
+  accept_late BOOLEAN NOT NULL DEFAULT TRUE,
+  created_by BIGINT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (course_id) REFERENCES courses(id),
+  FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_submission_boxes_course ON submission_boxes(course_id);
+
+CREATE TABLE IF NOT EXISTS submissions (
+  id BIGSERIAL PRIMARY KEY,
+  box_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  file_path VARCHAR(500) NOT NULL,
+  file_name VARCHAR(255) NOT NULL,
+  file_size BIGINT NOT NULL,
+  blake3_hash VARCHAR(64) NOT NULL,
+  sha256_hash VARCHAR(64) NOT NULL,
+  late BOOLEAN NOT NULL DEFAULT FALSE,
+  submitted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  UNIQUE (box_id, user_id),
+  FOREIGN KEY (box_id) REFERENCES submission_boxes(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_submissions_user ON submissions(user_id);
+CREATE INDEX IF NOT EXISTS idx_submissions_file_path ON submissions(file_path);
+
+CREATE TABLE IF NOT EXISTS notifications (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  kind VARCHAR(50) NOT NULL,
+  message TEXT NOT NULL,
+  package_id BIGINT,
+  read_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (package_id) REFERENCES packages(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+  id BIGSERIAL PRIMARY KEY,
+  actor_id BIGINT,
+  actor_email VARCHAR(255) NOT NULL DEFAULT '',
+  action VARCHAR(50) NOT NULL,
+  target_type VARCHAR(50) NOT NULL DEFAULT '',
+  target_id VARCHAR(255) NOT NULL DEFAULT '',
+  ip_address VARCHAR(45) NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  diff JSONB,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash VARCHAR(64) NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);
+
+CREATE TABLE IF NOT EXISTS access_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  token_prefix VARCHAR(20) NOT NULL,
+  scope VARCHAR(20) NOT NULL,
+  courses TEXT NOT NULL DEFAULT '',
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  last_used_at TIMESTAMP WITH TIME ZONE,
+  last_used_ip VARCHAR(45),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_tokens_user ON access_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS rotated_refresh_tokens (
+  token_hash VARCHAR(64) PRIMARY KEY,
+  family_id VARCHAR(64) NOT NULL,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  rotated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rotated_refresh_tokens_expires_at ON rotated_refresh_tokens(expires_at);
+
+INSERT INTO courses (name) VALUES ('General') ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO courses (name)
+  SELECT DISTINCT course_name FROM packages WHERE course_name IS NOT NULL AND course_name <> ''
+ON CONFLICT (name) DO NOTHING;
 
 -- Trigger for updated_at
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -99,4 +344,13 @@ CREATE TRIGGER update_packages_updated_at BEFORE UPDATE ON packages
 
 CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users
   FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_categories_updated_at BEFORE UPDATE ON categories
+  FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_courses_updated_at BEFORE UPDATE ON courses
+  FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_submission_boxes_updated_at BEFORE UPDATE ON submission_boxes
+  FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 `
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/search"
+)
+
+// SearchPackages returns packages matching query and the listing filters,
+// best match first. Every word must match; the last one also matches as a
+// prefix. Stemming uses the built-in 'spanish' text search configuration.
+func (p *PostgresDB) SearchPackages(query string, filters *PackageQuery, limit, offset int) ([]*models.SearchResult, error) {
+	words := search.Words(query)
+	if len(words) == 0 {
+		return []*models.SearchResult{}, nil
+	}
+	// Words are letters and digits only, so they are valid tsquery lexemes
+	words[len(words)-1] += ":*"
+
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	args := &queryArgs{placeholder: postgresPlaceholder}
+	tsquery := args.bind(strings.Join(words, " & "))
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+packageColumns+`, ts_rank_cd(search_vector, q)::float8 AS score
+		FROM packages, to_tsquery('spanish', `+tsquery+`) q
+		WHERE search_vector @@ q AND `+packageFilters(searchFilters(filters), args)+`
+		ORDER BY score DESC, created_at DESC
+		LIMIT `+args.bind(limit)+` OFFSET `+args.bind(offset),
+		args.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := scanSearchResults(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, p.attachTags(searchResultPackages(results))
+}
+
+// SetPackageReadme stores the README text extracted from a package archive;
+// search_vector is regenerated by PostgreSQL. An empty readme marks the
+// package as processed.
+func (p *PostgresDB) SetPackageReadme(packageID int64, readme string) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `UPDATE packages SET readme_text = $1 WHERE id = $2`, readme, packageID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPackageNotFound
+	}
+
+	return nil
+}
+
+// GetPackagesWithoutReadme returns packages after afterID whose README has
+// not been extracted yet, in ID order
+func (p *PostgresDB) GetPackagesWithoutReadme(afterID int64, limit int) ([]*models.Package, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+packageColumns+` FROM packages
+		WHERE readme_text IS NULL AND id > $1
+		ORDER BY id
+		LIMIT $2
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	packages := []*models.Package{}
+	for rows.Next() {
+		pkg := &models.Package{}
+		if err := scanPackage(rows, pkg); err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+
+	return packages, rows.Err()
+}
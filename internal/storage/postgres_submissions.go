@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// ListSubmissionBoxes returns the submission boxes of a course, or of every
+// course when courseID is 0, soonest deadline first
+func (p *PostgresDB) ListSubmissionBoxes(courseID int64) ([]*models.SubmissionBox, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	query := submissionBoxSelect
+	var args []interface{}
+	if courseID != 0 {
+		query += ` WHERE b.course_id = $1`
+		args = append(args, courseID)
+	}
+
+	rows, err := p.pool.Query(ctx, query+` ORDER BY b.deadline, b.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSubmissionBoxes(rows)
+}
+
+// GetSubmissionBox retrieves a submission box by ID
+func (p *PostgresDB) GetSubmissionBox(id int64) (*models.SubmissionBox, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	b := &models.SubmissionBox{}
+	err := scanSubmissionBox(p.pool.QueryRow(ctx, submissionBoxSelect+` WHERE b.id = $1`, id), b)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSubmissionBoxNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// CreateSubmissionBox opens a submission box on a course
+func (p *PostgresDB) CreateSubmissionBox(b *models.SubmissionBox) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	return p.pool.QueryRow(ctx, `
+		INSERT INTO submission_boxes
+			(course_id, title, description, deadline, allowed_extensions, max_size, accept_late, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, b.CourseID, b.Title, b.Description, b.Deadline, formatExtensions(b.AllowedExtensions),
+		b.MaxSize, b.AcceptLate, nullableID(b.CreatedBy)).Scan(&b.ID)
+}
+
+// UpdateSubmissionBox changes the settings of a submission box. Submissions
+// keep the late flag they were given when handed in.
+func (p *PostgresDB) UpdateSubmissionBox(b *models.SubmissionBox) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE submission_boxes
+		SET title = $1, description = $2, deadline = $3, allowed_extensions = $4, max_size = $5,
+			accept_late = $6
+		WHERE id = $7
+	`, b.Title, b.Description, b.Deadline, formatExtensions(b.AllowedExtensions), b.MaxSize,
+		b.AcceptLate, b.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSubmissionBoxNotFound
+	}
+	return nil
+}
+
+// DeleteSubmissionBox removes a submission box and, by cascade, its
+// submissions. The caller releases the submitted files.
+func (p *PostgresDB) DeleteSubmissionBox(id int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `DELETE FROM submission_boxes WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSubmissionBoxNotFound
+	}
+	return nil
+}
+
+// SaveSubmission records a student's file in a box, replacing any earlier
+// submission by the same student
+func (p *PostgresDB) SaveSubmission(sub *models.Submission) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	return p.pool.QueryRow(ctx, `
+		INSERT INTO submissions
+			(box_id, user_id, file_path, file_name, file_size, blake3_hash, sha256_hash, late, submitted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (box_id, user_id) DO UPDATE SET
+			file_path = EXCLUDED.file_path, file_name = EXCLUDED.file_name,
+			file_size = EXCLUDED.file_size, blake3_hash = EXCLUDED.blake3_hash,
+			sha256_hash = EXCLUDED.sha256_hash, late = EXCLUDED.late,
+			submitted_at = EXCLUDED.submitted_at
+		RETURNING id
+	`, sub.BoxID, sub.UserID, sub.FilePath, sub.FileName, sub.FileSize, sub.BLAKE3Hash,
+		sub.SHA256Hash, sub.Late, sub.SubmittedAt).Scan(&sub.ID)
+}
+
+// GetSubmission retrieves a submission by ID
+func (p *PostgresDB) GetSubmission(id int64) (*models.Submission, error) {
+	return p.getSubmission(`s.id = $1`, id)
+}
+
+// GetUserSubmission retrieves a student's submission to a box
+func (p *PostgresDB) GetUserSubmission(boxID, userID int64) (*models.Submission, error) {
+	return p.getSubmission(`s.box_id = $1 AND s.user_id = $2`, boxID, userID)
+}
+
+func (p *PostgresDB) getSubmission(where string, args ...interface{}) (*models.Submission, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	sub := &models.Submission{}
+	err := scanSubmission(p.pool.QueryRow(ctx, submissionSelect+` WHERE `+where, args...), sub)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSubmissionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListSubmissions returns the submissions to a box ordered by student email
+func (p *PostgresDB) ListSubmissions(boxID int64) ([]*models.Submission, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	rows, err := p.pool.Query(ctx, submissionSelect+` WHERE s.box_id = $1 ORDER BY u.email`, boxID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSubmissions(rows)
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// attachTags loads the tags of each package
+func (p *PostgresDB) attachTags(packages []*models.Package) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	for _, batch := range tagBatches(packages) {
+		args := &queryArgs{placeholder: postgresPlaceholder}
+		rows, err := p.pool.Query(ctx, packageTagsSQL(batch, args), args.args...)
+		if err != nil {
+			return err
+		}
+		err = scanPackageTags(rows, batch)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddPackageTags attaches tags to a package, creating tags that do not
+// exist yet. Tags the package already carries are ignored.
+func (p *PostgresDB) AddPackageTags(packageID int64, tags []string) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists int
+	if err := tx.QueryRow(ctx, `SELECT 1 FROM packages WHERE id = $1`, packageID).Scan(&exists); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPackageNotFound
+		}
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err := tx.Exec(ctx, `INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, tag)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO package_tags (package_id, tag_id)
+			SELECT $1, id FROM tags WHERE name = $2
+			ON CONFLICT DO NOTHING
+		`, packageID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RemovePackageTags detaches tags from a package and drops tags no longer
+// used by any package
+func (p *PostgresDB) RemovePackageTags(packageID int64, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM package_tags
+		WHERE package_id = $1 AND tag_id IN (SELECT id FROM tags WHERE name = ANY($2))
+	`, packageID, tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM package_tags)`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetTagCounts returns every tag used by packages matching the filters in
+// q, with the number of such packages, most used first
+func (p *PostgresDB) GetTagCounts(q *PackageQuery) ([]*models.Tag, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	args := &queryArgs{placeholder: postgresPlaceholder}
+	rows, err := p.pool.Query(ctx, tagCountsSQL(q, args), args.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTagCounts(rows)
+}
+
+// ListCategories returns the category taxonomy ordered by name
+func (p *PostgresDB) ListCategories() ([]*models.Category, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	rows, err := p.pool.Query(ctx, `SELECT `+categoryColumns+` FROM categories ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*models.Category{}
+	for rows.Next() {
+		c := &models.Category{}
+		if err := scanCategory(rows, c); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+
+	return categories, rows.Err()
+}
+
+// GetCategory retrieves a category by slug
+func (p *PostgresDB) GetCategory(slug string) (*models.Category, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	c := &models.Category{}
+	err := scanCategory(p.pool.QueryRow(ctx, `SELECT `+categoryColumns+` FROM categories WHERE slug = $1`, slug), c)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCategoryNotFound
+	}
+	return c, err
+}
+
+// CreateCategory adds a category to the taxonomy
+func (p *PostgresDB) CreateCategory(c *models.Category) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	err := p.pool.QueryRow(ctx, `
+		INSERT INTO categories (slug, name, color, icon, moderated)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, c.Slug, c.Name, c.Color, c.Icon, c.Moderated).Scan(&c.ID)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+		return ErrCategoryExists
+	}
+	return err
+}
+
+// UpdateCategory changes the name, color, icon and moderation flag of a
+// category; the slug is fixed because packages refer to it
+func (p *PostgresDB) UpdateCategory(c *models.Category) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE categories SET name = $1, color = $2, icon = $3, moderated = $4 WHERE slug = $5
+	`, c.Name, c.Color, c.Icon, c.Moderated, c.Slug)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
+
+// DeleteCategory removes a category that no package uses
+func (p *PostgresDB) DeleteCategory(slug string) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		DELETE FROM categories
+		WHERE slug = $1 AND NOT EXISTS (SELECT 1 FROM packages WHERE category = $1)
+	`, slug)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	if _, err := p.GetCategory(slug); err != nil {
+		return err
+	}
+	return ErrCategoryInUse
+}
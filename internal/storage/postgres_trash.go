@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// TrashPackage moves a package to the trash. Its file, revisions and
+// download history are kept until it is purged.
+func (p *PostgresDB) TrashPackage(id, userID int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE packages SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $1
+		WHERE id = $2 AND deleted_at IS NULL
+	`, nullableID(userID), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPackageNotFound
+	}
+
+	return nil
+}
+
+// RestorePackage takes a package out of the trash
+func (p *PostgresDB) RestorePackage(id int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE packages SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPackageNotFound
+	}
+
+	return nil
+}
+
+// PurgePackage removes a package in the trash for good; its download
+// records, history and revisions go with it. It returns
+// ErrPackageNotInTrash when the package is not in the trash, e.g. because
+// it was just restored.
+func (p *PostgresDB) PurgePackage(id int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `DELETE FROM packages WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPackageNotInTrash
+	}
+
+	return nil
+}
+
+// GetTrashedPackage retrieves a package in the trash by ID
+func (p *PostgresDB) GetTrashedPackage(id int64) (*models.Package, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	pkg := &models.Package{}
+	err := scanPackage(p.pool.QueryRow(ctx, `
+		SELECT `+packageColumns+`
+		FROM packages WHERE id = $1 AND deleted_at IS NOT NULL
+	`, id), pkg)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPackageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pkg, p.attachTags([]*models.Package{pkg})
+}
+
+// ListTrash returns the packages in the trash, most recently deleted first.
+// When deletedBefore is set, only packages deleted before then are listed.
+func (p *PostgresDB) ListTrash(deletedBefore *time.Time) ([]*models.Package, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	query := `SELECT ` + packageColumns + ` FROM packages WHERE deleted_at IS NOT NULL`
+	var args []interface{}
+	if deletedBefore != nil {
+		query += ` AND deleted_at < $1`
+		args = append(args, *deletedBefore)
+	}
+
+	rows, err := p.pool.Query(ctx, query+` ORDER BY deleted_at DESC, id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	packages := []*models.Package{}
+	for rows.Next() {
+		pkg := &models.Package{}
+		if err := scanPackage(rows, pkg); err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return packages, p.attachTags(packages)
+}
@@ -1,9 +1,12 @@
 package storage
 
 import (
-	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+
 	"github.com/jesus/FCCUR/internal/models"
 )
 
@@ -28,52 +31,29 @@ func (p *PostgresDB) CreateUser(email, passwordHash, fullName string, role model
 
 // GetUserByID retrieves a user by ID
 func (p *PostgresDB) GetUserByID(id int64) (*models.User, error) {
-	ctx, cancel := p.getContext()
-	defer cancel()
-
-	user := &models.User{}
-	err := p.pool.QueryRow(ctx, `
-		SELECT id, email, password_hash, full_name, role, assigned_courses,
-		       is_active, is_admin, email_verified, verification_token,
-		       reset_token, reset_token_expiry, last_login, created_at, updated_at
-		FROM users WHERE id = $1
-	`, id).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.FullName,
-		&user.Role, &user.AssignedCourses,
-		&user.IsActive, &user.IsAdmin, &user.EmailVerified, &user.VerificationToken,
-		&user.ResetToken, &user.ResetTokenExpiry, &user.LastLogin,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	}
-	return user, err
+	return p.getUser(`id = $1`, ErrUserNotFound, id)
 }
 
 // GetUserByEmail retrieves a user by email
 func (p *PostgresDB) GetUserByEmail(email string) (*models.User, error) {
+	return p.getUser(`email = $1`, ErrUserNotFound, email)
+}
+
+// getUser retrieves the user matching where, with their courses; notFound
+// is returned when there is none
+func (p *PostgresDB) getUser(where string, notFound error, args ...interface{}) (*models.User, error) {
 	ctx, cancel := p.getContext()
 	defer cancel()
 
 	user := &models.User{}
-	err := p.pool.QueryRow(ctx, `
-		SELECT id, email, password_hash, full_name, role, assigned_courses,
-		       is_active, is_admin, email_verified, verification_token,
-		       reset_token, reset_token_expiry, last_login, created_at, updated_at
-		FROM users WHERE email = $1
-	`, email).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.FullName,
-		&user.Role, &user.AssignedCourses,
-		&user.IsActive, &user.IsAdmin, &user.EmailVerified, &user.VerificationToken,
-		&user.ResetToken, &user.ResetTokenExpiry, &user.LastLogin,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	}
-	return user, err
+	err := scanUser(p.pool.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE `+where, args...), user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, notFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, p.attachCourses(user)
 }
 
 // UpdateUserLastLogin updates the last login timestamp
@@ -103,28 +83,7 @@ func (p *PostgresDB) SetUserResetToken(userID int64, token string, expiry time.T
 
 // GetUserByResetToken retrieves a user by reset token
 func (p *PostgresDB) GetUserByResetToken(token string) (*models.User, error) {
-	ctx, cancel := p.getContext()
-	defer cancel()
-
-	user := &models.User{}
-	err := p.pool.QueryRow(ctx, `
-		SELECT id, email, password_hash, full_name, role, assigned_courses,
-		       is_active, is_admin, email_verified, verification_token,
-		       reset_token, reset_token_expiry, last_login, created_at, updated_at
-		FROM users
-		WHERE reset_token = $1 AND reset_token_expiry > CURRENT_TIMESTAMP
-	`, token).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.FullName,
-		&user.Role, &user.AssignedCourses,
-		&user.IsActive, &user.IsAdmin, &user.EmailVerified, &user.VerificationToken,
-		&user.ResetToken, &user.ResetTokenExpiry, &user.LastLogin,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, ErrInvalidToken
-	}
-	return user, err
+	return p.getUser(`reset_token = $1 AND reset_token_expiry > CURRENT_TIMESTAMP`, ErrInvalidToken, token)
 }
 
 // UpdateUserPassword updates a user's password and clears reset token
@@ -140,6 +99,24 @@ func (p *PostgresDB) UpdateUserPassword(userID int64, passwordHash string) error
 	return err
 }
 
+// SetUserVerificationToken sets the token that confirms a user's email
+func (p *PostgresDB) SetUserVerificationToken(userID int64, token string, expiry time.Time) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	_, err := p.pool.Exec(ctx, `
+		UPDATE users
+		SET verification_token = $1, verification_token_expiry = $2
+		WHERE id = $3
+	`, token, expiry, userID)
+	return err
+}
+
+// GetUserByVerificationToken retrieves a user by an unexpired verification token
+func (p *PostgresDB) GetUserByVerificationToken(token string) (*models.User, error) {
+	return p.getUser(`verification_token = $1 AND verification_token_expiry > CURRENT_TIMESTAMP`, ErrInvalidToken, token)
+}
+
 // SetUserEmailVerified marks user's email as verified
 func (p *PostgresDB) SetUserEmailVerified(userID int64) error {
 	ctx, cancel := p.getContext()
@@ -147,23 +124,130 @@ func (p *PostgresDB) SetUserEmailVerified(userID int64) error {
 
 	_, err := p.pool.Exec(ctx, `
 		UPDATE users
-		SET email_verified = true, verification_token = NULL
+		SET email_verified = true, verification_token = NULL, verification_token_expiry = NULL
 		WHERE id = $1
 	`, userID)
 	return err
 }
 
-// CreateSession creates a new session
-func (p *PostgresDB) CreateSession(userID int64, token, refreshToken, ipAddress, userAgent string, expiresAt time.Time) (*models.Session, error) {
+// ListUsers returns a page of users matching q, ordered by email
+func (p *PostgresDB) ListUsers(q *UserQuery) (*UserPage, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	args := &queryArgs{placeholder: postgresPlaceholder}
+	rows, err := p.pool.Query(ctx, userListSQL(q, args), args.args...)
+	if err != nil {
+		return nil, err
+	}
+	users, err := scanUsers(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		if err := p.attachCourses(user); err != nil {
+			return nil, err
+		}
+	}
+
+	page := &UserPage{Users: users}
+	countArgs := &queryArgs{placeholder: postgresPlaceholder}
+	err = p.pool.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE `+userFilters(q, countArgs),
+		countArgs.args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// UpdateUserRole changes a user's role, keeping the deprecated is_admin
+// flag in step
+func (p *PostgresDB) UpdateUserRole(userID int64, role models.UserRole) error {
+	return p.updateUser(userID, `role = $1, is_admin = $2`, role, role == models.RoleAdmin)
+}
+
+// SetUserActive activates or deactivates a user
+func (p *PostgresDB) SetUserActive(userID int64, active bool) error {
+	return p.updateUser(userID, `is_active = $1`, active)
+}
+
+// ForcePasswordReset disables a user's password and sets a reset token, so
+// the user can only log in again after choosing a new password
+func (p *PostgresDB) ForcePasswordReset(userID int64, token string, expiry time.Time) error {
+	return p.updateUser(userID, `password_hash = '', reset_token = $1, reset_token_expiry = $2`, token, expiry)
+}
+
+// updateUser sets columns of a user, returning ErrUserNotFound when there
+// is no such user. The user ID is bound after args.
+func (p *PostgresDB) updateUser(userID int64, set string, args ...interface{}) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tag, err := p.pool.Exec(ctx, `UPDATE users SET `+set+` WHERE id = $`+fmt.Sprint(len(args)+1),
+		append(args, userID)...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetUserCourses replaces the courses a professor is assigned to
+func (p *PostgresDB) SetUserCourses(userID int64, courseIDs []int64) error {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists int
+	if err := tx.QueryRow(ctx, `SELECT 1 FROM users WHERE id = $1`, userID).Scan(&exists); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	// Keep the rows of courses still assigned, with their created_at
+	args := &queryArgs{placeholder: postgresPlaceholder}
+	if _, err := tx.Exec(ctx, unassignedCoursesSQL(userID, courseIDs, args), args.args...); err != nil {
+		return err
+	}
+	for _, courseID := range courseIDs {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO course_professors (course_id, user_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, courseID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CreateSession stores a new session
+func (p *PostgresDB) CreateSession(session *models.Session) (*models.Session, error) {
 	ctx, cancel := p.getContext()
 	defer cancel()
 
 	var id int64
 	err := p.pool.QueryRow(ctx, `
-		INSERT INTO sessions (user_id, token, refresh_token, ip_address, user_agent, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO sessions (user_id, jti, family_id, token, refresh_token, ip_address, user_agent,
+			expires_at, refresh_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id
-	`, userID, token, refreshToken, ipAddress, userAgent, expiresAt).Scan(&id)
+	`, session.UserID, session.JTI, session.FamilyID, session.Token, session.RefreshToken, session.IPAddress,
+		session.UserAgent, session.ExpiresAt, session.RefreshExpiresAt).Scan(&id)
 
 	if err != nil {
 		return nil, err
@@ -172,46 +256,94 @@ func (p *PostgresDB) CreateSession(userID int64, token, refreshToken, ipAddress,
 	return p.GetSessionByID(id)
 }
 
-// GetSessionByID retrieves a session by ID
-func (p *PostgresDB) GetSessionByID(id int64) (*models.Session, error) {
+// RotateSession replaces the session oldID with next, keeping rotatedHash,
+// the hash of the old refresh token, until next.RefreshExpiresAt. It
+// returns ErrSessionNotFound when oldID is gone, e.g. rotated by a
+// concurrent request.
+func (p *PostgresDB) RotateSession(oldID int64, rotatedHash string, next *models.Session) (*models.Session, error) {
 	ctx, cancel := p.getContext()
 	defer cancel()
 
-	session := &models.Session{}
-	err := p.pool.QueryRow(ctx, `
-		SELECT id, user_id, token, refresh_token, ip_address, user_agent, expires_at, created_at
-		FROM sessions WHERE id = $1
-	`, id).Scan(
-		&session.ID, &session.UserID, &session.Token, &session.RefreshToken,
-		&session.IPAddress, &session.UserAgent, &session.ExpiresAt, &session.CreatedAt,
-	)
-
-	if err == sql.ErrNoRows {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM sessions WHERE id = $1`, oldID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
 		return nil, ErrSessionNotFound
 	}
-	return session, err
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO rotated_refresh_tokens (token_hash, family_id, user_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, rotatedHash, next.FamilyID, next.UserID, next.RefreshExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, jti, family_id, token, refresh_token, ip_address, user_agent,
+			expires_at, refresh_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, next.UserID, next.JTI, next.FamilyID, next.Token, next.RefreshToken, next.IPAddress,
+		next.UserAgent, next.ExpiresAt, next.RefreshExpiresAt).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return p.GetSessionByID(id)
 }
 
-// GetSessionByToken retrieves a session by token
-func (p *PostgresDB) GetSessionByToken(token string) (*models.Session, error) {
+// getSession retrieves the session where column equals value
+func (p *PostgresDB) getSession(column string, value interface{}) (*models.Session, error) {
 	ctx, cancel := p.getContext()
 	defer cancel()
 
 	session := &models.Session{}
-	err := p.pool.QueryRow(ctx, `
-		SELECT id, user_id, token, refresh_token, ip_address, user_agent, expires_at, created_at
-		FROM sessions WHERE token = $1
-	`, token).Scan(
-		&session.ID, &session.UserID, &session.Token, &session.RefreshToken,
-		&session.IPAddress, &session.UserAgent, &session.ExpiresAt, &session.CreatedAt,
-	)
-
-	if err == sql.ErrNoRows {
+	err := scanSession(p.pool.QueryRow(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE `+column+` = $1`, value), session)
+	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrSessionNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
+	return session, nil
+}
+
+// GetSessionByID retrieves a session by ID
+func (p *PostgresDB) GetSessionByID(id int64) (*models.Session, error) {
+	return p.getSession("id", id)
+}
+
+// GetSessionByJTI retrieves the unexpired session of an access token by
+// its jti claim
+func (p *PostgresDB) GetSessionByJTI(jti string) (*models.Session, error) {
+	session, err := p.getSession("jti", jti)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+	return session, nil
+}
+
+// GetSessionByToken retrieves a session by token
+func (p *PostgresDB) GetSessionByToken(token string) (*models.Session, error) {
+	session, err := p.getSession("token", token)
+	if err != nil {
+		return nil, err
+	}
 
 	// Check if session is expired
 	if time.Now().After(session.ExpiresAt) {
@@ -221,24 +353,17 @@ func (p *PostgresDB) GetSessionByToken(token string) (*models.Session, error) {
 	return session, nil
 }
 
-// GetSessionByRefreshToken retrieves a session by refresh token
+// GetSessionByRefreshToken retrieves a session by refresh token, which
+// must not have expired
 func (p *PostgresDB) GetSessionByRefreshToken(refreshToken string) (*models.Session, error) {
-	ctx, cancel := p.getContext()
-	defer cancel()
-
-	session := &models.Session{}
-	err := p.pool.QueryRow(ctx, `
-		SELECT id, user_id, token, refresh_token, ip_address, user_agent, expires_at, created_at
-		FROM sessions WHERE refresh_token = $1
-	`, refreshToken).Scan(
-		&session.ID, &session.UserID, &session.Token, &session.RefreshToken,
-		&session.IPAddress, &session.UserAgent, &session.ExpiresAt, &session.CreatedAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, ErrSessionNotFound
+	session, err := p.getSession("refresh_token", refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.RefreshExpiresAt) {
+		return nil, ErrSessionExpired
 	}
-	return session, err
+	return session, nil
 }
 
 // DeleteSession deletes a session by token
@@ -259,12 +384,50 @@ func (p *PostgresDB) DeleteUserSessions(userID int64) error {
 	return err
 }
 
-// CleanExpiredSessions removes expired sessions
+// DeleteSessionFamily deletes the sessions refreshed from one login and
+// returns them
+func (p *PostgresDB) DeleteSessionFamily(familyID string) ([]*models.Session, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	rows, err := p.pool.Query(ctx, `DELETE FROM sessions WHERE family_id = $1 RETURNING `+sessionColumns, familyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSessions(rows)
+}
+
+// GetRotatedRefreshToken retrieves a refresh token that was exchanged for
+// a new session by its hash
+func (p *PostgresDB) GetRotatedRefreshToken(tokenHash string) (*models.RotatedRefreshToken, error) {
+	ctx, cancel := p.getContext()
+	defer cancel()
+
+	t := &models.RotatedRefreshToken{}
+	err := scanRotatedRefreshToken(p.pool.QueryRow(ctx, `
+		SELECT `+rotatedRefreshTokenColumns+` FROM rotated_refresh_tokens WHERE token_hash = $1
+	`, tokenHash), t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CleanExpiredSessions removes sessions and rotated refresh tokens that
+// can no longer be refreshed
 func (p *PostgresDB) CleanExpiredSessions() error {
 	ctx, cancel := p.getContext()
 	defer cancel()
 
-	_, err := p.pool.Exec(ctx, `DELETE FROM sessions WHERE expires_at < CURRENT_TIMESTAMP`)
+	if _, err := p.pool.Exec(ctx, `DELETE FROM sessions WHERE refresh_expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return err
+	}
+	_, err := p.pool.Exec(ctx, `DELETE FROM rotated_refresh_tokens WHERE expires_at < CURRENT_TIMESTAMP`)
 	return err
 }
 
@@ -274,7 +437,7 @@ func (p *PostgresDB) ListUserSessions(userID int64) ([]*models.Session, error) {
 	defer cancel()
 
 	rows, err := p.pool.Query(ctx, `
-		SELECT id, user_id, token, refresh_token, ip_address, user_agent, expires_at, created_at
+		SELECT `+sessionColumns+`
 		FROM sessions
 		WHERE user_id = $1 AND expires_at > CURRENT_TIMESTAMP
 		ORDER BY created_at DESC
@@ -284,18 +447,5 @@ func (p *PostgresDB) ListUserSessions(userID int64) ([]*models.Session, error) {
 	}
 	defer rows.Close()
 
-	var sessions []*models.Session
-	for rows.Next() {
-		session := &models.Session{}
-		err := rows.Scan(
-			&session.ID, &session.UserID, &session.Token, &session.RefreshToken,
-			&session.IPAddress, &session.UserAgent, &session.ExpiresAt, &session.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		sessions = append(sessions, session)
-	}
-
-	return sessions, rows.Err()
+	return scanSessions(rows)
 }
@@ -0,0 +1,107 @@
+package storage
+
+import "github.com/jesus/FCCUR/internal/models"
+
+// packageColumns is the column list read by scanPackage
+const packageColumns = `id, name, version, description, category, content_type, course_name,
+		file_path, file_name, file_size, blake3_hash, sha256_hash, download_url, platform,
+		thumbnail_path, visibility, status, uploaded_by, review_reason, reviewed_by, reviewed_at,
+		deleted_at, deleted_by, created_at, updated_at`
+
+// rowScanner is satisfied by *sql.Row, *sql.Rows, pgx.Row and pgx.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPackage scans a row selected with packageColumns into pkg
+func scanPackage(row rowScanner, pkg *models.Package) error {
+	var uploadedBy, reviewedBy, deletedBy *int64
+	err := row.Scan(
+		&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description,
+		&pkg.Category, &pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileName, &pkg.FileSize,
+		&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL,
+		&pkg.Platform, &pkg.ThumbnailPath, &pkg.Visibility,
+		&pkg.Status, &uploadedBy, &pkg.ReviewReason, &reviewedBy, &pkg.ReviewedAt,
+		&pkg.DeletedAt, &deletedBy, &pkg.CreatedAt, &pkg.UpdatedAt,
+	)
+	if uploadedBy != nil {
+		pkg.UploadedBy = *uploadedBy
+	}
+	if reviewedBy != nil {
+		pkg.ReviewedBy = *reviewedBy
+	}
+	if deletedBy != nil {
+		pkg.DeletedBy = *deletedBy
+	}
+	return err
+}
+
+// packageVisibility stores an unset visibility as public
+func packageVisibility(v models.Visibility) models.Visibility {
+	if v == "" {
+		return models.VisibilityPublic
+	}
+	return v
+}
+
+// packageStatus stores an unset status as published
+func packageStatus(s models.PackageStatus) models.PackageStatus {
+	if s == "" {
+		return models.StatusPublished
+	}
+	return s
+}
+
+// nullableID maps a zero ID to SQL NULL for optional foreign keys
+func nullableID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// revisionColumns lists package_revisions columns in the order scanRevision expects
+const revisionColumns = `id, package_id, file_path, file_name, file_size, blake3_hash,
+	sha256_hash, replaced_by, created_at`
+
+// scanRevision scans a row selected with revisionColumns into rev
+func scanRevision(row rowScanner, rev *models.PackageRevision) error {
+	var replacedBy *int64
+	err := row.Scan(&rev.ID, &rev.PackageID, &rev.FilePath, &rev.FileName, &rev.FileSize,
+		&rev.BLAKE3Hash, &rev.SHA256Hash, &replacedBy, &rev.CreatedAt)
+	if replacedBy != nil {
+		rev.ReplacedBy = *replacedBy
+	}
+	return err
+}
+
+// rowIterator is satisfied by *sql.Rows and pgx.Rows
+type rowIterator interface {
+	rowScanner
+	Next() bool
+	Err() error
+}
+
+// extraColumnRow scans one more column after packageColumns into extra
+type extraColumnRow struct {
+	rowScanner
+	extra interface{}
+}
+
+func (r extraColumnRow) Scan(dest ...interface{}) error {
+	return r.rowScanner.Scan(append(dest, r.extra)...)
+}
+
+// scanSearchResults reads rows selected with packageColumns followed by a
+// rank column
+func scanSearchResults(rows rowIterator) ([]*models.SearchResult, error) {
+	results := []*models.SearchResult{}
+	for rows.Next() {
+		result := &models.SearchResult{Package: &models.Package{}}
+		if err := scanPackage(extraColumnRow{rows, &result.Rank}, result.Package); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
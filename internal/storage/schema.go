@@ -9,13 +9,23 @@ CREATE TABLE IF NOT EXISTS packages (
   category TEXT NOT NULL,
   content_type TEXT NOT NULL DEFAULT 'tool',
   course_name TEXT,
-  file_path TEXT NOT NULL UNIQUE,
+  file_path TEXT NOT NULL,
+  file_name TEXT NOT NULL DEFAULT '',
   file_size INTEGER NOT NULL,
   blake3_hash TEXT NOT NULL,
   sha256_hash TEXT NOT NULL,
   download_url TEXT,
   platform TEXT,
   thumbnail_path TEXT,
+  readme_text TEXT,
+  visibility TEXT NOT NULL DEFAULT 'public',
+  status TEXT NOT NULL DEFAULT 'published',
+  uploaded_by INTEGER,
+  review_reason TEXT NOT NULL DEFAULT '',
+  reviewed_by INTEGER,
+  reviewed_at DATETIME,
+  deleted_at DATETIME,
+  deleted_by INTEGER,
   created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
   updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
@@ -33,6 +43,11 @@ CREATE INDEX IF NOT EXISTS idx_packages_category ON packages(category);
 CREATE INDEX IF NOT EXISTS idx_packages_platform ON packages(platform);
 CREATE INDEX IF NOT EXISTS idx_packages_content_type ON packages(content_type);
 CREATE INDEX IF NOT EXISTS idx_packages_course_name ON packages(course_name);
+CREATE INDEX IF NOT EXISTS idx_packages_visibility ON packages(visibility);
+CREATE INDEX IF NOT EXISTS idx_packages_status ON packages(status);
+CREATE INDEX IF NOT EXISTS idx_packages_deleted_at ON packages(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_packages_file_path ON packages(file_path);
+CREATE INDEX IF NOT EXISTS idx_packages_blake3 ON packages(blake3_hash);
 CREATE INDEX IF NOT EXISTS idx_downloads_package ON downloads(package_id);
 CREATE INDEX IF NOT EXISTS idx_downloads_date ON downloads(downloaded_at);
 
@@ -47,8 +62,12 @@ CREATE TABLE IF NOT EXISTS users (
   is_admin BOOLEAN DEFAULT 0,
   email_verified BOOLEAN DEFAULT 0,
   verification_token TEXT,
+  verification_token_expiry DATETIME,
   reset_token TEXT,
   reset_token_expiry DATETIME,
+  mfa_secret TEXT,
+  mfa_enabled BOOLEAN DEFAULT 0,
+  mfa_last_step INTEGER DEFAULT 0,
   last_login DATETIME,
   created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
   updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
@@ -57,18 +76,233 @@ CREATE TABLE IF NOT EXISTS users (
 CREATE TABLE IF NOT EXISTS sessions (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   user_id INTEGER NOT NULL,
+  jti TEXT,
+  family_id TEXT,
   token TEXT NOT NULL UNIQUE,
   refresh_token TEXT NOT NULL UNIQUE,
   ip_address TEXT,
   user_agent TEXT,
   expires_at DATETIME NOT NULL,
+  refresh_expires_at DATETIME,
   created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
   FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
+CREATE TABLE IF NOT EXISTS package_history (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  package_id INTEGER NOT NULL,
+  user_id INTEGER,
+  field TEXT NOT NULL,
+  old_value TEXT,
+  new_value TEXT,
+  changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (package_id) REFERENCES packages(id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_history_package ON package_history(package_id);
+
+CREATE TABLE IF NOT EXISTS package_revisions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  package_id INTEGER NOT NULL,
+  file_path TEXT NOT NULL,
+  file_name TEXT NOT NULL DEFAULT '',
+  file_size INTEGER NOT NULL,
+  blake3_hash TEXT NOT NULL,
+  sha256_hash TEXT NOT NULL,
+  replaced_by INTEGER,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (package_id) REFERENCES packages(id),
+  FOREIGN KEY (replaced_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_revisions_package ON package_revisions(package_id);
+CREATE INDEX IF NOT EXISTS idx_package_revisions_file_path ON package_revisions(file_path);
+
+CREATE TABLE IF NOT EXISTS tags (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL UNIQUE,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS package_tags (
+  package_id INTEGER NOT NULL,
+  tag_id INTEGER NOT NULL,
+  PRIMARY KEY (package_id, tag_id),
+  FOREIGN KEY (package_id) REFERENCES packages(id),
+  FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_tags_tag ON package_tags(tag_id);
+
+CREATE TABLE IF NOT EXISTS categories (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  color TEXT NOT NULL DEFAULT '#6b7280',
+  icon TEXT NOT NULL DEFAULT '',
+  moderated BOOLEAN NOT NULL DEFAULT 0,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO categories (slug, name, color, icon) VALUES
+  ('os', 'Sistema Operativo', '#2563eb', 'OS'),
+  ('compiler', 'Compilador', '#10b981', '⚙️'),
+  ('ide', 'IDE', '#f59e0b', 'IDE'),
+  ('tool', 'Herramienta', '#6b7280', '🛠️'),
+  ('library', 'Biblioteca', '#8b5cf6', '📚');
+
+INSERT OR IGNORE INTO categories (slug, name)
+  SELECT DISTINCT category, category FROM packages WHERE category IS NOT NULL AND category != '';
+
+CREATE TABLE IF NOT EXISTS courses (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL UNIQUE,
+  code TEXT NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT '',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS course_professors (
+  course_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (course_id, user_id),
+  FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_professors_user ON course_professors(user_id);
+
+CREATE TABLE IF NOT EXISTS course_enrollments (
+  course_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (course_id, user_id),
+  FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_enrollments_user ON course_enrollments(user_id);
+
+CREATE TABLE IF NOT EXISTS submission_boxes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  course_id INTEGER NOT NULL,
+  title TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  deadline DATETIME NOT NULL,
+  allowed_extensions TEXT NOT NULL DEFAULT '',
+  max_size INTEGER NOT NULL DEFAULT 0,
+  accept_late BOOLEAN NOT NULL DEFAULT 1,
+  created_by INTEGER,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (course_id) REFERENCES courses(id),
+  FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_submission_boxes_course ON submission_boxes(course_id);
+
+CREATE TABLE IF NOT EXISTS submissions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  box_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  file_path TEXT NOT NULL,
+  file_name TEXT NOT NULL,
+  file_size INTEGER NOT NULL,
+  blake3_hash TEXT NOT NULL,
+  sha256_hash TEXT NOT NULL,
+  late BOOLEAN NOT NULL DEFAULT 0,
+  submitted_at DATETIME NOT NULL,
+  UNIQUE (box_id, user_id),
+  FOREIGN KEY (box_id) REFERENCES submission_boxes(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_submissions_user ON submissions(user_id);
+CREATE INDEX IF NOT EXISTS idx_submissions_file_path ON submissions(file_path);
+
+CREATE TABLE IF NOT EXISTS notifications (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  kind TEXT NOT NULL,
+  message TEXT NOT NULL,
+  package_id INTEGER,
+  read_at DATETIME,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (package_id) REFERENCES packages(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  actor_id INTEGER,
+  actor_email TEXT NOT NULL DEFAULT '',
+  action TEXT NOT NULL,
+  target_type TEXT NOT NULL DEFAULT '',
+  target_id TEXT NOT NULL DEFAULT '',
+  ip_address TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  diff TEXT,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash TEXT NOT NULL,
+  used_at DATETIME,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);
+
+CREATE TABLE IF NOT EXISTS access_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  token_prefix TEXT NOT NULL,
+  scope TEXT NOT NULL,
+  courses TEXT NOT NULL DEFAULT '',
+  expires_at DATETIME NOT NULL,
+  last_used_at DATETIME,
+  last_used_ip TEXT,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_tokens_user ON access_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS rotated_refresh_tokens (
+  token_hash TEXT PRIMARY KEY,
+  family_id TEXT NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at DATETIME NOT NULL,
+  rotated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rotated_refresh_tokens_expires_at ON rotated_refresh_tokens(expires_at);
+
+INSERT OR IGNORE INTO courses (name) VALUES ('General');
+
+INSERT OR IGNORE INTO courses (name)
+  SELECT DISTINCT course_name FROM packages WHERE course_name IS NOT NULL AND course_name != '';
+
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_users_verification_token ON users(verification_token);
 CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
 CREATE INDEX IF NOT EXISTS idx_sessions_refresh_token ON sessions(refresh_token);
 CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
 CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_jti ON sessions(jti);
+CREATE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions(family_id);
 `
@@ -8,7 +8,8 @@ import (
 
 // SQLiteDB implements the Database interface for SQLite
 type SQLiteDB struct {
-	db *sql.DB
+	db  *sql.DB
+	fts bool // FTS5 compiled in; see ensureSearchIndex
 }
 
 // NewSQLiteDatabase creates a new SQLite database connection
@@ -25,7 +26,7 @@ func NewSQLiteDatabase(path string) (*SQLiteDB, error) {
 	db.Exec("PRAGMA synchronous=NORMAL")
 	db.Exec("PRAGMA cache_size=10000")
 
-	return &SQLiteDB{db: db}, nil
+	return &SQLiteDB{db: db, fts: hasFTS5(db)}, nil
 }
 
 // Close closes the database connection
@@ -44,10 +45,23 @@ func (s *SQLiteDB) Migrate() error {
 	migrator, err := NewMigrator(s, GetMigrationsPath())
 	if err != nil {
 		// Fallback to old schema if migrations not available
-		_, err := s.db.Exec(schema)
-		return err
+		if _, err := s.db.Exec(schema); err != nil {
+			return err
+		}
+		return s.afterMigrate()
 	}
 	defer migrator.Close()
 
-	return migrator.Up()
+	if err := migrator.Up(); err != nil {
+		return err
+	}
+	return s.afterMigrate()
+}
+
+// afterMigrate runs the data steps that need Go code rather than SQL
+func (s *SQLiteDB) afterMigrate() error {
+	if err := s.importAssignedCourses(); err != nil {
+		return err
+	}
+	return s.ensureSearchIndex()
 }
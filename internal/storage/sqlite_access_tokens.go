@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// CreateAccessToken stores a new personal access token and sets its ID
+func (s *SQLiteDB) CreateAccessToken(t *models.AccessToken) error {
+	result, err := s.db.Exec(`
+		INSERT INTO access_tokens (user_id, name, token_hash, token_prefix, scope, courses, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.UserID, t.Name, t.TokenHash, t.Prefix, t.Scope, formatTokenCourses(t.Courses),
+		sqliteTime(t.ExpiresAt), sqliteTime(t.CreatedAt))
+	if err != nil {
+		return err
+	}
+
+	t.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetAccessTokenByHash retrieves a personal access token by the hash of
+// the token, expired or not
+func (s *SQLiteDB) GetAccessTokenByHash(tokenHash string) (*models.AccessToken, error) {
+	t := &models.AccessToken{}
+	err := scanAccessToken(s.db.QueryRow(`SELECT `+accessTokenColumns+` FROM access_tokens WHERE token_hash = ?`,
+		tokenHash), t)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ListAccessTokens returns a user's personal access tokens, newest first
+func (s *SQLiteDB) ListAccessTokens(userID int64) ([]*models.AccessToken, error) {
+	rows, err := s.db.Query(`
+		SELECT `+accessTokenColumns+` FROM access_tokens WHERE user_id = ? ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAccessTokens(rows)
+}
+
+// DeleteAccessToken revokes one of a user's personal access tokens
+func (s *SQLiteDB) DeleteAccessToken(userID, id int64) error {
+	result, err := s.db.Exec(`DELETE FROM access_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+// DeleteUserAccessTokens revokes every personal access token of a user and
+// returns how many there were
+func (s *SQLiteDB) DeleteUserAccessTokens(userID int64) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM access_tokens WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// TouchAccessToken records that a personal access token was just used
+func (s *SQLiteDB) TouchAccessToken(id int64, ipAddress string) error {
+	_, err := s.db.Exec(`UPDATE access_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?`,
+		sqliteTime(time.Now()), ipAddress, id)
+	return err
+}
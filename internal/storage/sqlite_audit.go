@@ -0,0 +1,43 @@
+package storage
+
+import "github.com/jesus/FCCUR/internal/models"
+
+// CreateAuditEvent appends an event to the audit log
+func (s *SQLiteDB) CreateAuditEvent(e *models.AuditEvent) error {
+	result, err := s.db.Exec(`
+		INSERT INTO audit_events (actor_id, actor_email, action, target_type, target_id,
+		                          ip_address, user_agent, diff)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, nullableID(e.ActorID), e.ActorEmail, e.Action, e.TargetType, e.TargetID,
+		e.IPAddress, e.UserAgent, auditDiff(e))
+	if err != nil {
+		return err
+	}
+
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListAuditEvents returns a page of the audit log, newest first
+func (s *SQLiteDB) ListAuditEvents(q *AuditQuery) (*AuditPage, error) {
+	args := &queryArgs{placeholder: sqlitePlaceholder, timeArg: sqliteTime}
+	rows, err := s.db.Query(auditListSQL(q, args), args.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page, err := scanAuditPage(rows, q)
+	if err != nil {
+		return nil, err
+	}
+
+	countArgs := &queryArgs{placeholder: sqlitePlaceholder, timeArg: sqliteTime}
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM audit_events WHERE `+auditFilters(q, countArgs),
+		countArgs.args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// attachProfessors loads the professors assigned to each course
+func (s *SQLiteDB) attachProfessors(courses []*models.Course, courseID int64) error {
+	args := &queryArgs{placeholder: sqlitePlaceholder}
+	rows, err := s.db.Query(courseMembersSQL(courseProfessorsTable, courseID, args), args.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scanCourseProfessors(rows, courses)
+}
+
+// attachCourses sets the courses user teaches and is enrolled in
+func (s *SQLiteDB) attachCourses(user *models.User) error {
+	for _, m := range []struct {
+		table string
+		dst   *string
+	}{
+		{courseProfessorsTable, &user.AssignedCourses},
+		{courseEnrollmentsTable, &user.EnrolledCourses},
+	} {
+		args := &queryArgs{placeholder: sqlitePlaceholder}
+		rows, err := s.db.Query(userCoursesSQL(m.table, user.ID, args), args.args...)
+		if err != nil {
+			return err
+		}
+		*m.dst, err = scanCourseNames(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListCourses returns every course with its professors, ordered by name
+func (s *SQLiteDB) ListCourses() ([]*models.Course, error) {
+	rows, err := s.db.Query(`SELECT ` + courseColumns + ` FROM courses ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+
+	courses := []*models.Course{}
+	for rows.Next() {
+		c := &models.Course{}
+		if err := scanCourse(rows, c); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return courses, s.attachProfessors(courses, 0)
+}
+
+// GetCourse retrieves a course and its professors by ID
+func (s *SQLiteDB) GetCourse(id int64) (*models.Course, error) {
+	return s.getCourse(`id = ?`, id)
+}
+
+// GetCourseByName retrieves a course and its professors by name
+func (s *SQLiteDB) GetCourseByName(name string) (*models.Course, error) {
+	return s.getCourse(`name = ?`, name)
+}
+
+func (s *SQLiteDB) getCourse(where string, arg interface{}) (*models.Course, error) {
+	c := &models.Course{}
+	err := scanCourse(s.db.QueryRow(`SELECT `+courseColumns+` FROM courses WHERE `+where, arg), c)
+	if err == sql.ErrNoRows {
+		return nil, ErrCourseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c, s.attachProfessors([]*models.Course{c}, c.ID)
+}
+
+// CreateCourse adds a course
+func (s *SQLiteDB) CreateCourse(c *models.Course) error {
+	result, err := s.db.Exec(`
+		INSERT INTO courses (name, code, description)
+		VALUES (?, ?, ?)
+	`, c.Name, c.Code, c.Description)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return ErrCourseExists
+		}
+		return err
+	}
+
+	c.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateCourse changes the name, code and description of a course. Renaming
+// a course moves its packages along with it.
+func (s *SQLiteDB) UpdateCourse(c *models.Course) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	if err := tx.QueryRow(`SELECT name FROM courses WHERE id = ?`, c.ID).Scan(&oldName); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrCourseNotFound
+		}
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE courses
+		SET name = ?, code = ?, description = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, c.Name, c.Code, c.Description, c.ID)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return ErrCourseExists
+		}
+		return err
+	}
+
+	if oldName != c.Name {
+		rows, err := tx.Query(`SELECT id FROM packages WHERE course_name = ?`, oldName)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		_, err = tx.Exec(`
+			UPDATE packages SET course_name = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE course_name = ?
+		`, c.Name, oldName)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := s.indexPackage(tx, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCourse removes a course that no package or submission box uses,
+// along with its professor assignments and enrollments
+func (s *SQLiteDB) DeleteCourse(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var used int64
+	err = tx.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM packages WHERE course_name = (SELECT name FROM courses WHERE id = ?))
+		     + (SELECT COUNT(*) FROM submission_boxes WHERE course_id = ?)
+	`, id, id).Scan(&used)
+	if err != nil {
+		return err
+	}
+	if used > 0 {
+		return ErrCourseInUse
+	}
+
+	result, err := tx.Exec(`DELETE FROM courses WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrCourseNotFound
+	}
+
+	// SQLite does not enforce the cascade without PRAGMA foreign_keys
+	for _, table := range []string{courseProfessorsTable, courseEnrollmentsTable} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE course_id = ?`, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AddCourseProfessor assigns a professor to a course; assigning twice is a no-op
+func (s *SQLiteDB) AddCourseProfessor(courseID, userID int64) error {
+	return s.addCourseMember(courseProfessorsTable, courseID, userID)
+}
+
+// RemoveCourseProfessor unassigns a professor from a course
+func (s *SQLiteDB) RemoveCourseProfessor(courseID, userID int64) error {
+	return s.removeCourseMember(courseProfessorsTable, courseID, userID)
+}
+
+// ListCourseStudents returns the students enrolled in a course
+func (s *SQLiteDB) ListCourseStudents(courseID int64) ([]*models.CourseMember, error) {
+	args := &queryArgs{placeholder: sqlitePlaceholder}
+	rows, err := s.db.Query(courseMembersSQL(courseEnrollmentsTable, courseID, args), args.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCourseMembers(rows)
+}
+
+// EnrollStudent enrolls a student in a course; enrolling twice is a no-op
+func (s *SQLiteDB) EnrollStudent(courseID, userID int64) error {
+	return s.addCourseMember(courseEnrollmentsTable, courseID, userID)
+}
+
+// UnenrollStudent removes a student from a course
+func (s *SQLiteDB) UnenrollStudent(courseID, userID int64) error {
+	return s.removeCourseMember(courseEnrollmentsTable, courseID, userID)
+}
+
+func (s *SQLiteDB) addCourseMember(table string, courseID, userID int64) error {
+	var exists int
+	if err := s.db.QueryRow(`SELECT 1 FROM courses WHERE id = ?`, courseID).Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrCourseNotFound
+		}
+		return err
+	}
+
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO `+table+` (course_id, user_id) VALUES (?, ?)`, courseID, userID)
+	return err
+}
+
+func (s *SQLiteDB) removeCourseMember(table string, courseID, userID int64) error {
+	_, err := s.db.Exec(`DELETE FROM `+table+` WHERE course_id = ? AND user_id = ?`, courseID, userID)
+	return err
+}
+
+// importAssignedCourses moves course names left in users.assigned_courses
+// into course_professors, creating missing courses, and clears the column
+// so the import runs once
+func (s *SQLiteDB) importAssignedCourses() error {
+	rows, err := s.db.Query(legacyAssignmentsSQL)
+	if err != nil {
+		return err
+	}
+	assignments, err := scanLegacyAssignments(rows)
+	rows.Close()
+	if err != nil || len(assignments) == 0 {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, a := range assignments {
+		for _, name := range a.courses {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO courses (name) VALUES (?)`, name); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`
+				INSERT OR IGNORE INTO course_professors (course_id, user_id)
+				SELECT id, ? FROM courses WHERE name = ?
+			`, a.userID, name)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`UPDATE users SET assigned_courses = '' WHERE id = ?`, a.userID); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Imported course assignments of %d users", len(assignments))
+	return tx.Commit()
+}
@@ -0,0 +1,124 @@
+package storage
+
+// SetUserMFASecret stores a TOTP secret pending confirmation; MFA stays
+// disabled until EnableUserMFA
+func (s *SQLiteDB) SetUserMFASecret(userID int64, secret string) error {
+	return s.updateUser(userID, `mfa_secret = ?, mfa_enabled = 0`, secret)
+}
+
+// EnableUserMFA turns on MFA with the pending secret, records step as used
+// and replaces the user's recovery codes
+func (s *SQLiteDB) EnableUserMFA(userID int64, step int64, codeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users SET mfa_enabled = 1, mfa_last_step = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND mfa_secret IS NOT NULL
+	`, step, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := s.insertRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableUserMFA turns off MFA and drops the secret and recovery codes
+func (s *SQLiteDB) DisableUserMFA(userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users SET mfa_secret = NULL, mfa_enabled = 0, mfa_last_step = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes replaces every recovery code of a user
+func (s *SQLiteDB) ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.insertRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteDB) insertRecoveryCodes(tx sqlExecer, userID int64, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseTOTPStep records step as the last TOTP step accepted for a user. It
+// returns false when step is not newer than the last one, i.e. the code
+// was already used.
+func (s *SQLiteDB) UseTOTPStep(userID int64, step int64) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE users SET mfa_last_step = ? WHERE id = ? AND COALESCE(mfa_last_step, 0) < ?
+	`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used. It
+// returns false when the user has no such unused code.
+func (s *SQLiteDB) UseRecoveryCode(userID int64, codeHash string) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left
+func (s *SQLiteDB) CountRecoveryCodes(userID int64) (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL`,
+		userID).Scan(&n)
+	return n, err
+}
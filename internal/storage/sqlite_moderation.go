@@ -0,0 +1,72 @@
+package storage
+
+import "github.com/jesus/FCCUR/internal/models"
+
+// ReviewPackage records the outcome of a package review: its new status,
+// the reason given and who reviewed it
+func (s *SQLiteDB) ReviewPackage(id int64, status models.PackageStatus, reason string, reviewerID int64) error {
+	result, err := s.db.Exec(`
+		UPDATE packages
+		SET status = ?, review_reason = ?, reviewed_by = ?, reviewed_at = CURRENT_TIMESTAMP,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, status, reason, nullableID(reviewerID), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPackageNotFound
+	}
+
+	return nil
+}
+
+// CreateNotification stores a notification for a user
+func (s *SQLiteDB) CreateNotification(n *models.Notification) error {
+	result, err := s.db.Exec(`
+		INSERT INTO notifications (user_id, kind, message, package_id)
+		VALUES (?, ?, ?, ?)
+	`, n.UserID, n.Kind, n.Message, nullableID(n.PackageID))
+	if err != nil {
+		return err
+	}
+
+	n.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListNotifications returns up to limit notifications of a user, newest
+// first
+func (s *SQLiteDB) ListNotifications(userID int64, unreadOnly bool, limit int) ([]*models.Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE user_id = ?`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+
+	rows, err := s.db.Query(query+` ORDER BY created_at DESC, id DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotifications(rows)
+}
+
+// MarkNotificationsRead marks notification id of a user as read, or all of
+// the user's notifications when id is 0
+func (s *SQLiteDB) MarkNotificationsRead(userID, id int64) error {
+	query := `UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL`
+	args := []interface{}{userID}
+	if id != 0 {
+		query += ` AND id = ?`
+		args = append(args, id)
+	}
+
+	_, err := s.db.Exec(query, args...)
+	return err
+}
@@ -11,61 +11,54 @@ import (
 func (s *SQLiteDB) CreatePackage(pkg *models.Package) (int64, error) {
 	query := `
 		INSERT INTO packages (name, version, description, category, content_type, course_name,
-			file_path, file_size, blake3_hash, sha256_hash, download_url, platform, thumbnail_path)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			file_path, file_name, file_size, blake3_hash, sha256_hash, download_url, platform, thumbnail_path,
+			visibility, status, uploaded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	result, err := s.db.Exec(query,
 		pkg.Name, pkg.Version, pkg.Description, pkg.Category, pkg.ContentType, pkg.CourseName,
-		pkg.FilePath, pkg.FileSize, pkg.BLAKE3Hash, pkg.SHA256Hash,
-		pkg.DownloadURL, pkg.Platform, pkg.ThumbnailPath,
+		pkg.FilePath, pkg.FileName, pkg.FileSize, pkg.BLAKE3Hash, pkg.SHA256Hash,
+		pkg.DownloadURL, pkg.Platform, pkg.ThumbnailPath, packageVisibility(pkg.Visibility),
+		packageStatus(pkg.Status), nullableID(pkg.UploadedBy),
 	)
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, s.indexPackage(s.db, id)
 }
 
 // GetPackage retrieves a package by ID
 func (s *SQLiteDB) GetPackage(id int64) (*models.Package, error) {
-	query := `SELECT id, name, version, description, category, content_type, course_name,
-		file_path, file_size, blake3_hash, sha256_hash, download_url, platform, thumbnail_path,
-		created_at, updated_at FROM packages WHERE id = ?`
+	query := `SELECT ` + packageColumns + ` FROM packages WHERE id = ? AND deleted_at IS NULL`
 
 	pkg := &models.Package{}
-	err := s.db.QueryRow(query, id).Scan(
-		&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description,
-		&pkg.Category, &pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileSize,
-		&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL,
-		&pkg.Platform, &pkg.ThumbnailPath, &pkg.CreatedAt, &pkg.UpdatedAt,
-	)
+	if err := scanPackage(s.db.QueryRow(query, id), pkg); err != nil {
+		return pkg, err
+	}
 
-	return pkg, err
+	return pkg, s.attachTags([]*models.Package{pkg})
 }
 
 // FindPackageByHash retrieves a package by BLAKE3 hash
 func (s *SQLiteDB) FindPackageByHash(blake3Hash string) (*models.Package, error) {
-	query := `SELECT id, name, version, description, category, content_type, course_name,
-		file_path, file_size, blake3_hash, sha256_hash, download_url, platform, thumbnail_path,
-		created_at, updated_at FROM packages WHERE blake3_hash = ?`
+	query := `SELECT ` + packageColumns + ` FROM packages WHERE blake3_hash = ? AND deleted_at IS NULL`
 
 	pkg := &models.Package{}
-	err := s.db.QueryRow(query, blake3Hash).Scan(
-		&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description,
-		&pkg.Category, &pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileSize,
-		&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL,
-		&pkg.Platform, &pkg.ThumbnailPath, &pkg.CreatedAt, &pkg.UpdatedAt,
-	)
+	err := scanPackage(s.db.QueryRow(query, blake3Hash), pkg)
 
 	return pkg, err
 }
 
 // GetPackages retrieves all packages
 func (s *SQLiteDB) GetPackages() ([]*models.Package, error) {
-	query := `SELECT id, name, version, description, category, content_type, course_name,
-		file_path, file_size, blake3_hash, sha256_hash, download_url, platform, thumbnail_path,
-		created_at, updated_at FROM packages ORDER BY created_at DESC`
+	query := `SELECT ` + packageColumns + ` FROM packages WHERE deleted_at IS NULL ORDER BY created_at DESC`
 
 	rows, err := s.db.Query(query)
 	if err != nil {
@@ -76,78 +69,39 @@ func (s *SQLiteDB) GetPackages() ([]*models.Package, error) {
 	packages := []*models.Package{}
 	for rows.Next() {
 		pkg := &models.Package{}
-		err := rows.Scan(
-			&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description,
-			&pkg.Category, &pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileSize,
-			&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL,
-			&pkg.Platform, &pkg.ThumbnailPath, &pkg.CreatedAt, &pkg.UpdatedAt,
-		)
+		err := scanPackage(rows, pkg)
 		if err != nil {
 			return nil, err
 		}
 		packages = append(packages, pkg)
 	}
 
-	return packages, nil
+	return packages, s.attachTags(packages)
 }
 
-// ListPackages retrieves packages with filters and pagination
-func (s *SQLiteDB) ListPackages(limit, offset int, category, platform, contentType, courseName string) ([]*models.Package, error) {
-	query := `SELECT id, name, version, description, category, content_type, course_name,
-		file_path, file_size, blake3_hash, sha256_hash, download_url, platform, thumbnail_path,
-		created_at, updated_at FROM packages WHERE 1=1`
-	args := []interface{}{}
-
-	if category != "" {
-		query += ` AND category = ?`
-		args = append(args, category)
-	}
-	if platform != "" {
-		query += ` AND platform = ?`
-		args = append(args, platform)
-	}
-	if contentType != "" {
-		query += ` AND content_type = ?`
-		args = append(args, contentType)
-	}
-	if courseName != "" {
-		query += ` AND course_name = ?`
-		args = append(args, courseName)
-	}
-
-	query += ` ORDER BY created_at DESC`
-
-	if limit > 0 {
-		query += ` LIMIT ?`
-		args = append(args, limit)
-	}
-	if offset > 0 {
-		query += ` OFFSET ?`
-		args = append(args, offset)
+// ListPackages returns one page of packages matching the filters in q,
+// in the requested order, along with the total match count
+func (s *SQLiteDB) ListPackages(q *PackageQuery) (*PackagePage, error) {
+	args := &queryArgs{placeholder: sqlitePlaceholder, timeArg: sqliteTime}
+	rows, err := s.db.Query(packageListSQL(q, args), args.args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	rows, err := s.db.Query(query, args...)
+	page, err := scanPackagePage(rows, q)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	packages := []*models.Package{}
-	for rows.Next() {
-		pkg := &models.Package{}
-		err := rows.Scan(
-			&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description,
-			&pkg.Category, &pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileSize,
-			&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL,
-			&pkg.Platform, &pkg.ThumbnailPath, &pkg.CreatedAt, &pkg.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		packages = append(packages, pkg)
+	countArgs := &queryArgs{placeholder: sqlitePlaceholder}
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM packages WHERE `+packageFilters(q, countArgs),
+		countArgs.args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
 	}
 
-	return packages, nil
+	return page, s.attachTags(page.Packages)
 }
 
 // RecordDownload logs a download event
@@ -168,12 +122,45 @@ func (s *SQLiteDB) DeletePackage(id int64) error {
 	}
 	defer tx.Rollback()
 
+	if err := s.deletePackageRows(tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deletePackageRows deletes package id and every row referencing it
+func (s *SQLiteDB) deletePackageRows(tx *sql.Tx, id int64) error {
 	// Delete download records first (foreign key constraint)
-	_, err = tx.Exec("DELETE FROM downloads WHERE package_id = ?", id)
+	_, err := tx.Exec("DELETE FROM downloads WHERE package_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM package_history WHERE package_id = ?", id)
 	if err != nil {
 		return err
 	}
 
+	_, err = tx.Exec("DELETE FROM package_revisions WHERE package_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM package_tags WHERE package_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE notifications SET package_id = NULL WHERE package_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.unindexPackage(tx, id); err != nil {
+		return err
+	}
+
 	// Delete package record
 	result, err := tx.Exec("DELETE FROM packages WHERE id = ?", id)
 	if err != nil {
@@ -189,7 +176,42 @@ func (s *SQLiteDB) DeletePackage(id int64) error {
 		return sql.ErrNoRows
 	}
 
-	return tx.Commit()
+	return nil
+}
+
+// UpdatePackageFile updates the stored file location, size and hashes of a package
+func (s *SQLiteDB) UpdatePackageFile(pkg *models.Package) error {
+	result, err := s.db.Exec(`
+		UPDATE packages
+		SET file_path = ?, file_name = ?, file_size = ?, blake3_hash = ?, sha256_hash = ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, pkg.FilePath, pkg.FileName, pkg.FileSize, pkg.BLAKE3Hash, pkg.SHA256Hash, pkg.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPackageNotFound
+	}
+
+	return nil
+}
+
+// CountPackagesByFilePath counts packages, prior revisions and submissions
+// referencing a stored file
+func (s *SQLiteDB) CountPackagesByFilePath(filePath string) (int64, error) {
+	var count int64
+	err := s.db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM packages WHERE file_path = ?)
+		     + (SELECT COUNT(*) FROM package_revisions WHERE file_path = ?)
+		     + (SELECT COUNT(*) FROM submissions WHERE file_path = ?)
+	`, filePath, filePath, filePath).Scan(&count)
+	return count, err
 }
 
 // GetStats retrieves download statistics
@@ -202,6 +224,7 @@ func (s *SQLiteDB) GetStats() ([]*models.DownloadStats, error) {
 			COALESCE(MAX(d.downloaded_at), '') as last_download
 		FROM packages p
 		LEFT JOIN downloads d ON p.id = d.package_id
+		WHERE p.deleted_at IS NULL
 		GROUP BY p.id, p.name
 		ORDER BY total DESC
 	`
@@ -259,22 +282,20 @@ func (s *SQLiteDB) GetTotalDownloads() (int64, error) {
 // GetPackageCount gets the total number of packages
 func (s *SQLiteDB) GetPackageCount() (int64, error) {
 	var count int64
-	err := s.db.QueryRow(`SELECT COUNT(*) FROM packages`).Scan(&count)
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM packages WHERE deleted_at IS NULL`).Scan(&count)
 	return count, err
 }
 
 // GetTotalSize gets the total size of all packages
 func (s *SQLiteDB) GetTotalSize() (int64, error) {
 	var size int64
-	err := s.db.QueryRow(`SELECT COALESCE(SUM(file_size), 0) FROM packages`).Scan(&size)
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(file_size), 0) FROM packages WHERE deleted_at IS NULL`).Scan(&size)
 	return size, err
 }
 
 // GetRecentPackages gets the most recent packages
 func (s *SQLiteDB) GetRecentPackages(limit int) ([]*models.Package, error) {
-	query := `SELECT id, name, version, description, category, content_type, course_name,
-		file_path, file_size, blake3_hash, sha256_hash, download_url, platform, thumbnail_path,
-		created_at, updated_at FROM packages ORDER BY created_at DESC LIMIT ?`
+	query := `SELECT ` + packageColumns + ` FROM packages WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT ?`
 
 	rows, err := s.db.Query(query, limit)
 	if err != nil {
@@ -285,17 +306,175 @@ func (s *SQLiteDB) GetRecentPackages(limit int) ([]*models.Package, error) {
 	packages := []*models.Package{}
 	for rows.Next() {
 		pkg := &models.Package{}
-		err := rows.Scan(
-			&pkg.ID, &pkg.Name, &pkg.Version, &pkg.Description,
-			&pkg.Category, &pkg.ContentType, &pkg.CourseName, &pkg.FilePath, &pkg.FileSize,
-			&pkg.BLAKE3Hash, &pkg.SHA256Hash, &pkg.DownloadURL,
-			&pkg.Platform, &pkg.ThumbnailPath, &pkg.CreatedAt, &pkg.UpdatedAt,
-		)
+		err := scanPackage(rows, pkg)
 		if err != nil {
 			return nil, err
 		}
 		packages = append(packages, pkg)
 	}
 
-	return packages, nil
+	return packages, s.attachTags(packages)
+}
+
+// UpdatePackage updates editable package metadata and records the field
+// changes in package_history within a single transaction
+func (s *SQLiteDB) UpdatePackage(pkg *models.Package, changes []*models.PackageChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE packages
+		SET name = ?, version = ?, description = ?, category = ?, content_type = ?,
+			course_name = ?, platform = ?, visibility = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, pkg.Name, pkg.Version, pkg.Description, pkg.Category, pkg.ContentType,
+		pkg.CourseName, pkg.Platform, packageVisibility(pkg.Visibility), pkg.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPackageNotFound
+	}
+
+	for _, c := range changes {
+		_, err := tx.Exec(`
+			INSERT INTO package_history (package_id, user_id, field, old_value, new_value)
+			VALUES (?, ?, ?, ?, ?)
+		`, pkg.ID, nullableID(c.UserID), c.Field, c.OldValue, c.NewValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.indexPackage(tx, pkg.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetPackageHistory returns metadata edits for a package, newest first
+func (s *SQLiteDB) GetPackageHistory(packageID int64) ([]*models.PackageChange, error) {
+	rows, err := s.db.Query(`
+		SELECT h.id, h.package_id, h.user_id, COALESCE(u.email, ''), h.field,
+		       COALESCE(h.old_value, ''), COALESCE(h.new_value, ''), h.changed_at
+		FROM package_history h
+		LEFT JOIN users u ON u.id = h.user_id
+		WHERE h.package_id = ?
+		ORDER BY h.changed_at DESC, h.id DESC
+	`, packageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*models.PackageChange
+	for rows.Next() {
+		c := &models.PackageChange{}
+		var userID sql.NullInt64
+		err := rows.Scan(&c.ID, &c.PackageID, &userID, &c.UserEmail, &c.Field,
+			&c.OldValue, &c.NewValue, &c.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		c.UserID = userID.Int64
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
+
+// ReplacePackageFile points a package at a new file and keeps the previous
+// file as a revision, within a single transaction. The package's status and
+// uploader are saved too, since a new file may need review.
+func (s *SQLiteDB) ReplacePackageFile(pkg *models.Package, previous *models.PackageRevision) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO package_revisions (package_id, file_path, file_name, file_size,
+			blake3_hash, sha256_hash, replaced_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, pkg.ID, previous.FilePath, previous.FileName, previous.FileSize,
+		previous.BLAKE3Hash, previous.SHA256Hash, nullableID(previous.ReplacedBy))
+	if err != nil {
+		return err
+	}
+	previous.ID, _ = result.LastInsertId()
+
+	result, err = tx.Exec(`
+		UPDATE packages
+		SET file_path = ?, file_name = ?, file_size = ?, blake3_hash = ?, sha256_hash = ?,
+			status = ?, uploaded_by = ?, readme_text = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, pkg.FilePath, pkg.FileName, pkg.FileSize, pkg.BLAKE3Hash, pkg.SHA256Hash,
+		packageStatus(pkg.Status), nullableID(pkg.UploadedBy), pkg.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPackageNotFound
+	}
+
+	// The new file's README is extracted afterwards; drop the old one now
+	if err := s.indexPackage(tx, pkg.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetPackageRevisions returns the previous files of a package, newest first
+func (s *SQLiteDB) GetPackageRevisions(packageID int64) ([]*models.PackageRevision, error) {
+	rows, err := s.db.Query(`
+		SELECT `+revisionColumns+`
+		FROM package_revisions
+		WHERE package_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, packageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.PackageRevision
+	for rows.Next() {
+		rev := &models.PackageRevision{}
+		if err := scanRevision(rows, rev); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetPackageRevision retrieves a single revision by ID
+func (s *SQLiteDB) GetPackageRevision(id int64) (*models.PackageRevision, error) {
+	rev := &models.PackageRevision{}
+	err := scanRevision(s.db.QueryRow(`
+		SELECT `+revisionColumns+`
+		FROM package_revisions WHERE id = ?
+	`, id), rev)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrPackageNotFound
+	}
+	return rev, err
 }
@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+	"github.com/jesus/FCCUR/internal/search"
+)
+
+// FTS5 is optional in go-sqlite3 (build tag sqlite_fts5), so the index table
+// is created at startup rather than by a migration. Without FTS5, search
+// falls back to substring matching.
+const sqliteSearchTable = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS packages_fts USING fts5(
+		name, description, course_name, readme,
+		tokenize = 'unicode61 remove_diacritics 2'
+	)
+`
+
+// bm25 column weights for name, description, course_name and readme; they
+// mirror the A-D weights of the PostgreSQL search_vector
+const sqliteSearchRank = `bm25(packages_fts, 10.0, 4.0, 2.0, 1.0)`
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// hasFTS5 reports whether the linked SQLite library was built with FTS5
+func hasFTS5(db *sql.DB) bool {
+	var enabled bool
+	err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled)
+	return err == nil && enabled
+}
+
+// ensureSearchIndex creates the FTS5 table and rebuilds it when its row count
+// differs from packages (first run, or rows written by a build without FTS5)
+func (s *SQLiteDB) ensureSearchIndex() error {
+	if !s.fts {
+		log.Printf("SQLite built without FTS5 (build tag sqlite_fts5); search uses substring matching")
+		return nil
+	}
+
+	if _, err := s.db.Exec(sqliteSearchTable); err != nil {
+		return err
+	}
+
+	var indexed, total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM packages_fts`).Scan(&indexed); err != nil {
+		return err
+	}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM packages`).Scan(&total); err != nil {
+		return err
+	}
+	if indexed == total {
+		return nil
+	}
+
+	rows, err := s.db.Query(`SELECT id FROM packages`)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM packages_fts`); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.indexPackage(tx, id); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Search index rebuilt: %d packages", len(ids))
+	return tx.Commit()
+}
+
+// indexPackage writes the stemmed text of a package into packages_fts
+func (s *SQLiteDB) indexPackage(ex sqlExecer, id int64) error {
+	if !s.fts {
+		return nil
+	}
+
+	var name, description, courseName, readme string
+	err := ex.QueryRow(`
+		SELECT name, COALESCE(description, ''), COALESCE(course_name, ''), COALESCE(readme_text, '')
+		FROM packages WHERE id = ?
+	`, id).Scan(&name, &description, &courseName, &readme)
+	if err != nil {
+		return err
+	}
+
+	if err := s.unindexPackage(ex, id); err != nil {
+		return err
+	}
+	_, err = ex.Exec(`
+		INSERT INTO packages_fts (rowid, name, description, course_name, readme)
+		VALUES (?, ?, ?, ?, ?)
+	`, id, search.Normalize(name), search.Normalize(description),
+		search.Normalize(courseName), search.Normalize(readme))
+	return err
+}
+
+// unindexPackage removes a package from packages_fts
+func (s *SQLiteDB) unindexPackage(ex sqlExecer, id int64) error {
+	if !s.fts {
+		return nil
+	}
+	_, err := ex.Exec(`DELETE FROM packages_fts WHERE rowid = ?`, id)
+	return err
+}
+
+// SearchPackages returns packages matching query and the listing filters,
+// best match first. Every word must match; the last one also matches as a
+// prefix.
+func (s *SQLiteDB) SearchPackages(query string, filters *PackageQuery, limit, offset int) ([]*models.SearchResult, error) {
+	if !s.fts {
+		return s.searchPackagesLike(query, searchFilters(filters), limit, offset)
+	}
+
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return []*models.SearchResult{}, nil
+	}
+	// Terms are letters and digits only, so quoting them is safe
+	for i, t := range terms {
+		terms[i] = `"` + t + `"`
+	}
+	terms[len(terms)-1] += "*"
+
+	args := &queryArgs{placeholder: sqlitePlaceholder}
+	match := args.bind(strings.Join(terms, " "))
+	rows, err := s.db.Query(`
+		SELECT `+packageColumns+`, m.score
+		FROM packages
+		JOIN (
+			SELECT rowid AS package_id, -`+sqliteSearchRank+` AS score
+			FROM packages_fts WHERE packages_fts MATCH `+match+`
+		) m ON m.package_id = packages.id
+		WHERE `+packageFilters(searchFilters(filters), args)+`
+		ORDER BY m.score DESC, created_at DESC
+		LIMIT `+args.bind(limit)+` OFFSET `+args.bind(offset),
+		args.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := scanSearchResults(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, s.attachTags(searchResultPackages(results))
+}
+
+// searchPackagesLike is the SearchPackages fallback for builds without FTS5:
+// every word must appear as a substring, weighted by the column it hits
+func (s *SQLiteDB) searchPackagesLike(query string, filters *PackageQuery, limit, offset int) ([]*models.SearchResult, error) {
+	words := search.Words(query)
+	if len(words) == 0 {
+		return []*models.SearchResult{}, nil
+	}
+
+	var where, rank []string
+	var whereArgs, rankArgs []interface{}
+	for _, w := range words {
+		pattern := "%" + w + "%"
+		where = append(where, `(lower(name) LIKE ? OR lower(COALESCE(description, '')) LIKE ?
+			OR lower(COALESCE(course_name, '')) LIKE ? OR lower(COALESCE(readme_text, '')) LIKE ?)`)
+		rank = append(rank, `(CASE WHEN lower(name) LIKE ? THEN 10 ELSE 0 END
+			+ CASE WHEN lower(COALESCE(description, '')) LIKE ? THEN 4 ELSE 0 END
+			+ CASE WHEN lower(COALESCE(course_name, '')) LIKE ? THEN 2 ELSE 0 END
+			+ CASE WHEN lower(COALESCE(readme_text, '')) LIKE ? THEN 1 ELSE 0 END)`)
+		for i := 0; i < 4; i++ {
+			whereArgs = append(whereArgs, pattern)
+			rankArgs = append(rankArgs, pattern)
+		}
+	}
+
+	args := &queryArgs{args: append(rankArgs, whereArgs...), placeholder: sqlitePlaceholder}
+	rows, err := s.db.Query(`
+		SELECT `+packageColumns+`, `+strings.Join(rank, " + ")+` AS score
+		FROM packages
+		WHERE `+strings.Join(where, " AND ")+` AND `+packageFilters(filters, args)+`
+		ORDER BY score DESC, created_at DESC
+		LIMIT `+args.bind(limit)+` OFFSET `+args.bind(offset),
+		args.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := scanSearchResults(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, s.attachTags(searchResultPackages(results))
+}
+
+// SetPackageReadme stores the README text extracted from a package archive
+// and refreshes its search entry. An empty readme marks the package as
+// processed.
+func (s *SQLiteDB) SetPackageReadme(packageID int64, readme string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE packages SET readme_text = ? WHERE id = ?`, readme, packageID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPackageNotFound
+	}
+
+	if err := s.indexPackage(tx, packageID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetPackagesWithoutReadme returns packages after afterID whose README has
+// not been extracted yet, in ID order
+func (s *SQLiteDB) GetPackagesWithoutReadme(afterID int64, limit int) ([]*models.Package, error) {
+	rows, err := s.db.Query(`
+		SELECT `+packageColumns+` FROM packages
+		WHERE readme_text IS NULL AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	packages := []*models.Package{}
+	for rows.Next() {
+		pkg := &models.Package{}
+		if err := scanPackage(rows, pkg); err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+
+	return packages, rows.Err()
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// ListSubmissionBoxes returns the submission boxes of a course, or of every
+// course when courseID is 0, soonest deadline first
+func (s *SQLiteDB) ListSubmissionBoxes(courseID int64) ([]*models.SubmissionBox, error) {
+	query := submissionBoxSelect
+	var args []interface{}
+	if courseID != 0 {
+		query += ` WHERE b.course_id = ?`
+		args = append(args, courseID)
+	}
+
+	rows, err := s.db.Query(query+` ORDER BY b.deadline, b.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSubmissionBoxes(rows)
+}
+
+// GetSubmissionBox retrieves a submission box by ID
+func (s *SQLiteDB) GetSubmissionBox(id int64) (*models.SubmissionBox, error) {
+	b := &models.SubmissionBox{}
+	err := scanSubmissionBox(s.db.QueryRow(submissionBoxSelect+` WHERE b.id = ?`, id), b)
+	if err == sql.ErrNoRows {
+		return nil, ErrSubmissionBoxNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// CreateSubmissionBox opens a submission box on a course
+func (s *SQLiteDB) CreateSubmissionBox(b *models.SubmissionBox) error {
+	result, err := s.db.Exec(`
+		INSERT INTO submission_boxes
+			(course_id, title, description, deadline, allowed_extensions, max_size, accept_late, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, b.CourseID, b.Title, b.Description, b.Deadline.UTC(), formatExtensions(b.AllowedExtensions),
+		b.MaxSize, b.AcceptLate, nullableID(b.CreatedBy))
+	if err != nil {
+		return err
+	}
+
+	b.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateSubmissionBox changes the settings of a submission box. Submissions
+// keep the late flag they were given when handed in.
+func (s *SQLiteDB) UpdateSubmissionBox(b *models.SubmissionBox) error {
+	result, err := s.db.Exec(`
+		UPDATE submission_boxes
+		SET title = ?, description = ?, deadline = ?, allowed_extensions = ?, max_size = ?,
+			accept_late = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, b.Title, b.Description, b.Deadline.UTC(), formatExtensions(b.AllowedExtensions), b.MaxSize,
+		b.AcceptLate, b.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrSubmissionBoxNotFound
+	}
+	return nil
+}
+
+// DeleteSubmissionBox removes a submission box and its submissions. The
+// caller releases the submitted files.
+func (s *SQLiteDB) DeleteSubmissionBox(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM submission_boxes WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrSubmissionBoxNotFound
+	}
+
+	// SQLite does not enforce the cascade without PRAGMA foreign_keys
+	if _, err := tx.Exec(`DELETE FROM submissions WHERE box_id = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveSubmission records a student's file in a box, replacing any earlier
+// submission by the same student
+func (s *SQLiteDB) SaveSubmission(sub *models.Submission) error {
+	_, err := s.db.Exec(`
+		INSERT INTO submissions
+			(box_id, user_id, file_path, file_name, file_size, blake3_hash, sha256_hash, late, submitted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (box_id, user_id) DO UPDATE SET
+			file_path = excluded.file_path, file_name = excluded.file_name,
+			file_size = excluded.file_size, blake3_hash = excluded.blake3_hash,
+			sha256_hash = excluded.sha256_hash, late = excluded.late,
+			submitted_at = excluded.submitted_at
+	`, sub.BoxID, sub.UserID, sub.FilePath, sub.FileName, sub.FileSize, sub.BLAKE3Hash,
+		sub.SHA256Hash, sub.Late, sub.SubmittedAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	return s.db.QueryRow(`SELECT id FROM submissions WHERE box_id = ? AND user_id = ?`,
+		sub.BoxID, sub.UserID).Scan(&sub.ID)
+}
+
+// GetSubmission retrieves a submission by ID
+func (s *SQLiteDB) GetSubmission(id int64) (*models.Submission, error) {
+	return s.getSubmission(`s.id = ?`, id)
+}
+
+// GetUserSubmission retrieves a student's submission to a box
+func (s *SQLiteDB) GetUserSubmission(boxID, userID int64) (*models.Submission, error) {
+	return s.getSubmission(`s.box_id = ? AND s.user_id = ?`, boxID, userID)
+}
+
+func (s *SQLiteDB) getSubmission(where string, args ...interface{}) (*models.Submission, error) {
+	sub := &models.Submission{}
+	err := scanSubmission(s.db.QueryRow(submissionSelect+` WHERE `+where, args...), sub)
+	if err == sql.ErrNoRows {
+		return nil, ErrSubmissionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListSubmissions returns the submissions to a box ordered by student email
+func (s *SQLiteDB) ListSubmissions(boxID int64) ([]*models.Submission, error) {
+	rows, err := s.db.Query(submissionSelect+` WHERE s.box_id = ? ORDER BY u.email`, boxID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSubmissions(rows)
+}
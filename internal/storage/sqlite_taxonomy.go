@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// attachTags loads the tags of each package
+func (s *SQLiteDB) attachTags(packages []*models.Package) error {
+	for _, batch := range tagBatches(packages) {
+		args := &queryArgs{placeholder: sqlitePlaceholder}
+		rows, err := s.db.Query(packageTagsSQL(batch, args), args.args...)
+		if err != nil {
+			return err
+		}
+		err = scanPackageTags(rows, batch)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddPackageTags attaches tags to a package, creating tags that do not
+// exist yet. Tags the package already carries are ignored.
+func (s *SQLiteDB) AddPackageTags(packageID int64, tags []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT 1 FROM packages WHERE id = ?`, packageID).Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPackageNotFound
+		}
+		return err
+	}
+
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (name) VALUES (?)`, tag); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO package_tags (package_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ?
+		`, packageID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemovePackageTags detaches tags from a package and drops tags no longer
+// used by any package
+func (s *SQLiteDB) RemovePackageTags(packageID int64, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{packageID}
+	for _, tag := range tags {
+		args = append(args, tag)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM package_tags
+		WHERE package_id = ? AND tag_id IN (
+			SELECT id FROM tags WHERE name IN (?`+strings.Repeat(", ?", len(tags)-1)+`)
+		)
+	`, args...)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteUnusedTags(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteUnusedTags removes tags without packages so they drop out of the facets
+func deleteUnusedTags(ex sqlExecer) error {
+	_, err := ex.Exec(`DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM package_tags)`)
+	return err
+}
+
+// GetTagCounts returns every tag used by packages matching the filters in
+// q, with the number of such packages, most used first
+func (s *SQLiteDB) GetTagCounts(q *PackageQuery) ([]*models.Tag, error) {
+	args := &queryArgs{placeholder: sqlitePlaceholder}
+	rows, err := s.db.Query(tagCountsSQL(q, args), args.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTagCounts(rows)
+}
+
+// ListCategories returns the category taxonomy ordered by name
+func (s *SQLiteDB) ListCategories() ([]*models.Category, error) {
+	rows, err := s.db.Query(`SELECT ` + categoryColumns + ` FROM categories ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*models.Category{}
+	for rows.Next() {
+		c := &models.Category{}
+		if err := scanCategory(rows, c); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+
+	return categories, rows.Err()
+}
+
+// GetCategory retrieves a category by slug
+func (s *SQLiteDB) GetCategory(slug string) (*models.Category, error) {
+	c := &models.Category{}
+	err := scanCategory(s.db.QueryRow(`SELECT `+categoryColumns+` FROM categories WHERE slug = ?`, slug), c)
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryNotFound
+	}
+	return c, err
+}
+
+// CreateCategory adds a category to the taxonomy
+func (s *SQLiteDB) CreateCategory(c *models.Category) error {
+	result, err := s.db.Exec(`
+		INSERT INTO categories (slug, name, color, icon, moderated)
+		VALUES (?, ?, ?, ?, ?)
+	`, c.Slug, c.Name, c.Color, c.Icon, c.Moderated)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return ErrCategoryExists
+		}
+		return err
+	}
+
+	c.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateCategory changes the name, color, icon and moderation flag of a
+// category; the slug is fixed because packages refer to it
+func (s *SQLiteDB) UpdateCategory(c *models.Category) error {
+	result, err := s.db.Exec(`
+		UPDATE categories
+		SET name = ?, color = ?, icon = ?, moderated = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE slug = ?
+	`, c.Name, c.Color, c.Icon, c.Moderated, c.Slug)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
+
+// DeleteCategory removes a category that no package uses
+func (s *SQLiteDB) DeleteCategory(slug string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var used int64
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM packages WHERE category = ?`, slug).Scan(&used); err != nil {
+		return err
+	}
+	if used > 0 {
+		return ErrCategoryInUse
+	}
+
+	result, err := tx.Exec(`DELETE FROM categories WHERE slug = ?`, slug)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return tx.Commit()
+}
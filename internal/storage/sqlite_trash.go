@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// TrashPackage moves a package to the trash. Its file, revisions and
+// download history are kept until it is purged.
+func (s *SQLiteDB) TrashPackage(id, userID int64) error {
+	result, err := s.db.Exec(`
+		UPDATE packages SET deleted_at = CURRENT_TIMESTAMP, deleted_by = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`, nullableID(userID), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPackageNotFound
+	}
+
+	return nil
+}
+
+// RestorePackage takes a package out of the trash
+func (s *SQLiteDB) RestorePackage(id int64) error {
+	result, err := s.db.Exec(`
+		UPDATE packages SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = ? AND deleted_at IS NOT NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPackageNotFound
+	}
+
+	return nil
+}
+
+// PurgePackage removes a package in the trash for good, with its download
+// records, history and revisions. It returns ErrPackageNotInTrash when the
+// package is not in the trash, e.g. because it was just restored.
+func (s *SQLiteDB) PurgePackage(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Writing the row first holds the write lock, so a restore cannot
+	// commit between this check and the delete
+	result, err := tx.Exec(`
+		UPDATE packages SET deleted_at = deleted_at
+		WHERE id = ? AND deleted_at IS NOT NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPackageNotInTrash
+	}
+
+	if err := s.deletePackageRows(tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTrashedPackage retrieves a package in the trash by ID
+func (s *SQLiteDB) GetTrashedPackage(id int64) (*models.Package, error) {
+	query := `SELECT ` + packageColumns + ` FROM packages WHERE id = ? AND deleted_at IS NOT NULL`
+
+	pkg := &models.Package{}
+	err := scanPackage(s.db.QueryRow(query, id), pkg)
+	if err == sql.ErrNoRows {
+		return nil, ErrPackageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pkg, s.attachTags([]*models.Package{pkg})
+}
+
+// ListTrash returns the packages in the trash, most recently deleted first.
+// When deletedBefore is set, only packages deleted before then are listed.
+func (s *SQLiteDB) ListTrash(deletedBefore *time.Time) ([]*models.Package, error) {
+	query := `SELECT ` + packageColumns + ` FROM packages WHERE deleted_at IS NOT NULL`
+	var args []interface{}
+	if deletedBefore != nil {
+		query += ` AND deleted_at < ?`
+		args = append(args, sqliteTime(*deletedBefore))
+	}
+
+	rows, err := s.db.Query(query+` ORDER BY deleted_at DESC, id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	packages := []*models.Package{}
+	for rows.Next() {
+		pkg := &models.Package{}
+		if err := scanPackage(rows, pkg); err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return packages, s.attachTags(packages)
+}
@@ -28,50 +28,26 @@ func (s *SQLiteDB) CreateUser(email, passwordHash, fullName string, role models.
 
 // GetUserByID retrieves a user by ID
 func (s *SQLiteDB) GetUserByID(id int64) (*models.User, error) {
-	user := &models.User{}
-	err := s.db.QueryRow(`
-		SELECT id, email, password_hash, full_name, role, assigned_courses,
-		       is_active, is_admin, email_verified, verification_token,
-		       reset_token, reset_token_expiry, last_login, created_at, updated_at
-		FROM users WHERE id = ?
-	`, id).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.FullName,
-		&user.Role, &user.AssignedCourses,
-		&user.IsActive, &user.IsAdmin, &user.EmailVerified, &user.VerificationToken,
-		&user.ResetToken, &user.ResetTokenExpiry, &user.LastLogin,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+	return s.getUser(`id = ?`, ErrUserNotFound, id)
 }
 
 // GetUserByEmail retrieves a user by email
 func (s *SQLiteDB) GetUserByEmail(email string) (*models.User, error) {
+	return s.getUser(`email = ?`, ErrUserNotFound, email)
+}
+
+// getUser retrieves the user matching where, with their courses; notFound
+// is returned when there is none
+func (s *SQLiteDB) getUser(where string, notFound error, args ...interface{}) (*models.User, error) {
 	user := &models.User{}
-	err := s.db.QueryRow(`
-		SELECT id, email, password_hash, full_name, role, assigned_courses,
-		       is_active, is_admin, email_verified, verification_token,
-		       reset_token, reset_token_expiry, last_login, created_at, updated_at
-		FROM users WHERE email = ?
-	`, email).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.FullName,
-		&user.Role, &user.AssignedCourses,
-		&user.IsActive, &user.IsAdmin, &user.EmailVerified, &user.VerificationToken,
-		&user.ResetToken, &user.ResetTokenExpiry, &user.LastLogin,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
+	err := scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE `+where, args...), user)
 	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
+		return nil, notFound
 	}
 	if err != nil {
 		return nil, err
 	}
-	return user, nil
+	return user, s.attachCourses(user)
 }
 
 // UpdateUserLastLogin updates the last login timestamp
@@ -95,27 +71,7 @@ func (s *SQLiteDB) SetUserResetToken(userID int64, token string, expiry time.Tim
 
 // GetUserByResetToken retrieves a user by reset token
 func (s *SQLiteDB) GetUserByResetToken(token string) (*models.User, error) {
-	user := &models.User{}
-	err := s.db.QueryRow(`
-		SELECT id, email, password_hash, full_name, role, assigned_courses,
-		       is_active, is_admin, email_verified, verification_token,
-		       reset_token, reset_token_expiry, last_login, created_at, updated_at
-		FROM users
-		WHERE reset_token = ? AND reset_token_expiry > CURRENT_TIMESTAMP
-	`, token).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.FullName,
-		&user.Role, &user.AssignedCourses,
-		&user.IsActive, &user.IsAdmin, &user.EmailVerified, &user.VerificationToken,
-		&user.ResetToken, &user.ResetTokenExpiry, &user.LastLogin,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrInvalidToken
-	}
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+	return s.getUser(`reset_token = ? AND reset_token_expiry > CURRENT_TIMESTAMP`, ErrInvalidToken, token)
 }
 
 // UpdateUserPassword updates a user's password and clears reset token
@@ -129,22 +85,139 @@ func (s *SQLiteDB) UpdateUserPassword(userID int64, passwordHash string) error {
 	return err
 }
 
+// SetUserVerificationToken sets the token that confirms a user's email
+func (s *SQLiteDB) SetUserVerificationToken(userID int64, token string, expiry time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE users
+		SET verification_token = ?, verification_token_expiry = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, token, sqliteTime(expiry), userID)
+	return err
+}
+
+// GetUserByVerificationToken retrieves a user by an unexpired verification token
+func (s *SQLiteDB) GetUserByVerificationToken(token string) (*models.User, error) {
+	return s.getUser(`verification_token = ? AND verification_token_expiry > CURRENT_TIMESTAMP`, ErrInvalidToken, token)
+}
+
 // SetUserEmailVerified marks user's email as verified
 func (s *SQLiteDB) SetUserEmailVerified(userID int64) error {
 	_, err := s.db.Exec(`
 		UPDATE users
-		SET email_verified = 1, verification_token = NULL, updated_at = CURRENT_TIMESTAMP
+		SET email_verified = 1, verification_token = NULL, verification_token_expiry = NULL,
+		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`, userID)
 	return err
 }
 
-// CreateSession creates a new session
-func (s *SQLiteDB) CreateSession(userID int64, token, refreshToken, ipAddress, userAgent string, expiresAt time.Time) (*models.Session, error) {
+// ListUsers returns a page of users matching q, ordered by email
+func (s *SQLiteDB) ListUsers(q *UserQuery) (*UserPage, error) {
+	args := &queryArgs{placeholder: sqlitePlaceholder}
+	rows, err := s.db.Query(userListSQL(q, args), args.args...)
+	if err != nil {
+		return nil, err
+	}
+	users, err := scanUsers(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		if err := s.attachCourses(user); err != nil {
+			return nil, err
+		}
+	}
+
+	page := &UserPage{Users: users}
+	countArgs := &queryArgs{placeholder: sqlitePlaceholder}
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM users WHERE `+userFilters(q, countArgs),
+		countArgs.args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// UpdateUserRole changes a user's role, keeping the deprecated is_admin
+// flag in step
+func (s *SQLiteDB) UpdateUserRole(userID int64, role models.UserRole) error {
+	return s.updateUser(userID, `role = ?, is_admin = ?`, role, role == models.RoleAdmin)
+}
+
+// SetUserActive activates or deactivates a user
+func (s *SQLiteDB) SetUserActive(userID int64, active bool) error {
+	return s.updateUser(userID, `is_active = ?`, active)
+}
+
+// ForcePasswordReset disables a user's password and sets a reset token, so
+// the user can only log in again after choosing a new password
+func (s *SQLiteDB) ForcePasswordReset(userID int64, token string, expiry time.Time) error {
+	return s.updateUser(userID, `password_hash = '', reset_token = ?, reset_token_expiry = ?`, token, expiry)
+}
+
+// updateUser sets columns of a user, returning ErrUserNotFound when there
+// is no such user
+func (s *SQLiteDB) updateUser(userID int64, set string, args ...interface{}) error {
+	result, err := s.db.Exec(`UPDATE users SET `+set+`, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		append(args, userID)...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetUserCourses replaces the courses a professor is assigned to
+func (s *SQLiteDB) SetUserCourses(userID int64, courseIDs []int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT 1 FROM users WHERE id = ?`, userID).Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	// Keep the rows of courses still assigned, with their created_at
+	args := &queryArgs{placeholder: sqlitePlaceholder}
+	if _, err := tx.Exec(unassignedCoursesSQL(userID, courseIDs, args), args.args...); err != nil {
+		return err
+	}
+	for _, courseID := range courseIDs {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO course_professors (course_id, user_id) VALUES (?, ?)`,
+			courseID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CreateSession stores a new session
+func (s *SQLiteDB) CreateSession(session *models.Session) (*models.Session, error) {
 	result, err := s.db.Exec(`
-		INSERT INTO sessions (user_id, token, refresh_token, ip_address, user_agent, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, userID, token, refreshToken, ipAddress, userAgent, expiresAt)
+		INSERT INTO sessions (user_id, jti, family_id, token, refresh_token, ip_address, user_agent,
+			expires_at, refresh_expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, session.UserID, session.JTI, session.FamilyID, session.Token, session.RefreshToken, session.IPAddress,
+		session.UserAgent, session.ExpiresAt, sqliteTime(session.RefreshExpiresAt))
 	if err != nil {
 		return nil, err
 	}
@@ -157,16 +230,59 @@ func (s *SQLiteDB) CreateSession(userID int64, token, refreshToken, ipAddress, u
 	return s.GetSessionByID(id)
 }
 
-// GetSessionByID retrieves a session by ID
-func (s *SQLiteDB) GetSessionByID(id int64) (*models.Session, error) {
+// RotateSession replaces the session oldID with next, keeping rotatedHash,
+// the hash of the old refresh token, until next.RefreshExpiresAt. It
+// returns ErrSessionNotFound when oldID is gone, e.g. rotated by a
+// concurrent request.
+func (s *SQLiteDB) RotateSession(oldID int64, rotatedHash string, next *models.Session) (*models.Session, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, oldID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrSessionNotFound
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO rotated_refresh_tokens (token_hash, family_id, user_id, expires_at)
+		VALUES (?, ?, ?, ?)
+	`, rotatedHash, next.FamilyID, next.UserID, sqliteTime(next.RefreshExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = tx.Exec(`
+		INSERT INTO sessions (user_id, jti, family_id, token, refresh_token, ip_address, user_agent,
+			expires_at, refresh_expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, next.UserID, next.JTI, next.FamilyID, next.Token, next.RefreshToken, next.IPAddress,
+		next.UserAgent, next.ExpiresAt, sqliteTime(next.RefreshExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetSessionByID(id)
+}
+
+// getSession retrieves the session where column equals value
+func (s *SQLiteDB) getSession(column string, value interface{}) (*models.Session, error) {
 	session := &models.Session{}
-	err := s.db.QueryRow(`
-		SELECT id, user_id, token, refresh_token, ip_address, user_agent, expires_at, created_at
-		FROM sessions WHERE id = ?
-	`, id).Scan(
-		&session.ID, &session.UserID, &session.Token, &session.RefreshToken,
-		&session.IPAddress, &session.UserAgent, &session.ExpiresAt, &session.CreatedAt,
-	)
+	err := scanSession(s.db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE `+column+` = ?`, value), session)
 	if err == sql.ErrNoRows {
 		return nil, ErrSessionNotFound
 	}
@@ -176,19 +292,27 @@ func (s *SQLiteDB) GetSessionByID(id int64) (*models.Session, error) {
 	return session, nil
 }
 
+// GetSessionByID retrieves a session by ID
+func (s *SQLiteDB) GetSessionByID(id int64) (*models.Session, error) {
+	return s.getSession("id", id)
+}
+
+// GetSessionByJTI retrieves the unexpired session of an access token by
+// its jti claim
+func (s *SQLiteDB) GetSessionByJTI(jti string) (*models.Session, error) {
+	session, err := s.getSession("jti", jti)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+	return session, nil
+}
+
 // GetSessionByToken retrieves a session by token
 func (s *SQLiteDB) GetSessionByToken(token string) (*models.Session, error) {
-	session := &models.Session{}
-	err := s.db.QueryRow(`
-		SELECT id, user_id, token, refresh_token, ip_address, user_agent, expires_at, created_at
-		FROM sessions WHERE token = ?
-	`, token).Scan(
-		&session.ID, &session.UserID, &session.Token, &session.RefreshToken,
-		&session.IPAddress, &session.UserAgent, &session.ExpiresAt, &session.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrSessionNotFound
-	}
+	session, err := s.getSession("token", token)
 	if err != nil {
 		return nil, err
 	}
@@ -201,22 +325,16 @@ func (s *SQLiteDB) GetSessionByToken(token string) (*models.Session, error) {
 	return session, nil
 }
 
-// GetSessionByRefreshToken retrieves a session by refresh token
+// GetSessionByRefreshToken retrieves a session by refresh token, which
+// must not have expired
 func (s *SQLiteDB) GetSessionByRefreshToken(refreshToken string) (*models.Session, error) {
-	session := &models.Session{}
-	err := s.db.QueryRow(`
-		SELECT id, user_id, token, refresh_token, ip_address, user_agent, expires_at, created_at
-		FROM sessions WHERE refresh_token = ?
-	`, refreshToken).Scan(
-		&session.ID, &session.UserID, &session.Token, &session.RefreshToken,
-		&session.IPAddress, &session.UserAgent, &session.ExpiresAt, &session.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrSessionNotFound
-	}
+	session, err := s.getSession("refresh_token", refreshToken)
 	if err != nil {
 		return nil, err
 	}
+	if time.Now().After(session.RefreshExpiresAt) {
+		return nil, ErrSessionExpired
+	}
 	return session, nil
 }
 
@@ -232,16 +350,62 @@ func (s *SQLiteDB) DeleteUserSessions(userID int64) error {
 	return err
 }
 
-// CleanExpiredSessions removes expired sessions
+// DeleteSessionFamily deletes the sessions refreshed from one login and
+// returns them
+func (s *SQLiteDB) DeleteSessionFamily(familyID string) ([]*models.Session, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT `+sessionColumns+` FROM sessions WHERE family_id = ?`, familyID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := scanSessions(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE family_id = ?`, familyID); err != nil {
+		return nil, err
+	}
+	return sessions, tx.Commit()
+}
+
+// GetRotatedRefreshToken retrieves a refresh token that was exchanged for
+// a new session by its hash
+func (s *SQLiteDB) GetRotatedRefreshToken(tokenHash string) (*models.RotatedRefreshToken, error) {
+	t := &models.RotatedRefreshToken{}
+	err := scanRotatedRefreshToken(s.db.QueryRow(`
+		SELECT `+rotatedRefreshTokenColumns+` FROM rotated_refresh_tokens WHERE token_hash = ?
+	`, tokenHash), t)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CleanExpiredSessions removes sessions and rotated refresh tokens that
+// can no longer be refreshed
 func (s *SQLiteDB) CleanExpiredSessions() error {
-	_, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at < CURRENT_TIMESTAMP`)
+	now := sqliteTime(time.Now())
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE refresh_expires_at < ?`, now); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`DELETE FROM rotated_refresh_tokens WHERE expires_at < ?`, now)
 	return err
 }
 
 // ListUserSessions lists all active sessions for a user
 func (s *SQLiteDB) ListUserSessions(userID int64) ([]*models.Session, error) {
 	rows, err := s.db.Query(`
-		SELECT id, user_id, token, refresh_token, ip_address, user_agent, expires_at, created_at
+		SELECT `+sessionColumns+`
 		FROM sessions
 		WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP
 		ORDER BY created_at DESC
@@ -251,18 +415,5 @@ func (s *SQLiteDB) ListUserSessions(userID int64) ([]*models.Session, error) {
 	}
 	defer rows.Close()
 
-	var sessions []*models.Session
-	for rows.Next() {
-		session := &models.Session{}
-		err := rows.Scan(
-			&session.ID, &session.UserID, &session.Token, &session.RefreshToken,
-			&session.IPAddress, &session.UserAgent, &session.ExpiresAt, &session.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		sessions = append(sessions, session)
-	}
-
-	return sessions, rows.Err()
+	return scanSessions(rows)
 }
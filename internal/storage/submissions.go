@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// submissionBoxSelect selects submission boxes in the order
+// scanSubmissionBox expects, with their course name and submission count
+const submissionBoxSelect = `
+	SELECT b.id, b.course_id, c.name, b.title, b.description, b.deadline,
+		b.allowed_extensions, b.max_size, b.accept_late, COALESCE(b.created_by, 0),
+		(SELECT COUNT(*) FROM submissions s WHERE s.box_id = b.id),
+		b.created_at, b.updated_at
+	FROM submission_boxes b JOIN courses c ON c.id = b.course_id`
+
+// scanSubmissionBox scans a row selected with submissionBoxSelect into b
+func scanSubmissionBox(row rowScanner, b *models.SubmissionBox) error {
+	var extensions string
+	err := row.Scan(&b.ID, &b.CourseID, &b.CourseName, &b.Title, &b.Description, &b.Deadline,
+		&extensions, &b.MaxSize, &b.AcceptLate, &b.CreatedBy, &b.SubmissionCount,
+		&b.CreatedAt, &b.UpdatedAt)
+	b.AllowedExtensions = models.ParseExtensions(extensions)
+	return err
+}
+
+// scanSubmissionBoxes reads rows selected with submissionBoxSelect
+func scanSubmissionBoxes(rows rowIterator) ([]*models.SubmissionBox, error) {
+	boxes := []*models.SubmissionBox{}
+	for rows.Next() {
+		b := &models.SubmissionBox{}
+		if err := scanSubmissionBox(rows, b); err != nil {
+			return nil, err
+		}
+		boxes = append(boxes, b)
+	}
+	return boxes, rows.Err()
+}
+
+// formatExtensions stores an extension list as comma-separated text
+func formatExtensions(exts []string) string {
+	return strings.Join(exts, ",")
+}
+
+// submissionSelect selects submissions in the order scanSubmission expects,
+// with the submitting user's email and name
+const submissionSelect = `
+	SELECT s.id, s.box_id, s.user_id, u.email, COALESCE(u.full_name, ''), s.file_path,
+		s.file_name, s.file_size, s.blake3_hash, s.sha256_hash, s.late, s.submitted_at
+	FROM submissions s JOIN users u ON u.id = s.user_id`
+
+// scanSubmission scans a row selected with submissionSelect into sub
+func scanSubmission(row rowScanner, sub *models.Submission) error {
+	return row.Scan(&sub.ID, &sub.BoxID, &sub.UserID, &sub.UserEmail, &sub.UserName, &sub.FilePath,
+		&sub.FileName, &sub.FileSize, &sub.BLAKE3Hash, &sub.SHA256Hash, &sub.Late, &sub.SubmittedAt)
+}
+
+// scanSubmissions reads rows selected with submissionSelect
+func scanSubmissions(rows rowIterator) ([]*models.Submission, error) {
+	submissions := []*models.Submission{}
+	for rows.Next() {
+		sub := &models.Submission{}
+		if err := scanSubmission(rows, sub); err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, sub)
+	}
+	return submissions, rows.Err()
+}
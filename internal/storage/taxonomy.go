@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// tagBatchSize bounds the IDs bound in one tag lookup, well under SQLite's
+// limit on statement parameters
+const tagBatchSize = 500
+
+// tagBatches splits packages into groups loaded by a single tag query
+func tagBatches(packages []*models.Package) [][]*models.Package {
+	var batches [][]*models.Package
+	for len(packages) > tagBatchSize {
+		batches = append(batches, packages[:tagBatchSize])
+		packages = packages[tagBatchSize:]
+	}
+	if len(packages) > 0 {
+		batches = append(batches, packages)
+	}
+	return batches
+}
+
+// packageTagsSQL selects the package ID and tag name of every tag on batch
+func packageTagsSQL(batch []*models.Package, a *queryArgs) string {
+	ids := make([]string, len(batch))
+	for i, pkg := range batch {
+		ids[i] = a.bind(pkg.ID)
+	}
+	return `
+		SELECT pt.package_id, t.name
+		FROM package_tags pt JOIN tags t ON t.id = pt.tag_id
+		WHERE pt.package_id IN (` + strings.Join(ids, ", ") + `)
+		ORDER BY t.name`
+}
+
+// scanPackageTags reads rows from packageTagsSQL onto the packages of batch
+func scanPackageTags(rows rowIterator, batch []*models.Package) error {
+	byID := make(map[int64]*models.Package, len(batch))
+	for _, pkg := range batch {
+		pkg.Tags = nil
+		byID[pkg.ID] = pkg
+	}
+
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		if pkg := byID[id]; pkg != nil {
+			pkg.Tags = append(pkg.Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+// tagCountsSQL counts packages per tag among those matching the filters in
+// q, most used first
+func tagCountsSQL(q *PackageQuery, a *queryArgs) string {
+	return `
+		SELECT t.name, COUNT(*) AS packages
+		FROM tags t JOIN package_tags pt ON pt.tag_id = t.id
+		WHERE pt.package_id IN (SELECT id FROM packages WHERE ` + packageFilters(q, a) + `)
+		GROUP BY t.name
+		ORDER BY packages DESC, t.name`
+}
+
+// scanTagCounts reads rows from tagCountsSQL
+func scanTagCounts(rows rowIterator) ([]*models.Tag, error) {
+	tags := []*models.Tag{}
+	for rows.Next() {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// categoryColumns lists category columns in the order scanCategory expects,
+// including the number of published packages using each one
+const categoryColumns = `id, slug, name, color, icon, moderated,
+	(SELECT COUNT(*) FROM packages
+	 WHERE packages.category = categories.slug AND packages.status = 'published'
+	   AND packages.deleted_at IS NULL),
+	created_at, updated_at`
+
+// scanCategory scans a row selected with categoryColumns into c
+func scanCategory(row rowScanner, c *models.Category) error {
+	return row.Scan(&c.ID, &c.Slug, &c.Name, &c.Color, &c.Icon, &c.Moderated, &c.Count,
+		&c.CreatedAt, &c.UpdatedAt)
+}
+
+// searchResultPackages returns the packages of results
+func searchResultPackages(results []*models.SearchResult) []*models.Package {
+	packages := make([]*models.Package, len(results))
+	for i, result := range results {
+		packages[i] = result.Package
+	}
+	return packages
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/jesus/FCCUR/internal/models"
+)
+
+// UserQuery filters and paginates the user list, ordered by email. Empty
+// filters match everything.
+type UserQuery struct {
+	Search string          // Substring of the email or full name, case-insensitive
+	Role   models.UserRole // Only users with this role
+	Active *bool           // Only active (true) or deactivated (false) users
+	Limit  int
+	Offset int
+}
+
+// UserPage is one page of the user list
+type UserPage struct {
+	Users []*models.User
+	Total int64 // Users matching the filters, across all pages
+}
+
+// userColumns lists user columns in the order scanUser expects. Optional
+// columns are NULL until first set, e.g. reset_token before any reset.
+const userColumns = `id, email, password_hash, COALESCE(full_name, ''), COALESCE(role, 'student'),
+	is_active, is_admin, email_verified, COALESCE(verification_token, ''), verification_token_expiry,
+	COALESCE(reset_token, ''), reset_token_expiry, COALESCE(mfa_secret, ''), COALESCE(mfa_enabled, FALSE),
+	COALESCE(mfa_last_step, 0), last_login, created_at, updated_at`
+
+// scanUser scans a row selected with userColumns into user
+func scanUser(row rowScanner, user *models.User) error {
+	var verificationTokenExpiry, resetTokenExpiry, lastLogin sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.Email, &user.PasswordHash, &user.FullName,
+		&user.Role,
+		&user.IsActive, &user.IsAdmin, &user.EmailVerified, &user.VerificationToken, &verificationTokenExpiry,
+		&user.ResetToken, &resetTokenExpiry, &user.MFASecret, &user.MFAEnabled,
+		&user.MFALastStep, &lastLogin,
+		&user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	user.VerificationTokenExpiry = verificationTokenExpiry.Time
+	user.ResetTokenExpiry = resetTokenExpiry.Time
+	user.LastLogin = lastLogin.Time
+	return nil
+}
+
+// sessionColumns lists session columns in the order scanSession expects.
+// Sessions from before access tokens carried a jti have none.
+const sessionColumns = `id, user_id, COALESCE(jti, ''), COALESCE(family_id, ''), token, refresh_token,
+	COALESCE(ip_address, ''), COALESCE(user_agent, ''), expires_at, refresh_expires_at, created_at`
+
+// scanSession scans a row selected with sessionColumns into session
+func scanSession(row rowScanner, session *models.Session) error {
+	return row.Scan(
+		&session.ID, &session.UserID, &session.JTI, &session.FamilyID, &session.Token, &session.RefreshToken,
+		&session.IPAddress, &session.UserAgent, &session.ExpiresAt, &session.RefreshExpiresAt, &session.CreatedAt,
+	)
+}
+
+// scanSessions reads rows selected with sessionColumns
+func scanSessions(rows rowIterator) ([]*models.Session, error) {
+	var sessions []*models.Session
+	for rows.Next() {
+		session := &models.Session{}
+		if err := scanSession(rows, session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// rotatedRefreshTokenColumns lists rotated refresh token columns in the
+// order scanRotatedRefreshToken expects
+const rotatedRefreshTokenColumns = `token_hash, family_id, user_id, expires_at, rotated_at`
+
+// scanRotatedRefreshToken scans a row selected with
+// rotatedRefreshTokenColumns into t
+func scanRotatedRefreshToken(row rowScanner, t *models.RotatedRefreshToken) error {
+	return row.Scan(&t.TokenHash, &t.FamilyID, &t.UserID, &t.ExpiresAt, &t.RotatedAt)
+}
+
+// userFilters returns the WHERE conditions for the filters in q
+func userFilters(q *UserQuery, a *queryArgs) string {
+	conds := []string{"1 = 1"}
+	if q.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(q.Search)) + "%"
+		conds = append(conds, `(lower(email) LIKE `+a.bind(pattern)+` ESCAPE '\' OR lower(COALESCE(full_name, '')) LIKE `+
+			a.bind(pattern)+` ESCAPE '\')`)
+	}
+	if q.Role != "" {
+		conds = append(conds, `role = `+a.bind(string(q.Role)))
+	}
+	if q.Active != nil {
+		conds = append(conds, `is_active = `+a.bind(*q.Active))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// likeEscaper escapes LIKE wildcards so search text matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// userListSQL builds the page query for q
+func userListSQL(q *UserQuery, a *queryArgs) string {
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + userFilters(q, a)
+	return query + ` ORDER BY lower(email), id LIMIT ` + a.bind(q.Limit) + ` OFFSET ` + a.bind(q.Offset)
+}
+
+// scanUsers reads rows selected with userColumns
+func scanUsers(rows rowIterator) ([]*models.User, error) {
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		if err := scanUser(rows, user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
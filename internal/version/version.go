@@ -0,0 +1,208 @@
+// Package version orders free-text package versions. Semantic versions
+// ("1.85.0", "v2.1", "3.0.0-rc.1") are compared by semver rules; anything
+// else ("2024-R2", "jdk8u392") falls back to natural ordering where digit
+// runs compare numerically.
+package version
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version
+type semver struct {
+	core       [3]int
+	prerelease []string
+}
+
+// Compare returns -1, 0 or 1 as a is older than, equal to or newer than b
+func Compare(a, b string) int {
+	va, okA := parseSemver(a)
+	vb, okB := parseSemver(b)
+	if okA && okB {
+		return compareSemver(va, vb)
+	}
+	return compareLoose(a, b)
+}
+
+// Newer reports whether a is a newer version than b
+func Newer(a, b string) bool {
+	return Compare(a, b) > 0
+}
+
+// parseSemver accepts MAJOR[.MINOR[.PATCH]][-PRERELEASE][+BUILD] with an
+// optional leading "v"
+func parseSemver(s string) (semver, bool) {
+	var v semver
+
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+
+	// Build metadata does not affect precedence
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if i == len(s)-1 {
+			return v, false
+		}
+		v.prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	// A bare number with a suffix ("2024-R2") is a release scheme of its
+	// own, not a pre-release of "2024"
+	if len(parts) == 1 && v.prerelease != nil {
+		return v, false
+	}
+	for i, part := range parts {
+		n, ok := parseNumber(part)
+		if !ok {
+			return v, false
+		}
+		v.core[i] = n
+	}
+
+	for _, id := range v.prerelease {
+		if id == "" {
+			return v, false
+		}
+	}
+
+	return v, true
+}
+
+func compareSemver(a, b semver) int {
+	for i := range a.core {
+		if c := compareInt(a.core[i], b.core[i]); c != 0 {
+			return c
+		}
+	}
+
+	// A release is newer than any of its pre-releases
+	switch {
+	case len(a.prerelease) == 0 && len(b.prerelease) == 0:
+		return 0
+	case len(a.prerelease) == 0:
+		return 1
+	case len(b.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		idA, idB := a.prerelease[i], b.prerelease[i]
+		nA, numA := parseNumber(idA)
+		nB, numB := parseNumber(idB)
+
+		var c int
+		switch {
+		case numA && numB:
+			c = compareInt(nA, nB)
+		case numA:
+			c = -1 // Numeric identifiers sort before alphanumeric ones
+		case numB:
+			c = 1
+		default:
+			c = compareLoose(idA, idB) // "rc10" is newer than "rc2"
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return compareInt(len(a.prerelease), len(b.prerelease))
+}
+
+// compareLoose splits both strings into digit and non-digit runs and
+// compares them pairwise, numbers numerically and text case-insensitively
+func compareLoose(a, b string) int {
+	ta, tb := tokenize(a), tokenize(b)
+
+	for i := 0; i < len(ta) && i < len(tb); i++ {
+		nA, numA := parseNumber(ta[i])
+		nB, numB := parseNumber(tb[i])
+
+		var c int
+		switch {
+		case numA && numB:
+			c = compareInt(nA, nB)
+			if c == 0 {
+				// "007" and "7": prefer the shorter spelling for a stable order
+				c = compareInt(len(tb[i]), len(ta[i]))
+			}
+		case numA:
+			c = 1 // "1.2.3" is newer than "1.2.beta"
+		case numB:
+			c = -1
+		default:
+			c = strings.Compare(strings.ToLower(ta[i]), strings.ToLower(tb[i]))
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return compareInt(len(ta), len(tb))
+}
+
+// tokenize splits s into alternating runs of digits and non-digits,
+// dropping separator punctuation
+func tokenize(s string) []string {
+	var tokens []string
+	var current strings.Builder
+	digits := false
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r == '.' || r == '-' || r == '_' || r == ' ' || r == '+':
+			flush()
+		case r >= '0' && r <= '9':
+			if !digits {
+				flush()
+			}
+			digits = true
+			current.WriteRune(r)
+		default:
+			if digits {
+				flush()
+			}
+			digits = false
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+func parseNumber(s string) (int, bool) {
+	if s == "" || strings.Trim(s, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
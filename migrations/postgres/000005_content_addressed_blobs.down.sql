@@ -0,0 +1,8 @@
+-- Drop index
+DROP INDEX IF EXISTS idx_packages_file_path;
+
+-- Drop file_name column
+ALTER TABLE packages DROP COLUMN IF EXISTS file_name;
+
+-- Restore unique constraint (fails if packages still share a blob)
+ALTER TABLE packages ADD CONSTRAINT packages_file_path_key UNIQUE (file_path);
@@ -0,0 +1,9 @@
+-- Several packages may now share one content-addressed blob
+ALTER TABLE packages DROP CONSTRAINT IF EXISTS packages_file_path_key;
+
+-- Original upload filename, since file_path now points at a hash-named blob
+ALTER TABLE packages ADD COLUMN IF NOT EXISTS file_name VARCHAR(255) NOT NULL DEFAULT '';
+UPDATE packages SET file_name = regexp_replace(file_path, '^.*/', '') WHERE file_name = '';
+
+-- Index for blob reference counting
+CREATE INDEX IF NOT EXISTS idx_packages_file_path ON packages(file_path);
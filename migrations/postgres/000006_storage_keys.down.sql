@@ -0,0 +1,3 @@
+-- Restore filesystem paths relative to the default ./packages directory
+UPDATE packages SET file_path = 'packages/' || file_path WHERE file_path LIKE 'blobs/%';
+UPDATE packages SET thumbnail_path = 'packages/' || thumbnail_path WHERE thumbnail_path LIKE 'thumbnails/%';
@@ -0,0 +1,14 @@
+-- Field-level history of package metadata edits
+CREATE TABLE IF NOT EXISTS package_history (
+  id BIGSERIAL PRIMARY KEY,
+  package_id BIGINT NOT NULL,
+  user_id BIGINT,
+  field VARCHAR(50) NOT NULL,
+  old_value TEXT,
+  new_value TEXT,
+  changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (package_id) REFERENCES packages(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_history_package ON package_history(package_id);
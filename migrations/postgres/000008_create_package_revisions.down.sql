@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_package_revisions_file_path;
+DROP INDEX IF EXISTS idx_package_revisions_package;
+DROP TABLE IF EXISTS package_revisions;
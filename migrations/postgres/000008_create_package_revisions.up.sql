@@ -0,0 +1,17 @@
+-- Previous files of packages whose file was replaced
+CREATE TABLE IF NOT EXISTS package_revisions (
+  id BIGSERIAL PRIMARY KEY,
+  package_id BIGINT NOT NULL,
+  file_path VARCHAR(500) NOT NULL,
+  file_name VARCHAR(255) NOT NULL DEFAULT '',
+  file_size BIGINT NOT NULL,
+  blake3_hash VARCHAR(64) NOT NULL,
+  sha256_hash VARCHAR(64) NOT NULL,
+  replaced_by BIGINT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (package_id) REFERENCES packages(id) ON DELETE CASCADE,
+  FOREIGN KEY (replaced_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_revisions_package ON package_revisions(package_id);
+CREATE INDEX IF NOT EXISTS idx_package_revisions_file_path ON package_revisions(file_path);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_packages_search;
+ALTER TABLE packages DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE packages DROP COLUMN IF EXISTS readme_text;
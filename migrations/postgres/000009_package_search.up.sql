@@ -0,0 +1,13 @@
+-- README text extracted from package archives for full-text search.
+-- NULL means not extracted yet; '' means the package has no README.
+ALTER TABLE packages ADD COLUMN IF NOT EXISTS readme_text TEXT;
+
+-- Weighted Spanish document: name > description > course > README
+ALTER TABLE packages ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('spanish', coalesce(name, '')), 'A') ||
+  setweight(to_tsvector('spanish', coalesce(description, '')), 'B') ||
+  setweight(to_tsvector('spanish', coalesce(course_name, '')), 'C') ||
+  setweight(to_tsvector('spanish', coalesce(readme_text, '')), 'D')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_packages_search ON packages USING GIN(search_vector);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS update_categories_updated_at ON categories;
+DROP TABLE IF EXISTS categories;
+DROP INDEX IF EXISTS idx_package_tags_tag;
+DROP TABLE IF EXISTS package_tags;
+DROP TABLE IF EXISTS tags;
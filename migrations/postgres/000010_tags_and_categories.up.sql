@@ -0,0 +1,45 @@
+-- Free-form tags, linked many-to-many to packages
+CREATE TABLE IF NOT EXISTS tags (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(50) NOT NULL UNIQUE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS package_tags (
+  package_id BIGINT NOT NULL,
+  tag_id BIGINT NOT NULL,
+  PRIMARY KEY (package_id, tag_id),
+  FOREIGN KEY (package_id) REFERENCES packages(id) ON DELETE CASCADE,
+  FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_tags_tag ON package_tags(tag_id);
+
+-- Admin-managed category taxonomy; packages.category holds the slug
+CREATE TABLE IF NOT EXISTS categories (
+  id BIGSERIAL PRIMARY KEY,
+  slug VARCHAR(100) NOT NULL UNIQUE,
+  name VARCHAR(100) NOT NULL,
+  color VARCHAR(7) NOT NULL DEFAULT '#6b7280',
+  icon VARCHAR(20) NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_categories_updated_at
+  BEFORE UPDATE ON categories
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO categories (slug, name, color, icon) VALUES
+  ('os', 'Sistema Operativo', '#2563eb', 'OS'),
+  ('compiler', 'Compilador', '#10b981', '⚙️'),
+  ('ide', 'IDE', '#f59e0b', 'IDE'),
+  ('tool', 'Herramienta', '#6b7280', '🛠️'),
+  ('library', 'Biblioteca', '#8b5cf6', '📚')
+ON CONFLICT (slug) DO NOTHING;
+
+-- Keep categories already in use valid
+INSERT INTO categories (slug, name)
+  SELECT DISTINCT category, category FROM packages WHERE category IS NOT NULL AND category <> ''
+ON CONFLICT (slug) DO NOTHING;
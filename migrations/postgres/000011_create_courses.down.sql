@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_course_professors_user;
+DROP TABLE IF EXISTS course_professors;
+DROP TRIGGER IF EXISTS update_courses_updated_at ON courses;
+DROP TABLE IF EXISTS courses;
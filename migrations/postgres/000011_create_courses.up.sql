@@ -0,0 +1,36 @@
+-- Courses; packages.course_name refers to courses.name
+CREATE TABLE IF NOT EXISTS courses (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL UNIQUE,
+  code VARCHAR(50) NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_courses_updated_at
+  BEFORE UPDATE ON courses
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+-- Professors allowed to publish and edit materials of a course
+CREATE TABLE IF NOT EXISTS course_professors (
+  course_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (course_id, user_id),
+  FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_professors_user ON course_professors(user_id);
+
+-- Default course for materials uploaded without one
+INSERT INTO courses (name) VALUES ('General') ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO courses (name)
+  SELECT DISTINCT course_name FROM packages WHERE course_name IS NOT NULL AND course_name <> ''
+ON CONFLICT (name) DO NOTHING;
+
+-- users.assigned_courses is imported into course_professors by the server
+-- at startup, since it may hold a JSON array or a comma-separated list
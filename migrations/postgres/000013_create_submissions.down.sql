@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_submissions_file_path;
+DROP INDEX IF EXISTS idx_submissions_user;
+DROP TABLE IF EXISTS submissions;
+DROP TRIGGER IF EXISTS update_submission_boxes_updated_at ON submission_boxes;
+DROP INDEX IF EXISTS idx_submission_boxes_course;
+DROP TABLE IF EXISTS submission_boxes;
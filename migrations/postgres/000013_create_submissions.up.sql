@@ -0,0 +1,43 @@
+-- Assignment boxes students hand files in to
+CREATE TABLE IF NOT EXISTS submission_boxes (
+  id BIGSERIAL PRIMARY KEY,
+  course_id BIGINT NOT NULL,
+  title VARCHAR(255) NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  deadline TIMESTAMP WITH TIME ZONE NOT NULL,
+  allowed_extensions VARCHAR(500) NOT NULL DEFAULT '', -- Comma-separated, e.g. ".zip,.pdf"
+  max_size BIGINT NOT NULL DEFAULT 0,
+  accept_late BOOLEAN NOT NULL DEFAULT TRUE,
+  created_by BIGINT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (course_id) REFERENCES courses(id),
+  FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_submission_boxes_course ON submission_boxes(course_id);
+
+CREATE TRIGGER update_submission_boxes_updated_at
+  BEFORE UPDATE ON submission_boxes
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+-- One file per student and box; resubmitting replaces it
+CREATE TABLE IF NOT EXISTS submissions (
+  id BIGSERIAL PRIMARY KEY,
+  box_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  file_path VARCHAR(500) NOT NULL,
+  file_name VARCHAR(255) NOT NULL,
+  file_size BIGINT NOT NULL,
+  blake3_hash VARCHAR(64) NOT NULL,
+  sha256_hash VARCHAR(64) NOT NULL,
+  late BOOLEAN NOT NULL DEFAULT FALSE,
+  submitted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  UNIQUE (box_id, user_id),
+  FOREIGN KEY (box_id) REFERENCES submission_boxes(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_submissions_user ON submissions(user_id);
+CREATE INDEX IF NOT EXISTS idx_submissions_file_path ON submissions(file_path);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_notifications_user;
+DROP TABLE IF EXISTS notifications;
+ALTER TABLE categories DROP COLUMN IF EXISTS moderated;
+DROP INDEX IF EXISTS idx_packages_status;
+ALTER TABLE packages DROP COLUMN IF EXISTS reviewed_at;
+ALTER TABLE packages DROP COLUMN IF EXISTS reviewed_by;
+ALTER TABLE packages DROP COLUMN IF EXISTS review_reason;
+ALTER TABLE packages DROP COLUMN IF EXISTS uploaded_by;
+ALTER TABLE packages DROP COLUMN IF EXISTS status;
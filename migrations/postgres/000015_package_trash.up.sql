@@ -0,0 +1,6 @@
+-- Deleted packages stay in the trash, with their files and download
+-- history, until restored or purged after the retention period
+ALTER TABLE packages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE packages ADD COLUMN IF NOT EXISTS deleted_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_packages_deleted_at ON packages(deleted_at);
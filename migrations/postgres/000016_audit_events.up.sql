@@ -0,0 +1,19 @@
+-- Security-relevant and administrative actions. Rows are never updated;
+-- actor_email is kept so events survive the actor's deletion.
+CREATE TABLE IF NOT EXISTS audit_events (
+  id BIGSERIAL PRIMARY KEY,
+  actor_id BIGINT,
+  actor_email VARCHAR(255) NOT NULL DEFAULT '',
+  action VARCHAR(50) NOT NULL,
+  target_type VARCHAR(50) NOT NULL DEFAULT '',
+  target_id VARCHAR(255) NOT NULL DEFAULT '',
+  ip_address VARCHAR(45) NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  diff JSONB,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id);
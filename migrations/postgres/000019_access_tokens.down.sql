@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_access_tokens_user;
+DROP TABLE IF EXISTS access_tokens;
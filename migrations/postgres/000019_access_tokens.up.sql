@@ -0,0 +1,17 @@
+-- Personal access tokens for scripts, stored as SHA-256 hashes. courses
+-- limits an upload-scoped token to some courses (JSON array, empty for any).
+CREATE TABLE IF NOT EXISTS access_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  token_prefix VARCHAR(20) NOT NULL,
+  scope VARCHAR(20) NOT NULL,
+  courses TEXT NOT NULL DEFAULT '',
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  last_used_at TIMESTAMP WITH TIME ZONE,
+  last_used_ip VARCHAR(45),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_tokens_user ON access_tokens(user_id);
@@ -0,0 +1,5 @@
+-- Access tokens name their session in the jti claim, so that ending the
+-- session revokes the token. Sessions from before have none.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS jti VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_jti ON sessions(jti);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS rotated_refresh_tokens;
+DROP INDEX IF EXISTS idx_sessions_family_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS refresh_expires_at;
+ALTER TABLE sessions DROP COLUMN IF EXISTS family_id;
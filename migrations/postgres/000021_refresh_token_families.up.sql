@@ -0,0 +1,22 @@
+-- Refresh tokens rotate within the family of sessions started by one login,
+-- which expires refresh_expires_at. Rotated tokens are kept as SHA-256
+-- hashes until then, so that reusing one, a sign it was stolen, ends the
+-- family. Sessions from before get a family of their own and the default
+-- 30 days.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS family_id VARCHAR(64);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS refresh_expires_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE sessions SET family_id = 'session-' || id, refresh_expires_at = created_at + INTERVAL '30 days'
+  WHERE family_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions(family_id);
+
+CREATE TABLE IF NOT EXISTS rotated_refresh_tokens (
+  token_hash VARCHAR(64) PRIMARY KEY,
+  family_id VARCHAR(64) NOT NULL,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  rotated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rotated_refresh_tokens_expires_at ON rotated_refresh_tokens(expires_at);
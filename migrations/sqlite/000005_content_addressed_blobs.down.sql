@@ -0,0 +1,41 @@
+-- Restore the unique file_path constraint and drop file_name
+CREATE TABLE packages_old (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  version TEXT NOT NULL,
+  description TEXT,
+  category TEXT NOT NULL,
+  content_type TEXT NOT NULL DEFAULT 'tool',
+  course_name TEXT,
+  file_path TEXT NOT NULL UNIQUE,
+  file_size INTEGER NOT NULL,
+  blake3_hash TEXT NOT NULL,
+  sha256_hash TEXT NOT NULL,
+  download_url TEXT,
+  platform TEXT,
+  thumbnail_path TEXT,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Packages sharing a blob collapse to the oldest row
+INSERT OR IGNORE INTO packages_old (
+  id, name, version, description, category, content_type, course_name,
+  file_path, file_size, blake3_hash, sha256_hash, download_url,
+  platform, thumbnail_path, created_at, updated_at
+)
+SELECT
+  id, name, version, description, category, content_type, course_name,
+  file_path, file_size, blake3_hash, sha256_hash, download_url,
+  platform, thumbnail_path, created_at, updated_at
+FROM packages
+ORDER BY id;
+
+DROP TABLE packages;
+ALTER TABLE packages_old RENAME TO packages;
+
+-- Recreate indexes for packages
+CREATE INDEX IF NOT EXISTS idx_packages_category ON packages(category);
+CREATE INDEX IF NOT EXISTS idx_packages_platform ON packages(platform);
+CREATE INDEX IF NOT EXISTS idx_packages_content_type ON packages(content_type);
+CREATE INDEX IF NOT EXISTS idx_packages_course_name ON packages(course_name);
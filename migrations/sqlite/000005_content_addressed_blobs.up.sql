@@ -0,0 +1,45 @@
+-- Several packages may now share one content-addressed blob, so file_path is
+-- no longer unique. SQLite cannot drop a constraint, so rebuild the table.
+CREATE TABLE packages_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  version TEXT NOT NULL,
+  description TEXT,
+  category TEXT NOT NULL,
+  content_type TEXT NOT NULL DEFAULT 'tool',
+  course_name TEXT,
+  file_path TEXT NOT NULL,
+  file_name TEXT NOT NULL DEFAULT '',
+  file_size INTEGER NOT NULL,
+  blake3_hash TEXT NOT NULL,
+  sha256_hash TEXT NOT NULL,
+  download_url TEXT,
+  platform TEXT,
+  thumbnail_path TEXT,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Copy rows, deriving file_name from the basename of file_path
+INSERT INTO packages_new (
+  id, name, version, description, category, content_type, course_name,
+  file_path, file_name, file_size, blake3_hash, sha256_hash, download_url,
+  platform, thumbnail_path, created_at, updated_at
+)
+SELECT
+  id, name, version, description, category, content_type, course_name,
+  file_path, replace(file_path, rtrim(file_path, replace(file_path, '/', '')), ''),
+  file_size, blake3_hash, sha256_hash, download_url,
+  platform, thumbnail_path, created_at, updated_at
+FROM packages;
+
+DROP TABLE packages;
+ALTER TABLE packages_new RENAME TO packages;
+
+-- Recreate indexes for packages
+CREATE INDEX IF NOT EXISTS idx_packages_category ON packages(category);
+CREATE INDEX IF NOT EXISTS idx_packages_platform ON packages(platform);
+CREATE INDEX IF NOT EXISTS idx_packages_content_type ON packages(content_type);
+CREATE INDEX IF NOT EXISTS idx_packages_course_name ON packages(course_name);
+CREATE INDEX IF NOT EXISTS idx_packages_file_path ON packages(file_path);
+CREATE INDEX IF NOT EXISTS idx_packages_blake3 ON packages(blake3_hash);
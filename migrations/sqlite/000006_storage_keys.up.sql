@@ -0,0 +1,9 @@
+-- Package files and thumbnails are now addressed by storage keys relative to
+-- the storage backend root instead of filesystem paths.
+UPDATE packages
+SET file_path = 'blobs/' || substr(blake3_hash, 1, 2) || '/' || substr(blake3_hash, 3, 2) || '/' || blake3_hash
+WHERE file_path LIKE '%blobs/' || substr(blake3_hash, 1, 2) || '/' || substr(blake3_hash, 3, 2) || '/' || blake3_hash;
+
+UPDATE packages
+SET thumbnail_path = 'thumbnails/' || replace(thumbnail_path, rtrim(thumbnail_path, replace(thumbnail_path, '/', '')), '')
+WHERE thumbnail_path LIKE '%/thumbnails/%';
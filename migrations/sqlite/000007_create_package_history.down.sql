@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_package_history_package;
+DROP TABLE IF EXISTS package_history;
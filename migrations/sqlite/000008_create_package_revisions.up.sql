@@ -0,0 +1,17 @@
+-- Previous files of packages whose file was replaced
+CREATE TABLE IF NOT EXISTS package_revisions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  package_id INTEGER NOT NULL,
+  file_path TEXT NOT NULL,
+  file_name TEXT NOT NULL DEFAULT '',
+  file_size INTEGER NOT NULL,
+  blake3_hash TEXT NOT NULL,
+  sha256_hash TEXT NOT NULL,
+  replaced_by INTEGER,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (package_id) REFERENCES packages(id),
+  FOREIGN KEY (replaced_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_revisions_package ON package_revisions(package_id);
+CREATE INDEX IF NOT EXISTS idx_package_revisions_file_path ON package_revisions(file_path);
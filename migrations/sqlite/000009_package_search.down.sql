@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS packages_fts;
+ALTER TABLE packages DROP COLUMN readme_text;
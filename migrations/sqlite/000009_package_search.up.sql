@@ -0,0 +1,5 @@
+-- README text extracted from package archives for full-text search.
+-- NULL means not extracted yet; '' means the package has no README.
+-- The FTS5 index itself (packages_fts) is created by the server at startup
+-- because FTS5 support depends on how SQLite was compiled.
+ALTER TABLE packages ADD COLUMN readme_text TEXT;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS categories;
+DROP INDEX IF EXISTS idx_package_tags_tag;
+DROP TABLE IF EXISTS package_tags;
+DROP TABLE IF EXISTS tags;
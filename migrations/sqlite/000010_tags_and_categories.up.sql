@@ -0,0 +1,38 @@
+-- Free-form tags, linked many-to-many to packages
+CREATE TABLE IF NOT EXISTS tags (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL UNIQUE,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS package_tags (
+  package_id INTEGER NOT NULL,
+  tag_id INTEGER NOT NULL,
+  PRIMARY KEY (package_id, tag_id),
+  FOREIGN KEY (package_id) REFERENCES packages(id),
+  FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_tags_tag ON package_tags(tag_id);
+
+-- Admin-managed category taxonomy; packages.category holds the slug
+CREATE TABLE IF NOT EXISTS categories (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  color TEXT NOT NULL DEFAULT '#6b7280',
+  icon TEXT NOT NULL DEFAULT '',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO categories (slug, name, color, icon) VALUES
+  ('os', 'Sistema Operativo', '#2563eb', 'OS'),
+  ('compiler', 'Compilador', '#10b981', '⚙️'),
+  ('ide', 'IDE', '#f59e0b', 'IDE'),
+  ('tool', 'Herramienta', '#6b7280', '🛠️'),
+  ('library', 'Biblioteca', '#8b5cf6', '📚');
+
+-- Keep categories already in use valid
+INSERT OR IGNORE INTO categories (slug, name)
+  SELECT DISTINCT category, category FROM packages WHERE category IS NOT NULL AND category != '';
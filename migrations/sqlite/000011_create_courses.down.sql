@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_course_professors_user;
+DROP TABLE IF EXISTS course_professors;
+DROP TABLE IF EXISTS courses;
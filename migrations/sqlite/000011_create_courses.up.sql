@@ -0,0 +1,30 @@
+-- Courses; packages.course_name refers to courses.name
+CREATE TABLE IF NOT EXISTS courses (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL UNIQUE,
+  code TEXT NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT '',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Professors allowed to publish and edit materials of a course
+CREATE TABLE IF NOT EXISTS course_professors (
+  course_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (course_id, user_id),
+  FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_professors_user ON course_professors(user_id);
+
+-- Default course for materials uploaded without one
+INSERT OR IGNORE INTO courses (name) VALUES ('General');
+
+INSERT OR IGNORE INTO courses (name)
+  SELECT DISTINCT course_name FROM packages WHERE course_name IS NOT NULL AND course_name != '';
+
+-- users.assigned_courses is imported into course_professors by the server
+-- at startup, since it may hold a JSON array or a comma-separated list
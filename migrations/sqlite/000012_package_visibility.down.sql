@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_course_enrollments_user;
+DROP TABLE IF EXISTS course_enrollments;
+DROP INDEX IF EXISTS idx_packages_visibility;
+ALTER TABLE packages DROP COLUMN visibility;
@@ -0,0 +1,17 @@
+-- Who may see a package: public, authenticated, enrolled (students of its
+-- course and the course's professors) or staff (professors and admins)
+ALTER TABLE packages ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
+
+CREATE INDEX IF NOT EXISTS idx_packages_visibility ON packages(visibility);
+
+-- Students enrolled in a course, who may see its course-restricted packages
+CREATE TABLE IF NOT EXISTS course_enrollments (
+  course_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (course_id, user_id),
+  FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_enrollments_user ON course_enrollments(user_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_submissions_file_path;
+DROP INDEX IF EXISTS idx_submissions_user;
+DROP TABLE IF EXISTS submissions;
+DROP INDEX IF EXISTS idx_submission_boxes_course;
+DROP TABLE IF EXISTS submission_boxes;
@@ -0,0 +1,38 @@
+-- Assignment boxes students hand files in to
+CREATE TABLE IF NOT EXISTS submission_boxes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  course_id INTEGER NOT NULL,
+  title TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  deadline DATETIME NOT NULL,
+  allowed_extensions TEXT NOT NULL DEFAULT '', -- Comma-separated, e.g. ".zip,.pdf"
+  max_size INTEGER NOT NULL DEFAULT 0,
+  accept_late BOOLEAN NOT NULL DEFAULT 1,
+  created_by INTEGER,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (course_id) REFERENCES courses(id),
+  FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_submission_boxes_course ON submission_boxes(course_id);
+
+-- One file per student and box; resubmitting replaces it
+CREATE TABLE IF NOT EXISTS submissions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  box_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  file_path TEXT NOT NULL,
+  file_name TEXT NOT NULL,
+  file_size INTEGER NOT NULL,
+  blake3_hash TEXT NOT NULL,
+  sha256_hash TEXT NOT NULL,
+  late BOOLEAN NOT NULL DEFAULT 0,
+  submitted_at DATETIME NOT NULL,
+  UNIQUE (box_id, user_id),
+  FOREIGN KEY (box_id) REFERENCES submission_boxes(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_submissions_user ON submissions(user_id);
+CREATE INDEX IF NOT EXISTS idx_submissions_file_path ON submissions(file_path);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_notifications_user;
+DROP TABLE IF EXISTS notifications;
+ALTER TABLE categories DROP COLUMN moderated;
+DROP INDEX IF EXISTS idx_packages_status;
+ALTER TABLE packages DROP COLUMN reviewed_at;
+ALTER TABLE packages DROP COLUMN reviewed_by;
+ALTER TABLE packages DROP COLUMN review_reason;
+ALTER TABLE packages DROP COLUMN uploaded_by;
+ALTER TABLE packages DROP COLUMN status;
@@ -0,0 +1,27 @@
+-- Review state of uploads: published, pending (awaiting an admin) or
+-- rejected. Only published packages are listed publicly.
+ALTER TABLE packages ADD COLUMN status TEXT NOT NULL DEFAULT 'published';
+ALTER TABLE packages ADD COLUMN uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE packages ADD COLUMN review_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE packages ADD COLUMN reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE packages ADD COLUMN reviewed_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_packages_status ON packages(status);
+
+-- Uploads to a moderated category need approval
+ALTER TABLE categories ADD COLUMN moderated BOOLEAN NOT NULL DEFAULT 0;
+
+-- Messages for users, e.g. the outcome of a review
+CREATE TABLE IF NOT EXISTS notifications (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  kind TEXT NOT NULL,
+  message TEXT NOT NULL,
+  package_id INTEGER,
+  read_at DATETIME,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (package_id) REFERENCES packages(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at);
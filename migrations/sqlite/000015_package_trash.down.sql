@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_packages_deleted_at;
+ALTER TABLE packages DROP COLUMN deleted_by;
+ALTER TABLE packages DROP COLUMN deleted_at;
@@ -0,0 +1,6 @@
+-- Deleted packages stay in the trash, with their files and download
+-- history, until restored or purged after the retention period
+ALTER TABLE packages ADD COLUMN deleted_at DATETIME;
+ALTER TABLE packages ADD COLUMN deleted_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_packages_deleted_at ON packages(deleted_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_verification_token;
+ALTER TABLE users DROP COLUMN verification_token_expiry;
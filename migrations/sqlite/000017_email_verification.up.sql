@@ -0,0 +1,4 @@
+-- Verification links expire like password reset links
+ALTER TABLE users ADD COLUMN verification_token_expiry DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_users_verification_token ON users(verification_token);
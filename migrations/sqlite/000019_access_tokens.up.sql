@@ -0,0 +1,17 @@
+-- Personal access tokens for scripts, stored as SHA-256 hashes. courses
+-- limits an upload-scoped token to some courses (JSON array, empty for any).
+CREATE TABLE IF NOT EXISTS access_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  token_prefix TEXT NOT NULL,
+  scope TEXT NOT NULL,
+  courses TEXT NOT NULL DEFAULT '',
+  expires_at DATETIME NOT NULL,
+  last_used_at DATETIME,
+  last_used_ip TEXT,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_tokens_user ON access_tokens(user_id);
@@ -0,0 +1,22 @@
+-- Refresh tokens rotate within the family of sessions started by one login,
+-- which expires refresh_expires_at. Rotated tokens are kept as SHA-256
+-- hashes until then, so that reusing one, a sign it was stolen, ends the
+-- family. Sessions from before get a family of their own and the default
+-- 30 days.
+ALTER TABLE sessions ADD COLUMN family_id TEXT;
+ALTER TABLE sessions ADD COLUMN refresh_expires_at DATETIME;
+
+UPDATE sessions SET family_id = 'session-' || id, refresh_expires_at = datetime(created_at, '+30 days')
+  WHERE family_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions(family_id);
+
+CREATE TABLE IF NOT EXISTS rotated_refresh_tokens (
+  token_hash TEXT PRIMARY KEY,
+  family_id TEXT NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at DATETIME NOT NULL,
+  rotated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rotated_refresh_tokens_expires_at ON rotated_refresh_tokens(expires_at);
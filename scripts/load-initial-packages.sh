@@ -10,6 +10,8 @@ FCCUR_URL="${FCCUR_URL:-http://localhost:8080}"
 API_ENDPOINT="${FCCUR_URL}/api/upload"
 MATERIAL_DIR="${MATERIAL_DIR:-./Material}"
 TOOLS_DIR="${TOOLS_DIR:-./Tools}"
+# Personal access token with the upload scope (POST /api/auth/tokens)
+FCCUR_TOKEN="${FCCUR_TOKEN:-}"
 
 # Colors for output
 GREEN='\033[0;32m'
@@ -72,6 +74,7 @@ upload_material() {
 
     # Upload the file
     response=$(curl -s -w "\n%{http_code}" -X POST "$API_ENDPOINT" \
+        -H "Authorization: Bearer $FCCUR_TOKEN" \
         -F "content_type=material" \
         -F "course_name=$course_name" \
         -F "name=$name" \
@@ -106,6 +109,7 @@ upload_tool() {
 
     # Upload the file
     response=$(curl -s -w "\n%{http_code}" -X POST "$API_ENDPOINT" \
+        -H "Authorization: Bearer $FCCUR_TOKEN" \
         -F "content_type=tool" \
         -F "name=$name" \
         -F "version=$version" \
@@ -261,6 +265,10 @@ main() {
     # Check server connectivity
     check_server
 
+    if [ -z "$FCCUR_TOKEN" ]; then
+        print_warning "FCCUR_TOKEN is not set; uploads need a personal access token with the upload scope"
+    fi
+
     # Load materials
     if [ -d "$MATERIAL_DIR" ]; then
         load_all_materials
@@ -308,11 +316,13 @@ OPTIONS:
     -u, --url URL       FCCUR server URL (default: http://localhost:8080)
     -m, --materials DIR Material directory (default: ./Material)
     -t, --tools DIR     Tools directory (default: ./Tools)
+    -k, --token TOKEN   Personal access token with the upload scope
 
 ENVIRONMENT VARIABLES:
     FCCUR_URL           Server URL
     MATERIAL_DIR        Material directory path
     TOOLS_DIR           Tools directory path
+    FCCUR_TOKEN         Personal access token with the upload scope
 
 EXAMPLES:
     # Load with default settings
@@ -327,6 +337,11 @@ EXAMPLES:
     # Using environment variables
     FCCUR_URL=http://pi.local:8080 MATERIAL_DIR=/mnt/materials $0
 
+    # Create the token once while logged in, then reuse it
+    curl -X POST -H "Authorization: Bearer \$JWT" -H "Content-Type: application/json" \\
+        -d '{"name": "initial load", "scope": "upload"}' \$FCCUR_URL/api/auth/tokens
+    FCCUR_TOKEN=fccur_... $0
+
 MANIFEST FILE:
     Create a file named 'tools-manifest.txt' with the following format:
 
@@ -359,6 +374,10 @@ while [[ $# -gt 0 ]]; do
             TOOLS_DIR="$2"
             shift 2
             ;;
+        -k|--token)
+            FCCUR_TOKEN="$2"
+            shift 2
+            ;;
         *)
             echo "Unknown option: $1"
             usage
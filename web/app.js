@@ -1,15 +1,42 @@
 // API Base URL
 const API_BASE = '/api';
 
+// Packages fetched per page of the listing
+const PAGE_SIZE = 50;
+
+// Sort dropdown values mapped to /api/packages sort and order parameters
+const SORT_PARAMS = {
+    'date-desc': { sort: 'newest' },
+    'date-asc': { sort: 'newest', order: 'asc' },
+    'name-asc': { sort: 'name' },
+    'name-desc': { sort: 'name', order: 'desc' },
+    'size-desc': { sort: 'size' },
+    'size-asc': { sort: 'size', order: 'asc' },
+    'downloads-desc': { sort: 'downloads' }
+};
+
+// Visibility levels other than public, with their badge labels
+const VISIBILITY_LABELS = {
+    authenticated: '🔒 Usuarios registrados',
+    enrolled: '🔒 Inscritos en el curso',
+    staff: '🔒 Solo docentes'
+};
+
 // Global state
-let allPackages = [];
-let filteredPackages = [];
-let downloadStats = [];
+let packagesById = new Map(); // Every package loaded so far, for detail views
+let filteredPackages = [];    // Packages shown in the grid
+let nextCursor = null;        // Cursor for the next page of the grid, if any
+let libraryTotal = 0;         // Total packages in the repository
+let searchResults = null;     // Results of /api/search for the current query
+let searchTimer = null;
+let categories = new Map();   // Category taxonomy by slug
+let selectedTags = new Set(); // Tags every listed package must carry
+let courses = [];             // Registered courses, ordered by name
 
 // Initialize on page load
 document.addEventListener('DOMContentLoaded', () => {
-    loadPackages();
-    loadStats();
+    // Stats show the package total, which comes with the first listing
+    Promise.all([loadCategories(), loadCourses()]).finally(() => loadPackages().then(loadStats));
     setupEventListeners();
 });
 
@@ -17,7 +44,8 @@ document.addEventListener('DOMContentLoaded', () => {
 function setupEventListeners() {
     // Search input
     document.getElementById('search-input').addEventListener('input', (e) => {
-        filterPackages();
+        clearTimeout(searchTimer);
+        searchTimer = setTimeout(runSearch, 250);
     });
 
     // Content type filter
@@ -55,6 +83,9 @@ function setupEventListeners() {
         filterPackages();
     });
 
+    // Next page of the listing
+    document.getElementById('load-more').addEventListener('click', loadMorePackages);
+
     // Content type in upload form
     document.getElementById('package-content-type').addEventListener('change', (e) => {
         const courseNameGroup = document.getElementById('course-name-group');
@@ -86,17 +117,7 @@ function setupEventListeners() {
 async function loadPackages() {
     try {
         showLoading();
-        const response = await fetch(`${API_BASE}/packages`);
-
-        if (!response.ok) {
-            throw new Error('Error loading packages');
-        }
-
-        allPackages = await response.json() || [];
-        filteredPackages = [...allPackages];
-
-        // Load download stats for sorting
-        await loadStatsForSorting();
+        packagesById = new Map();
 
         // Restore sort preference
         const sortPreference = localStorage.getItem('fccur_sort_preference');
@@ -104,8 +125,13 @@ async function loadPackages() {
             document.getElementById('sort-filter').value = sortPreference;
         }
 
-        renderPackages();
-        renderRecentUploads();
+        // Latest uploads, which also gives the repository total
+        const recent = await fetchPackagePage(new URLSearchParams({ limit: 10 }));
+        libraryTotal = recent.total;
+        rememberPackages(recent.packages);
+        renderRecentUploads(recent.packages);
+
+        await filterPackages();
         hideLoading();
 
         // Initialize course filter visibility based on current content-type selection
@@ -116,15 +142,102 @@ async function loadPackages() {
     }
 }
 
-// Load stats for sorting purposes
-async function loadStatsForSorting() {
+// Authorization header for the logged-in user, if any; packages that are not
+// public are only listed and served to logged-in users
+function authHeaders() {
+    const token = localStorage.getItem('access_token');
+    return token ? { 'Authorization': `Bearer ${token}` } : {};
+}
+
+// fetch with the user's access token attached
+function apiFetch(url, options = {}) {
+    return fetch(url, { ...options, headers: { ...authHeaders(), ...(options.headers || {}) } });
+}
+
+// Whether a package needs a signed link for browser downloads and images
+function isRestricted(pkg) {
+    return pkg.visibility && pkg.visibility !== 'public';
+}
+
+// Fetch a short-lived signed link for a package that is not public
+async function fetchPackageLink(id) {
+    const response = await apiFetch(`${API_BASE}/packages/link?id=${id}`);
+    if (!response.ok) {
+        throw new Error('No tienes acceso a este paquete');
+    }
+    return response.json();
+}
+
+// Fetch one page of /api/packages
+async function fetchPackagePage(params) {
+    const response = await apiFetch(`${API_BASE}/packages?${params}`);
+
+    if (!response.ok) {
+        throw new Error('Error loading packages');
+    }
+
+    return response.json();
+}
+
+// Current dropdown filters, keyed by package field (and query parameter)
+function currentFilters() {
+    const inputs = {
+        content_type: 'content-type-filter',
+        category: 'category-filter',
+        course_name: 'course-filter',
+        platform: 'platform-filter'
+    };
+
+    const filters = {};
+    for (const [field, id] of Object.entries(inputs)) {
+        const value = document.getElementById(id).value;
+        if (value) filters[field] = value;
+    }
+    return filters;
+}
+
+// Query parameters for the current dropdown and tag filters
+function filterParams() {
+    const params = new URLSearchParams(currentFilters());
+    selectedTags.forEach(tag => params.append('tag', tag));
+    return params;
+}
+
+// Query parameters for the current filters and sort
+function listingParams(cursor) {
+    const params = filterParams();
+    const sort = SORT_PARAMS[document.getElementById('sort-filter').value] || SORT_PARAMS['date-desc'];
+
+    params.set('sort', sort.sort);
+    if (sort.order) params.set('order', sort.order);
+    params.set('limit', PAGE_SIZE);
+    if (cursor) params.set('cursor', cursor);
+
+    return params;
+}
+
+// Keep loaded packages available for the detail and download views
+function rememberPackages(packages) {
+    packages.forEach(pkg => packagesById.set(pkg.id, pkg));
+}
+
+// Append the next page of the listing to the grid
+async function loadMorePackages() {
+    if (!nextCursor) return;
+
+    const button = document.getElementById('load-more');
+    button.disabled = true;
+
     try {
-        const response = await fetch(`${API_BASE}/stats`);
-        if (response.ok) {
-            downloadStats = await response.json();
-        }
+        const page = await fetchPackagePage(listingParams(nextCursor));
+        filteredPackages = filteredPackages.concat(page.packages);
+        nextCursor = page.next_cursor || null;
+        rememberPackages(page.packages);
+        renderPackages();
     } catch (error) {
-        console.error('Error loading stats:', error);
+        showError('Error al cargar paquetes: ' + error.message);
+    } finally {
+        button.disabled = false;
     }
 }
 
@@ -133,6 +246,7 @@ function renderPackages() {
     const grid = document.getElementById('packages-grid');
     const noResults = document.getElementById('no-results');
     grid.innerHTML = '';
+    document.getElementById('load-more').style.display = nextCursor ? 'block' : 'none';
 
     if (filteredPackages.length === 0) {
         grid.style.display = 'none';
@@ -147,6 +261,7 @@ function renderPackages() {
         const card = createPackageCard(pkg);
         grid.appendChild(card);
     });
+    loadRestrictedThumbnails(grid);
 }
 
 // Create package card element
@@ -165,7 +280,7 @@ function createPackageCard(pkg, compact = false) {
 
     if (compact) {
         card.innerHTML = `
-            <img src="/api/thumbnail?id=${pkg.id}" alt="${escapeHtml(pkg.name)}" class="package-thumbnail-compact" loading="lazy">
+            ${thumbnailImage(pkg, 'package-thumbnail-compact')}
             <div class="package-header">
                 <h4>${escapeHtml(pkg.name)} v${escapeHtml(pkg.version)}</h4>
                 ${isNew ? '<span class="badge-new">NUEVO</span>' : ''}
@@ -178,13 +293,14 @@ function createPackageCard(pkg, compact = false) {
         `;
     } else {
         card.innerHTML = `
-            <img src="/api/thumbnail?id=${pkg.id}" alt="${escapeHtml(pkg.name)}" class="package-thumbnail" loading="lazy">
+            ${thumbnailImage(pkg, 'package-thumbnail')}
             <div class="package-header">
                 <h3>${escapeHtml(pkg.name)} ${isNew ? '<span class="badge-new">NUEVO</span>' : ''}</h3>
                 <span class="version">v${escapeHtml(pkg.version)}</span>
             </div>
             <div class="package-body">
                 ${pkg.course_name ? `<p class="course-badge">📖 ${escapeHtml(pkg.course_name)}</p>` : ''}
+                ${isRestricted(pkg) ? `<p class="visibility-badge">${VISIBILITY_LABELS[pkg.visibility] || '🔒'}</p>` : ''}
                 <p class="description">${escapeHtml(pkg.description) || 'Sin descripción'}</p>
                 <div class="package-meta">
                     <span>${contentTypeLabel}</span>
@@ -192,6 +308,7 @@ function createPackageCard(pkg, compact = false) {
                     <span>📦 ${size}</span>
                     <span>📂 ${category}</span>
                 </div>
+                ${renderTags(pkg.tags)}
             </div>
             <div class="package-footer">
                 <button class="btn-download" onclick="downloadPackage(${pkg.id})">
@@ -207,6 +324,27 @@ function createPackageCard(pkg, compact = false) {
     return card;
 }
 
+// Thumbnail image for a card; packages that are not public need a signed
+// link, which is fetched once the card is on the page
+function thumbnailImage(pkg, className) {
+    if (isRestricted(pkg)) {
+        return `<img alt="${escapeHtml(pkg.name)}" class="${className} thumbnail-restricted" data-package-id="${pkg.id}" loading="lazy">`;
+    }
+    return `<img src="/api/thumbnail?id=${pkg.id}" alt="${escapeHtml(pkg.name)}" class="${className}" loading="lazy">`;
+}
+
+// Load the thumbnails of restricted packages in a container through signed links
+function loadRestrictedThumbnails(container) {
+    container.querySelectorAll('img.thumbnail-restricted:not([src])').forEach(async img => {
+        try {
+            const link = await fetchPackageLink(img.dataset.packageId);
+            img.src = `/api/thumbnail?id=${img.dataset.packageId}&${link.query}`;
+        } catch (error) {
+            img.remove();
+        }
+    });
+}
+
 // Check if package is new (less than 7 days old)
 function isPackageNew(createdAt) {
     const packageDate = new Date(createdAt);
@@ -215,16 +353,11 @@ function isPackageNew(createdAt) {
     return daysDifference < 7;
 }
 
-// Render recent uploads
-function renderRecentUploads() {
+// Render recent uploads (the newest packages, as returned by the API)
+function renderRecentUploads(recentPackages) {
     const container = document.getElementById('recent-uploads');
     container.innerHTML = '';
 
-    // Get last 10 packages sorted by date
-    const recentPackages = [...allPackages]
-        .sort((a, b) => new Date(b.created_at) - new Date(a.created_at))
-        .slice(0, 10);
-
     if (recentPackages.length === 0) {
         container.innerHTML = '<p class="no-recent">No hay paquetes subidos recientemente</p>';
         return;
@@ -234,17 +367,18 @@ function renderRecentUploads() {
         const card = createPackageCard(pkg, true);
         container.appendChild(card);
     });
+    loadRestrictedThumbnails(container);
 }
 
 // Download package
 async function downloadPackage(id) {
     try {
-        const pkg = allPackages.find(p => p.id === id);
+        const pkg = packagesById.get(id);
         if (!pkg) return;
 
-        // Create download link
+        // Create download link; restricted packages need a signed one
         const a = document.createElement('a');
-        a.href = `/download/?id=${id}`;
+        a.href = isRestricted(pkg) ? (await fetchPackageLink(id)).url : `/download/?id=${id}`;
         a.download = `${pkg.name}-${pkg.version}`;
         document.body.appendChild(a);
         a.click();
@@ -261,7 +395,7 @@ async function downloadPackage(id) {
 
 // Show package info modal
 function showPackageInfo(id) {
-    const pkg = allPackages.find(p => p.id === id);
+    const pkg = packagesById.get(id);
     if (!pkg) return;
 
     const modalBody = document.getElementById('modal-body');
@@ -290,6 +424,12 @@ function showPackageInfo(id) {
                 <strong>Categoría:</strong>
                 ${getCategoryName(pkg.category)}
             </div>
+            ${pkg.tags && pkg.tags.length ? `
+            <div class="info-item">
+                <strong>Etiquetas:</strong>
+                ${renderTags(pkg.tags)}
+            </div>
+            ` : ''}
             <div class="info-item">
                 <strong>Plataforma:</strong>
                 ${escapeHtml(pkg.platform)}
@@ -360,6 +500,15 @@ function showPackageInfo(id) {
         }
     }
 
+    // Checksum files of restricted packages are served through a signed link
+    if (isRestricted(pkg)) {
+        fetchPackageLink(pkg.id).then(link => {
+            modalBody.querySelectorAll('a.btn-checksum').forEach(a => {
+                a.href += `&${link.query}`;
+            });
+        }).catch(() => {});
+    }
+
     document.getElementById('modal').style.display = 'flex';
 }
 
@@ -372,7 +521,7 @@ async function loadArchiveContents(id) {
         button.disabled = true;
         button.textContent = 'Cargando...';
 
-        const response = await fetch(`${API_BASE}/archive/contents?id=${id}`);
+        const response = await apiFetch(`${API_BASE}/archive/contents?id=${id}`);
         if (!response.ok) {
             throw new Error('Error al cargar contenido del archivo');
         }
@@ -431,93 +580,136 @@ function closeModal() {
     document.getElementById('modal').style.display = 'none';
 }
 
-// Filter packages
-function filterPackages() {
-    const search = document.getElementById('search-input').value.toLowerCase();
-    const contentType = document.getElementById('content-type-filter').value;
-    const category = document.getElementById('category-filter').value;
-    const course = document.getElementById('course-filter').value;
-    const platform = document.getElementById('platform-filter').value;
-    const sortBy = document.getElementById('sort-filter').value;
-
-    filteredPackages = allPackages.filter(pkg => {
-        const matchesSearch = !search ||
-            pkg.name.toLowerCase().includes(search) ||
-            (pkg.description && pkg.description.toLowerCase().includes(search)) ||
-            (pkg.course_name && pkg.course_name.toLowerCase().includes(search));
+// Run a server-side full-text search (stemming, README contents)
+async function runSearch() {
+    const query = document.getElementById('search-input').value.trim();
+    if (!query) {
+        searchResults = null;
+        filterPackages();
+        return;
+    }
 
-        const matchesContentType = !contentType || pkg.content_type === contentType;
-        const matchesCategory = !category || pkg.category === category;
-        const matchesCourse = !course || pkg.course_name === course;
-        const matchesPlatform = !platform || pkg.platform === platform;
+    try {
+        const response = await apiFetch(`${API_BASE}/search?q=${encodeURIComponent(query)}&limit=100`);
+        if (!response.ok) throw new Error('Error en la búsqueda');
+        const data = await response.json();
+        searchResults = data.results;
+    } catch (error) {
+        // Fall back to the plain listing
+        searchResults = null;
+    }
+    filterPackages();
+}
 
-        return matchesSearch && matchesContentType && matchesCategory && matchesCourse && matchesPlatform;
-    });
+// Filter packages: a server-side listing, or the search results (in
+// relevance order) narrowed down by the dropdown filters
+async function filterPackages() {
+    const search = document.getElementById('search-input').value.trim();
 
-    // Apply sorting
-    sortPackages(filteredPackages, sortBy);
+    try {
+        if (search && searchResults) {
+            const filters = Object.entries(currentFilters());
+            filteredPackages = searchResults.filter(pkg =>
+                filters.every(([field, value]) => pkg[field] === value) &&
+                [...selectedTags].every(tag => (pkg.tags || []).includes(tag)));
+            nextCursor = null;
+        } else {
+            const page = await fetchPackagePage(listingParams());
+            filteredPackages = page.packages;
+            nextCursor = page.next_cursor || null;
+        }
+    } catch (error) {
+        showError('Error al cargar paquetes: ' + error.message);
+        return;
+    }
 
+    rememberPackages(filteredPackages);
     renderPackages();
+    loadTagFacets();
 }
 
-// Sort packages based on selected criteria
-function sortPackages(packages, sortBy) {
-    switch (sortBy) {
-        case 'date-desc':
-            packages.sort((a, b) => new Date(b.created_at) - new Date(a.created_at));
-            break;
-        case 'date-asc':
-            packages.sort((a, b) => new Date(a.created_at) - new Date(b.created_at));
-            break;
-        case 'name-asc':
-            packages.sort((a, b) => a.name.localeCompare(b.name));
-            break;
-        case 'name-desc':
-            packages.sort((a, b) => b.name.localeCompare(a.name));
-            break;
-        case 'size-desc':
-            packages.sort((a, b) => b.file_size - a.file_size);
-            break;
-        case 'size-asc':
-            packages.sort((a, b) => a.file_size - b.file_size);
-            break;
-        case 'downloads-desc':
-            packages.sort((a, b) => {
-                const aDownloads = getDownloadCount(a.id);
-                const bDownloads = getDownloadCount(b.id);
-                return bDownloads - aDownloads;
-            });
-            break;
-        default:
-            packages.sort((a, b) => new Date(b.created_at) - new Date(a.created_at));
+// Load the category taxonomy and fill the category dropdowns
+async function loadCategories() {
+    try {
+        const response = await fetch(`${API_BASE}/categories`);
+        if (!response.ok) throw new Error('Error loading categories');
+        const list = await response.json();
+
+        categories = new Map(list.map(c => [c.slug, c]));
+        for (const id of ['category-filter', 'package-category']) {
+            const select = document.getElementById(id);
+            select.length = 1; // Keep the placeholder option
+            list.forEach(c => select.add(new Option(c.name, c.slug)));
+        }
+    } catch (error) {
+        console.error('Error loading categories:', error);
+    }
+}
+
+// Show the tags of packages matching the current filters, with counts
+async function loadTagFacets() {
+    const container = document.getElementById('tag-facets');
+
+    try {
+        const response = await apiFetch(`${API_BASE}/tags?${filterParams()}`);
+        if (!response.ok) throw new Error('Error loading tags');
+        const tags = await response.json();
+
+        container.innerHTML = '';
+        tags.forEach(tag => {
+            const chip = document.createElement('button');
+            chip.className = 'tag-chip' + (selectedTags.has(tag.name) ? ' active' : '');
+            chip.textContent = `#${tag.name} (${tag.count})`;
+            chip.addEventListener('click', () => toggleTag(tag.name));
+            container.appendChild(chip);
+        });
+    } catch (error) {
+        container.innerHTML = '';
+    }
+}
+
+// Add or remove a tag from the active filters
+function toggleTag(tag) {
+    if (selectedTags.has(tag)) {
+        selectedTags.delete(tag);
+    } else {
+        selectedTags.add(tag);
     }
+    filterPackages();
 }
 
-// Get download count for a package
-function getDownloadCount(packageId) {
-    const stat = downloadStats.find(s => s.package_id === packageId);
-    return stat ? stat.total_downloads : 0;
+// Render tags as chips
+function renderTags(tags) {
+    if (!tags || tags.length === 0) return '';
+    return `<div class="package-tags">${tags.map(tag =>
+        `<span class="tag-chip">#${escapeHtml(tag)}</span>`).join('')}</div>`;
 }
 
-// Populate course filter with unique course names
+// Load the registered courses for the course filter and upload form
+async function loadCourses() {
+    try {
+        const response = await fetch(`${API_BASE}/courses`);
+        if (!response.ok) throw new Error('Error loading courses');
+        courses = await response.json();
+
+        const select = document.getElementById('package-course-name');
+        select.length = 1; // Keep the "General" default option
+        courses.filter(c => c.name !== 'General').forEach(c => select.add(new Option(c.code ? `${c.name} (${c.code})` : c.name, c.name)));
+        populateCourseFilter();
+    } catch (error) {
+        console.error('Error loading courses:', error);
+    }
+}
+
+// Populate course filter with the registered courses
 function populateCourseFilter() {
     const courseFilter = document.getElementById('course-filter');
-    const courses = new Set();
+    const selected = courseFilter.value;
 
-    allPackages.forEach(pkg => {
-        if (pkg.content_type === 'material' && pkg.course_name) {
-            courses.add(pkg.course_name);
-        }
-    });
-
-    // Keep the "all" option and add unique courses
-    courseFilter.innerHTML = '<option value="">Todos los cursos</option>';
-    Array.from(courses).sort().forEach(course => {
-        const option = document.createElement('option');
-        option.value = course;
-        option.textContent = course;
-        courseFilter.appendChild(option);
-    });
+    // Keep the "all" option and add every course
+    courseFilter.length = 1;
+    courses.forEach(c => courseFilter.add(new Option(c.name, c.name)));
+    courseFilter.value = selected;
 }
 
 // Initialize course filter on page load
@@ -561,7 +753,7 @@ async function calculateFileHash(file) {
 
 // Check for duplicate file by hash
 async function checkDuplicate(hash) {
-    const response = await fetch(`${API_BASE}/check-duplicate?hash=${hash}`);
+    const response = await apiFetch(`${API_BASE}/check-duplicate?hash=${hash}`);
     if (!response.ok) {
         throw new Error('Error checking for duplicates');
     }
@@ -650,6 +842,10 @@ async function uploadPackage(e) {
         });
 
         xhr.open('POST', `${API_BASE}/upload`);
+        const token = localStorage.getItem('access_token');
+        if (token) {
+            xhr.setRequestHeader('Authorization', `Bearer ${token}`);
+        }
         xhr.send(formData);
 
     } catch (error) {
@@ -685,7 +881,7 @@ Opciones:
 // Load statistics
 async function loadStats() {
     try {
-        const response = await fetch(`${API_BASE}/stats`);
+        const response = await apiFetch(`${API_BASE}/stats`);
         if (!response.ok) return;
 
         const stats = await response.json();
@@ -701,7 +897,7 @@ function renderStats(stats) {
     grid.innerHTML = '';
 
     // Total packages
-    const totalCard = createStatCard('Total Paquetes', allPackages.length);
+    const totalCard = createStatCard('Total Paquetes', libraryTotal);
     grid.appendChild(totalCard);
 
     // Total downloads
@@ -790,16 +986,10 @@ function getPlatformIcon(platform) {
     return icons[platform.toLowerCase()] || '💻';
 }
 
-// Get category name
+// Get category name from the taxonomy
 function getCategoryName(category) {
-    const names = {
-        'os': 'Sistema Operativo',
-        'compiler': 'Compilador',
-        'ide': 'IDE',
-        'tool': 'Herramienta',
-        'library': 'Biblioteca'
-    };
-    return names[category] || category;
+    const c = categories.get(category);
+    return escapeHtml(c ? c.name : category);
 }
 
 // Escape HTML to prevent XSS
@@ -872,7 +1062,7 @@ async function deletePackage(id) {
         }
 
         const result = await response.json();
-        showSuccess('Paquete eliminado exitosamente');
+        showSuccess('Paquete movido a la papelera');
 
         // Close modal and reload data
         closeModal();
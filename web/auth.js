@@ -76,7 +76,7 @@ async function handleRegister(e) {
         // Store tokens
         saveSession(data);
 
-        showMessage('¡Cuenta creada exitosamente! Redirigiendo...', 'success');
+        showMessage('¡Cuenta creada! Te enviamos un correo para verificar tu dirección. Redirigiendo...', 'success');
         setTimeout(() => {
             window.location.href = '/';
         }, 1500);
@@ -108,13 +108,121 @@ async function handleLogin(e) {
             throw new Error(data.error || 'Error al iniciar sesión');
         }
 
-        // Store tokens
-        saveSession(data);
+        await handleAuthResult(data);
+    } catch (error) {
+        showMessage(error.message, 'error');
+    }
+}
 
-        showMessage('¡Inicio de sesión exitoso! Redirigiendo...', 'success');
-        setTimeout(() => {
-            window.location.href = '/';
-        }, 1500);
+// Confirm the email address with the token of a verification link
+async function verifyEmail(token) {
+    showLogin();
+    try {
+        const response = await fetch(`${API_BASE}/auth/verify-email`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ token })
+        });
+
+        const data = await response.json();
+
+        if (!response.ok) {
+            throw new Error(data.error || 'Error al verificar el correo');
+        }
+
+        showMessage('¡Correo verificado! Ya puedes iniciar sesión.', 'success');
+    } catch (error) {
+        showMessage(error.message, 'error');
+    }
+}
+
+// Finish a login: ask for the second factor when the server requires it
+async function handleAuthResult(data) {
+    if (data.mfa_required || data.mfa_setup_required) {
+        hideAllForms();
+        document.getElementById('mfa-form').style.display = 'block';
+        document.getElementById('mfa-token').value = data.mfa_token;
+        document.getElementById('mfa-setup').style.display = 'none';
+        document.getElementById('mfa-hint').style.display = data.mfa_setup_required ? 'none' : 'block';
+        if (data.mfa_setup_required) {
+            await startMFASetup(data.mfa_token);
+        }
+        return;
+    }
+
+    // Store tokens
+    saveSession(data);
+
+    showMessage('¡Inicio de sesión exitoso! Redirigiendo...', 'success');
+    setTimeout(() => {
+        window.location.href = '/';
+    }, 1500);
+}
+
+// Start enrolling in two-factor authentication during login
+async function startMFASetup(mfaToken) {
+    try {
+        const response = await fetch(`${API_BASE}/auth/mfa/setup`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ mfa_token: mfaToken })
+        });
+
+        const data = await response.json();
+
+        if (!response.ok) {
+            throw new Error(data.error || 'Error al configurar la verificación en dos pasos');
+        }
+
+        document.getElementById('mfa-secret').textContent = data.secret;
+        document.getElementById('mfa-uri').href = data.provisioning_uri;
+        document.getElementById('mfa-setup').style.display = 'block';
+    } catch (error) {
+        showMessage(error.message, 'error');
+    }
+}
+
+// Handle the second factor: a TOTP code, a recovery code, or the first
+// code of a new enrollment
+async function handleMFA(e) {
+    e.preventDefault();
+
+    const mfaToken = document.getElementById('mfa-token').value;
+    const code = document.getElementById('mfa-code').value.trim();
+    const setup = document.getElementById('mfa-setup').style.display !== 'none';
+
+    let url = `${API_BASE}/auth/mfa/verify`;
+    let body = { mfa_token: mfaToken, code };
+    if (setup) {
+        url = `${API_BASE}/auth/mfa/enable`;
+    } else if (!/^\d{6}$/.test(code)) {
+        body = { mfa_token: mfaToken, recovery_code: code };
+    }
+
+    try {
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(body)
+        });
+
+        const data = await response.json();
+
+        if (!response.ok) {
+            throw new Error(data.error || 'Código incorrecto');
+        }
+
+        if (data.recovery_codes) {
+            alert('Guarda estos códigos de recuperación; cada uno sirve una sola vez:\n\n' +
+                data.recovery_codes.join('\n'));
+        }
+        await handleAuthResult(data);
     } catch (error) {
         showMessage(error.message, 'error');
     }
@@ -298,12 +406,57 @@ async function handleOAuth2Login() {
     }
 }
 
-// Check for OAuth2 callback
+// OpenID Connect functions
+async function checkOIDCProviders() {
+    try {
+        const response = await fetch(`${API_BASE}/oidc/providers`);
+        const providers = await response.json();
+
+        if (!providers.length) {
+            return;
+        }
+
+        const container = document.getElementById('oidc-buttons');
+        container.innerHTML = '';
+        providers.forEach(provider => {
+            const button = document.createElement('button');
+            button.type = 'button';
+            button.className = 'btn-oauth2';
+            button.textContent = `Continuar con ${provider.display_name}`;
+            button.onclick = () => handleOIDCLogin(provider.name);
+            container.appendChild(button);
+        });
+        document.getElementById('oidc-login').style.display = 'block';
+    } catch (error) {
+        console.error('Error checking OpenID Connect providers:', error);
+    }
+}
+
+async function handleOIDCLogin(provider) {
+    try {
+        const response = await fetch(`${API_BASE}/oidc/login?provider=${encodeURIComponent(provider)}`);
+        const data = await response.json();
+
+        if (!response.ok || !data.auth_url) {
+            throw new Error(data.error || 'Error al iniciar sesión');
+        }
+
+        // The callback below must finish the login through /oidc/callback
+        sessionStorage.setItem('oidc_login', provider);
+        window.location.href = data.auth_url;
+    } catch (error) {
+        showMessage(error.message, 'error');
+    }
+}
+
+// Check for OAuth2 or OpenID Connect callback
 async function handleOAuth2Callback() {
     const params = new URLSearchParams(window.location.search);
     const code = params.get('code');
     const state = params.get('state');
     const error = params.get('error');
+    const oidcProvider = sessionStorage.getItem('oidc_login');
+    sessionStorage.removeItem('oidc_login');
 
     if (error) {
         showMessage('Error de autenticación: ' + (params.get('error_description') || error), 'error');
@@ -315,21 +468,17 @@ async function handleOAuth2Callback() {
         showMessage('Autenticando...', 'success');
 
         try {
-            // The callback endpoint will handle the OAuth2 exchange
-            const response = await fetch(`${API_BASE}/oauth2/callback?code=${code}&state=${state}`);
+            // The callback endpoint will handle the code exchange
+            const endpoint = oidcProvider ? 'oidc/callback' : 'oauth2/callback';
+            const query = `code=${encodeURIComponent(code)}&state=${encodeURIComponent(state)}`;
+            const response = await fetch(`${API_BASE}/${endpoint}?${query}`);
             const data = await response.json();
 
             if (!response.ok) {
                 throw new Error(data.error || 'Error al autenticar');
             }
 
-            // Store tokens
-            saveSession(data);
-
-            showMessage('¡Autenticación exitosa! Redirigiendo...', 'success');
-            setTimeout(() => {
-                window.location.href = '/';
-            }, 1500);
+            await handleAuthResult(data);
         } catch (error) {
             showMessage(error.message, 'error');
             setTimeout(() => {
@@ -350,12 +499,18 @@ window.addEventListener('DOMContentLoaded', async () => {
 
     const params = new URLSearchParams(window.location.search);
     const resetToken = params.get('token');
+    const verifyToken = params.get('verify');
 
     if (resetToken) {
         showResetConfirm(resetToken);
+    } else if (verifyToken) {
+        await verifyEmail(verifyToken);
+        await checkOAuth2Config();
+        await checkOIDCProviders();
     } else {
         showLogin();
         // Check if OAuth2 is available
         await checkOAuth2Config();
+        await checkOIDCProviders();
     }
 });